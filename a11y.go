@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A11yConfig sets up accessibility mode, for screen readers and braille
+// displays: plain output without colors, escape sequences or symbols,
+// and answers without markdown.
+type A11yConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Speak reads answers aloud in accessibility mode, like --speak.
+	Speak bool `yaml:"speak"`
+}
+
+// accessible is set by --a11y or a11y.enabled.
+var accessible bool
+
+var (
+	mdFence   = regexp.MustCompile("(?m)^\\s*(```|~~~)\\s*(\\S*)\\s*$")
+	mdHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.*?)\s*#*\s*$`)
+	mdRule    = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	mdQuote   = regexp.MustCompile(`(?m)^>\s?`)
+	mdBullet  = regexp.MustCompile(`(?m)^(\s*)[-*+]\s+(\[[ xX]\]\s+)?`)
+	mdImage   = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdStrong  = regexp.MustCompile(`(\*\*|~~)(\S(?:.*?\S)?)(\*\*|~~)`)
+	mdStar    = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	// Underscores only count at word boundaries, so snake_case survives.
+	mdUnderline = regexp.MustCompile(`(^|\W)_{1,2}(\S(?:.*?\S)?)_{1,2}(\W|$)`)
+	mdCode      = regexp.MustCompile("`([^`]+)`")
+	mdTableRule = regexp.MustCompile(`(?m)^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdEndsClean = regexp.MustCompile(`[.!?:;,]$`)
+)
+
+// decor returns fancy normally and plain in accessibility mode, for
+// output that uses symbols or box drawing.
+func decor(fancy, plain string) string {
+	if accessible {
+		return plain
+	}
+	return fancy
+}
+
+// forDisplay prepares an answer for the terminal: markdown is rendered,
+// or in accessibility mode turned into plain sentences. The stored text
+// is unchanged.
+func forDisplay(text string) string {
+	switch {
+	case accessible:
+		return plainSentences(text)
+	case renderingMarkdown():
+		return renderMarkdown(text)
+	}
+	return text
+}
+
+// plainSentences strips markdown decorations so a screen reader reads the
+// words rather than the punctuation. Headings and list items become
+// sentences, code blocks are announced, and links keep their address.
+func plainSentences(text string) string {
+	var out []string
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			if inCode {
+				out = append(out, "End of code.")
+			} else if m[2] != "" {
+				out = append(out, "Code, "+m[2]+":")
+			} else {
+				out = append(out, "Code:")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		if mdRule.MatchString(line) || mdTableRule.MatchString(line) {
+			continue
+		}
+		heading := mdHeading.MatchString(line)
+		line = mdHeading.ReplaceAllString(line, "$1")
+		line = mdQuote.ReplaceAllString(line, "")
+		bullet := mdBullet.MatchString(line)
+		line = mdBullet.ReplaceAllString(line, "$1")
+		line = mdImage.ReplaceAllString(line, "image: $1")
+		line = mdLink.ReplaceAllString(line, "$1 ($2)")
+		line = mdStrong.ReplaceAllString(line, "$2")
+		line = mdStar.ReplaceAllString(line, "$1")
+		line = mdUnderline.ReplaceAllString(line, "$1$2$3")
+		line = mdCode.ReplaceAllString(line, "$1")
+		if strings.HasPrefix(strings.TrimSpace(line), "|") {
+			cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+			for i := range cells {
+				cells[i] = strings.TrimSpace(cells[i])
+			}
+			line = strings.Join(cells, ", ")
+		}
+		// End headings and list items with a full stop so they are read
+		// as separate sentences.
+		if t := strings.TrimSpace(line); (heading || bullet) && t != "" && !mdEndsClean.MatchString(t) {
+			line += "."
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
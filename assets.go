@@ -0,0 +1,41 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// assets holds the files built into the binary: default personas and
+// prompt templates.
+//
+//go:embed assets
+var assets embed.FS
+
+func asset(name string) string {
+	data, err := assets.ReadFile("assets/" + name)
+	if err != nil {
+		panic(fmt.Sprintf("missing asset %s", name))
+	}
+	return string(data)
+}
+
+// builtinPersonas are the personas shipped in assets/personas.yaml.
+var builtinPersonas = func() map[string]Persona {
+	var personas map[string]Persona
+	if err := yaml.Unmarshal([]byte(asset("personas.yaml")), &personas); err != nil {
+		panic(fmt.Sprintf("assets/personas.yaml: %v", err))
+	}
+	return personas
+}()
+
+// persona looks a persona up in the configuration, then among the
+// built-in ones.
+func (c *Config) persona(name string) (Persona, bool) {
+	if p, ok := c.Personas[name]; ok {
+		return p, true
+	}
+	p, ok := builtinPersonas[name]
+	return p, ok
+}
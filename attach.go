@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Attachment is a file sent with a message, or an image made for one.
+// Images are sent to the model as images; the text of other files went
+// into the message. The file itself is stored as a blob (see storeBlob).
+type Attachment struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+	// Ref is the stored file, relative to the chats directory.
+	Ref string `xml:"ref,attr,omitempty"`
+	// data holds the image of an incognito conversation, which is never
+	// written to disk.
+	data []byte
+}
+
+// isImage reports whether the attachment is sent to the model as an image.
+func (a Attachment) isImage() bool {
+	return imageTypes[a.Type]
+}
+
+// Size limits for attachments sent inline with a message.
+const (
+	maxTextAttachment  = 512 << 10
+	maxImageAttachment = 20 << 20
+)
+
+var imageTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+func init() {
+	registerCommand(&command{
+		name:  "attach",
+		usage: "/attach [file...] [message]",
+		help:  "Send files (text, PDFs, images or audio) with your next message, or with the text after them",
+		run:   cmdAttach,
+	})
+}
+
+func cmdAttach(s *session, args string) error {
+	if args == "" {
+		if len(s.files) == 0 && len(s.context) == 0 {
+			info("Nothing attached\n")
+		}
+		for _, a := range s.files {
+			fmt.Printf("  %s (%s)\n", a.Name, a.Type)
+		}
+		if len(s.context) > 0 {
+			fmt.Printf("  text blocks: %d\n", len(s.context))
+		}
+		return nil
+	}
+	// Files come first; from the first word that isn't one, the rest is a
+	// message to send with them.
+	rest := args
+	for attached := 0; rest != ""; attached++ {
+		word, after, _ := strings.Cut(rest, " ")
+		path := expandHome(word)
+		if attached > 0 {
+			if st, err := os.Stat(path); err != nil || st.IsDir() {
+				break
+			}
+		}
+		if err := s.attach(path); err != nil {
+			return err
+		}
+		rest = strings.TrimSpace(after)
+	}
+	if rest != "" {
+		s.submit(rest)
+	}
+	return nil
+}
+
+// attach reads a file and queues it for the next message in the form the
+// model can use: images as image parts, audio as a transcript, PDFs and
+// text as text. Other binary files are refused.
+func (s *session) attach(path string) error {
+	return s.attachAs(path, filepath.Base(path))
+}
+
+// attachAs attaches a file under the given name.
+func (s *session) attachAs(path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	kind := detectType(name, data)
+
+	switch {
+	case imageTypes[kind]:
+		if len(data) > maxImageAttachment {
+			return fmt.Errorf("%s is larger than %d MB", name, maxImageAttachment>>20)
+		}
+		a := Attachment{Name: name, Type: kind}
+		if s.incognito {
+			a.data = data
+		} else if a.Ref, err = storeBlob(data, kind); err != nil {
+			return err
+		}
+		s.files = append(s.files, a)
+		info("Attached %s (%s)\n", name, kind)
+		return nil
+
+	case strings.HasPrefix(kind, "audio/") || kind == "video/mp4" || kind == "video/webm":
+		// Recordings are kept as their transcript only; they can be
+		// large, and the model never sees them.
+		info("Transcribing %s...\n", name)
+		ctx, cancel := s.requestContext()
+		defer cancel()
+		segments, err := transcribeAudio(ctx, s.client, path, false)
+		if err != nil {
+			return err
+		}
+		text := formatTranscript(segments, "text")
+		s.context = append(s.context, untrusted("transcript of "+name, text))
+		info("Attached transcript of %s (%d words)\n", name, len(strings.Fields(text)))
+		return nil
+
+	case kind == "application/pdf":
+		text, err := pdfText(path)
+		if err != nil {
+			return err
+		}
+		s.context = append(s.context, untrusted("file "+name, text))
+		info("Attached %s (%d words of text)\n", name, len(strings.Fields(text)))
+
+	case isText(kind, data):
+		if len(data) > maxTextAttachment {
+			return fmt.Errorf("%s is larger than %d KB", name, maxTextAttachment>>10)
+		}
+		s.context = append(s.context, untrusted("file "+name, string(data)))
+		info("Attached %s (%s)\n", name, formatBytes(len(data)))
+
+	default:
+		return fmt.Errorf("%s looks binary (%s); attach text, PDFs, images (PNG, JPEG, GIF, WebP) or audio", name, kind)
+	}
+	// Documents went into the message as text; the file is kept with it.
+	if !s.incognito {
+		ref, err := storeBlob(data, kind)
+		if err != nil {
+			return err
+		}
+		s.files = append(s.files, Attachment{Name: name, Type: kind, Ref: ref})
+	}
+	return nil
+}
+
+// detectType sniffs the content, falling back to the extension for
+// types the sniffer doesn't know, such as most audio formats.
+func detectType(name string, data []byte) string {
+	sniffed, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if sniffed != "application/octet-stream" && sniffed != "text/plain" {
+		return sniffed
+	}
+	if byExt, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(name))), ";"); byExt != "" {
+		if sniffed == "application/octet-stream" || strings.HasPrefix(byExt, "text/") {
+			return byExt
+		}
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m4a", ".flac", ".mp3", ".mpga", ".ogg", ".oga", ".opus":
+		return "audio/" + strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+	return sniffed
+}
+
+// isText reports whether a file can go into a message as text. A text
+// type, which may come from the extension alone, is trusted unless the
+// content looks binary.
+func isText(kind string, data []byte) bool {
+	if strings.HasPrefix(kind, "text/") || kind == "application/json" || kind == "application/xml" {
+		return !looksBinary(data)
+	}
+	return utf8.Valid(data) && !bytes.ContainsRune(data, 0)
+}
+
+// looksBinary reports whether data has a NUL byte, or is not UTF-8 and
+// has more than a few control characters, in its first 8 KB.
+func looksBinary(data []byte) bool {
+	head := data[:min(len(data), 8<<10)]
+	if bytes.ContainsRune(head, 0) {
+		return true
+	}
+	if utf8.Valid(head) {
+		return false
+	}
+	control := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' || b == 0x7f {
+			control++
+		}
+	}
+	return control > len(head)/20
+}
+
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// load reads the attached file, checking that it isn't damaged.
+func (a Attachment) load() ([]byte, error) {
+	if a.data != nil {
+		return a.data, nil
+	}
+	data, err := readBlob(a.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("attachment %s: %w", a.Name, err)
+	}
+	return data, nil
+}
+
+// viewable returns a file the attachment can be opened from: the stored
+// file, or for an encrypted one a decrypted copy that is removed when the
+// session ends.
+func (s *session) viewable(a Attachment) (string, error) {
+	file := filepath.Join(chatsDir, filepath.FromSlash(a.Ref))
+	if a.Ref == "" || !isSealedBlob(a.Ref) {
+		return file, nil
+	}
+	data, err := a.load()
+	if err != nil {
+		return "", err
+	}
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(a.Type); len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	return s.tempFile("attachment-*"+ext, data)
+}
+
+func (a Attachment) dataURL() (string, error) {
+	data, err := a.load()
+	if err != nil {
+		return "", err
+	}
+	return "data:" + a.Type + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// pdfText extracts the text of a PDF with pdftotext from poppler, which
+// copes with far more real-world PDFs than a parser we could carry.
+func pdfText(path string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", fmt.Errorf("reading PDFs needs pdftotext (from poppler-utils)")
+	}
+	out, err := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", path, "-").Output()
+	if err != nil {
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+	text := strings.TrimSpace(string(out))
+	if text == "" {
+		return "", fmt.Errorf("%s has no text layer (a scanned document?)", filepath.Base(path))
+	}
+	return text, nil
+}
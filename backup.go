@@ -0,0 +1,394 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestName = "manifest.json"
+
+// backupManifest is stored as the last archive entry and lists every other
+// entry with its SHA-256, so restore can detect truncation or tampering.
+type backupManifest struct {
+	CreatedAt string            `json:"created_at"`
+	Files     map[string]string `json:"files"`
+}
+
+// secretKeys are the config keys whose values are never backed up: the
+// credentials, wherever they appear. Settings that only say where to find
+// one, such as api_key_command, are kept.
+var secretKeys = map[string]bool{
+	"access_key":     true,
+	"api_key":        true,
+	"encryption_key": true,
+	"password":       true,
+	"secret":         true,
+	"secret_key":     true,
+	"token":          true,
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "backup",
+		usage: "backup create|restore|verify <file>",
+		help:  "Archive or restore conversations and settings (.tar.zst or .tar.gz)",
+		run:   runBackup,
+	})
+}
+
+// backupRoots maps the top-level directory inside an archive to the local
+// directory it is read from and restored to.
+func backupRoots() (map[string]string, error) {
+	cfgDir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"chats":  chatsDir,
+		"config": cfgDir,
+		"data":   dataDir,
+	}, nil
+}
+
+// backupDataFiles are the files backed up from the data directory, which
+// also holds the chats directory, logs and, for a data directory left in
+// the working directory by earlier versions, anything else.
+var backupDataFiles = []string{"history", "question-index.json", "shares.json", "tutor.json"}
+
+func runBackup(cfg *Config, args []string) int {
+	fs := newFlagSet("backup")
+	force := fs.Bool("force", false, "overwrite existing files on restore")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: backup create|restore|verify <file> [--force]")
+		return exitError
+	}
+
+	file := positional[1]
+	switch positional[0] {
+	case "create":
+		err = createBackup(file)
+	case "restore":
+		err = restoreBackup(file, *force)
+	case "verify":
+		var dir string
+		dir, err = extractBackup(file)
+		if err == nil {
+			os.RemoveAll(dir)
+			fmt.Println("Backup is intact")
+		}
+	default:
+		err = fmt.Errorf("unknown backup action %q", positional[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func createBackup(path string) error {
+	roots, err := backupRoots()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	comp, err := newCompressor(path, out)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(comp)
+	manifest := backupManifest{CreatedAt: time.Now().Format(time.RFC3339), Files: map[string]string{}}
+
+	names := make([]string, 0, len(roots))
+	for name := range roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		root := roots[name]
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err == nil && name == "data" && d.IsDir() && p != root {
+				return filepath.SkipDir
+			}
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			if name == "data" && !slices.Contains(backupDataFiles, rel) {
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if name == "config" && rel == "config.yaml" {
+				if data, err = stripSecrets(data); err != nil {
+					return fmt.Errorf("%s: %w", p, err)
+				}
+			}
+			entry := filepath.ToSlash(filepath.Join(name, rel))
+			manifest.Files[entry] = sha256Hex(data)
+			return writeTarFile(tw, entry, data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, manifestName, data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := comp.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", plural(int64(len(manifest.Files)), "file"), path)
+	return nil
+}
+
+// restoreBackup verifies the whole archive before touching any local file.
+func restoreBackup(path string, force bool) error {
+	dir, err := extractBackup(path)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	roots, err := backupRoots()
+	if err != nil {
+		return err
+	}
+
+	var restored, skipped int
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		top, rest, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		root, ok := roots[top]
+		if !ok {
+			return nil
+		}
+		dest := filepath.Join(root, filepath.FromSlash(rest))
+		if _, err := os.Stat(dest); err == nil && !force {
+			fmt.Fprintf(os.Stderr, "Skipping existing %s (use --force to overwrite)\n", dest)
+			skipped++
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		restored++
+		return os.WriteFile(dest, data, 0644)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s, skipped %d\n", plural(int64(restored), "file"), skipped)
+	return nil
+}
+
+// extractBackup unpacks an archive into a temporary directory and checks
+// every file against the manifest. The caller removes the directory.
+func extractBackup(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	decomp, err := newDecompressor(path, in)
+	if err != nil {
+		return "", err
+	}
+	defer decomp.Close()
+
+	dir, err := os.MkdirTemp("", appName+"-restore-")
+	if err != nil {
+		return "", err
+	}
+
+	hashes := map[string]string{}
+	var manifest *backupManifest
+	tr := tar.NewReader(decomp)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("corrupt archive: %w", err)
+		}
+		name := filepath.ToSlash(filepath.Clean(hdr.Name))
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(name, "../") || filepath.IsAbs(name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("corrupt archive: %w", err)
+		}
+		if name == manifestName {
+			manifest = &backupManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				os.RemoveAll(dir)
+				return "", fmt.Errorf("corrupt manifest: %w", err)
+			}
+			continue
+		}
+		hashes[name] = sha256Hex(data)
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	if err := verifyManifest(manifest, hashes); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+func verifyManifest(manifest *backupManifest, hashes map[string]string) error {
+	if manifest == nil {
+		return fmt.Errorf("archive has no manifest; it may be truncated")
+	}
+	for name, want := range manifest.Files {
+		got, ok := hashes[name]
+		if !ok {
+			return fmt.Errorf("integrity check failed: %s is missing", name)
+		}
+		if got != want {
+			return fmt.Errorf("integrity check failed: %s has been modified", name)
+		}
+	}
+	for name := range hashes {
+		if _, ok := manifest.Files[name]; !ok {
+			return fmt.Errorf("integrity check failed: unexpected file %s", name)
+		}
+	}
+	return nil
+}
+
+// stripSecrets removes the credentials from a YAML document, at any depth.
+func stripSecrets(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			kept := n.Content[:0]
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if secretKeys[strings.ToLower(n.Content[i].Value)] {
+					continue
+				}
+				kept = append(kept, n.Content[i], n.Content[i+1])
+			}
+			n.Content = kept
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(&doc)
+	if doc.Kind == 0 {
+		return data, nil
+	}
+	return yaml.Marshal(&doc)
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func newCompressor(path string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.zst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported archive type %q (use .tar.zst or .tar.gz)", path)
+}
+
+func newDecompressor(path string, r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.zst"):
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return gzip.NewReader(r)
+	}
+	return nil, fmt.Errorf("unsupported archive type %q (use .tar.zst or .tar.gz)", path)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Attached files are stored once, as blobs named by the SHA-256 of their
+// content: chats/blobs/4e/4e07…ab21.pdf. Conversations that attach the
+// same file share it, and a blob whose content no longer matches its name
+// is known to be damaged. Earlier versions kept images in chats/images,
+// also by hash; those are read and collected alike.
+//
+// With an encryption key, blobs are encrypted like the conversations and
+// named by a keyed HMAC of their content instead, so that neither the
+// content nor a hash confirming a guess at it can be read without the
+// key: chats/blobs/9c/9c31…07d2.bin.
+var blobDirs = []string{"blobs", "images"}
+
+// storeBlob stores a file's content and returns its ref, the path relative
+// to the chats directory.
+func storeBlob(data []byte, kind string) (string, error) {
+	if encryptionKey.isSet() {
+		return storeSealedBlob(data)
+	}
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(kind); len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	hash := sha256Hex(data)
+	legacy := path.Join("images", hash+ext)
+	if _, err := os.Stat(filepath.Join(chatsDir, filepath.FromSlash(legacy))); err == nil {
+		return legacy, nil
+	}
+	ref := path.Join("blobs", hash[:2], hash+ext)
+	file := filepath.Join(chatsDir, filepath.FromSlash(ref))
+	if _, err := os.Stat(file); err == nil {
+		return ref, nil
+	}
+	return ref, writeBlob(file, data, 0644)
+}
+
+func storeSealedBlob(data []byte) (string, error) {
+	salt, err := profileSalt()
+	if err != nil {
+		return "", err
+	}
+	name, err := blobMAC(salt, data)
+	if err != nil {
+		return "", err
+	}
+	ref := path.Join("blobs", name[:2], name+".bin")
+	file := filepath.Join(chatsDir, filepath.FromSlash(ref))
+	if _, err := os.Stat(file); err == nil {
+		return ref, nil
+	}
+	sealed, err := seal(data)
+	if err != nil {
+		return "", err
+	}
+	return ref, writeBlob(file, sealed, 0600)
+}
+
+func writeBlob(file string, data []byte, perm os.FileMode) error {
+	dirPerm := os.FileMode(0755)
+	if perm&0077 == 0 {
+		dirPerm = 0700
+	}
+	if err := os.MkdirAll(filepath.Dir(file), dirPerm); err != nil {
+		return err
+	}
+	// Write under another name first, so an interrupted write doesn't
+	// leave a damaged blob that later stores would take for complete.
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// blobMAC names the content of an encrypted blob: an HMAC keyed with a
+// key derived from the archive key for salt.
+func blobMAC(salt, data []byte) (string, error) {
+	key, err := archiveKey(salt)
+	if err != nil {
+		return "", err
+	}
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("chat-cli blob names"))
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// readBlob reads a stored blob, decrypting it if needed, and checks that
+// it isn't damaged.
+func readBlob(ref string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(chatsDir, filepath.FromSlash(ref)))
+	if err != nil {
+		return nil, err
+	}
+	plain, salt, err := unseal(data)
+	if err != nil {
+		return nil, err
+	}
+	return plain, verifyBlob(ref, plain, salt)
+}
+
+// blobHash returns the hash a blob is named by, if ref names one.
+func blobHash(ref string) (string, bool) {
+	name := path.Base(ref)
+	hash := strings.TrimSuffix(name, path.Ext(name))
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		return "", false
+	}
+	return hash, true
+}
+
+// verifyBlob checks that a blob's content matches its name. salt is the
+// one an encrypted blob was encrypted with, nil for others.
+func verifyBlob(ref string, data, salt []byte) error {
+	hash, ok := blobHash(ref)
+	if !ok {
+		return nil
+	}
+	sum := sha256Hex(data)
+	if salt != nil {
+		var err error
+		if sum, err = blobMAC(salt, data); err != nil {
+			return err
+		}
+	}
+	if sum != hash {
+		return errors.New("damaged: the content no longer matches its hash")
+	}
+	return nil
+}
+
+// walkBlobs calls fn with the ref of every stored blob.
+func walkBlobs(fn func(ref string, d fs.DirEntry) error) error {
+	for _, dir := range blobDirs {
+		err := filepath.WalkDir(filepath.Join(chatsDir, dir), func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() || strings.HasSuffix(p, ".tmp") {
+				return err
+			}
+			rel, err := filepath.Rel(chatsDir, p)
+			if err != nil {
+				return err
+			}
+			return fn(filepath.ToSlash(rel), d)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// BotConfig applies to every chat network the assistant is bridged to.
+type BotConfig struct {
+	// Persona answers in bot conversations (default: default_persona).
+	Persona string `yaml:"persona"`
+	// Context is how many recent messages are sent with each request
+	// (default 20); older ones stay in the stored conversation.
+	Context int `yaml:"context"`
+	// RateLimit is how many requests one user may make per minute
+	// (default 5).
+	RateLimit int           `yaml:"rate_limit"`
+	IRC       IRCConfig     `yaml:"irc"`
+	Matrix    MatrixConfig  `yaml:"matrix"`
+	Webhook   WebhookConfig `yaml:"webhook"`
+}
+
+// botAdapters connect the bot engine to a chat network.
+var botAdapters = map[string]func(cfg *Config, engine *botEngine, args []string) int{}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "bot",
+		usage: "bot <network> [options]",
+		help:  "Run the assistant as a bot on a chat network (bot <network> --help for options)",
+		run:   runBot,
+	})
+}
+
+func runBot(cfg *Config, args []string) int {
+	var names []string
+	for name := range botAdapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 || botAdapters[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "Usage: bot <%s> [options]\n", strings.Join(names, "|"))
+		return exitError
+	}
+	engine, err := newBotEngine(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return botAdapters[args[0]](cfg, engine, args[1:])
+}
+
+// botEngine keeps one conversation per chat (channel, room or direct
+// chat) and answers messages in it, limiting how often each user may ask.
+type botEngine struct {
+	client  *openai.Client
+	router  *router
+	context int
+	limit   int
+
+	notify NotifyConfig
+	// answering tracks the answers adapters are working on, so stopping
+	// can wait for them.
+	answering sync.WaitGroup
+
+	mu    sync.Mutex
+	convs map[string]*Conversation
+	asked map[string][]time.Time
+}
+
+const botPrompt = `You are a bot in a group chat. Messages start with the sender's name, as "name: ". Keep answers short and in plain text without markdown, as chat clients show it raw.`
+
+func newBotEngine(cfg *Config) (*botEngine, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.Bot.Persona
+	if name == "" {
+		name = cfg.DefaultPersona
+	}
+	r, err := newRouter(cfg, name, botPrompt)
+	if err != nil {
+		return nil, err
+	}
+	cfg.keepWarm(client, cfg.baseModel())
+	b := &botEngine{
+		client:  client,
+		router:  r,
+		context: cfg.Bot.Context,
+		limit:   cfg.Bot.RateLimit,
+		notify:  cfg.Notify,
+		convs:   map[string]*Conversation{},
+		asked:   map[string][]time.Time{},
+	}
+	if b.context <= 0 {
+		b.context = 20
+	}
+	if b.limit <= 0 {
+		b.limit = 5
+	}
+	onExpired(b.expire)
+	cfg.keepRetaining()
+	return b, nil
+}
+
+// expire drops deleted conversations, so their chats start afresh.
+func (b *botEngine) expire(ids []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range ids {
+		delete(b.convs, id)
+	}
+}
+
+var unsafeIDChars = regexp.MustCompile(`[^\w.-]+`)
+
+// conversation returns the stored conversation for a chat, tagged with
+// the network's name. A new one starts with the system prompt, but only if
+// none is stored: one that can't be read is an error, so that answering
+// doesn't overwrite it.
+func (b *botEngine) conversation(network, chat, system string) (*Conversation, error) {
+	id := botConversationID(network, chat)
+	if conv, ok := b.convs[id]; ok {
+		return conv, nil
+	}
+	conv, err := loadConversation(id)
+	if errors.Is(err, os.ErrNotExist) {
+		conv = newConversation(system)
+		conv.ID = id
+		conv.addTags(network)
+	} else if err != nil {
+		return nil, err
+	}
+	b.convs[id] = conv
+	return conv, nil
+}
+
+func botConversationID(network, chat string) string {
+	return network + "_" + strings.Trim(unsafeIDChars.ReplaceAllString(strings.ToLower(chat), "_"), "_")
+}
+
+// allow records a request by user and reports whether it is within the
+// rate limit.
+func (b *botEngine) allow(user string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cutoff := time.Now().Add(-time.Minute)
+	recent := b.asked[user][:0]
+	for _, t := range b.asked[user] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= b.limit {
+		b.asked[user] = recent
+		return false
+	}
+	b.asked[user] = append(recent, time.Now())
+	return true
+}
+
+// errRateLimited is returned by reply when the user has asked too often.
+var errRateLimited = errors.New("rate limited")
+
+// errorText is what a chat is told when answering failed. Failures other
+// than limits are also logged.
+func (b *botEngine) errorText(err error) string {
+	switch {
+	case errors.Is(err, errRateLimited):
+		return fmt.Sprintf("Slow down, please: at most %d questions a minute.", b.limit)
+	case errors.Is(err, errOverBudget):
+		return "Sorry, " + err.Error() + "."
+	case errors.Is(err, errBlocked):
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return "Sorry, that message can't be sent here."
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return "Sorry, that failed."
+}
+
+// reply records a message from user in a chat and returns the answer,
+// from the persona and model the routing rules pick for it.
+func (b *botEngine) reply(ctx context.Context, network, chat, user, text string) (string, error) {
+	queued.Add(1)
+	defer queued.Add(-1)
+	if !b.allow(network + ":" + user) {
+		return "", errRateLimited
+	}
+	rt, err := b.router.route(network, chat, user, text)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	conv, err := b.conversation(network, chat, rt.system)
+	b.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	id := conv.ID
+	text, err = b.router.cfg.Hooks.beforeSend(rt.persona, hookEvent{
+		Conversation: id,
+		Model:        rt.model,
+		Persona:      rt.persona,
+		Question:     text,
+	})
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	conv.addMessage("user", text)
+	conv.Messages[len(conv.Messages)-1].Speaker = user
+	view := withSystem(attributedView(conv, b.context), rt.system)
+	b.mu.Unlock()
+
+	r, err := callOpenAI(ctx, b.client, rt.model, view, nil)
+	if err != nil {
+		go b.notify.failed("bot", id, err)
+		return "", err
+	}
+	b.router.charge(rt, r)
+	go b.notify.succeeded("bot", id, fmt.Sprintf("answered %s in %s %s", user, network, chat))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv.addMessage("assistant", r.content)
+	conv.Messages[len(conv.Messages)-1].Model = rt.model
+	b.save(conv)
+	return r.content, nil
+}
+
+// attributedView is a conversation as the model sees it in a group chat:
+// the system prompt, then the last n messages (all if n is 0) with each
+// person's prefixed by their name.
+func attributedView(conv *Conversation, n int) *Conversation {
+	view := &Conversation{ID: conv.ID}
+	var rest []Message
+	for _, m := range conv.Messages {
+		if m.Role == "system" {
+			view.Messages = append(view.Messages, m)
+			continue
+		}
+		if m.Role == "user" && m.Speaker != "" {
+			m.Content = m.Speaker + ": " + m.Content
+		}
+		rest = append(rest, m)
+	}
+	if n > 0 && len(rest) > n {
+		rest = rest[len(rest)-n:]
+	}
+	view.Messages = append(view.Messages, rest...)
+	return view
+}
+
+// retry replaces the last answer in a chat with a new one.
+func (b *botEngine) retry(ctx context.Context, network, chat, user string) (string, error) {
+	queued.Add(1)
+	defer queued.Add(-1)
+	if !b.allow(network + ":" + user) {
+		return "", errRateLimited
+	}
+	b.mu.Lock()
+	conv, ok := b.convs[botConversationID(network, chat)]
+	if !ok || len(conv.Messages) < 2 || conv.Messages[len(conv.Messages)-1].Role != "assistant" {
+		b.mu.Unlock()
+		return "", errors.New("only the latest answer can be retried")
+	}
+	question := conv.Messages[len(conv.Messages)-2]
+	rt, err := b.router.route(network, chat, question.Speaker, question.Content)
+	if err != nil {
+		b.mu.Unlock()
+		return "", err
+	}
+	conv.Messages = conv.Messages[:len(conv.Messages)-1]
+	view := withSystem(attributedView(conv, b.context), rt.system)
+	b.mu.Unlock()
+
+	r, err := callOpenAI(ctx, b.client, rt.model, view, nil)
+	if err != nil {
+		go b.notify.failed("bot", conv.ID, err)
+		return "", err
+	}
+	b.router.charge(rt, r)
+	go b.notify.succeeded("bot", conv.ID, fmt.Sprintf("answered %s again in %s %s", user, network, chat))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv.addMessage("assistant", r.content)
+	conv.Messages[len(conv.Messages)-1].Model = rt.model
+	b.save(conv)
+	return r.content, nil
+}
+
+// forget removes an answer from a chat's conversation, so it is no
+// longer sent as context.
+func (b *botEngine) forget(network, chat, answer string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv, ok := b.convs[botConversationID(network, chat)]
+	if !ok {
+		return
+	}
+	for i := len(conv.Messages) - 1; i >= 0; i-- {
+		if m := conv.Messages[i]; m.Role == "assistant" && m.Content == answer {
+			conv.Messages = append(conv.Messages[:i], conv.Messages[i+1:]...)
+			b.save(conv)
+			return
+		}
+	}
+}
+
+// image generates a picture, counting against the user's rate limit.
+func (b *botEngine) image(ctx context.Context, network, user, prompt string) ([]byte, error) {
+	if !b.allow(network + ":" + user) {
+		return nil, errRateLimited
+	}
+	return generateImage(ctx, b.client, prompt)
+}
+
+// answer runs f, which answers a message, in the background.
+func (b *botEngine) answer(f func()) {
+	b.answering.Add(1)
+	go func() {
+		defer b.answering.Done()
+		f()
+	}()
+}
+
+// finish waits up to timeout for the answers in progress, once the
+// adapter has stopped taking messages.
+func (b *botEngine) finish(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		b.answering.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Fprintln(os.Stderr, "Warning: stopping with answers still in progress")
+	}
+}
+
+func (b *botEngine) save(conv *Conversation) {
+	err := os.MkdirAll(chatsDir, 0755)
+	if err == nil {
+		err = conv.save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save %s: %v\n", conv.ID, err)
+	}
+}
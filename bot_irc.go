@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type IRCConfig struct {
+	// Server is host:port; port 6697 implies TLS.
+	Server   string     `yaml:"server"`
+	TLS      bool       `yaml:"tls"`
+	Nick     string     `yaml:"nick"`
+	Password Credential `yaml:"password"`
+	Channels []string   `yaml:"channels"`
+}
+
+const (
+	// ircLineBytes keeps messages well inside IRC's 512-byte line limit
+	// once the server adds the prefix.
+	ircLineBytes = 400
+	// ircMaxLines caps a reply so the bot doesn't flood the channel.
+	ircMaxLines = 8
+)
+
+func init() {
+	botAdapters["irc"] = runIRCBot
+}
+
+func runIRCBot(cfg *Config, engine *botEngine, args []string) int {
+	c := cfg.Bot.IRC
+	fs := newFlagSet("bot irc")
+	fs.StringVar(&c.Server, "server", c.Server, "IRC server as host:port")
+	fs.BoolVar(&c.TLS, "tls", c.TLS, "connect with TLS (the default on port 6697)")
+	fs.StringVar(&c.Nick, "nick", c.Nick, "the bot's nick")
+	channel := fs.String("channel", "", "channel to join, in addition to bot.irc.channels")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if *channel != "" {
+		c.Channels = append(c.Channels, *channel)
+	}
+	if c.Nick == "" {
+		c.Nick = appName
+	}
+	if c.Server == "" || len(c.Channels) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: bot irc --server host:port --channel '#name' [--nick name] [--tls]")
+		return exitError
+	}
+
+	ctx, stop := stopContext()
+	defer stop()
+	if err := runIRC(ctx, c, engine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	return exitOK
+}
+
+type ircConn struct {
+	conn net.Conn
+	nick string
+}
+
+func (c *ircConn) send(format string, args ...any) error {
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	return err
+}
+
+// runIRC answers messages until the connection ends or ctx is done. Then
+// it finishes the answers in progress and quits.
+func runIRC(ctx context.Context, c IRCConfig, engine *botEngine) error {
+	_, port, _ := net.SplitHostPort(c.Server)
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if c.TLS || port == "6697" {
+		host, _, _ := net.SplitHostPort(c.Server)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.Server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	irc := &ircConn{conn: conn, nick: c.Nick}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		engine.finish(shutdownTimeout)
+		irc.send("QUIT :%s", "shutting down")
+		conn.Close()
+	}()
+
+	if c.Password.isSet() {
+		password, err := c.Password.resolve()
+		if err != nil {
+			return fmt.Errorf("bot.irc.password: %w", err)
+		}
+		irc.send("PASS %s", password)
+	}
+	irc.send("NICK %s", irc.nick)
+	irc.send("USER %s 0 * :%s bot", irc.nick, appName)
+
+	host, _, _ := net.SplitHostPort(c.Server)
+	in := bufio.NewScanner(conn)
+	for in.Scan() {
+		prefix, command, params := parseIRCLine(in.Text())
+		switch command {
+		case "PING":
+			irc.send("PONG :%s", strings.Join(params, " "))
+		case "001":
+			info("Connected to %s as %s\n", c.Server, irc.nick)
+			for _, ch := range c.Channels {
+				irc.send("JOIN %s", ch)
+			}
+		case "433":
+			// Nick in use.
+			irc.nick += "_"
+			irc.send("NICK %s", irc.nick)
+		case "JOIN":
+			if nickOf(prefix) == irc.nick && len(params) > 0 {
+				info("Joined %s\n", params[0])
+			}
+		case "ERROR":
+			return errors.New(strings.Join(params, " "))
+		case "PRIVMSG":
+			if len(params) < 2 || ctx.Err() != nil {
+				continue
+			}
+			target, text, sender := params[0], params[1], nickOf(prefix)
+			replyTo := target
+			if !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "&") {
+				// A direct message: every line is for the bot.
+				replyTo = sender
+			} else if text = addressedTo(irc.nick, text); text == "" {
+				continue
+			}
+			engine.answer(func() { irc.answer(engine, host, replyTo, sender, text) })
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := in.Err(); err != nil {
+		return err
+	}
+	return errors.New("the server closed the connection")
+}
+
+func (c *ircConn) answer(engine *botEngine, host, target, sender, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	answer, err := engine.reply(ctx, "irc", host+" "+target, sender, text)
+	if err != nil {
+		c.send("NOTICE %s :%s", sender, engine.errorText(err))
+		return
+	}
+	lines := ircLines(answer, ircLineBytes)
+	if len(lines) > ircMaxLines {
+		lines = append(lines[:ircMaxLines-1], "[…answer cut short]")
+	}
+	for i, line := range lines {
+		if i == 0 && strings.HasPrefix(target, "#") {
+			line = sender + ": " + line
+		}
+		c.send("PRIVMSG %s :%s", target, line)
+		// Pace lines to stay clear of flood protection.
+		time.Sleep(700 * time.Millisecond)
+	}
+}
+
+// addressedTo returns the message without the bot's nick if it starts
+// with "nick:" or "nick,", and "" if the message is for someone else.
+func addressedTo(nick, text string) string {
+	if len(text) <= len(nick) || !strings.EqualFold(text[:len(nick)], nick) {
+		return ""
+	}
+	rest := text[len(nick):]
+	if rest[0] != ':' && rest[0] != ',' {
+		return ""
+	}
+	return strings.TrimSpace(rest[1:])
+}
+
+// parseIRCLine splits ":prefix COMMAND a b :trailing text".
+func parseIRCLine(line string) (prefix, command string, params []string) {
+	if strings.HasPrefix(line, ":") {
+		prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+	params = fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return prefix, strings.ToUpper(fields[0]), params
+}
+
+func nickOf(prefix string) string {
+	nick, _, _ := strings.Cut(prefix, "!")
+	return nick
+}
+
+// ircLines breaks text into lines of at most n bytes at word boundaries,
+// dropping blank lines, since IRC messages cannot contain newlines.
+func ircLines(text string, n int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for len(word) > n {
+				lines = append(lines, word[:n])
+				word = word[n:]
+			}
+			if line != "" && len(line)+1+len(word) > n {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
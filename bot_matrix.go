@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type MatrixConfig struct {
+	// Homeserver is the client API's base URL, or pantalaimon's for
+	// encrypted rooms.
+	Homeserver string `yaml:"homeserver"`
+	// Token is the bot account's access token.
+	Token Credential `yaml:"token"`
+}
+
+// Reactions to the bot's answers that act on them.
+var (
+	matrixRetryKeys  = []string{"🔁", "🔄"}
+	matrixDeleteKeys = []string{"❌", "🗑"}
+)
+
+func init() {
+	botAdapters["matrix"] = runMatrixBot
+}
+
+func runMatrixBot(cfg *Config, engine *botEngine, args []string) int {
+	c := cfg.Bot.Matrix
+	fs := newFlagSet("bot matrix")
+	fs.StringVar(&c.Homeserver, "homeserver", c.Homeserver, "homeserver (or pantalaimon) URL")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if c.Homeserver == "" || !c.Token.isSet() {
+		fmt.Fprintln(os.Stderr, "Usage: bot matrix --homeserver URL, with bot.matrix.token set in the config")
+		return exitError
+	}
+	token, err := c.Token.resolve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: bot.matrix.token: %v\n", err)
+		return exitError
+	}
+
+	m := &matrixBot{
+		base:    strings.TrimRight(c.Homeserver, "/"),
+		token:   token,
+		engine:  engine,
+		members: map[string]int{},
+		answers: map[string]matrixAnswer{},
+		latest:  map[string]string{},
+		warned:  map[string]bool{},
+	}
+	ctx, stop := stopContext()
+	defer stop()
+	err = m.run(ctx)
+	engine.finish(shutdownTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	return exitOK
+}
+
+type matrixBot struct {
+	base   string
+	token  string
+	engine *botEngine
+	user   string
+	names  []string
+	txn    atomic.Int64
+
+	mu sync.Mutex
+	// members counts each room's joined members, to tell direct chats
+	// from group rooms.
+	members map[string]int
+	// answers are the bot's messages by event ID, and latest the last one
+	// in each room, for acting on reactions.
+	answers map[string]matrixAnswer
+	latest  map[string]string
+	// warned records rooms already told that encrypted messages can't be
+	// read.
+	warned map[string]bool
+}
+
+type matrixAnswer struct {
+	room string
+	text string
+}
+
+type matrixEvent struct {
+	Type    string          `json:"type"`
+	Sender  string          `json:"sender"`
+	EventID string          `json:"event_id"`
+	Content json.RawMessage `json:"content"`
+}
+
+type matrixMessage struct {
+	MsgType  string `json:"msgtype"`
+	Body     string `json:"body"`
+	Mentions struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions"`
+	RelatesTo struct {
+		RelType string `json:"rel_type"`
+		EventID string `json:"event_id"`
+		Key     string `json:"key"`
+	} `json:"m.relates_to"`
+}
+
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Summary struct {
+				Joined *int `json:"m.joined_member_count"`
+			} `json:"summary"`
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// matrixError is an error response from the homeserver.
+type matrixError struct {
+	Status  int
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *matrixError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("homeserver returned %d", e.Status)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// call makes a client API request, sending body as JSON unless it is
+// raw bytes, and decodes the response into out.
+func (m *matrixBot) call(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r, contentType = bytes.NewReader(b), http.DetectContentType(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.base+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if r != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := &matrixError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (m *matrixBot) send(ctx context.Context, room, eventType string, content any) (string, error) {
+	var sent struct {
+		EventID string `json:"event_id"`
+	}
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/%s/%d-%d", url.PathEscape(room), eventType, time.Now().UnixNano(), m.txn.Add(1))
+	err := m.call(ctx, http.MethodPut, path, content, &sent)
+	return sent.EventID, err
+}
+
+func (m *matrixBot) run(ctx context.Context) error {
+	var who struct {
+		UserID string `json:"user_id"`
+	}
+	if err := m.call(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &who); err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	m.user = who.UserID
+	localpart, _, _ := strings.Cut(strings.TrimPrefix(m.user, "@"), ":")
+	m.names = []string{localpart}
+	var profile struct {
+		Name string `json:"displayname"`
+	}
+	if m.call(ctx, http.MethodGet, "/_matrix/client/v3/profile/"+url.PathEscape(m.user)+"/displayname", nil, &profile) == nil && profile.Name != "" {
+		m.names = append(m.names, profile.Name)
+	}
+	info("Connected to %s as %s\n", m.base, m.user)
+
+	since := ""
+	for ctx.Err() == nil {
+		q := url.Values{"timeout": {"30000"}}
+		if since != "" {
+			q.Set("since", since)
+		}
+		var s matrixSync
+		err := m.call(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+q.Encode(), nil, &s)
+		var me *matrixError
+		if errors.As(err, &me) && (me.Status == http.StatusUnauthorized || me.Status == http.StatusForbidden) {
+			return err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: sync failed, retrying: %v\n", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		first := since == ""
+		since = s.NextBatch
+
+		for room := range s.Rooms.Invite {
+			if err := m.call(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(room), struct{}{}, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to join %s: %v\n", room, err)
+				continue
+			}
+			info("Joined %s\n", room)
+		}
+		for room, r := range s.Rooms.Join {
+			if r.Summary.Joined != nil {
+				m.mu.Lock()
+				m.members[room] = *r.Summary.Joined
+				m.mu.Unlock()
+			}
+			// The first sync is history: don't answer it again.
+			if first {
+				continue
+			}
+			for _, ev := range r.Timeline.Events {
+				if ev.Sender != m.user {
+					m.handle(ctx, room, ev)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *matrixBot) handle(ctx context.Context, room string, ev matrixEvent) {
+	var msg matrixMessage
+	json.Unmarshal(ev.Content, &msg)
+	switch ev.Type {
+	case "m.room.message":
+		// Skip edits, and notices, which other bots send.
+		if msg.MsgType != "m.text" || msg.RelatesTo.RelType == "m.replace" {
+			return
+		}
+		text := msg.Body
+		if !m.direct(ctx, room) {
+			if text = m.addressed(msg); text == "" {
+				return
+			}
+		}
+		m.engine.answer(func() { m.answer(room, ev, text) })
+	case "m.reaction":
+		if msg.RelatesTo.RelType == "m.annotation" {
+			m.engine.answer(func() {
+				m.react(room, ev.Sender, msg.RelatesTo.EventID, strings.TrimSuffix(msg.RelatesTo.Key, "\uFE0F"))
+			})
+		}
+	case "m.room.encrypted":
+		m.mu.Lock()
+		warned := m.warned[room]
+		m.warned[room] = true
+		m.mu.Unlock()
+		if !warned {
+			m.send(ctx, room, "m.room.message", map[string]any{
+				"msgtype": "m.notice",
+				"body":    "I can't read encrypted messages. To use me in encrypted rooms, run me through pantalaimon.",
+			})
+		}
+	}
+}
+
+// direct reports whether a room is a chat between the bot and one person,
+// where every message is for the bot.
+func (m *matrixBot) direct(ctx context.Context, room string) bool {
+	m.mu.Lock()
+	n, ok := m.members[room]
+	m.mu.Unlock()
+	if !ok {
+		var joined struct {
+			Joined map[string]json.RawMessage `json:"joined"`
+		}
+		if m.call(ctx, http.MethodGet, "/_matrix/client/v3/rooms/"+url.PathEscape(room)+"/joined_members", nil, &joined) != nil {
+			return false
+		}
+		n = len(joined.Joined)
+		m.mu.Lock()
+		m.members[room] = n
+		m.mu.Unlock()
+	}
+	return n == 2
+}
+
+// addressed returns a group message without the bot's name if it mentions
+// the bot, and "" if it is for someone else.
+func (m *matrixBot) addressed(msg matrixMessage) string {
+	for _, name := range m.names {
+		if text := addressedTo(name, msg.Body); text != "" {
+			return text
+		}
+	}
+	for _, id := range msg.Mentions.UserIDs {
+		if id == m.user {
+			return msg.Body
+		}
+	}
+	return ""
+}
+
+func (m *matrixBot) answer(room string, ev matrixEvent, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	m.typing(ctx, room, true)
+	defer m.typing(ctx, room, false)
+
+	if prompt, ok := strings.CutPrefix(text, "!image "); ok {
+		m.sendImage(ctx, room, ev.Sender, strings.TrimSpace(prompt))
+		return
+	}
+	answer, err := m.engine.reply(ctx, "matrix", room, ev.Sender, text)
+	if err != nil {
+		m.failed(ctx, room, err)
+		return
+	}
+	id, err := m.send(ctx, room, "m.room.message", map[string]any{
+		"msgtype":      "m.text",
+		"body":         answer,
+		"m.relates_to": map[string]any{"m.in_reply_to": map[string]string{"event_id": ev.EventID}},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to send to %s: %v\n", room, err)
+		return
+	}
+	m.mu.Lock()
+	m.answers[id] = matrixAnswer{room: room, text: answer}
+	m.latest[room] = id
+	m.mu.Unlock()
+}
+
+func (m *matrixBot) failed(ctx context.Context, room string, err error) {
+	m.send(ctx, room, "m.room.message", map[string]any{"msgtype": "m.notice", "body": m.engine.errorText(err)})
+}
+
+func (m *matrixBot) typing(ctx context.Context, room string, on bool) {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s", url.PathEscape(room), url.PathEscape(m.user))
+	m.call(ctx, http.MethodPut, path, map[string]any{"typing": on, "timeout": 30000}, nil)
+}
+
+// sendImage generates a picture, uploads it to the homeserver's media
+// repository and posts it.
+func (m *matrixBot) sendImage(ctx context.Context, room, sender, prompt string) {
+	data, err := m.engine.image(ctx, "matrix", sender, prompt)
+	if err != nil {
+		m.failed(ctx, room, err)
+		return
+	}
+	var upload struct {
+		URI string `json:"content_uri"`
+	}
+	err = m.call(ctx, http.MethodPost, "/_matrix/media/v3/upload?filename=image.png", data, &upload)
+	if err != nil {
+		m.failed(ctx, room, fmt.Errorf("failed to upload image: %w", err))
+		return
+	}
+	_, err = m.send(ctx, room, "m.room.message", map[string]any{
+		"msgtype": "m.image",
+		"body":    truncate(prompt, 100) + ".png",
+		"url":     upload.URI,
+		"info":    map[string]any{"mimetype": http.DetectContentType(data), "size": len(data)},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to send to %s: %v\n", room, err)
+	}
+}
+
+// react acts on a reaction to one of the bot's answers: retry replaces the
+// latest answer with a new one by editing it, and delete redacts an answer
+// and drops it from the conversation.
+func (m *matrixBot) react(room, sender, target, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	m.mu.Lock()
+	a, ok := m.answers[target]
+	latest := m.latest[room] == target
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch {
+	case slices.Contains(matrixRetryKeys, key):
+		if !latest {
+			return
+		}
+		m.typing(ctx, room, true)
+		answer, err := m.engine.retry(ctx, "matrix", room, sender)
+		m.typing(ctx, room, false)
+		if err != nil {
+			m.failed(ctx, room, err)
+			return
+		}
+		_, err = m.send(ctx, room, "m.room.message", map[string]any{
+			"msgtype":       "m.text",
+			"body":          "* " + answer,
+			"m.new_content": map[string]string{"msgtype": "m.text", "body": answer},
+			"m.relates_to":  map[string]string{"rel_type": "m.replace", "event_id": target},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to send to %s: %v\n", room, err)
+			return
+		}
+		m.mu.Lock()
+		m.answers[target] = matrixAnswer{room: room, text: answer}
+		m.mu.Unlock()
+	case slices.Contains(matrixDeleteKeys, key):
+		path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/redact/%s/%d-%d", url.PathEscape(room), url.PathEscape(target), time.Now().UnixNano(), m.txn.Add(1))
+		if err := m.call(ctx, http.MethodPut, path, map[string]string{"reason": "deleted by " + sender}, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to delete %s: %v\n", target, err)
+			return
+		}
+		m.engine.forget("matrix", room, a.text)
+		m.mu.Lock()
+		delete(m.answers, target)
+		if latest {
+			delete(m.latest, room)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// WebhookConfig connects gateways that speak HTTP and JSON, such as
+// signal-cli-rest-api or WhatsApp bridges.
+type WebhookConfig struct {
+	// Listen is the address to receive messages on (default :8766).
+	Listen string `yaml:"listen"`
+	// Network names the gateway in conversation IDs and tags (default
+	// webhook).
+	Network string `yaml:"network"`
+	// Secret, if set, must be sent as a bearer token or ?token=.
+	Secret Credential `yaml:"secret"`
+	// Fields are dotted paths to the chat, user and text in incoming
+	// JSON (default: the top-level keys chat, user and text).
+	Fields struct {
+		Chat string `yaml:"chat"`
+		User string `yaml:"user"`
+		Text string `yaml:"text"`
+	} `yaml:"fields"`
+	// Outbound, if its URL is set, receives answers in a request of its
+	// own instead of in the response.
+	Outbound WebhookOutbound `yaml:"outbound"`
+}
+
+type WebhookOutbound struct {
+	URL string `yaml:"url"`
+	// Body is a text/template for the request body, with .Chat, .User,
+	// .Text and .Reply, and json to quote a value. By default it is
+	// {"chat": ..., "user": ..., "reply": ...}.
+	Body string `yaml:"body"`
+	// Token, if set, is sent as a bearer token.
+	Token Credential `yaml:"token"`
+}
+
+const defaultWebhookListen = ":8766"
+
+func init() {
+	botAdapters["webhook"] = runWebhookBot
+}
+
+func runWebhookBot(cfg *Config, engine *botEngine, args []string) int {
+	c := cfg.Bot.Webhook
+	if c.Listen == "" {
+		c.Listen = defaultWebhookListen
+	}
+	if c.Network == "" {
+		c.Network = "webhook"
+	}
+	fs := newFlagSet("bot webhook")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to receive messages on")
+	fs.StringVar(&c.Network, "network", c.Network, "name of the gateway, used in conversation IDs")
+	fs.StringVar(&c.Outbound.URL, "outbound", c.Outbound.URL, "URL to send answers to, instead of in the response")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	h, err := newWebhookHandler(c, engine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.HandleFunc("GET /healthz", serveHealthz)
+	mux.Handle("GET /readyz", newReadiness(cfg))
+	srv := &http.Server{Addr: c.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := stopContext()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	info("Receiving %s messages on %s (Ctrl+C to stop)\n", c.Network, c.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+type webhookHandler struct {
+	cfg    WebhookConfig
+	engine *botEngine
+	secret string
+	token  string
+	body   *template.Template
+}
+
+// webhookMessage is what the outbound body template is executed with.
+type webhookMessage struct {
+	Chat, User, Text, Reply string
+}
+
+const defaultWebhookBody = `{"chat": {{json .Chat}}, "user": {{json .User}}, "reply": {{json .Reply}}}`
+
+func newWebhookHandler(c WebhookConfig, engine *botEngine) (*webhookHandler, error) {
+	h := &webhookHandler{cfg: c, engine: engine}
+	var err error
+	if h.secret, err = c.Secret.resolve(); err != nil {
+		return nil, fmt.Errorf("bot.webhook.secret: %w", err)
+	}
+	if h.token, err = c.Outbound.Token.resolve(); err != nil {
+		return nil, fmt.Errorf("bot.webhook.outbound.token: %w", err)
+	}
+	body := c.Outbound.Body
+	if body == "" {
+		body = defaultWebhookBody
+	}
+	h.body, err = template.New("body").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("bot.webhook.outbound.body: %w", err)
+	}
+	return h, nil
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a JSON message", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.secret != "" {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.secret)) != 1 {
+			http.Error(w, "wrong or missing token", http.StatusUnauthorized)
+			return
+		}
+	}
+	var in any
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&in); err != nil {
+		http.Error(w, "expected a JSON body", http.StatusBadRequest)
+		return
+	}
+	f := h.cfg.Fields
+	msg := webhookMessage{
+		Chat: jsonPath(in, cmp.Or(f.Chat, "chat")),
+		User: jsonPath(in, cmp.Or(f.User, "user")),
+		Text: strings.TrimSpace(jsonPath(in, cmp.Or(f.Text, "text"))),
+	}
+	if msg.Text == "" {
+		// Receipts, typing notices and the like.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if msg.Chat == "" {
+		msg.Chat = msg.User
+	}
+	if msg.Chat == "" {
+		http.Error(w, "the message has no chat or user", http.StatusBadRequest)
+		return
+	}
+
+	if h.cfg.Outbound.URL != "" {
+		w.WriteHeader(http.StatusAccepted)
+		go h.answer(msg)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+	reply, err := h.engine.reply(ctx, h.cfg.Network, msg.Chat, msg.User, msg.Text)
+	switch {
+	case errors.Is(err, errRateLimited), errors.Is(err, errOverBudget):
+		http.Error(w, h.engine.errorText(err), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		http.Error(w, "failed to answer", http.StatusBadGateway)
+		return
+	}
+	msg.Reply = reply
+	w.Header().Set("Content-Type", "application/json")
+	h.body.Execute(w, msg)
+}
+
+// answer replies to a message by calling the outbound URL.
+func (h *webhookHandler) answer(msg webhookMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	reply, err := h.engine.reply(ctx, h.cfg.Network, msg.Chat, msg.User, msg.Text)
+	if err != nil {
+		reply = h.engine.errorText(err)
+	}
+	msg.Reply = reply
+
+	var body bytes.Buffer
+	if err := h.body.Execute(&body, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: bot.webhook.outbound.body: %v\n", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Outbound.URL, &body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to send answer: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "Error: failed to send answer: %s returned %s\n", h.cfg.Outbound.URL, resp.Status)
+	}
+}
+
+// jsonPath follows a dotted path such as envelope.dataMessage.message
+// through decoded JSON, returning strings and numbers as text and "" for
+// anything missing.
+func jsonPath(v any, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = obj[key]
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// BudgetsConfig caps what the conversations with a persona or a tag may
+// cost each calendar month, in dollars. Personas and tags without a
+// budget, or with 0, are unlimited.
+type BudgetsConfig struct {
+	Personas map[string]float64 `yaml:"personas"`
+	Tags     map[string]float64 `yaml:"tags"`
+}
+
+// budgetWarnAt is the share of a budget that, once spent, is warned
+// about.
+const budgetWarnAt = 0.8
+
+// budget is one allowance that applies to the current conversation.
+type budget struct {
+	// kind is "persona" or "tag".
+	kind  string
+	name  string
+	limit float64
+}
+
+func (b budget) String() string {
+	return fmt.Sprintf("the %s %s", b.name, b.kind)
+}
+
+// monthSpending is what the archive, minus one conversation, spent in a
+// month by persona and by tag.
+type monthSpending struct {
+	month    string
+	exclude  string
+	personas map[string]float64
+	tags     map[string]float64
+}
+
+// budgets returns the allowances that apply to the current conversation.
+func (s *session) budgets() []budget {
+	var list []budget
+	if limit := s.cfg.Budgets.Personas[s.personaName()]; limit > 0 {
+		list = append(list, budget{kind: "persona", name: s.personaName(), limit: limit})
+	}
+	tags := slices.Clone(s.conv.Tags)
+	sort.Strings(tags)
+	for _, tag := range slices.Compact(tags) {
+		if limit := s.cfg.Budgets.Tags[tag]; limit > 0 {
+			list = append(list, budget{kind: "tag", name: tag, limit: limit})
+		}
+	}
+	return list
+}
+
+// checkBudgets warns, once a session, about each budget of the
+// conversation that is 80% spent, and refuses with exitBudgetExceeded
+// once one is spent in full. It reports whether the request may go out.
+func (s *session) checkBudgets() bool {
+	list := s.budgets()
+	if len(list) == 0 {
+		return true
+	}
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	archived, err := s.archiveSpending(start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to total this month's spending: %v\n", err)
+		return true
+	}
+	var current float64
+	for _, item := range conversationCosts(s.conv, start, start.AddDate(0, 1, 0)) {
+		current += item.cost
+	}
+	month := now.Format("January")
+	for _, b := range list {
+		spent := current + archived.personas[b.name]
+		if b.kind == "tag" {
+			spent = current + archived.tags[b.name]
+		}
+		if spent >= b.limit {
+			fmt.Fprintf(os.Stderr, "Error: %s has used up its budget of $%.2f for %s ($%.2f spent)\n", b, b.limit, month, spent)
+			s.exitCode = exitBudgetExceeded
+			return false
+		}
+		if key := b.kind + ":" + b.name; spent >= budgetWarnAt*b.limit && !s.budgetWarned[key] {
+			if s.budgetWarned == nil {
+				s.budgetWarned = map[string]bool{}
+			}
+			s.budgetWarned[key] = true
+			fmt.Fprintf(os.Stderr, "Warning: %s has used $%.2f of its $%.2f budget for %s (%.0f%%)\n", b, spent, b.limit, month, 100*spent/b.limit)
+		}
+	}
+	return true
+}
+
+// archiveSpending totals the saved conversations other than the current
+// one for the month starting at start. The archive is read once per
+// conversation and month; the current conversation's spending is added
+// from memory, so incognito ones count too.
+func (s *session) archiveSpending(start time.Time) (*monthSpending, error) {
+	month := start.Format("2006-01")
+	if c := s.spending; c != nil && c.month == month && c.exclude == s.conv.ID {
+		return c, nil
+	}
+	convs, _, err := loadArchive()
+	if err != nil {
+		return nil, err
+	}
+	c := &monthSpending{month: month, exclude: s.conv.ID, personas: map[string]float64{}, tags: map[string]float64{}}
+	for _, conv := range convs {
+		if conv.ID == s.conv.ID {
+			continue
+		}
+		for _, item := range conversationCosts(conv, start, start.AddDate(0, 1, 0)) {
+			c.personas[item.persona] += item.cost
+			for _, tag := range item.tags {
+				c.tags[tag] += item.cost
+			}
+		}
+	}
+	s.spending = c
+	return c, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChatTemplate seeds a new conversation: its prompt, opening messages,
+// model and settings. Templates ship in assets/chat_templates.yaml and
+// can be added in templates.yaml in the config directory.
+type ChatTemplate struct {
+	Description string `yaml:"description"`
+	// Persona is the persona to start from; SystemPrompt replaces its
+	// prompt and Model its model when set.
+	Persona      string `yaml:"persona"`
+	SystemPrompt string `yaml:"system_prompt"`
+	Model        string `yaml:"model"`
+	// Messages are added after the system prompt, e.g. an opening
+	// question from the assistant.
+	Messages []TemplateMessage `yaml:"messages"`
+	Tags     []string          `yaml:"tags"`
+	// Time and Reflect turn on --time and --reflect.
+	Time    bool `yaml:"time"`
+	Reflect bool `yaml:"reflect"`
+}
+
+type TemplateMessage struct {
+	Role    string `yaml:"role"`
+	Content string `yaml:"content"`
+}
+
+var templateFlag = flag.String("template", "", "start the conversation from a template (see the templates subcommand)")
+
+var builtinTemplates = func() map[string]ChatTemplate {
+	var templates map[string]ChatTemplate
+	if err := yaml.Unmarshal([]byte(asset("chat_templates.yaml")), &templates); err != nil {
+		panic(fmt.Sprintf("assets/chat_templates.yaml: %v", err))
+	}
+	return templates
+}()
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "templates",
+		usage: "templates",
+		help:  "List the conversation templates for new --template",
+		run: func(cfg *Config, args []string) int {
+			templates, err := loadTemplates()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+			for _, name := range sortedKeys(templates) {
+				fmt.Printf("%-14s %s\n", name, templates[name].Description)
+			}
+			return exitOK
+		},
+	})
+}
+
+// loadTemplates returns the built-in templates and those in
+// templates.yaml in the config directory.
+func loadTemplates() (map[string]ChatTemplate, error) {
+	templates := map[string]ChatTemplate{}
+	for name, t := range builtinTemplates {
+		templates[name] = t
+	}
+	dir, err := configDir()
+	if err != nil {
+		return templates, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "templates.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return templates, nil
+	}
+	if err != nil {
+		return templates, err
+	}
+	var custom map[string]ChatTemplate
+	if err := yaml.Unmarshal(data, &custom); err != nil {
+		return templates, fmt.Errorf("templates.yaml: %w", err)
+	}
+	for name, t := range custom {
+		for i, m := range t.Messages {
+			if m.Role != "user" && m.Role != "assistant" {
+				return templates, fmt.Errorf("templates.yaml: %s: message %d: role must be user or assistant, not %q", name, i+1, m.Role)
+			}
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+func findTemplate(name string) (ChatTemplate, error) {
+	templates, err := loadTemplates()
+	if err != nil {
+		return ChatTemplate{}, err
+	}
+	t, ok := templates[name]
+	if !ok {
+		return t, fmt.Errorf("no template named %q; there are %s", name, strings.Join(sortedKeys(templates), ", "))
+	}
+	return t, nil
+}
+
+// applyTemplate seeds the session's new conversation from t and shows
+// the messages it starts with.
+func (s *session) applyTemplate(name string, t ChatTemplate) {
+	if t.SystemPrompt != "" {
+		s.conv.Messages[0].Content = t.SystemPrompt
+	}
+	if t.Model != "" {
+		s.pinModel(t.Model)
+	}
+	s.injectTime = s.injectTime || t.Time
+	s.reflect = s.reflect || t.Reflect
+	s.conv.addTags(t.Tags...)
+	s.conv.Template = name
+	for _, m := range t.Messages {
+		s.conv.addMessage(m.Role, m.Content)
+		if m.Role == "assistant" {
+			fmt.Printf("%s %s\n\n", paint(theme.Assistant, "Assistant:"), forDisplay(m.Content))
+		} else {
+			info("%s%s\n", s.userPrompt(), m.Content)
+		}
+	}
+}
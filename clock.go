@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(nowTool{})
+}
+
+// timeContext describes the moment t for the model. Models have no clock
+// and a training cutoff, so without this "what day is it" and relative
+// dates ("next Friday") come out wrong.
+func timeContext(t time.Time) string {
+	_, offset := t.Zone()
+	return fmt.Sprintf("Current date and time: %s, %s (%s, UTC%s).",
+		t.Format("Monday"), t.Format("2006-01-02 15:04"), localZoneName(), formatOffset(offset))
+}
+
+// localZoneName returns the IANA name of the local time zone, which
+// time.Local only reports as "Local".
+func localZoneName() string {
+	if tz := os.Getenv("TZ"); tz != "" {
+		return strings.TrimPrefix(tz, ":")
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	name, _ := time.Now().Zone()
+	return name
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// withTimeContext returns a copy of c with the current time added at the
+// end. Placed after the system prompt, it would change the start of every
+// request each minute and leave nothing for the prompt cache to reuse.
+func withTimeContext(c *Conversation, now time.Time) *Conversation {
+	sent := *c
+	sent.Messages = append(slices.Clip(c.Messages), Message{Role: "system", Content: timeContext(now)})
+	return &sent
+}
+
+// withSystemNote returns a copy of c with a system message added after
+// the system prompt. The copy is what gets sent; the saved conversation
+// is left alone so notes don't pile up turn after turn.
+func withSystemNote(c *Conversation, note string) *Conversation {
+	sent := *c
+	sent.Messages = make([]Message, 0, len(c.Messages)+1)
+	inserted := false
+	for _, m := range c.Messages {
+		if !inserted && m.Role != "system" {
+			sent.Messages = append(sent.Messages, Message{Role: "system", Content: note})
+			inserted = true
+		}
+		sent.Messages = append(sent.Messages, m)
+	}
+	if !inserted {
+		sent.Messages = append(sent.Messages, Message{Role: "system", Content: note})
+	}
+	return &sent
+}
+
+// nowTool tells the model the current time, optionally in another zone.
+type nowTool struct{}
+
+func (nowTool) Name() string { return "now" }
+
+func (nowTool) Description() string {
+	return "Get the current date, time, weekday and ISO week, in the user's time zone or an IANA zone such as America/New_York."
+}
+
+func (nowTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"timezone": map[string]any{"type": "string", "description": "IANA zone name; omit for the user's local zone"},
+		},
+	}
+}
+
+func (nowTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Timezone string `json:"timezone"`
+	}
+	if len(args) > 0 {
+		if err := decodeArgs(args, &in); err != nil {
+			return "", err
+		}
+	}
+	t := time.Now()
+	zone := localZoneName()
+	if in.Timezone != "" {
+		loc, err := time.LoadLocation(in.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", in.Timezone)
+		}
+		t, zone = t.In(loc), in.Timezone
+	}
+	_, week := t.ISOWeek()
+	_, offset := t.Zone()
+	return fmt.Sprintf("%s (%s, %s, UTC%s, ISO week %d)",
+		t.Format(time.RFC3339), t.Format("Monday"), zone, formatOffset(offset), week), nil
+}
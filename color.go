@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+var useColor bool
+
+// consoleVT reports whether the terminal understands escape sequences;
+// without them the line editor and status line are turned off too.
+var consoleVT = true
+
+// setupColor applies the color setting: "always", "never", or "auto"
+// (the default), which colors terminals unless NO_COLOR is set or the
+// console is too old for escape sequences.
+func setupColor(mode string) {
+	consoleVT = setupConsole()
+	if accessible {
+		// Escape sequences can be read out, or garble braille.
+		useColor = false
+		return
+	}
+	switch mode {
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	default:
+		useColor = !headless && consoleVT && term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+	}
+}
+
+// paint wraps s in an SGR sequence such as "1;32" when color is on.
+func paint(sgr, s string) string {
+	if !useColor {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + "\x1b[0m"
+}
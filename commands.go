@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(s *session, args string) error
+}
+
+var commands = map[string]*command{}
+
+func init() {
+	registerCommand(&command{
+		name:  "help",
+		usage: "/help [command]",
+		help:  "List the chat commands, or describe one",
+		run:   cmdHelp,
+	})
+}
+
+func registerCommand(c *command) {
+	commands[c.name] = c
+}
+
+// isCommand reports whether input is a command. A message that starts
+// with a slash is sent by doubling it: "//etc/hosts is ..." sends
+// "/etc/hosts is ...".
+func isCommand(input string) bool {
+	return strings.HasPrefix(input, "/") && !strings.HasPrefix(input, "//")
+}
+
+// unescapeCommand undoes the doubled slash of a message that starts with
+// one.
+func unescapeCommand(input string) string {
+	if strings.HasPrefix(input, "//") {
+		return input[1:]
+	}
+	return input
+}
+
+func dispatchCommand(s *session, input string) error {
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command /%s; /help lists them, and // at the start sends a message beginning with /", name)
+	}
+	return cmd.run(s, strings.TrimSpace(args))
+}
+
+func cmdHelp(s *session, args string) error {
+	if name := strings.TrimPrefix(args, "/"); name != "" {
+		cmd, ok := commands[name]
+		if !ok {
+			return fmt.Errorf("unknown command /%s", name)
+		}
+		fmt.Printf("%s\n  %s\n", cmd.usage, cmd.help)
+		return nil
+	}
+	for _, cmd := range sortedCommands() {
+		if len(cmd.usage) > 32 {
+			fmt.Printf("  %s\n  %-32s %s\n", cmd.usage, "", cmd.help)
+			continue
+		}
+		fmt.Printf("  %-32s %s\n", cmd.usage, cmd.help)
+	}
+	info("Anything else is sent to the model; start with // to send a message that begins with /.\n")
+	return nil
+}
+
+func sortedCommands() []*command {
+	list := make([]*command, 0, len(commands))
+	for _, c := range commands {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
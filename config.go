@@ -0,0 +1,617 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the user configuration read from config.yaml in the config
+// directory. Every field is optional; zero values mean "use the default".
+type Config struct {
+	APIKey        string `yaml:"api_key"`
+	APIKeyFile    string `yaml:"api_key_file"`
+	APIKeyCommand string `yaml:"api_key_command"`
+	Model         string `yaml:"model"`
+	// Provider is the chat backend: openai (default), anthropic, ollama
+	// or azure, set up under Providers.
+	Provider  string          `yaml:"provider"`
+	Providers ProvidersConfig `yaml:"providers"`
+	DataDir   string          `yaml:"data_dir"`
+	// IDFormat names new conversations: ulid (default), uuid or unix.
+	IDFormat    string            `yaml:"id_format"`
+	Color       string            `yaml:"color"`
+	Theme       string            `yaml:"theme"`
+	Keybindings KeybindingsConfig `yaml:"keybindings"`
+	Sync        SyncConfig        `yaml:"sync"`
+	StatusLine  bool              `yaml:"status_line"`
+	TUI         bool              `yaml:"tui"`
+	// Headless is for running unattended, as in a container: nothing is
+	// opened and no colors are used.
+	Headless bool `yaml:"headless"`
+	// Plain prints answers as written, without rendering their markdown.
+	Plain bool `yaml:"plain"`
+	// LogFormat is text (default) or json, for log collectors.
+	LogFormat    string `yaml:"log_format"`
+	InjectTime   bool   `yaml:"inject_time"`
+	Stats        bool   `yaml:"stats"`
+	Verify       bool   `yaml:"verify"`
+	NoStream     bool   `yaml:"no_stream"`
+	AutoContinue int    `yaml:"auto_continue"`
+	// InputGuard is the size in bytes above which a message needs
+	// confirmation before it is sent (default 32768; -1 never asks).
+	InputGuard int `yaml:"input_guard"`
+	// HistorySize is how many lines typed at the prompt are kept for the
+	// up arrow (default 1000; -1 keeps none).
+	HistorySize    int                `yaml:"history_size"`
+	Context        ContextConfig      `yaml:"context"`
+	DefaultPersona string             `yaml:"default_persona"`
+	Personas       map[string]Persona `yaml:"personas"`
+	Retention      RetentionConfig    `yaml:"retention"`
+	Tools          ToolsConfig        `yaml:"tools"`
+	Digest         DigestConfig       `yaml:"digest"`
+	Email          EmailConfig        `yaml:"email"`
+	Issues         IssuesConfig       `yaml:"issues"`
+	Untrusted      UntrustedConfig    `yaml:"untrusted"`
+	Minutes        MinutesConfig      `yaml:"minutes"`
+	Podcast        PodcastConfig      `yaml:"podcast"`
+	YouTube        YouTubeConfig      `yaml:"youtube"`
+	OCR            OCRConfig          `yaml:"ocr"`
+	Diagram        DiagramConfig      `yaml:"diagram"`
+	Speech         SpeechConfig       `yaml:"speech"`
+	Open           OpenConfig         `yaml:"open"`
+	Serve          ServeConfig        `yaml:"serve"`
+	Bot            BotConfig          `yaml:"bot"`
+	A11y           A11yConfig         `yaml:"a11y"`
+	Routing        []RoutingRule      `yaml:"routing"`
+	Budgets        BudgetsConfig      `yaml:"budgets"`
+	ModelRouter    ModelRouterConfig  `yaml:"model_router"`
+	HTTP           HTTPConfig         `yaml:"http"`
+	Duplicates     DuplicatesConfig   `yaml:"duplicates"`
+	Hooks          HooksConfig        `yaml:"hooks"`
+	Notify         NotifyConfig       `yaml:"notify"`
+	// EncryptionKey is the passphrase conversations are encrypted with;
+	// profiles can have their own.
+	EncryptionKey Credential               `yaml:"encryption_key"`
+	Profiles      map[string]ProfileConfig `yaml:"profiles"`
+}
+
+type KeybindingsConfig struct {
+	// Preset is "emacs" (default) or "vi".
+	Preset string `yaml:"preset"`
+	// Bind maps an action name to a comma-separated list of keys,
+	// replacing the preset's keys for that action.
+	Bind map[string]string `yaml:"bind"`
+}
+
+func configPath() (string, error) {
+	if configFile != "" {
+		return expandHome(configFile), nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// loadConfig reads and validates config.yaml, with the keys CHAT_CLI_
+// variables set applied over it. Unknown keys and dubious values are
+// reported as warnings on stderr; invalid values are errors. Both point at
+// the offending line, or variable.
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && configFile == "" {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	env, err := applyEnv(root.Content[0])
+	if err != nil {
+		return cfg, err
+	}
+	if len(data) == 0 && len(env) == 0 {
+		return cfg, nil
+	}
+	if err := root.Decode(cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	v := &configValidator{file: path, root: root.Content[0], env: env}
+	v.unknownKeys(v.root, reflect.TypeOf(*cfg), "")
+	cfg.validate(v)
+	for _, w := range sortIssues(v.warnings) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if len(v.errors) > 0 {
+		return cfg, errors.New(strings.Join(sortIssues(v.errors), "\n"))
+	}
+	return cfg, nil
+}
+
+type configIssue struct {
+	line int
+	text string
+}
+
+func sortIssues(issues []configIssue) []string {
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].line < issues[j].line })
+	texts := make([]string, len(issues))
+	for i, issue := range issues {
+		texts[i] = issue.text
+	}
+	return texts
+}
+
+// configValidator collects problems found in a parsed config file.
+type configValidator struct {
+	file     string
+	root     *yaml.Node
+	warnings []configIssue
+	errors   []configIssue
+	// env names the variables that set nodes (see applyEnv).
+	env map[*yaml.Node]string
+}
+
+func (v *configValidator) warnf(path, format string, args ...any) {
+	v.warnings = append(v.warnings, v.issue(path, fmt.Sprintf(format, args...)))
+}
+
+func (v *configValidator) errorf(path, format string, args ...any) {
+	v.errors = append(v.errors, v.issue(path, fmt.Sprintf(format, args...)))
+}
+
+// issue locates a dotted key path in the file and renders
+// "file:line: key: msg".
+func (v *configValidator) issue(path, msg string) configIssue {
+	node := v.root
+	for _, key := range strings.Split(path, ".") {
+		key, index, _ := strings.Cut(key, "[")
+		next := mappingValue(node, key)
+		if next == nil {
+			break
+		}
+		node = next
+		// feeds[2] selects an item of a sequence.
+		if i, err := strconv.Atoi(strings.TrimSuffix(index, "]")); err == nil && node.Kind == yaml.SequenceNode && i < len(node.Content) {
+			node = node.Content[i]
+		}
+	}
+	if name, ok := v.env[node]; ok {
+		return configIssue{0, fmt.Sprintf("$%s: %s: %s", name, path, msg)}
+	}
+	return configIssue{node.Line, fmt.Sprintf("%s:%d: %s: %s", v.file, node.Line, path, msg)}
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// unknownKeys warns about mapping keys that no field of t corresponds to.
+func (v *configValidator) unknownKeys(n *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			ft, ok := fields[key.Value]
+			if !ok {
+				v.warnings = append(v.warnings, configIssue{key.Line, fmt.Sprintf("%s:%d: unknown key %q", v.file, key.Line, join(key.Value))})
+				continue
+			}
+			v.unknownKeys(n.Content[i+1], ft, join(key.Value))
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.unknownKeys(n.Content[i+1], t.Elem(), join(n.Content[i].Value))
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			v.unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// resolveDataDir returns the data directory for the data_dir setting.
+func resolveDataDir(configured string) string {
+	switch {
+	case configured != "":
+		return expandHome(configured)
+	case isDir("chats"):
+		// Before data went to the platform's data directory, it went
+		// to the working directory; keep using it where it exists.
+		return "."
+	}
+	if dir, err := defaultDataDir(); err == nil {
+		return dir
+	}
+	return dataDir
+}
+
+// applyGlobals applies settings that live in package state rather than
+// being passed around: the data directory, color mode and tool settings.
+func (cfg *Config) applyGlobals() error {
+	dataDir = resolveDataDir(cfg.DataDir)
+	chatsDir = filepath.Join(dataDir, "chats")
+	accessible = accessible || cfg.A11y.Enabled
+	headless = cfg.Headless
+	plainOutput = plainOutput || cfg.Plain
+	idFormat = cmp.Or(cfg.IDFormat, "ulid")
+	setupColor(cfg.Color)
+	if cfg.Theme != "" {
+		if err := setTheme(cfg.Theme); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	toolsConfig = cfg.Tools
+	httpConfig = cfg.HTTP
+	untrustedConfig = cfg.Untrusted
+	return cfg.applyProfile()
+}
+
+func (cfg *Config) validate(v *configValidator) {
+	v.checkModel("model", cfg.Model)
+	switch cfg.Color {
+	case "", "auto", "always", "never":
+	default:
+		v.errorf("color", "must be auto, always or never, not %q", cfg.Color)
+	}
+	switch cfg.IDFormat {
+	case "", "ulid", "uuid", "unix":
+	default:
+		v.errorf("id_format", "must be ulid, uuid or unix, not %q", cfg.IDFormat)
+	}
+	switch cfg.LogFormat {
+	case "", "text", "json":
+	default:
+		v.errorf("log_format", "must be text or json, not %q", cfg.LogFormat)
+	}
+	keySources := 0
+	for _, set := range []bool{cfg.APIKey != "", cfg.APIKeyFile != "", cfg.APIKeyCommand != ""} {
+		if set {
+			keySources++
+		}
+	}
+	if keySources > 1 {
+		v.warnf("api_key", "several of api_key, api_key_file and api_key_command are set; the first one wins")
+	}
+
+	switch cfg.Keybindings.Preset {
+	case "", "emacs", "vi":
+	default:
+		v.errorf("keybindings.preset", "must be emacs or vi, not %q", cfg.Keybindings.Preset)
+	}
+	for action, keys := range cfg.Keybindings.Bind {
+		path := "keybindings.bind." + action
+		if !knownAction(action) {
+			v.errorf(path, "unknown action %q", action)
+			continue
+		}
+		for _, k := range strings.Split(keys, ",") {
+			if k = strings.ToLower(strings.TrimSpace(k)); !validKeyName(k) {
+				v.errorf(path, "unknown key %q", k)
+			}
+		}
+	}
+
+	if cfg.DefaultPersona != "" && cfg.DefaultPersona != "default" {
+		if _, ok := cfg.persona(cfg.DefaultPersona); !ok {
+			v.errorf("default_persona", "no persona named %q", cfg.DefaultPersona)
+		}
+	}
+	for name, p := range cfg.Personas {
+		v.checkModel("personas."+name+".model", p.Model)
+		for i, st := range p.PostProcess {
+			key := fmt.Sprintf("personas.%s.post_process[%d]", name, i)
+			if err := st.check(); err != nil {
+				v.errorf(key, "%v", err)
+			}
+			v.checkModel(key+".model", st.Model)
+		}
+	}
+
+	for _, name := range cfg.Tools.Disabled {
+		if _, ok := tools[name]; !ok && name != "all" {
+			v.warnf("tools.disabled", "unknown tool %q", name)
+		}
+	}
+	if at := cfg.Context.SummarizeAt; at != -1 && (at < 0 || at > 1) {
+		v.errorf("context.summarize_at", "must be between 0 and 1, or -1 to never summarize")
+	}
+	if cfg.Context.KeepRecent < 0 {
+		v.errorf("context.keep_recent", "must not be negative")
+	}
+	if cfg.Context.Window < 0 {
+		v.errorf("context.window", "must not be negative")
+	}
+	v.checkModel("context.model", cfg.Context.Model)
+	if t := cfg.Duplicates.Threshold; t < 0 || t > 1 {
+		v.errorf("duplicates.threshold", "must be between 0 and 1")
+	}
+	for kind, hooks := range map[string][]Hook{"send": cfg.Hooks.Send, "answer": cfg.Hooks.Answer} {
+		for i, h := range hooks {
+			if err := h.check(); err != nil {
+				v.errorf(fmt.Sprintf("hooks.%s[%d]", kind, i), "%v", err)
+			}
+		}
+	}
+	for i, w := range cfg.Notify.Webhooks {
+		if err := w.check(); err != nil {
+			v.errorf(fmt.Sprintf("notify.webhooks[%d]", i), "%v", err)
+		}
+	}
+	if _, ok := providers[cfg.Provider]; cfg.Provider != "" && !ok {
+		v.errorf("provider", "must be one of %s, not %q", strings.Join(providerNames(), ", "), cfg.Provider)
+	}
+	if cfg.Provider == "azure" && (cfg.Providers.Azure.Endpoint == "" || cfg.Providers.Azure.Model == "") {
+		v.errorf("providers.azure", "endpoint and model (the deployment) are required")
+	}
+	if u := cfg.Providers.Ollama.URL; u != "" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			v.errorf("providers.ollama.url", "must be a URL, not %q", u)
+		}
+	}
+	if cfg.Providers.Anthropic.MaxTokens < 0 {
+		v.errorf("providers.anthropic.max_tokens", "must not be negative")
+	}
+	switch cfg.Providers.Anthropic.PromptCache {
+	case "", "5m", "1h", "off":
+	default:
+		v.errorf("providers.anthropic.prompt_cache", "must be 5m, 1h or off, not %q", cfg.Providers.Anthropic.PromptCache)
+	}
+	if cfg.AutoContinue < 0 {
+		v.errorf("auto_continue", "must not be negative")
+	}
+	if cfg.HistorySize < -1 {
+		v.errorf("history_size", "must be a number of lines, or -1 to keep none")
+	}
+	if cfg.Tools.Parallel < 0 {
+		v.errorf("tools.parallel", "must not be negative")
+	}
+	if cfg.Tools.MaxResult < 0 {
+		v.errorf("tools.max_result", "must not be negative")
+	}
+	for _, dir := range cfg.Tools.Files {
+		if fi, err := os.Stat(expandHome(dir)); err != nil || !fi.IsDir() {
+			v.warnf("tools.files", "%q is not a directory", dir)
+		}
+	}
+	switch w := cfg.Tools.Web; w.Search {
+	case "":
+	case "brave":
+		if !w.APIKey.isSet() {
+			v.errorf("tools.web.api_key", "is required for brave")
+		}
+	case "searxng":
+		if u, err := url.Parse(w.URL); err != nil || u.Host == "" {
+			v.errorf("tools.web.url", "must be the URL of the SearXNG instance, not %q", w.URL)
+		}
+	default:
+		v.errorf("tools.web.search", "must be brave or searxng, not %q", w.Search)
+	}
+	if cfg.Tools.Web.MaxBytes < 0 {
+		v.errorf("tools.web.max_bytes", "must not be negative")
+	}
+	switch cfg.Tools.Weather.Units {
+	case "", "metric", "imperial":
+	default:
+		v.errorf("tools.weather.units", "must be metric or imperial, not %q", cfg.Tools.Weather.Units)
+	}
+	for name, cal := range cfg.Tools.Calendars {
+		path := "tools.calendars." + name
+		if (cal.URL == "") == (cal.File == "") {
+			v.errorf(path, "set exactly one of url and file")
+		}
+		if cal.Password.sources() > 1 {
+			v.errorf(path+".password", "set only one of value, env, file and command")
+		}
+	}
+	if ha := cfg.Tools.HomeAssistant; ha.URL != "" {
+		if !ha.Token.isSet() {
+			v.errorf("tools.home_assistant.token", "is required (a long-lived access token)")
+		}
+		for _, e := range append(slices.Clone(ha.Read), ha.Control...) {
+			if !strings.Contains(e, ".") {
+				v.errorf("tools.home_assistant", "%q is not an entity id like light.kitchen", e)
+			}
+		}
+	}
+	if m := cfg.Tools.MQTT; m.Broker != "" {
+		if u, err := url.Parse(m.Broker); err != nil || u.Host == "" {
+			v.errorf("tools.mqtt.broker", "must be a URL like tcp://host:1883, not %q", m.Broker)
+		}
+		for _, t := range m.Publish {
+			if strings.HasSuffix(t, "#") || strings.Contains(t, "/#") {
+				v.warnf("tools.mqtt.publish", "%q lets the model publish to every topic below it", t)
+			}
+		}
+	}
+
+	retention := map[string]string{"retention.default": cfg.Retention.Default, "retention.images": cfg.Retention.Images}
+	for tag, r := range cfg.Retention.Tags {
+		retention["retention.tags."+tag] = r
+	}
+	for persona, r := range cfg.Retention.Personas {
+		retention["retention.personas."+persona] = r
+	}
+	for path, r := range retention {
+		if _, err := parseRetention(r); err != nil {
+			v.errorf(path, "%v (use e.g. 24h, 30d or forever)", err)
+		}
+	}
+
+	v.checkModel("digest.model", cfg.Digest.Model)
+	v.checkModel("issues.model", cfg.Issues.Model)
+	v.checkModel("minutes.model", cfg.Minutes.Model)
+	v.checkModel("podcast.model", cfg.Podcast.Model)
+	v.checkModel("ocr.model", cfg.OCR.Model)
+	if u := cfg.Diagram.KrokiURL; u != "" && u != "none" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			v.errorf("diagram.kroki_url", "must be a URL or none, not %q", u)
+		}
+	}
+	if sp := cfg.Speech; sp.Voice != "" && !slices.Contains(speechVoices, sp.Voice) {
+		v.errorf("speech.voice", "must be one of %s, not %q", strings.Join(speechVoices, ", "), sp.Voice)
+	}
+	if sp := cfg.Speech; sp.Speed != 0 && (sp.Speed < 0.25 || sp.Speed > 4) {
+		v.errorf("speech.speed", "must be from 0.25 to 4, not %g", sp.Speed)
+	}
+	switch cfg.Speech.Format {
+	case "", "mp3", "opus", "aac", "flac", "wav":
+	default:
+		v.errorf("speech.format", "must be mp3, opus, aac, flac or wav, not %q", cfg.Speech.Format)
+	}
+	if _, _, err := net.SplitHostPort(cfg.Serve.Listen); cfg.Serve.Listen != "" && err != nil {
+		v.errorf("serve.listen", "must be host:port or :port, not %q", cfg.Serve.Listen)
+	}
+	switch cfg.OCR.Engine {
+	case "", "vision", "tesseract":
+	default:
+		v.errorf("ocr.engine", "must be vision or tesseract, not %q", cfg.OCR.Engine)
+	}
+	for i, feed := range cfg.Digest.Feeds {
+		if u, err := url.Parse(feed.URL); err != nil || u.Host == "" {
+			v.errorf(fmt.Sprintf("digest.feeds[%d].url", i), "must be a feed URL, not %q", feed.URL)
+		}
+	}
+
+	if cfg.Email.From != "" {
+		if _, err := mail.ParseAddress(cfg.Email.From); err != nil {
+			v.errorf("email.from", "%v", err)
+		}
+	}
+	if p := cfg.Email.Persona; p != "" && p != "default" {
+		if _, ok := cfg.persona(p); !ok {
+			v.errorf("email.persona", "no persona named %q", p)
+		}
+	}
+	for i, rule := range cfg.Routing {
+		key := fmt.Sprintf("routing[%d]", i)
+		if rule.Persona != "" && rule.Persona != "default" {
+			if _, ok := cfg.persona(rule.Persona); !ok {
+				v.errorf(key+".persona", "no persona named %q", rule.Persona)
+			}
+		}
+		v.checkModel(key+".model", rule.Model)
+		for _, glob := range []string{rule.Chat, rule.User} {
+			if _, err := path.Match(glob, ""); err != nil {
+				v.errorf(key, "bad pattern %q", glob)
+			}
+		}
+		if rule.Budget < 0 {
+			v.errorf(key+".budget", "must not be negative")
+		}
+	}
+	for name, limit := range cfg.Budgets.Personas {
+		if limit < 0 {
+			v.errorf("budgets.personas."+name, "must not be negative")
+		}
+		if _, ok := cfg.persona(name); !ok && name != "default" {
+			v.warnf("budgets.personas."+name, "no persona named %q", name)
+		}
+	}
+	for tag, limit := range cfg.Budgets.Tags {
+		if limit < 0 {
+			v.errorf("budgets.tags."+tag, "must not be negative")
+		}
+	}
+	if mr := cfg.ModelRouter; mr.Enabled {
+		if mr.Cheap == "" || mr.Premium == "" {
+			v.errorf("model_router", "cheap and premium are required")
+		}
+		v.checkModel("model_router.classifier", mr.Classifier)
+		v.checkModel("model_router.cheap", mr.Cheap)
+		v.checkModel("model_router.premium", mr.Premium)
+		v.checkModel("model_router.code", mr.Code)
+	}
+	if t := cfg.HTTP.IdleTimeout; t != "" {
+		if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+			v.errorf("http.idle_timeout", "must be a duration such as 90s, not %q", t)
+		}
+	}
+	if cfg.Serve.MaxQueue < 0 {
+		v.errorf("serve.max_queue", "must not be negative")
+	}
+	if cfg.HTTP.MaxIdleConns < 0 {
+		v.errorf("http.max_idle_conns", "must not be negative")
+	}
+	if i := cfg.Email.Daemon.Interval; i != "" {
+		if d, err := time.ParseDuration(i); err != nil || d <= 0 {
+			v.errorf("email.daemon.interval", "must be a duration such as 5m, not %q", i)
+		}
+	}
+
+	switch cfg.Sync.Remote {
+	case "", "dir", "webdav", "s3":
+	default:
+		v.errorf("sync.remote", "must be dir, webdav or s3, not %q", cfg.Sync.Remote)
+	}
+	if u := cfg.Sync.WebDAV.URL; u != "" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			v.errorf("sync.webdav.url", "not a valid URL: %q", u)
+		}
+	}
+}
+
+// checkModel warns about model names the price table does not know; new
+// models appear faster than this list is updated, so it is not an error.
+func (v *configValidator) checkModel(path, model string) {
+	if model == "" {
+		return
+	}
+	if _, ok := lookupModel(model); !ok {
+		v.warnf(path, "unknown model %q; context size and cost will not be tracked", model)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the environment variables that set config keys: the
+// key's path in upper case, joined by underscores, so bot.irc.server is
+// CHAT_CLI_BOT_IRC_SERVER. Lists are comma-separated. Settings inside
+// lists and maps, such as personas, need the config file.
+const envPrefix = "CHAT_CLI_"
+
+// envSetting is a config key an environment variable can set.
+type envSetting struct {
+	path []string
+	list bool
+	// str keeps values such as "123" or "true" a string.
+	str  bool
+	kind reflect.Kind
+}
+
+var yamlUnmarshaler = reflect.TypeFor[yaml.Unmarshaler]()
+
+// envSettings maps variable names to the config keys of t.
+func envSettings(t reflect.Type, prefix string, path []string, out map[string]envSetting) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		p := append(path[:len(path):len(path)], key)
+		switch ft := f.Type; {
+		case reflect.PointerTo(ft).Implements(yamlUnmarshaler):
+			// Credentials are written as a plain string.
+			out[name] = envSetting{path: p, str: true}
+		case ft.Kind() == reflect.Struct:
+			envSettings(ft, name+"_", p, out)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.String:
+			out[name] = envSetting{path: p, list: true}
+		case ft.Kind() == reflect.String:
+			out[name] = envSetting{path: p, str: true}
+		case ft.Kind() >= reflect.Bool && ft.Kind() <= reflect.Float64:
+			out[name] = envSetting{path: p, kind: ft.Kind()}
+		}
+	}
+}
+
+// applyEnv sets the keys CHAT_CLI_ variables name in the config document,
+// before it is decoded and validated. It returns the nodes it set, by
+// variable, so problems with them can be reported.
+func applyEnv(root *yaml.Node) (map[*yaml.Node]string, error) {
+	settings := map[string]envSetting{}
+	envSettings(reflect.TypeFor[Config](), envPrefix, nil, settings)
+	set := map[*yaml.Node]string{}
+	var unknown []string
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) || name == configEnv {
+			continue
+		}
+		s, ok := settings[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		value, err := s.normalize(value)
+		if err != nil {
+			return nil, fmt.Errorf("$%s: %w", name, err)
+		}
+		node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		if s.str {
+			node.Tag = "!!str"
+		}
+		if s.list {
+			node = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+				}
+			}
+		}
+		m := root
+		for _, key := range s.path[:len(s.path)-1] {
+			next := mappingValue(m, key)
+			if next == nil || next.Kind != yaml.MappingNode {
+				next = &yaml.Node{Kind: yaml.MappingNode}
+				setMappingValue(m, key, next)
+			}
+			m = next
+		}
+		setMappingValue(m, s.path[len(s.path)-1], node)
+		set[node] = name
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		fmt.Fprintf(os.Stderr, "Warning: $%s doesn't name a config key\n", name)
+	}
+	return set, nil
+}
+
+// normalize checks that the config key's type can hold value, which
+// decoding would blame on a line of the file, and spells booleans such as
+// 1 the way YAML does.
+func (s envSetting) normalize(value string) (string, error) {
+	switch {
+	case s.kind == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("must be true or false, not %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	case s.kind >= reflect.Int && s.kind <= reflect.Uintptr:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "", fmt.Errorf("must be a whole number, not %q", value)
+		}
+	case s.kind == reflect.Float32 || s.kind == reflect.Float64:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("must be a number, not %q", value)
+		}
+	}
+	return value, nil
+}
+
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// HTTPConfig tunes the connections to the API. Every client shares one
+// pool, so requests reuse an open HTTP/2 connection instead of paying
+// for a new TLS handshake each time.
+type HTTPConfig struct {
+	// MaxIdleConns is how many idle connections are kept (default 8).
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// IdleTimeout is how long an idle connection is kept (default 90s).
+	IdleTimeout string `yaml:"idle_timeout"`
+	// WarmUp connects at startup, while the first question is typed.
+	// In serve, bot and email daemon the connection is also kept open
+	// by pinging before the idle timeout.
+	WarmUp bool `yaml:"warm_up"`
+}
+
+var (
+	// httpConfig is the http section of the config.
+	httpConfig HTTPConfig
+
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+)
+
+// apiHTTPClient is the HTTP client shared by all API clients, and by
+// web_search.
+func apiHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		transport := &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          httpConfig.maxIdleConns(),
+			MaxIdleConnsPerHost:   httpConfig.maxIdleConns(),
+			IdleConnTimeout:       httpConfig.idleTimeout(),
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		}
+		httpClient = &http.Client{Transport: transport}
+	})
+	return httpClient
+}
+
+func (c HTTPConfig) maxIdleConns() int {
+	if c.MaxIdleConns <= 0 {
+		return 8
+	}
+	return c.MaxIdleConns
+}
+
+func (c HTTPConfig) idleTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.IdleTimeout); err == nil && d > 0 {
+		return d
+	}
+	return 90 * time.Second
+}
+
+// warmUp opens a connection to the API with a free request, so the first
+// real one doesn't wait for DNS and the TLS handshake. Failures are left
+// for the real request to report.
+func warmUp(client *openai.Client, model string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	client.Models.Get(ctx, model)
+}
+
+// keepWarm warms up the connection and keeps it open for as long as the
+// program runs, for the long-running modes. It does nothing unless
+// http.warm_up is set.
+func (cfg *Config) keepWarm(client *openai.Client, model string) {
+	if !cfg.HTTP.WarmUp {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.HTTP.idleTimeout() * 2 / 3)
+		defer ticker.Stop()
+		for {
+			warmUp(client, model)
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// setupConsole prepares the terminal for UTF-8 and escape sequences,
+// which Unix terminals handle already.
+func setupConsole() bool {
+	return true
+}
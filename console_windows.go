@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// setupConsole switches the console to UTF-8, so that characters such as
+// æ, ø and å survive, and turns on its handling of ANSI escape sequences,
+// which Windows 10 and later support but leave off. It reports false on
+// older consoles that lack escape sequences, which then get plain output.
+func setupConsole() bool {
+	const utf8CodePage = 65001
+	windows.SetConsoleCP(utf8CodePage)
+	windows.SetConsoleOutputCP(utf8CodePage)
+	vt := true
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		h := windows.Handle(f.Fd())
+		var mode uint32
+		if windows.GetConsoleMode(h, &mode) != nil {
+			// Redirected to a file or pipe.
+			continue
+		}
+		if windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) != nil {
+			vt = false
+		}
+	}
+	return vt
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// continuePrompt asks for the rest of an answer that hit the length
+// limit. It is sent once and not stored.
+const continuePrompt = "Your last answer was cut off. Continue exactly where it stopped, mid-sentence if need be, " +
+	"without repeating anything or adding an introduction."
+
+func init() {
+	registerCommand(&command{
+		name:  "continue",
+		usage: "/continue",
+		help:  "Get the rest of an answer that was cut off at the length limit",
+		run: func(s *session, args string) error {
+			return s.continueAnswer()
+		},
+	})
+}
+
+// continueAnswer asks the model to go on with a cut-off answer and adds
+// what it writes to the stored message, so the parts read as one.
+func (s *session) continueAnswer() error {
+	i := s.conv.lastIndex("assistant")
+	if i < 0 || i != len(s.conv.Messages)-1 || !s.conv.Messages[i].Truncated {
+		return fmt.Errorf("the last answer was not cut off")
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+
+	timer := startStats(s.model)
+	response, err := s.continuation(ctx, s.conv)
+	if err != nil {
+		s.requestFailed(err)
+		return nil
+	}
+	timer.add(response)
+	stats := timer.done()
+
+	msg := &s.conv.Messages[i]
+	msg.Content += response.content
+	msg.Truncated = response.truncated()
+	if msg.Stats != nil {
+		msg.Stats.TotalMS += stats.TotalMS
+		msg.Stats.PromptTokens += stats.PromptTokens
+		msg.Stats.CompletionTokens += stats.CompletionTokens
+		stats = msg.Stats
+	}
+	if quiet {
+		fmt.Println(forDisplay(response.content))
+	} else {
+		fmt.Printf("%s %s\n\n", paint(theme.Assistant, "Assistant (continued):"), forDisplay(response.content))
+	}
+	s.showTruncated(msg.Truncated)
+	s.showStats(stats)
+	s.save()
+	s.status.refresh(s)
+	s.runAnswerHooks(i)
+	return nil
+}
+
+// continuation requests the rest of the cut-off answer that ends conv.
+func (s *session) continuation(ctx context.Context, conv *Conversation) (*reply, error) {
+	view := &Conversation{Messages: append(slices.Clone(conv.condensed().Messages), Message{Role: "user", Content: continuePrompt})}
+	if conv.hasUntrustedSince(0) {
+		view = withSystemNote(view, untrustedNotice)
+	}
+	response, err := s.provider.Complete(ctx, s.model, view, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.recordUsage(response)
+	return response, nil
+}
+
+// autoContinue fetches the rest of a cut-off answer, up to
+// --auto-continue times, before it is shown, adding to response.
+func (s *session) autoContinue(ctx context.Context, conv *Conversation, response *reply, timer *statsTimer) error {
+	for n := 0; n < s.maxContinues && response.truncated(); n++ {
+		partial := &Conversation{Messages: append(slices.Clone(conv.Messages), Message{Role: "assistant", Content: response.content})}
+		more, err := s.continuation(ctx, partial)
+		if err != nil {
+			return err
+		}
+		timer.add(more)
+		response.content += more.content
+		response.finishReason = more.finishReason
+	}
+	return nil
+}
+
+// showTruncated tells the user that an answer stopped at the length limit.
+func (s *session) showTruncated(truncated bool) {
+	if truncated {
+		info("%s\n\n", paint(theme.Meta, decor("  ⋯ cut off at the length limit; /continue for the rest",
+			"The answer was cut off at the length limit. Type /continue for the rest.")))
+	}
+}
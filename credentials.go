@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var errNoAPIKey = errors.New("no API key found: set OPENAI_KEY or run '" + appName + " setup'")
+
+// resolveAPIKey finds the OpenAI key. OPENAI_KEY wins so a key can be
+// overridden per shell; otherwise the first configured source is used.
+func resolveAPIKey(cfg *Config) (string, error) {
+	if key := os.Getenv("OPENAI_KEY"); key != "" {
+		return key, nil
+	}
+	switch {
+	case cfg.APIKey != "":
+		return cfg.APIKey, nil
+	case cfg.APIKeyFile != "":
+		data, err := os.ReadFile(expandHome(cfg.APIKeyFile))
+		if err != nil {
+			return "", fmt.Errorf("failed to read api_key_file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case cfg.APIKeyCommand != "":
+		out, err := shellCommand(cfg.APIKeyCommand).Output()
+		if err != nil {
+			return "", fmt.Errorf("api_key_command failed: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return "", errNoAPIKey
+}
+
+// Credential is a secret in the config file. It is written either as a
+// plain string or as a mapping naming where to get it, so secrets need not
+// be stored in the file itself:
+//
+//	password: hunter2
+//	password: {env: CALENDAR_PASSWORD}
+//	password: {file: ~/.calendar-password}
+//	password: {command: pass show calendar}
+type Credential struct {
+	Value   string `yaml:"value"`
+	Env     string `yaml:"env"`
+	File    string `yaml:"file"`
+	Command string `yaml:"command"`
+}
+
+func (c *Credential) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		c.Value = n.Value
+		return nil
+	}
+	type plain Credential
+	return n.Decode((*plain)(c))
+}
+
+func (c Credential) isSet() bool {
+	return c != Credential{}
+}
+
+func (c Credential) sources() int {
+	n := 0
+	for _, s := range []string{c.Value, c.Env, c.File, c.Command} {
+		if s != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (c Credential) resolve() (string, error) {
+	switch {
+	case c.Value != "":
+		return c.Value, nil
+	case c.Env != "":
+		return os.Getenv(c.Env), nil
+	case c.File != "":
+		data, err := os.ReadFile(expandHome(c.File))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case c.Command != "":
+		out, err := shellCommand(c.Command).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", c.Command, err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return "", nil
+}
+
+// shellCommand runs a user-supplied command line through the platform
+// shell, so pipes and quoting behave as the user expects.
+func shellCommand(line string) *exec.Cmd {
+	return shellCommandContext(context.Background(), line)
+}
+
+func shellCommandContext(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "stats",
+		usage: "stats [--days n] [--tui] | stats export [--month 2024-05]",
+		help:  "Chart the archive's usage, or export a month's costs per model and tag as CSV or PDF",
+		run:   runStats,
+	})
+}
+
+// statsRanges are the periods, in days, the dashboard cycles through;
+// 0 is all time.
+var statsRanges = []int{7, 30, 90, 365, 0}
+
+// archiveStats is what the stored conversations say about how the chat
+// was used over a period. Tokens and cost come from the stats stored
+// with each answer, so answers from before they were recorded count as
+// messages only.
+type archiveStats struct {
+	days int
+	// from is the first day of the period; daily[i] is the day i days
+	// later.
+	from          time.Time
+	daily         []dayUsage
+	models        []modelUsage
+	personas      []personaUsage
+	conversations []conversationUsage
+	messages      int
+	tokens        int64
+	cost          float64
+	// cached are the prompt tokens read from the prompt cache, and saved
+	// what that saved.
+	cached     int64
+	saved      float64
+	unreadable int
+}
+
+type dayUsage struct {
+	messages int
+	tokens   int64
+	cost     float64
+}
+
+type modelUsage struct {
+	model  string
+	tokens int64
+	cost   float64
+	// priced is false for models missing from the price table.
+	priced bool
+}
+
+type personaUsage struct {
+	persona       string
+	conversations int
+}
+
+type conversationUsage struct {
+	id       string
+	first    string
+	messages int
+	tokens   int64
+}
+
+func runStats(cfg *Config, args []string) int {
+	fs := newFlagSet("stats")
+	days := fs.Int("days", 30, "the number of days to cover, counting today; 0 covers all time")
+	tui := fs.Bool("tui", false, "show a full-screen dashboard")
+	if len(args) > 0 && args[0] == "export" {
+		return runStatsExport(args[1:])
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) > 0 || *days < 0 {
+		fmt.Fprintln(os.Stderr, "Usage: stats [--days n] [--tui] | stats export [--month 2024-05] [--format csv|pdf] [-o file]")
+		return exitError
+	}
+	if *tui {
+		err := runDashboard(*days)
+		if err == nil {
+			return exitOK
+		}
+		if !errors.Is(err, errNoDashboard) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v; printing the stats instead\n", err)
+	}
+	st, err := collectStats(*days, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		width = w
+	}
+	fmt.Print(st.report(width))
+	return exitOK
+}
+
+// collectStats reads every conversation for the days up to and including
+// now's. Conversations that can't be read are counted and left out.
+func collectStats(days int, now time.Time) (*archiveStats, error) {
+	convs, unreadable, err := loadArchive()
+	if err != nil {
+		return nil, err
+	}
+	st := &archiveStats{days: days, unreadable: unreadable}
+
+	today := localDay(now)
+	st.from = today.AddDate(0, 0, 1-max(days, 1))
+	if days == 0 {
+		for _, conv := range convs {
+			for _, msg := range conv.Messages {
+				if t, err := time.Parse(time.RFC3339, msg.Timestamp); err == nil && localDay(t).Before(st.from) {
+					st.from = localDay(t)
+				}
+			}
+		}
+	}
+	st.daily = make([]dayUsage, daysBetween(st.from, today)+1)
+
+	models := map[string]*modelUsage{}
+	personas := map[string]int{}
+	for _, conv := range convs {
+		cu := conversationUsage{id: conv.ID}
+		active := false
+		for _, msg := range conv.Messages {
+			if msg.Role != "user" && msg.Role != "assistant" {
+				continue
+			}
+			cu.messages++
+			if cu.first == "" && msg.Role == "user" && !msg.Redacted {
+				cu.first = msg.Content
+			}
+			var tokens int64
+			if msg.Stats != nil {
+				tokens = msg.Stats.PromptTokens + msg.Stats.CompletionTokens
+				cu.tokens += tokens
+			}
+			t, err := time.Parse(time.RFC3339, msg.Timestamp)
+			if err != nil {
+				continue
+			}
+			i := daysBetween(st.from, localDay(t))
+			if i < 0 || i >= len(st.daily) {
+				continue
+			}
+			active = true
+			st.messages++
+			st.daily[i].messages++
+			if msg.Stats == nil {
+				continue
+			}
+			m := models[msg.Stats.Model]
+			if m == nil {
+				m = &modelUsage{model: msg.Stats.Model}
+				models[msg.Stats.Model] = m
+			}
+			m.tokens += tokens
+			st.tokens += tokens
+			st.daily[i].tokens += tokens
+			st.cached += msg.Stats.CachedTokens
+			if info, ok := lookupModel(msg.Stats.Model); ok {
+				st.saved += info.saving(msg.Stats.CachedTokens)
+				cost := info.cost(msg.Stats.tokens())
+				m.cost += cost
+				m.priced = true
+				st.cost += cost
+				st.daily[i].cost += cost
+			}
+		}
+		if active {
+			persona := cmp.Or(conv.Persona, "default")
+			personas[persona]++
+			st.conversations = append(st.conversations, cu)
+		}
+	}
+
+	for _, m := range models {
+		st.models = append(st.models, *m)
+	}
+	slices.SortFunc(st.models, func(a, b modelUsage) int {
+		return cmp.Or(cmp.Compare(b.tokens, a.tokens), cmp.Compare(a.model, b.model))
+	})
+	for p, n := range personas {
+		st.personas = append(st.personas, personaUsage{persona: p, conversations: n})
+	}
+	slices.SortFunc(st.personas, func(a, b personaUsage) int {
+		return cmp.Or(cmp.Compare(b.conversations, a.conversations), cmp.Compare(a.persona, b.persona))
+	})
+	slices.SortFunc(st.conversations, func(a, b conversationUsage) int {
+		return cmp.Or(cmp.Compare(b.messages, a.messages), cmp.Compare(b.tokens, a.tokens), cmp.Compare(a.id, b.id))
+	})
+	return st, nil
+}
+
+// loadArchive reads every stored conversation, and counts those that
+// can't be read.
+func loadArchive() ([]*Conversation, int, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+	var convs []*Conversation
+	unreadable := 0
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			unreadable++
+			continue
+		}
+		convs = append(convs, conv)
+	}
+	return convs, unreadable, nil
+}
+
+// localDay is midnight, local time, of the day t falls on.
+func localDay(t time.Time) time.Time {
+	y, m, d := t.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// daysBetween counts the calendar days from a to b, which need not be
+// 24 hours each.
+func daysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+func (st *archiveStats) period() string {
+	if st.days == 0 {
+		return "All time"
+	}
+	if st.days == 1 {
+		return "Today"
+	}
+	return fmt.Sprintf("Last %d days", st.days)
+}
+
+func (st *archiveStats) summary() string {
+	s := fmt.Sprintf("%s, %s in %s, %s tokens, $%.2f", st.period(),
+		plural(int64(st.messages), "message"), plural(int64(len(st.conversations)), "conversation"),
+		formatTokens(st.tokens), st.cost)
+	if st.cached > 0 {
+		s += fmt.Sprintf(" (%s cached tokens saved $%.2f)", formatTokens(st.cached), st.saved)
+	}
+	return s
+}
+
+// series returns one value per day.
+func (st *archiveStats) series(value func(dayUsage) float64) []float64 {
+	vals := make([]float64, len(st.daily))
+	for i, d := range st.daily {
+		vals[i] = value(d)
+	}
+	return vals
+}
+
+// peak describes the busiest day of a series.
+func (st *archiveStats) peak(vals []float64, format func(float64) string) string {
+	best, total := 0, 0.0
+	for i, v := range vals {
+		total += v
+		if v > vals[best] {
+			best = i
+		}
+	}
+	if total == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%s on %s, %s a day on average", format(vals[best]),
+		st.from.AddDate(0, 0, best).Format(time.DateOnly), format(total/float64(len(vals))))
+}
+
+func formatCount(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprint(int64(v))
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func formatCost(v float64) string {
+	return fmt.Sprintf("$%.2f", v)
+}
+
+// report is the printed form of the stats: sparklines of the days and
+// bars for the rest, or just the numbers with --a11y.
+func (st *archiveStats) report(width int) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, paint(theme.Heading, st.summary()))
+	if st.unreadable > 0 {
+		fmt.Fprintln(&b, paint(theme.Meta, fmt.Sprintf("(%s could not be read; run fsck)", plural(int64(st.unreadable), "conversation"))))
+	}
+	messages := st.series(func(d dayUsage) float64 { return float64(d.messages) })
+	costs := st.series(func(d dayUsage) float64 { return d.cost })
+	fmt.Fprintf(&b, "\n%s\n", paint(theme.Heading, "Messages per day"))
+	if !accessible {
+		fmt.Fprintf(&b, "  %s\n", paint(theme.Accent, sparkline(messages, width-4)))
+	}
+	fmt.Fprintf(&b, "  Peak %s\n", st.peak(messages, formatCount))
+	fmt.Fprintf(&b, "\n%s\n", paint(theme.Heading, "Cost per day"))
+	if !accessible {
+		fmt.Fprintf(&b, "  %s\n", paint(theme.Accent, sparkline(costs, width-4)))
+	}
+	fmt.Fprintf(&b, "  Peak %s\n", st.peak(costs, formatCost))
+	for _, section := range [][]string{
+		st.modelLines(width, 10),
+		st.personaLines(width, 10),
+		st.conversationLines(width, 10),
+	} {
+		b.WriteString("\n" + strings.Join(section, "\n") + "\n")
+	}
+	return b.String()
+}
+
+func (st *archiveStats) modelLines(width, n int) []string {
+	lines := []string{paint(theme.Heading, "Tokens per model")}
+	if len(st.models) == 0 {
+		return append(lines, paint(theme.Meta, "  no answers with stats"))
+	}
+	labelWidth := 0
+	for _, m := range st.models[:min(n, len(st.models))] {
+		labelWidth = max(labelWidth, len([]rune(m.model)))
+	}
+	labelWidth = min(labelWidth, 24)
+	top := float64(st.models[0].tokens)
+	for _, m := range st.models[:min(n, len(st.models))] {
+		value := formatTokens(m.tokens) + " tokens, "
+		if m.priced {
+			value += formatCost(m.cost)
+		} else {
+			value += "no price"
+		}
+		lines = append(lines, barLine(truncate(m.model, labelWidth), labelWidth, float64(m.tokens)/top, value, width))
+	}
+	return lines
+}
+
+func (st *archiveStats) personaLines(width, n int) []string {
+	lines := []string{paint(theme.Heading, "Personas")}
+	if len(st.personas) == 0 {
+		return append(lines, paint(theme.Meta, "  no conversations"))
+	}
+	labelWidth := 0
+	for _, p := range st.personas[:min(n, len(st.personas))] {
+		labelWidth = max(labelWidth, len([]rune(p.persona)))
+	}
+	labelWidth = min(labelWidth, 24)
+	top := float64(st.personas[0].conversations)
+	for _, p := range st.personas[:min(n, len(st.personas))] {
+		lines = append(lines, barLine(truncate(p.persona, labelWidth), labelWidth,
+			float64(p.conversations)/top, plural(int64(p.conversations), "conversation"), width))
+	}
+	return lines
+}
+
+func (st *archiveStats) conversationLines(width, n int) []string {
+	lines := []string{paint(theme.Heading, "Longest conversations")}
+	if len(st.conversations) == 0 {
+		return append(lines, paint(theme.Meta, "  no conversations"))
+	}
+	shown := st.conversations[:min(n, len(st.conversations))]
+	idWidth := 0
+	for _, c := range shown {
+		idWidth = max(idWidth, len(c.id))
+	}
+	for _, c := range shown {
+		head := fmt.Sprintf("  %-*s %4d msgs %7s tokens", idWidth, c.id, c.messages, formatTokens(c.tokens))
+		line := paint(theme.Meta, head)
+		if room := width - len(head) - 2; room > 10 && c.first != "" {
+			line += "  " + truncate(c.first, room)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// barLine is a labelled horizontal bar frac of the room left by the
+// label and value; with --a11y only the label and value are shown.
+func barLine(label string, labelWidth int, frac float64, value string, width int) string {
+	head := fmt.Sprintf("  %-*s ", labelWidth, label)
+	if accessible {
+		return head + value
+	}
+	room := max(width-len([]rune(head))-len([]rune(value))-1, 1)
+	n := max(int(math.Round(frac*float64(room))), 1)
+	return head + paint(theme.Accent, strings.Repeat(decor("█", "#"), n)) + " " + value
+}
+
+// sparkline draws vals as a row of block characters at most width wide,
+// taking the largest value of the days that share a column.
+func sparkline(vals []float64, width int) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	cols := bucket(vals, max(width, 1))
+	top := slices.Max(cols)
+	var sb strings.Builder
+	for _, v := range cols {
+		i := 0
+		if top > 0 {
+			i = int(math.Round(v / top * float64(len(blocks)-1)))
+		}
+		sb.WriteRune(blocks[i])
+	}
+	return sb.String()
+}
+
+// bucket shrinks vals to at most n values, each the largest of those it
+// stands for.
+func bucket(vals []float64, n int) []float64 {
+	if len(vals) <= n {
+		return vals
+	}
+	out := make([]float64, n)
+	for i, v := range vals {
+		j := i * n / len(vals)
+		out[j] = max(out[j], v)
+	}
+	return out
+}
+
+// brailleChart draws vals as a line chart in braille characters, each
+// holding 2×4 dots, width cells wide and height rows high.
+func brailleChart(vals []float64, width, height int) []string {
+	// The dot in column x (0-1) and row y (0-3) of a cell.
+	bits := [2][4]rune{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+	cells := make([][]rune, height)
+	for i := range cells {
+		cells[i] = []rune(strings.Repeat("⠀", width))
+	}
+	dotsX, dotsY := width*2, height*4
+	// Stretch short series across the chart; shrink long ones.
+	points := make([]float64, dotsX)
+	if len(vals) <= dotsX {
+		for x := range points {
+			points[x] = vals[min(x*len(vals)/dotsX, len(vals)-1)]
+		}
+	} else {
+		points = bucket(vals, dotsX)
+	}
+	top := slices.Max(points)
+	prev := -1
+	for x, v := range points {
+		y := 0
+		if top > 0 {
+			y = int(math.Round(v / top * float64(dotsY-1)))
+		}
+		// Join each point to the last with a vertical stroke.
+		lo, hi := y, y
+		if prev >= 0 {
+			lo, hi = min(y, prev), max(y, prev)
+		}
+		for dy := lo; dy <= hi; dy++ {
+			row := dotsY - 1 - dy
+			cells[row/4][x/2] |= bits[x%2][row%4]
+		}
+		prev = y
+	}
+	lines := make([]string, height)
+	for i, row := range cells {
+		lines[i] = string(row)
+	}
+	return lines
+}
+
+// errNoDashboard is returned by runDashboard when there is no terminal
+// to draw it on.
+var errNoDashboard = errors.New("the dashboard needs a terminal")
+
+// runDashboard shows the stats full screen until q is pressed. The
+// arrow keys change the period and r reads the archive again.
+func runDashboard(days int) error {
+	fd := int(os.Stdin.Fd())
+	if accessible || headless || !consoleVT || !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errNoDashboard
+	}
+	st, err := collectStats(days, time.Now())
+	if err != nil {
+		return err
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go func() {
+		in := bufio.NewReader(os.Stdin)
+		for {
+			k, err := readKey(in)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- k
+		}
+	}()
+	size := func() (int, int) {
+		w, h, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || w <= 0 || h <= 0 {
+			return 80, 24
+		}
+		return w, h
+	}
+	w, h := size()
+	os.Stdout.WriteString(st.dashboard(w, h))
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch k {
+			case "q", "esc", "ctrl+c", "ctrl+d":
+				return nil
+			case "left", "-", "h":
+				days = nextRange(days, -1)
+			case "right", "+", "l":
+				days = nextRange(days, 1)
+			case "r", "ctrl+l":
+			default:
+				continue
+			}
+			if st, err = collectStats(days, time.Now()); err != nil {
+				return err
+			}
+		case <-tick.C:
+			if nw, nh := size(); nw == w && nh == h {
+				continue
+			}
+		}
+		w, h = size()
+		os.Stdout.WriteString(st.dashboard(w, h))
+	}
+}
+
+// nextRange steps from days to the next shorter (dir < 0) or longer
+// period in statsRanges.
+func nextRange(days, dir int) int {
+	// All time is longer than any number of days.
+	length := func(d int) int {
+		if d == 0 {
+			return math.MaxInt
+		}
+		return d
+	}
+	if dir > 0 {
+		for _, r := range statsRanges {
+			if length(r) > length(days) {
+				return r
+			}
+		}
+		return days
+	}
+	for i := len(statsRanges) - 1; i >= 0; i-- {
+		if length(statsRanges[i]) < length(days) {
+			return statsRanges[i]
+		}
+	}
+	return days
+}
+
+// dashboard draws the whole screen: the daily charts on top, models and
+// personas side by side below them, then the longest conversations, and
+// a status bar at the bottom.
+func (st *archiveStats) dashboard(w, h int) string {
+	var rows []string
+	chartHeight := max(2, min(8, (h-12)/4))
+	axisWidth := 9
+	chart := func(title string, vals []float64, format func(float64) string) {
+		top := slices.Max(vals)
+		rows = append(rows, paint(theme.Heading, title)+paint(theme.Meta, "  peak "+st.peak(vals, format)))
+		for i, line := range brailleChart(vals, max(w-axisWidth-1, 10), chartHeight) {
+			label := ""
+			switch i {
+			case 0:
+				label = format(top)
+			case chartHeight - 1:
+				label = format(0)
+			}
+			rows = append(rows, paint(theme.Meta, fmt.Sprintf("%*s ", axisWidth-1, label))+"│"+paint(theme.Accent, line))
+		}
+		from, to := st.from.Format(time.DateOnly), st.from.AddDate(0, 0, len(st.daily)-1).Format(time.DateOnly)
+		gap := max(w-axisWidth-len(from)-len(to), 1)
+		rows = append(rows, paint(theme.Meta, strings.Repeat(" ", axisWidth)+from+strings.Repeat(" ", gap)+to))
+	}
+	chart("Messages per day", st.series(func(d dayUsage) float64 { return float64(d.messages) }), formatCount)
+	chart("Cost per day", st.series(func(d dayUsage) float64 { return d.cost }), formatCost)
+
+	listRows := max((h-1-len(rows)-3)/2, 1)
+	half := (w - 2) / 2
+	left := st.modelLines(half, listRows-1)
+	right := st.personaLines(w-half-2, listRows-1)
+	for i := range max(len(left), len(right)) {
+		l, r := "", ""
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		l = wrapRows(l, half)[0]
+		_, n := layout(l, math.MaxInt)
+		rows = append(rows, l+"\x1b[0m"+strings.Repeat(" ", half-n+2)+r)
+	}
+	rows = append(rows, "")
+	rows = append(rows, st.conversationLines(w, max(h-1-len(rows)-1, 0))...)
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	for i, row := range rows[:min(len(rows), h-1)] {
+		// Rows that don't fit are cut rather than wrapped.
+		fmt.Fprintf(&sb, "\x1b[%d;1H%s\x1b[0m", i+1, wrapRows(row, w)[0])
+	}
+	bar := st.summary()
+	if st.unreadable > 0 {
+		bar += fmt.Sprintf(" │ %d unreadable", st.unreadable)
+	}
+	fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[%sm%s\x1b[0m", h, theme.Status, statusBar(bar, "←/→ period · r reload · q quit", w))
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type DiagramConfig struct {
+	// KrokiURL is the rendering service used when neither mermaid-cli
+	// nor Graphviz is installed; "none" keeps diagrams local.
+	KrokiURL string `yaml:"kroki_url"`
+}
+
+const defaultKrokiURL = "https://kroki.io"
+
+const diagramPrompt = `Draw the diagram described below as %s source, using the conversation so far for context. Answer with only the source: no explanation and no code fence. Keep labels short and the layout readable.
+
+%s`
+
+func init() {
+	registerCommand(&command{
+		name:  "diagram",
+		usage: "/diagram [--dot] <description>",
+		help:  "Draw a diagram with Mermaid (or Graphviz with --dot) and save it as SVG",
+		run:   cmdDiagram,
+	})
+}
+
+func cmdDiagram(s *session, args string) error {
+	lang, language := "mermaid", "Mermaid"
+	if rest, ok := strings.CutPrefix(args, "--dot"); ok {
+		lang, language = "dot", "Graphviz DOT"
+		args = strings.TrimSpace(rest)
+	}
+	if args == "" {
+		return fmt.Errorf("usage: /diagram [--dot] <description>")
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	sent := *s.conv
+	sent.Messages = append(append([]Message{}, s.conv.Messages...), Message{Role: "user", Content: fmt.Sprintf(diagramPrompt, language, args)})
+	r, err := s.provider.Complete(ctx, s.model, &sent, nil)
+	if err != nil {
+		s.requestFailed(err)
+		return nil
+	}
+	s.recordUsage(r)
+	source := stripCodeFence(r.content)
+
+	s.conv.addMessage("user", "/diagram "+args)
+	s.conv.addMessage("assistant", "```"+lang+"\n"+source+"\n```")
+	msg := &s.conv.Messages[len(s.conv.Messages)-1]
+	svg, err := renderDiagram(ctx, lang, source, s.cfg.Diagram.KrokiURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the diagram could not be rendered: %v\n", err)
+		fmt.Println(msg.Content)
+		s.save()
+		return nil
+	}
+
+	var path string
+	if s.incognito {
+		// Incognito conversations leave nothing in the chats directory,
+		// and nothing behind once they end.
+		if path, err = s.tempFile("diagram-*.svg", svg); err != nil {
+			return err
+		}
+	} else {
+		ref, err := storeBlob(svg, "image/svg+xml")
+		if err != nil {
+			return err
+		}
+		msg.Attachments = []Attachment{{Name: "diagram.svg", Type: "image/svg+xml", Ref: ref}}
+		if path, err = s.viewable(msg.Attachments[0]); err != nil {
+			return err
+		}
+	}
+	s.save()
+	fmt.Printf("Diagram saved to %s\n", path)
+	return nil
+}
+
+// renderDiagram turns Mermaid or DOT source into SVG with mmdc or dot
+// when installed, falling back to a Kroki server.
+func renderDiagram(ctx context.Context, lang, source, krokiURL string) ([]byte, error) {
+	switch lang {
+	case "mermaid":
+		if _, err := exec.LookPath("mmdc"); err == nil {
+			return renderMermaid(ctx, source)
+		}
+	case "dot":
+		if _, err := exec.LookPath("dot"); err == nil {
+			cmd := exec.CommandContext(ctx, "dot", "-Tsvg")
+			cmd.Stdin = strings.NewReader(source)
+			return commandOutput(cmd)
+		}
+	}
+
+	if krokiURL == "none" {
+		return nil, fmt.Errorf("install mermaid-cli (mmdc) or Graphviz (dot), or set diagram.kroki_url")
+	}
+	if krokiURL == "" {
+		krokiURL = defaultKrokiURL
+	}
+	kind := map[string]string{"mermaid": "mermaid", "dot": "graphviz"}[lang]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(krokiURL, "/")+"/"+kind+"/svg", strings.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, truncate(string(body), 200))
+	}
+	return body, nil
+}
+
+func renderMermaid(ctx context.Context, source string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "chat-cli-diagram")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "diagram.mmd"), filepath.Join(dir, "diagram.svg")
+	if err := os.WriteFile(in, []byte(source), 0644); err != nil {
+		return nil, err
+	}
+	if _, err := commandOutput(exec.CommandContext(ctx, "mmdc", "--quiet", "-i", in, "-o", out)); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(out)
+}
+
+// commandOutput runs cmd and returns its stdout, or an error carrying
+// its stderr.
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(cmd.Path), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
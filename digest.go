@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DigestConfig lists the feeds the digest subcommand summarizes.
+type DigestConfig struct {
+	// Prompt is the instruction for feeds without their own.
+	Prompt string `yaml:"prompt"`
+	// Markdown, if set, is a directory to write digest-YYYY-MM-DD.md files
+	// to instead of saving a conversation.
+	Markdown string       `yaml:"markdown"`
+	Model    string       `yaml:"model"`
+	Feeds    []DigestFeed `yaml:"feeds"`
+}
+
+type DigestFeed struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url"`
+	Prompt string `yaml:"prompt"`
+}
+
+const defaultDigestPrompt = "Summarize these new feed items in a few short bullet points, most important first. " +
+	"Mention each item's title. Skip items that are pure promotion."
+
+const (
+	// digestFirstRunWindow bounds what a feed's first digest covers, so
+	// subscribing to a busy feed doesn't summarize its whole archive.
+	digestFirstRunWindow = 7 * 24 * time.Hour
+	digestMaxItems       = 20
+	digestSeenLimit      = 500
+)
+
+// digestState remembers, per feed URL, which items have been digested.
+type digestState map[string][]string
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "digest",
+		usage: "digest [--markdown dir] [--dry-run]",
+		help:  "Summarize new items from the configured RSS/Atom feeds",
+		run:   runDigest,
+	})
+}
+
+func runDigest(cfg *Config, args []string) int {
+	fs := newFlagSet("digest")
+	markdown := fs.String("markdown", cfg.Digest.Markdown, "write a markdown file to this directory instead of a conversation")
+	dryRun := fs.Bool("dry-run", false, "list new items without summarizing them")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if len(cfg.Digest.Feeds) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no feeds configured (digest.feeds in config.yaml)")
+		return exitError
+	}
+
+	state := digestState{}
+	if err := loadConfigJSON("digest-state.json", &state); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	type section struct {
+		feed  DigestFeed
+		items []feedItem
+	}
+	var sections []section
+	for _, feed := range cfg.Digest.Feeds {
+		items, err := fetchFeed(ctx, feed.URL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", feed.displayName(), err)
+			continue
+		}
+		items = state.newItems(feed.URL, items, now)
+		if len(items) == 0 {
+			continue
+		}
+		sections = append(sections, section{feed, items})
+	}
+
+	if *dryRun {
+		for _, sec := range sections {
+			fmt.Printf("%s (%d new)\n", sec.feed.displayName(), len(sec.items))
+			for _, it := range sec.items {
+				fmt.Printf("  %s\n", it.Title)
+			}
+		}
+		return exitOK
+	}
+	if len(sections) == 0 {
+		fmt.Println("No new items")
+		return exitOK
+	}
+
+	// fail reports an error here and to the notification webhooks.
+	fail := func(err error, code int) int {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		cfg.Notify.failed("digest", "", err)
+		return code
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		return fail(err, exitError)
+	}
+	model := cfg.Digest.Model
+	if model == "" {
+		model = cfg.baseModel()
+	}
+
+	conv := newConversation("Daily digest of RSS and Atom feeds.")
+	conv.addTags("digest")
+	var md strings.Builder
+	fmt.Fprintf(&md, "# Digest %s\n", now.Format("2006-01-02"))
+	for _, sec := range sections {
+		prompt := sec.feed.Prompt
+		if prompt == "" {
+			prompt = cfg.Digest.Prompt
+		}
+		if prompt == "" {
+			prompt = defaultDigestPrompt
+		}
+		items := formatFeedItems(sec.feed.displayName(), sec.items)
+		info("Summarizing %s (%d new)...\n", sec.feed.displayName(), len(sec.items))
+		r, err := ask(ctx, client, model, prompt, items)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", sec.feed.displayName(), err), exitAPIError)
+		}
+		conv.addMessage("user", "## "+sec.feed.displayName()+"\n\n"+items)
+		conv.addMessage("assistant", r.content)
+
+		fmt.Fprintf(&md, "\n## %s\n\n%s\n\nSources:\n", sec.feed.displayName(), strings.TrimSpace(r.content))
+		for _, it := range sec.items {
+			fmt.Fprintf(&md, "- [%s](%s)\n", it.Title, it.Link)
+		}
+	}
+
+	if *markdown != "" {
+		dir := expandHome(*markdown)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fail(err, exitError)
+		}
+		path := filepath.Join(dir, "digest-"+now.Format("2006-01-02")+".md")
+		if err := os.WriteFile(path, []byte(md.String()), 0644); err != nil {
+			return fail(err, exitError)
+		}
+		fmt.Printf("Digest written to: %s\n", path)
+		cfg.Notify.succeeded("digest", "", fmt.Sprintf("%d feeds summarized in %s", len(sections), path))
+	} else {
+		if err := os.MkdirAll(chatsDir, 0755); err != nil {
+			return fail(err, exitError)
+		}
+		if err := conv.save(); err != nil {
+			return fail(err, exitError)
+		}
+		fmt.Printf("Digest saved to: %s\n", conv.getFilePath())
+		cfg.Notify.succeeded("digest", conv.ID, fmt.Sprintf("%d feeds summarized", len(sections)))
+	}
+
+	for _, sec := range sections {
+		state.markSeen(sec.feed.URL, sec.items)
+	}
+	if err := saveConfigJSON("digest-state.json", state); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return exitOK
+}
+
+func (f DigestFeed) displayName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return f.URL
+}
+
+// newItems returns the items of a feed not digested before. On a feed's
+// first run only recent items count.
+func (st digestState) newItems(url string, items []feedItem, now time.Time) []feedItem {
+	seen, known := st[url]
+	var out []feedItem
+	for _, it := range items {
+		if known && slices.Contains(seen, it.ID) {
+			continue
+		}
+		if !known && !it.Published.IsZero() && now.Sub(it.Published) > digestFirstRunWindow {
+			continue
+		}
+		out = append(out, it)
+		if len(out) == digestMaxItems {
+			break
+		}
+	}
+	return out
+}
+
+func (st digestState) markSeen(url string, items []feedItem) {
+	seen := st[url]
+	for _, it := range items {
+		seen = append(seen, it.ID)
+	}
+	if len(seen) > digestSeenLimit {
+		seen = seen[len(seen)-digestSeenLimit:]
+	}
+	st[url] = seen
+}
+
+type feedItem struct {
+	ID        string
+	Title     string
+	Link      string
+	Published time.Time
+	Summary   string
+	// Enclosure is the URL of an attached media file, such as a
+	// podcast episode.
+	Enclosure string
+}
+
+// feedDoc decodes RSS 2.0, RSS 1.0 (RDF) and Atom: each fills a different
+// part of the struct.
+type feedDoc struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem `xml:"item"`
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Links     []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"date"`
+	Description string `xml:"description"`
+	Enclosure   struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+func fetchFeed(ctx context.Context, url string) ([]feedItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", appName)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data)
+}
+
+func parseFeed(data []byte) ([]feedItem, error) {
+	var doc feedDoc
+	dec := xml.NewDecoder(strings.NewReader(string(data)))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not a feed: %w", err)
+	}
+
+	var items []feedItem
+	for _, it := range append(doc.Channel.Items, doc.Items...) {
+		id := it.GUID
+		if id == "" {
+			id = it.Link
+		}
+		if id == "" {
+			id = it.Title
+		}
+		items = append(items, feedItem{
+			ID:        id,
+			Title:     strings.TrimSpace(it.Title),
+			Link:      strings.TrimSpace(it.Link),
+			Published: parseFeedTime(it.PubDate, it.Date),
+			Summary:   it.Description,
+			Enclosure: it.Enclosure.URL,
+		})
+	}
+	for _, e := range doc.Entries {
+		item := feedItem{
+			ID:        e.ID,
+			Title:     strings.TrimSpace(e.Title),
+			Published: parseFeedTime(e.Published, e.Updated),
+			Summary:   e.Summary,
+		}
+		if item.Summary == "" {
+			item.Summary = e.Content
+		}
+		for _, l := range e.Links {
+			switch {
+			case l.Rel == "enclosure":
+				item.Enclosure = l.Href
+			case (l.Rel == "" || l.Rel == "alternate") && item.Link == "":
+				item.Link = l.Href
+			}
+		}
+		if item.ID == "" {
+			item.ID = item.Link
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func parseFeedTime(values ...string) time.Time {
+	layouts := []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2006-01-02"}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// formatFeedItems renders items as plain text for the model, with HTML
+// stripped and long bodies cut short.
+func formatFeedItems(feed string, items []feedItem) string {
+	var b strings.Builder
+	for i, it := range items {
+		summary := html.UnescapeString(htmlTag.ReplaceAllString(it.Summary, " "))
+		summary = strings.Join(strings.Fields(summary), " ")
+		item := fmt.Sprintf("%s\n%s\n%s", it.Title, it.Link, truncate(summary, 1500))
+		fmt.Fprintf(&b, "%d. %s\n\n", i+1, untrusted("feed "+feed, item))
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const documentPrompt = `Write a complete, compilable %s document for the request below. Answer with only the source: no explanation and no code fence. Use only packages or features that ship with a standard installation, and write the text in your own voice as described above.`
+
+const documentTemplatePrompt = `Fill in this template, keeping its structure and preamble:
+
+%s`
+
+// compileAttempts is how many times a document that fails to compile is
+// sent back to the model with the errors.
+const compileAttempts = 2
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "document",
+		usage: "document [--typst] [--template file] [--persona name] [-o file] [--no-open] <request>",
+		help:  "Write a LaTeX or Typst document and compile it to PDF",
+		run:   runDocument,
+	})
+}
+
+func runDocument(cfg *Config, args []string) int {
+	fs := newFlagSet("document")
+	typst := fs.Bool("typst", false, "write Typst instead of LaTeX")
+	template := fs.String("template", "", "a .tex or .typ file to fill in")
+	personaName := fs.String("persona", "", "persona whose voice the document is written in")
+	output := fs.String("o", "", "the source file to write (default document.tex or document.typ)")
+	noOpen := fs.Bool("no-open", false, "don't open the PDF")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: document [--typst] [--template file] [--persona name] [-o file] [--no-open] <request>")
+		return exitError
+	}
+
+	ext := ".tex"
+	if *typst || filepath.Ext(*template) == ".typ" || filepath.Ext(*output) == ".typ" {
+		ext = ".typ"
+	}
+	source := *output
+	if source == "" {
+		source = "document" + ext
+	} else if filepath.Ext(source) != ext {
+		source = strings.TrimSuffix(source, filepath.Ext(source)) + ext
+	}
+
+	persona, err := cfg.resolvePersona(*personaName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	model := cfg.baseModel()
+	if persona.Model != "" {
+		model = persona.Model
+	}
+	language := map[string]string{".tex": "LaTeX", ".typ": "Typst"}[ext]
+	system := persona.SystemPrompt + "\n\n" + fmt.Sprintf(documentPrompt, language)
+	if *template != "" {
+		t, err := os.ReadFile(*template)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		system += "\n\n" + fmt.Sprintf(documentTemplatePrompt, t)
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	ctx := context.Background()
+	conv := &Conversation{}
+	conv.addMessage("system", system)
+	conv.addMessage("user", strings.Join(rest, " "))
+	for attempt := 0; ; attempt++ {
+		info("Writing...\n")
+		r, err := callOpenAI(ctx, client, model, conv, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+		text := stripCodeFence(r.content)
+		if err := os.WriteFile(source, []byte(text+"\n"), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+
+		pdf, err := compileDocument(ctx, source)
+		if errors.Is(err, errNoCompiler) {
+			info("Source written to %s (install %s to compile it)\n", source, map[string]string{".tex": "latexmk or pdflatex", ".typ": "typst"}[ext])
+			return exitOK
+		}
+		if err != nil {
+			if attempt+1 < compileAttempts {
+				info("Compiling failed; asking for a fix...\n")
+				conv.addMessage("assistant", text)
+				conv.addMessage("user", "It does not compile:\n\n"+truncateLines(err.Error(), 30)+"\n\nAnswer with the corrected document.")
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "The source is in %s\n", source)
+			return exitError
+		}
+
+		info("Written %s and %s\n", source, pdf)
+		if !*noOpen && !headless {
+			if err := openerFor(cfg.Open, pdf).Open(pdf); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not open %s: %v\n", pdf, err)
+			}
+		}
+		return exitOK
+	}
+}
+
+var errNoCompiler = errors.New("no compiler installed")
+
+// compileDocument builds the PDF next to the source with typst, latexmk
+// or pdflatex, whichever applies and is installed.
+func compileDocument(ctx context.Context, source string) (string, error) {
+	dir := filepath.Dir(source)
+	pdf := strings.TrimSuffix(source, filepath.Ext(source)) + ".pdf"
+	var cmd *exec.Cmd
+	switch {
+	case filepath.Ext(source) == ".typ":
+		if _, err := exec.LookPath("typst"); err != nil {
+			return "", errNoCompiler
+		}
+		cmd = exec.CommandContext(ctx, "typst", "compile", source, pdf)
+	case hasCommand("latexmk"):
+		cmd = exec.CommandContext(ctx, "latexmk", "-pdf", "-interaction=nonstopmode", "-halt-on-error", "-outdir="+dir, source)
+	case hasCommand("pdflatex"):
+		cmd = exec.CommandContext(ctx, "pdflatex", "-interaction=nonstopmode", "-halt-on-error", "-output-directory="+dir, source)
+	default:
+		return "", errNoCompiler
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%s failed:\n%s", filepath.Base(cmd.Path), compilerErrors(string(out)))
+	}
+	return pdf, nil
+}
+
+// compilerErrors picks the error lines out of compiler output, which for
+// LaTeX is mostly noise.
+func compilerErrors(out string) string {
+	var errs []string
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "!") || strings.HasPrefix(l, "error:") || strings.Contains(l, ":error:") {
+			end := min(i+3, len(lines))
+			errs = append(errs, lines[i:end]...)
+		}
+	}
+	if len(errs) == 0 {
+		return strings.TrimSpace(out)
+	}
+	return strings.Join(errs, "\n")
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"golang.org/x/term"
+)
+
+// DuplicatesConfig turns on the check for questions asked before. It
+// compares embeddings, so rewordings of a question are found too.
+type DuplicatesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Threshold is the cosine similarity that counts as the same
+	// question (default 0.9).
+	Threshold float64 `yaml:"threshold"`
+	// Model is the embedding model (default text-embedding-3-small).
+	Model string `yaml:"model"`
+}
+
+const (
+	embeddingDimensions = 256
+	// minQuestionWords keeps greetings and "thanks" from matching.
+	minQuestionWords = 4
+)
+
+// questionIndex caches the embeddings of past questions by the hash of
+// their text, in question-index.json in the data directory, so each
+// question is only embedded once.
+type questionIndex struct {
+	Model   string               `json:"model"`
+	Vectors map[string][]float32 `json:"vectors"`
+}
+
+// questionCache keeps the questions read from each conversation file,
+// with its modification time, so that a session reads the archive again
+// only where it changed.
+type questionCache map[string]questionFile
+
+type questionFile struct {
+	modTime   time.Time
+	questions []pastQuestion
+}
+
+// pastQuestion is a question from the archive and the answer it got.
+type pastQuestion struct {
+	conv     string
+	asked    string
+	question string
+	answer   string
+}
+
+func (c DuplicatesConfig) threshold() float64 {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return 0.9
+}
+
+func (c DuplicatesConfig) model() string {
+	if c.Model != "" {
+		return c.Model
+	}
+	return string(openai.EmbeddingModelTextEmbedding3Small)
+}
+
+// confirmNotDuplicate looks for an earlier question like text and, if
+// there is one, shows its answer and asks whether to send anyway. Only
+// interactive sessions are asked; failures never hold a message up.
+func (s *session) confirmNotDuplicate(text string) bool {
+	dc := s.cfg.Duplicates
+	if !dc.Enabled || s.incognito || len(strings.Fields(text)) < minQuestionWords || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return true
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	past, err := s.findDuplicate(ctx, text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: duplicate check failed: %v\n", err)
+		return true
+	}
+	if past == nil {
+		return true
+	}
+	date := past.asked
+	if t, err := time.Parse(time.RFC3339, past.asked); err == nil {
+		date = t.Local().Format("2 Jan 2006")
+	}
+	fmt.Printf("%s\n  %s\n%s\n  %s\n",
+		paint(theme.Meta, fmt.Sprintf("You asked this on %s (%s):", date, past.conv)), truncate(past.question, 200),
+		paint(theme.Meta, "The answer was:"), truncate(forDisplay(past.answer), 400))
+	answer, err := s.input.ReadLine("Send anyway? [y/N] ")
+	if err != nil || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		info("Not sent; show %s has the whole conversation\n", past.conv)
+		return false
+	}
+	return true
+}
+
+// findDuplicate returns the most similar earlier question above the
+// threshold, or nil.
+func (s *session) findDuplicate(ctx context.Context, text string) (*pastQuestion, error) {
+	dc := s.cfg.Duplicates
+	if s.questions == nil {
+		s.questions = questionCache{}
+	}
+	questions, err := archiveQuestions(s.questions)
+	if err != nil {
+		return nil, err
+	}
+	idx := loadQuestionIndex(dc.model())
+	var missing []string
+	for _, q := range questions {
+		if _, ok := idx.Vectors[sha256Hex([]byte(q.question))]; !ok {
+			missing = append(missing, q.question)
+		}
+	}
+	missing = append(missing, text)
+	// The API takes at most 2048 inputs per request.
+	for len(missing) > 0 {
+		batch := missing[:min(len(missing), 2048)]
+		missing = missing[len(batch):]
+		vectors, err := embedTexts(ctx, s.client, dc.model(), batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vectors {
+			idx.Vectors[sha256Hex([]byte(batch[i]))] = v
+		}
+	}
+	idx.prune(questions, text)
+	if err := idx.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save the question index: %v\n", err)
+	}
+
+	query := idx.Vectors[sha256Hex([]byte(text))]
+	var best *pastQuestion
+	bestScore := dc.threshold()
+	for i, q := range questions {
+		if q.conv == s.conv.ID {
+			continue
+		}
+		if score := cosine(query, idx.Vectors[sha256Hex([]byte(q.question))]); score >= bestScore {
+			best, bestScore = &questions[i], score
+		}
+	}
+	return best, nil
+}
+
+// archiveQuestions collects the answered questions in the saved
+// conversations, reading only the files that changed since they were put
+// in cache.
+func archiveQuestions(cache questionCache) ([]pastQuestion, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		return nil, err
+	}
+	var questions []pastQuestion
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		seen[e.Name()] = true
+		cached, ok := cache[e.Name()]
+		if !ok || !cached.modTime.Equal(fi.ModTime()) {
+			conv, err := loadConversation(e.Name())
+			if err != nil {
+				continue
+			}
+			cached = questionFile{modTime: fi.ModTime(), questions: conversationQuestions(conv)}
+			cache[e.Name()] = cached
+		}
+		questions = append(questions, cached.questions...)
+	}
+	for name := range cache {
+		if !seen[name] {
+			delete(cache, name)
+		}
+	}
+	return questions, nil
+}
+
+// conversationQuestions returns the answered questions in a conversation.
+func conversationQuestions(conv *Conversation) []pastQuestion {
+	var questions []pastQuestion
+	for i, msg := range conv.Messages {
+		if msg.Role != "user" || msg.Redacted || len(strings.Fields(msg.Content)) < minQuestionWords {
+			continue
+		}
+		for _, next := range conv.Messages[i+1:] {
+			if next.Role == "user" {
+				break
+			}
+			if next.Role == "assistant" && next.Content != "" && !next.Redacted {
+				questions = append(questions, pastQuestion{conv: conv.ID, asked: msg.Timestamp, question: msg.Content, answer: next.Content})
+				break
+			}
+		}
+	}
+	return questions
+}
+
+func embedTexts(ctx context.Context, client *openai.Client, model string, texts []string) ([][]float32, error) {
+	// The start of a long question says enough about it, and keeps
+	// within the model's input limit.
+	inputs := make([]string, len(texts))
+	for i, text := range texts {
+		inputs[i] = validUTF8Prefix(text, 8000)
+	}
+	resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input:      openai.F[openai.EmbeddingNewParamsInputUnion](openai.EmbeddingNewParamsInputArrayOfStrings(inputs)),
+		Model:      openai.F(openai.EmbeddingModel(model)),
+		Dimensions: openai.F(int64(embeddingDimensions)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, errors.New("the embeddings response doesn't match the request")
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		v := make([]float32, len(d.Embedding))
+		for i, x := range d.Embedding {
+			v[i] = float32(x)
+		}
+		vectors[d.Index] = v
+	}
+	return vectors, nil
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func questionIndexPath() string {
+	return filepath.Join(dataDir, "question-index.json")
+}
+
+// loadQuestionIndex reads the cached embeddings, starting afresh if they
+// were made with another model.
+func loadQuestionIndex(model string) *questionIndex {
+	idx := &questionIndex{}
+	if data, err := os.ReadFile(questionIndexPath()); err == nil {
+		json.Unmarshal(data, idx)
+	}
+	if idx.Model != model || idx.Vectors == nil {
+		idx = &questionIndex{Model: model, Vectors: map[string][]float32{}}
+	}
+	return idx
+}
+
+// prune drops the embeddings of questions that are no longer in the
+// archive, redacted or deleted, keeping those of keep.
+func (idx *questionIndex) prune(questions []pastQuestion, keep ...string) {
+	live := map[string]bool{}
+	for _, q := range questions {
+		live[sha256Hex([]byte(q.question))] = true
+	}
+	for _, text := range keep {
+		live[sha256Hex([]byte(text))] = true
+	}
+	for hash := range idx.Vectors {
+		if !live[hash] {
+			delete(idx.Vectors, hash)
+		}
+	}
+}
+
+// pruneQuestionIndex drops the embeddings of questions no longer in the
+// archive from question-index.json, after messages were redacted.
+func pruneQuestionIndex() error {
+	data, err := os.ReadFile(questionIndexPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	idx := &questionIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return os.Remove(questionIndexPath())
+	}
+	questions, err := archiveQuestions(questionCache{})
+	if err != nil {
+		return err
+	}
+	idx.prune(questions)
+	return idx.save()
+}
+
+func (idx *questionIndex) save() error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(questionIndexPath(), data, 0600)
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// lineReader reads one logical line of user input. It returns io.EOF when
+// input is exhausted. Typed reports whether the last line was typed at a
+// terminal, rather than piped in or pasted.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Typed() bool
+}
+
+// newLineReader returns the interactive editor when stdin and stdout are
+// terminals, and a plain line scanner otherwise (pipes, --quiet).
+func newLineReader(cfg *Config) (lineReader, error) {
+	if quiet || accessible || headless || !consoleVT || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		// A terminal in --quiet mode still marks pastes, so a pasted stack
+		// trace arrives as one message. Accessibility mode sends no escape
+		// sequences at all.
+		paste := !accessible && consoleVT && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+		return &scanReader{scanner: scanner, paste: paste, terminal: term.IsTerminal(int(os.Stdin.Fd()))}, nil
+	}
+	km, err := newKeymap(cfg.Keybindings)
+	if err != nil {
+		return nil, err
+	}
+	return &editor{
+		in:   bufio.NewReader(os.Stdin),
+		out:  os.Stdout,
+		fd:   int(os.Stdin.Fd()),
+		keys: km,
+	}, nil
+}
+
+type scanReader struct {
+	scanner *bufio.Scanner
+	// paste turns on bracketed paste, so pasted lines are read as one.
+	paste bool
+	// terminal is whether stdin is one; pasted is whether the last line
+	// was.
+	terminal, pasted bool
+}
+
+// Bracketed paste: the terminal wraps pasted text in pasteStart and
+// pasteEnd once enabled with pasteOn.
+const (
+	pasteOn    = "\x1b[?2004h"
+	pasteOff   = "\x1b[?2004l"
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+func (r *scanReader) ReadLine(prompt string) (string, error) {
+	info("%s", prompt)
+	if r.paste {
+		fmt.Print(pasteOn)
+		defer fmt.Print(pasteOff)
+	}
+	line, err := r.next()
+	r.pasted = strings.Contains(line, pasteStart)
+	if err != nil || !r.pasted {
+		return line, err
+	}
+	// Gather the lines of the paste, which the terminal sent as one.
+	lines := []string{line}
+	for !strings.Contains(line, pasteEnd) {
+		if line, err = r.next(); err != nil {
+			break
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+	return strings.NewReplacer(pasteStart, "", pasteEnd, "").Replace(text), nil
+}
+
+func (r *scanReader) Typed() bool { return r.terminal && !r.pasted }
+
+func (r *scanReader) next() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editor is a small raw-mode line editor driven by a keymap.
+type editor struct {
+	in   *bufio.Reader
+	out  io.Writer
+	fd   int
+	keys *keymap
+
+	// onCopyLast is invoked for the copy-last action without leaving the
+	// line being edited.
+	onCopyLast func()
+	// afterRender redraws screen furniture, such as the status line, that
+	// clearing below the prompt erases.
+	afterRender func()
+	// history is browsed with the up and down arrows; nil has none.
+	history *inputHistory
+
+	// recall is the history entry being shown, len(history) for the line
+	// being typed, which draft keeps while browsing.
+	recall int
+	draft  []rune
+
+	buf       []rune
+	pos       int
+	normal    bool
+	cursorRow int
+	// pasted is whether anything was pasted into the line.
+	pasted bool
+}
+
+var errCancelled = errors.New("cancelled")
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(e.fd, state)
+	fmt.Fprint(e.out, pasteOn)
+	defer fmt.Fprint(e.out, pasteOff)
+
+	e.buf, e.pos, e.normal, e.cursorRow = nil, 0, false, 0
+	e.pasted = false
+	e.resetRecall()
+	e.render(prompt)
+
+	for {
+		k, err := readKey(e.in)
+		if err != nil {
+			return "", err
+		}
+		if k == "paste" {
+			text, err := readPaste(e.in)
+			if err != nil {
+				return "", err
+			}
+			if !e.normal {
+				e.insert([]rune(text)...)
+				e.pasted = true
+			}
+			e.render(prompt)
+			continue
+		}
+		line, done, err := e.handle(k, prompt)
+		if errors.Is(err, errCancelled) {
+			e.pos = len(e.buf)
+			e.render(prompt)
+			fmt.Fprint(e.out, "^C\r\n")
+			e.buf, e.pos, e.normal, e.cursorRow = nil, 0, false, 0
+			e.pasted = false
+			e.resetRecall()
+			e.render(prompt)
+			continue
+		}
+		if err != nil || done {
+			return line, err
+		}
+		e.render(prompt)
+	}
+}
+
+func (e *editor) Typed() bool { return !e.pasted }
+
+func (e *editor) handle(k, prompt string) (line string, done bool, err error) {
+	bindings := e.keys.insert
+	if e.normal {
+		bindings = e.keys.normal
+	}
+	action, bound := bindings[k]
+	if !bound {
+		if !e.normal && isPrintableKey(k) {
+			e.insert([]rune(k)...)
+		}
+		return "", false, nil
+	}
+
+	switch action {
+	case actSend:
+		// Without bracketed paste, a pasted newline arrives with the
+		// rest of the paste right behind it, which typing never does.
+		if k == "enter" && e.in.Buffered() > 0 && !e.normal {
+			e.insert('\n')
+			e.pasted = true
+			return "", false, nil
+		}
+		return e.finish(prompt), true, nil
+	case actNewline:
+		e.insert('\n')
+	case actCancel:
+		return "", false, errCancelled
+	case actEOF:
+		if len(e.buf) == 0 {
+			fmt.Fprint(e.out, "\r\n")
+			return "", true, io.EOF
+		}
+		e.deleteAt(e.pos)
+	case actRetry:
+		if len(e.buf) == 0 {
+			e.buf = []rune("/retry")
+			return e.finish(prompt), true, nil
+		}
+	case actCopyLast:
+		if e.onCopyLast != nil {
+			e.onCopyLast()
+		}
+	case actHistoryPrev:
+		if !e.lineUp() {
+			e.recallEntry(e.recall - 1)
+		}
+	case actHistoryNext:
+		if !e.lineDown() {
+			e.recallEntry(e.recall + 1)
+		}
+	case actLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case actRight:
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case actHome:
+		e.pos = 0
+	case actEnd:
+		e.pos = len(e.buf)
+	case actWordLeft:
+		e.pos = e.wordStart()
+	case actWordRight:
+		for e.pos < len(e.buf) && !unicode.IsSpace(e.buf[e.pos]) {
+			e.pos++
+		}
+		for e.pos < len(e.buf) && unicode.IsSpace(e.buf[e.pos]) {
+			e.pos++
+		}
+	case actBackspace:
+		if e.pos > 0 {
+			e.pos--
+			e.deleteAt(e.pos)
+		}
+	case actDelete:
+		e.deleteAt(e.pos)
+	case actKillEnd:
+		e.buf = e.buf[:e.pos]
+	case actKillStart:
+		e.buf = append([]rune{}, e.buf[e.pos:]...)
+		e.pos = 0
+	case actKillWord:
+		start := e.wordStart()
+		e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+		e.pos = start
+	case actClearScreen:
+		fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		e.cursorRow = 0
+	case actNormalMode:
+		e.normal = true
+		if e.pos > 0 {
+			e.pos--
+		}
+	case actInsertMode:
+		e.normal = false
+	case actAppend:
+		e.normal = false
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case actAppendEnd:
+		e.normal = false
+		e.pos = len(e.buf)
+	case actInsertStart:
+		e.normal = false
+		e.pos = 0
+	case actSubstituteLn:
+		e.normal = false
+		e.buf, e.pos = nil, 0
+	}
+	return "", false, nil
+}
+
+func (e *editor) insert(r ...rune) {
+	tail := append(r, e.buf[e.pos:]...)
+	e.buf = append(e.buf[:e.pos], tail...)
+	e.pos += len(r)
+}
+
+func (e *editor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+func (e *editor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// resetRecall starts browsing the history from the bottom again.
+func (e *editor) resetRecall() {
+	e.recall, e.draft = 0, nil
+	if e.history != nil {
+		e.recall = len(e.history.entries)
+	}
+}
+
+// recallEntry shows history entry i, or past the newest entry the line
+// that was being typed.
+func (e *editor) recallEntry(i int) {
+	if e.history == nil || i < 0 || i > len(e.history.entries) || i == e.recall {
+		return
+	}
+	if e.recall == len(e.history.entries) {
+		e.draft = e.buf
+	}
+	e.recall = i
+	if i == len(e.history.entries) {
+		e.buf = e.draft
+	} else {
+		e.buf = []rune(e.history.entries[i])
+	}
+	e.pos = len(e.buf)
+	if e.normal && e.pos > 0 {
+		e.pos--
+	}
+}
+
+// lineUp moves the cursor to the line above in a buffer of several lines,
+// keeping its column where it can. It reports false on the first line.
+func (e *editor) lineUp() bool {
+	start := e.lineStart(e.pos)
+	if start == 0 {
+		return false
+	}
+	prev := e.lineStart(start - 1)
+	e.pos = min(prev+e.pos-start, start-1)
+	return true
+}
+
+// lineDown is lineUp for the line below.
+func (e *editor) lineDown() bool {
+	end := e.pos
+	for end < len(e.buf) && e.buf[end] != '\n' {
+		end++
+	}
+	if end == len(e.buf) {
+		return false
+	}
+	next := end + 1
+	nextEnd := next
+	for nextEnd < len(e.buf) && e.buf[nextEnd] != '\n' {
+		nextEnd++
+	}
+	e.pos = min(next+e.pos-e.lineStart(e.pos), nextEnd)
+	return true
+}
+
+// lineStart returns where the line holding position i begins.
+func (e *editor) lineStart(i int) int {
+	for i > 0 && e.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// finish redraws the line with the cursor at the end and moves to a fresh
+// row, leaving the submitted text on screen. The line goes in the history.
+func (e *editor) finish(prompt string) string {
+	e.pos = len(e.buf)
+	e.render(prompt)
+	fmt.Fprint(e.out, "\r\n")
+	e.history.add(string(e.buf))
+	return string(e.buf)
+}
+
+// render redraws the prompt and buffer in place, accounting for embedded
+// newlines and soft wrapping at the terminal width.
+func (e *editor) render(prompt string) {
+	width, _, err := term.GetSize(e.fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	text := prompt + string(e.buf)
+
+	var sb strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", e.cursorRow)
+	}
+	sb.WriteString("\r\x1b[J")
+	sb.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	endRow, endCol := layout(text, width)
+	if endCol == width {
+		sb.WriteString("\r\n")
+		endRow, endCol = endRow+1, 0
+	}
+	curRow, curCol := layout(prompt+string(e.buf[:e.pos]), width)
+	if curCol == width {
+		curRow, curCol = curRow+1, 0
+	}
+	if endRow > curRow {
+		fmt.Fprintf(&sb, "\x1b[%dA", endRow-curRow)
+	}
+	sb.WriteString("\r")
+	if curCol > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dC", curCol)
+	}
+	e.cursorRow = curRow
+
+	fmt.Fprint(e.out, sb.String())
+	if e.afterRender != nil {
+		e.afterRender()
+	}
+}
+
+// layout returns the row and column the cursor ends at after printing s
+// from column zero on a terminal of the given width. ANSI escape
+// sequences take no space.
+func layout(s string, width int) (row, col int) {
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case inEscape:
+			if unicode.IsLetter(r) {
+				inEscape = false
+			}
+			continue
+		case r == '\x1b':
+			inEscape = true
+			continue
+		case r == '\n':
+			row, col = row+1, 0
+			continue
+		}
+		if col == width {
+			row, col = row+1, 0
+		}
+		col++
+	}
+	return row, col
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig sets up the email subcommand: where mail is read from and
+// sent through, and how replies should sound.
+type EmailConfig struct {
+	// From is the sender address, e.g. "Ada Lovelace <ada@example.com>".
+	From string `yaml:"from"`
+	// Persona drafts the replies; Tone is added to its instructions.
+	Persona string      `yaml:"persona"`
+	Tone    string      `yaml:"tone"`
+	IMAP    MailServer  `yaml:"imap"`
+	SMTP    MailServer  `yaml:"smtp"`
+	Daemon  EmailDaemon `yaml:"daemon"`
+}
+
+type MailServer struct {
+	Host     string     `yaml:"host"`
+	Port     int        `yaml:"port"`
+	Username string     `yaml:"username"`
+	Password Credential `yaml:"password"`
+	// Mailbox is the IMAP folder to search; default INBOX.
+	Mailbox string `yaml:"mailbox"`
+}
+
+const emailDraftPrompt = "You draft email replies on the user's behalf. Reply to the email below. " +
+	"Write only the body of the reply: no subject line, no quoted original, no commentary."
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "email",
+		usage: "email reply <file.eml> | --imap <search> | email daemon",
+		help:  "Draft a reply to an email, edit it and send it via SMTP, or answer mail unattended",
+		run:   runEmail,
+	})
+}
+
+func runEmail(cfg *Config, args []string) int {
+	if len(args) > 0 && args[0] == "daemon" {
+		return runEmailDaemon(cfg, args[1:])
+	}
+	fs := newFlagSet("email")
+	search := fs.String("imap", "", "IMAP search criteria (e.g. 'FROM alice UNSEEN'); replies to the newest match")
+	personaName := fs.String("persona", cfg.Email.Persona, "persona that drafts the reply")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) == 0 || rest[0] != "reply" || (len(rest) == 2) == (*search != "") || len(rest) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: email reply <file.eml> | email reply --imap <search>")
+		return exitError
+	}
+
+	var raw []byte
+	if *search != "" {
+		raw, err = fetchIMAPMessage(cfg.Email.IMAP, *search)
+	} else {
+		raw, err = os.ReadFile(rest[1])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not an email message: %v\n", err)
+		return exitError
+	}
+	body, err := plainTextBody(msg.Header, msg.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	persona, err := cfg.resolvePersona(*personaName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	model := cfg.baseModel()
+	if persona.Model != "" {
+		model = persona.Model
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	system := persona.SystemPrompt + "\n\n" + emailDraftPrompt + "\n\n" + untrustedNotice
+	if cfg.Email.Tone != "" {
+		system += "\n\nTone: " + cfg.Email.Tone
+	}
+	conv := newConversation(system)
+	if *personaName != "" && *personaName != "default" {
+		conv.Persona = *personaName
+	}
+	conv.addTags("email")
+	dec := new(mime.WordDecoder)
+	subject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+	from, _ := dec.DecodeHeader(msg.Header.Get("From"))
+	conv.addMessage("user", untrusted("email", fmt.Sprintf("From: %s\nSubject: %s\n\n%s", from, subject, strings.TrimSpace(body))))
+
+	fmt.Printf("From:    %s\nSubject: %s\n\n%s\n\n", from, subject, truncateLines(body, 20))
+
+	ctx := context.Background()
+	w := &wizard{in: bufio.NewReader(os.Stdin)}
+	var draft string
+	for {
+		if draft == "" {
+			info("Drafting...\n")
+			r, err := callOpenAI(ctx, client, model, conv, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitAPIError
+			}
+			draft = strings.TrimSpace(r.content)
+			conv.addMessage("assistant", draft)
+		}
+		fmt.Printf("%s\n%s\n\n", paint(theme.Assistant, "Draft:"), draft)
+
+		choice, err := w.ask("[s]end, [e]dit, [r]evise, [q]uit", "")
+		if err != nil {
+			return exitError
+		}
+		switch strings.ToLower(choice) {
+		case "s", "send":
+			if code := sendReply(cfg.Email, msg.Header, subject, draft, w); code != exitOK {
+				return code
+			}
+			saveEmailConversation(conv)
+			return exitOK
+		case "e", "edit":
+			edited, err := externalEdit(draft)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			draft = strings.TrimSpace(edited)
+			conv.addMessage("assistant", draft)
+		case "r", "revise":
+			how, err := w.ask("How should it change?", "")
+			if err != nil {
+				return exitError
+			}
+			if how != "" {
+				conv.addMessage("user", how)
+				draft = ""
+			}
+		case "q", "quit":
+			saveEmailConversation(conv)
+			return exitOK
+		}
+	}
+}
+
+func saveEmailConversation(conv *Conversation) {
+	err := os.MkdirAll(chatsDir, 0755)
+	if err == nil {
+		err = conv.save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: conversation not saved: %v\n", err)
+		return
+	}
+	info("Conversation saved to: %s\n", conv.getFilePath())
+}
+
+func truncateLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n[... %d more lines]", len(lines)-n)
+}
+
+// plainTextBody returns the text/plain part of a message, decoding
+// transfer encodings. HTML-only mail is returned with tags stripped.
+func plainTextBody(h mail.Header, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	body = decodeTransfer(h.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var htmlPart string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := plainTextBody(mail.Header(part.Header), part)
+			if err != nil {
+				continue
+			}
+			ct := part.Header.Get("Content-Type")
+			if strings.HasPrefix(ct, "text/html") {
+				htmlPart = text
+				continue
+			}
+			if text != "" && !strings.HasPrefix(ct, "application/") {
+				return text, nil
+			}
+		}
+		return htmlPart, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "text/html" {
+		return strings.TrimSpace(htmlTag.ReplaceAllString(string(data), "")), nil
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", nil
+	}
+	return string(data), nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
+
+// sendReply builds the reply, asks for confirmation and sends it.
+func sendReply(cfg EmailConfig, orig mail.Header, subject, body string, w *wizard) int {
+	if cfg.SMTP.Host == "" || cfg.From == "" {
+		fmt.Fprintln(os.Stderr, "Error: email.smtp.host and email.from must be set to send")
+		return exitError
+	}
+	to := orig.Get("Reply-To")
+	if to == "" {
+		to = orig.Get("From")
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot reply to %q: %v\n", to, err)
+		return exitError
+	}
+	sender, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: email.from: %v\n", err)
+		return exitError
+	}
+
+	answer, err := w.ask(fmt.Sprintf("Send to %s? (y/N)", rcpt.String()), "")
+	if err != nil || !strings.EqualFold(answer, "y") {
+		fmt.Println("Not sent")
+		return exitOK
+	}
+
+	msg := replyMessage(sender, rcpt, orig, subject, body)
+	if err := sendSMTP(cfg.SMTP, sender.Address, rcpt.Address, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: sending failed: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Sent to %s\n", rcpt.String())
+	return exitOK
+}
+
+// replyMessage formats a plain-text reply to orig, threaded with it.
+func replyMessage(sender, rcpt *mail.Address, orig mail.Header, subject, body string) []byte {
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	var msg bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&msg, "%s: %s\r\n", k, v) }
+	header("From", sender.String())
+	header("To", rcpt.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", newEmailMessageID(sender.Address))
+	if id := orig.Get("Message-ID"); id != "" {
+		header("In-Reply-To", id)
+		header("References", strings.TrimSpace(orig.Get("References")+" "+id))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+	return msg.Bytes()
+}
+
+func newEmailMessageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+	return fmt.Sprintf("<%s.%s@%s>", strconv.FormatInt(time.Now().Unix(), 36), hex.EncodeToString(b), domain)
+}
+
+// sendSMTP delivers msg. Port 465 uses implicit TLS; other ports upgrade
+// with STARTTLS, which net/smtp requires before it will send a password.
+func sendSMTP(s MailServer, from, to string, msg []byte) error {
+	port := s.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	var c *smtp.Client
+	if port == 465 {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.Host})
+		if err != nil {
+			return err
+		}
+		if c, err = smtp.NewClient(conn, s.Host); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if c, err = smtp.Dial(addr); err != nil {
+			return err
+		}
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	defer c.Close()
+
+	if s.Username != "" {
+		password, err := s.Password.resolve()
+		if err != nil {
+			return fmt.Errorf("password: %w", err)
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.Username, password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// externalEdit opens text in $VISUAL or $EDITOR and returns the result.
+func externalEdit(text string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	f, err := os.CreateTemp("", appName+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	cmd := shellCommand(editor + " " + shellQuote(f.Name()))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
+
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
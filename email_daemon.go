@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// EmailDaemon configures email daemon, which answers incoming mail on its
+// own.
+type EmailDaemon struct {
+	// Interval is how often the mailbox is checked (default 2m).
+	Interval string `yaml:"interval"`
+	// Search selects the mail to answer (default UNSEEN). Answered mail
+	// is marked as seen.
+	Search string `yaml:"search"`
+	// Allow lists the addresses or @domains that get answers. If empty,
+	// everyone does.
+	Allow []string `yaml:"allow"`
+}
+
+const emailDaemonPrompt = "You answer email on the user's behalf. Reply to the latest email in the thread. " +
+	"Write only the body of the reply: no subject line, no quoted original, no commentary."
+
+func runEmailDaemon(cfg *Config, args []string) int {
+	fs := newFlagSet("email daemon")
+	interval := fs.Duration("interval", 2*time.Minute, "how often to check the mailbox")
+	once := fs.Bool("once", false, "check once and exit")
+	if d, err := time.ParseDuration(cfg.Email.Daemon.Interval); err == nil {
+		*interval = d
+	}
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if cfg.Email.SMTP.Host == "" || cfg.Email.From == "" {
+		fmt.Fprintln(os.Stderr, "Error: email.smtp.host and email.from must be set to send")
+		return exitError
+	}
+	d, err := newEmailResponder(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if len(cfg.Email.Daemon.Allow) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: email.daemon.allow is empty, so any sender gets an answer")
+	}
+	if !*once {
+		cfg.keepWarm(d.client, d.model)
+		cfg.keepRetaining()
+	}
+
+	ctx, stop := stopContext()
+	defer stop()
+	info("Answering mail to %s every %s (Ctrl+C to stop)\n", d.sender.Address, *interval)
+	for {
+		// Mail being answered is finished before stopping.
+		d.poll(context.WithoutCancel(ctx))
+		if *once {
+			return exitOK
+		}
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(*interval):
+		}
+	}
+}
+
+type emailResponder struct {
+	cfg    EmailConfig
+	client *openai.Client
+	model  string
+	system string
+	sender *mail.Address
+	notify NotifyConfig
+}
+
+func newEmailResponder(cfg *Config) (*emailResponder, error) {
+	sender, err := mail.ParseAddress(cfg.Email.From)
+	if err != nil {
+		return nil, fmt.Errorf("email.from: %w", err)
+	}
+	persona, err := cfg.resolvePersona(cfg.Email.Persona)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d := &emailResponder{
+		cfg:    cfg.Email,
+		notify: cfg.Notify,
+		client: client,
+		model:  cfg.baseModel(),
+		system: persona.SystemPrompt + "\n\n" + emailDaemonPrompt + "\n\n" + untrustedNotice,
+		sender: sender,
+	}
+	if persona.Model != "" {
+		d.model = persona.Model
+	}
+	if cfg.Email.Tone != "" {
+		d.system += "\n\nTone: " + cfg.Email.Tone
+	}
+	return d, nil
+}
+
+// poll answers the mail waiting in the mailbox. Failures are reported
+// and the next poll tries again.
+func (d *emailResponder) poll(ctx context.Context) {
+	search := d.cfg.Daemon.Search
+	if search == "" {
+		search = "UNSEEN"
+	}
+	msgs, err := fetchIMAPMessages(d.cfg.IMAP, search)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		d.notify.failed("email", "", err)
+	}
+	for _, raw := range msgs {
+		if ctx.Err() != nil {
+			return
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping a message that can't be parsed: %v\n", err)
+			continue
+		}
+		if err := d.answer(ctx, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			d.notify.failed("email", "", err)
+		}
+	}
+}
+
+func (d *emailResponder) answer(ctx context.Context, msg *mail.Message) error {
+	dec := new(mime.WordDecoder)
+	subject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+	to := msg.Header.Get("Reply-To")
+	if to == "" {
+		to = msg.Header.Get("From")
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("cannot reply to %q: %v", to, err)
+	}
+	if reason := d.skip(msg.Header, rcpt); reason != "" {
+		info("Skipping %q from %s: %s\n", subject, rcpt.Address, reason)
+		return nil
+	}
+	body, err := plainTextBody(msg.Header, msg.Body)
+	if err != nil {
+		return err
+	}
+
+	conv := d.thread(msg.Header)
+	from, _ := dec.DecodeHeader(msg.Header.Get("From"))
+	conv.addMessage("user", untrusted("email", fmt.Sprintf("From: %s\nSubject: %s\n\n%s", from, subject, strings.TrimSpace(body))))
+	conv.Messages[len(conv.Messages)-1].Speaker = rcpt.Address
+
+	r, err := callOpenAI(ctx, d.client, d.model, conv, nil)
+	if err != nil {
+		saveEmailConversation(conv)
+		return err
+	}
+	reply := strings.TrimSpace(r.content)
+	if err := sendSMTP(d.cfg.SMTP, d.sender.Address, rcpt.Address, replyMessage(d.sender, rcpt, msg.Header, subject, reply)); err != nil {
+		saveEmailConversation(conv)
+		return fmt.Errorf("sending to %s failed: %w", rcpt.Address, err)
+	}
+	conv.addMessage("assistant", reply)
+	saveEmailConversation(conv)
+	info("Answered %q from %s\n", subject, rcpt.Address)
+	d.notify.succeeded("email", conv.ID, fmt.Sprintf("answered %q from %s", subject, rcpt.Address))
+	return nil
+}
+
+// skip returns why a message should not be answered, or "". Mail from
+// ourselves and automatic mail are skipped so two responders can't get
+// into a loop.
+func (d *emailResponder) skip(h mail.Header, rcpt *mail.Address) string {
+	addr := strings.ToLower(rcpt.Address)
+	if addr == strings.ToLower(d.sender.Address) {
+		return "sent by this address"
+	}
+	if auto := h.Get("Auto-Submitted"); auto != "" && !strings.EqualFold(auto, "no") {
+		return "automatic reply"
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "list", "junk":
+		return "bulk or list mail"
+	}
+	if h.Get("List-Id") != "" {
+		return "mailing list"
+	}
+	if allow := d.cfg.Daemon.Allow; len(allow) > 0 {
+		_, domain, _ := strings.Cut(addr, "@")
+		if !slices.ContainsFunc(allow, func(a string) bool {
+			a = strings.ToLower(a)
+			return a == addr || a == "@"+domain
+		}) {
+			return "not in email.daemon.allow"
+		}
+	}
+	return ""
+}
+
+// thread returns the conversation for the thread a message belongs to,
+// found by the first message in its References (or In-Reply-To), which
+// replies carry along.
+func (d *emailResponder) thread(h mail.Header) *Conversation {
+	root := h.Get("Message-ID")
+	if refs := strings.Fields(h.Get("References")); len(refs) > 0 {
+		root = refs[0]
+	} else if parent := strings.TrimSpace(h.Get("In-Reply-To")); parent != "" {
+		root = parent
+	}
+	if root == "" {
+		root = h.Get("From") + h.Get("Subject")
+	}
+	id := "email_" + sha256Hex([]byte(root))[:16]
+	if conv, err := loadConversation(id); err == nil {
+		return conv
+	}
+	conv := newConversation(d.system)
+	conv.ID = id
+	if d.cfg.Persona != "" && d.cfg.Persona != "default" {
+		conv.Persona = d.cfg.Persona
+	}
+	conv.addTags("email")
+	return conv
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchIMAPMessage returns the raw newest message in the configured
+// mailbox that matches an IMAP SEARCH criteria string. The mailbox is
+// opened read-only, so the message is not marked as seen.
+func fetchIMAPMessage(s MailServer, criteria string) ([]byte, error) {
+	c, err := dialIMAP(s, "EXAMINE")
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	uids, err := c.search(criteria)
+	if err != nil {
+		return nil, err
+	}
+	if len(uids) == 0 {
+		return nil, fmt.Errorf("no message matches %q", criteria)
+	}
+	return c.fetch(uids[len(uids)-1], "BODY.PEEK[]")
+}
+
+// fetchIMAPMessages returns every message matching criteria, oldest
+// first, marking them as seen.
+func fetchIMAPMessages(s MailServer, criteria string) ([][]byte, error) {
+	c, err := dialIMAP(s, "SELECT")
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	uids, err := c.search(criteria)
+	if err != nil {
+		return nil, err
+	}
+	var msgs [][]byte
+	for _, uid := range uids {
+		msg, err := c.fetch(uid, "BODY[]")
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// dialIMAP logs in and opens the mailbox with EXAMINE (read-only) or
+// SELECT.
+func dialIMAP(s MailServer, open string) (*imapConn, error) {
+	if s.Host == "" {
+		return nil, fmt.Errorf("email.imap.host is not set")
+	}
+	port := s.Port
+	if port == 0 {
+		port = 993
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp",
+		net.JoinHostPort(s.Host, strconv.Itoa(port)), &tls.Config{ServerName: s.Host})
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	if _, err := c.r.ReadString('\n'); err != nil { // greeting
+		conn.Close()
+		return nil, err
+	}
+	password, err := s.Password.resolve()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("imap password: %w", err)
+	}
+	if _, err := c.cmd("LOGIN " + imapQuote(s.Username) + " " + imapQuote(password)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("imap login: %w", err)
+	}
+
+	mailbox := s.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := c.cmd(open + " " + imapQuote(mailbox)); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() {
+	c.cmd("LOGOUT")
+	c.conn.Close()
+}
+
+func (c *imapConn) search(criteria string) ([]string, error) {
+	lines, err := c.cmd("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, fmt.Errorf("imap search: %w", err)
+	}
+	var uids []string
+	for _, l := range lines {
+		if rest, ok := strings.CutPrefix(l.text, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+	return uids, nil
+}
+
+func (c *imapConn) fetch(uid, item string) ([]byte, error) {
+	lines, err := c.cmd("UID FETCH " + uid + " " + item)
+	if err != nil {
+		return nil, fmt.Errorf("imap fetch: %w", err)
+	}
+	for _, l := range lines {
+		if l.literal != nil {
+			return l.literal, nil
+		}
+	}
+	return nil, fmt.Errorf("imap fetch: message %s has no body", uid)
+}
+
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapLine is an untagged response line, with the literal that followed
+// it if it ended in {n}.
+type imapLine struct {
+	text    string
+	literal []byte
+}
+
+var imapLiteral = regexp.MustCompile(`\{(\d+)\}\r?\n$`)
+
+// cmd sends a command and collects responses up to its tagged completion.
+func (c *imapConn) cmd(command string) ([]imapLine, error) {
+	c.conn.SetDeadline(time.Now().Add(time.Minute))
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+	var lines []imapLine
+	for {
+		text, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(text, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				return nil, fmt.Errorf("%s", strings.TrimSpace(rest))
+			}
+			return lines, nil
+		}
+		line := imapLine{text: strings.TrimRight(text, "\r\n")}
+		if m := imapLiteral.FindStringSubmatch(text); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			line.literal = make([]byte, n)
+			if _, err := io.ReadFull(c.r, line.literal); err != nil {
+				return nil, err
+			}
+		}
+		lines = append(lines, line)
+	}
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
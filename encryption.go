@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ProfileConfig is a separate set of conversations, chosen with
+// --profile. Each profile can have its own encryption key, so people
+// sharing a machine can't read each other's archives.
+type ProfileConfig struct {
+	// DataDir defaults to profiles/<name> in the data directory.
+	DataDir       string     `yaml:"data_dir"`
+	EncryptionKey Credential `yaml:"encryption_key"`
+}
+
+// Encrypted conversation files start with encryptedMagic, then the salt
+// the key was derived with, then the AES-256-GCM nonce and ciphertext.
+const (
+	encryptedMagic = "CHATENC1\n"
+	saltSize       = 16
+	// kdfIterations follows OWASP's advice for PBKDF2-HMAC-SHA256.
+	kdfIterations = 600000
+)
+
+var (
+	// profileName is the profile in use, "" for the default one, and
+	// encryptionKey the passphrase its conversations are encrypted with.
+	profileName   string
+	encryptionKey Credential
+
+	passphraseOnce sync.Once
+	passphrase     string
+	passphraseErr  error
+
+	keysMu sync.Mutex
+	keys   = map[string][]byte{}
+)
+
+var errWrongKey = errors.New("cannot decrypt: wrong encryption key, or the file is damaged")
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "encrypt",
+		usage: "encrypt",
+		help:  "Encrypt existing conversations and attachments with the profile's encryption key",
+		run:   runEncrypt,
+	})
+}
+
+// applyProfile points the data directory at the selected profile's and
+// picks its key.
+func (cfg *Config) applyProfile() error {
+	encryptionKey = cfg.EncryptionKey
+	if profileName == "" {
+		return nil
+	}
+	p, ok := cfg.Profiles[profileName]
+	if !ok {
+		return fmt.Errorf("no profile named %q in the config file", profileName)
+	}
+	dataDir = filepath.Join(dataDir, "profiles", profileName)
+	if p.DataDir != "" {
+		dataDir = expandHome(p.DataDir)
+	}
+	chatsDir = filepath.Join(dataDir, "chats")
+	encryptionKey = p.EncryptionKey
+	// Keep other accounts out of the profile's files where the file
+	// system allows it.
+	return os.MkdirAll(chatsDir, 0700)
+}
+
+func runEncrypt(cfg *Config, args []string) int {
+	fs := newFlagSet("encrypt")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if !encryptionKey.isSet() {
+		fmt.Fprintln(os.Stderr, "Error: no encryption key is set for this profile")
+		return exitError
+	}
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	n, files := 0, 0
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(chatsDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", e.Name(), err)
+			return exitError
+		}
+		sealed, err := sealAttachments(conv)
+		if err == nil && (sealed > 0 || !bytes.HasPrefix(data, []byte(encryptedMagic))) {
+			err = conv.save()
+			n++
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", e.Name(), err)
+			return exitError
+		}
+		files += sealed
+	}
+	fmt.Printf("Encrypted %d conversations and %d attached files\n", n, files)
+	if files > 0 {
+		fmt.Println("Run `chat-cli images gc` to remove the unencrypted copies")
+	}
+	return exitOK
+}
+
+// sealAttachments stores the conversation's unencrypted attachments again
+// as encrypted blobs and points it at them. The unencrypted blobs stay
+// until nothing refers to them.
+func sealAttachments(conv *Conversation) (int, error) {
+	n := 0
+	for i := range conv.Messages {
+		for j, a := range conv.Messages[i].Attachments {
+			if a.Ref == "" || isSealedBlob(a.Ref) {
+				continue
+			}
+			data, err := readBlob(a.Ref)
+			if err != nil {
+				return n, fmt.Errorf("%s: %w", a.Ref, err)
+			}
+			ref, err := storeSealedBlob(data)
+			if err != nil {
+				return n, err
+			}
+			conv.Messages[i].Attachments[j].Ref = ref
+			n++
+		}
+	}
+	return n, nil
+}
+
+// isSealedBlob reports whether the blob at ref is encrypted.
+func isSealedBlob(ref string) bool {
+	f, err := os.Open(filepath.Join(chatsDir, filepath.FromSlash(ref)))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(encryptedMagic))
+	_, err = io.ReadFull(f, head)
+	return err == nil && string(head) == encryptedMagic
+}
+
+// encodeConversation serializes a conversation for storage, encrypted if
+// the profile has a key.
+func encodeConversation(c *Conversation) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to encode XML: %w", err)
+	}
+	if !encryptionKey.isSet() {
+		return buf.Bytes(), nil
+	}
+	return seal(buf.Bytes())
+}
+
+// seal encrypts data with the profile's key.
+func seal(data []byte) ([]byte, error) {
+	salt, err := profileSalt()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := archiveCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(encryptedMagic), salt...)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(encryptedMagic)), nil
+}
+
+// unseal decrypts what seal encrypted, and returns anything else as it
+// is. It also returns the salt the data was encrypted with, nil if it
+// wasn't.
+func unseal(data []byte) (plain, salt []byte, err error) {
+	rest, ok := bytes.CutPrefix(data, []byte(encryptedMagic))
+	if !ok {
+		return data, nil, nil
+	}
+	if !encryptionKey.isSet() {
+		return nil, nil, errors.New("the file is encrypted, but no encryption key is set")
+	}
+	if len(rest) < saltSize {
+		return nil, nil, errWrongKey
+	}
+	salt = rest[:saltSize]
+	aead, err := archiveCipher(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	rest = rest[saltSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, nil, errWrongKey
+	}
+	plain, err = aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(encryptedMagic))
+	if err != nil {
+		return nil, nil, errWrongKey
+	}
+	return plain, salt, nil
+}
+
+// parseConversation reads a stored conversation, decrypting it if needed.
+func parseConversation(data []byte) (*Conversation, error) {
+	data, _, err := unseal(data)
+	if err != nil {
+		return nil, err
+	}
+	conv := &Conversation{}
+	if err := xml.Unmarshal(data, conv); err != nil {
+		return nil, err
+	}
+	if err := conv.migrate(); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// archiveCipher returns the cipher for a salt's key.
+func archiveCipher(salt []byte) (cipher.AEAD, error) {
+	key, err := archiveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// archiveKey derives the key for a salt from the passphrase. Deriving is
+// slow by design, so keys are cached.
+func archiveKey(salt []byte) ([]byte, error) {
+	passphraseOnce.Do(func() {
+		passphrase, passphraseErr = encryptionKey.resolve()
+		if passphraseErr == nil && passphrase == "" {
+			passphraseErr = errors.New("the encryption key is empty")
+		}
+	})
+	if passphraseErr != nil {
+		return nil, fmt.Errorf("encryption_key: %w", passphraseErr)
+	}
+	keysMu.Lock()
+	key, ok := keys[string(salt)]
+	if !ok {
+		var err error
+		key, err = pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, 32)
+		if err != nil {
+			keysMu.Unlock()
+			return nil, err
+		}
+		keys[string(salt)] = key
+	}
+	keysMu.Unlock()
+	return key, nil
+}
+
+// profileSalt is the salt new files are encrypted with, kept in the
+// chats directory so one key derivation serves every file.
+func profileSalt() ([]byte, error) {
+	path := filepath.Join(chatsDir, ".salt")
+	salt, err := os.ReadFile(path)
+	if err == nil && len(salt) == saltSize {
+		return salt, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	salt = make([]byte, saltSize)
+	rand.Read(salt)
+	return salt, os.WriteFile(path, salt, 0600)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultEnvVars are always reported by /env when set.
+var defaultEnvVars = []string{"SHELL", "TERM", "LANG", "GOPATH", "GOOS", "GOARCH", "CGO_ENABLED"}
+
+// secretEnvPattern matches the names of variables whose values /env masks.
+var secretEnvPattern = regexp.MustCompile(`(?i)(api_?key|token|secret|password|key$)`)
+
+func init() {
+	registerCommand(&command{
+		name:  "env",
+		usage: "/env [VAR...]",
+		help:  "Attach OS, Go, shell and selected environment details to the next message",
+		run:   cmdEnv,
+	})
+}
+
+func cmdEnv(s *session, args string) error {
+	report := redactEnvReport(collectEnvReport(strings.Fields(args)))
+	fmt.Printf("\n%s\n", report)
+
+	answer, err := s.input.ReadLine("Include this in your next message? [y/N] ")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		info("Not included\n")
+		return nil
+	}
+	s.addContext("Environment", report)
+	info("Environment will be sent with your next message\n")
+	return nil
+}
+
+func collectEnvReport(extra []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "OS: %s/%s", runtime.GOOS, runtime.GOARCH)
+	if release := osRelease(); release != "" {
+		fmt.Fprintf(&b, " (%s)", release)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Go: %s\n", commandVersion("go", "version"))
+	if shell := os.Getenv("SHELL"); shell != "" {
+		fmt.Fprintf(&b, "Shell: %s\n", commandVersion(shell, "--version"))
+	}
+
+	seen := map[string]bool{}
+	for _, name := range append(defaultEnvVars, extra...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(&b, "%s=%s\n", name, value)
+		} else if slices.Contains(extra, name) {
+			fmt.Fprintf(&b, "%s is not set\n", name)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// redactEnvReport masks values of secret-looking variables and replaces
+// the home directory and user name, which identify the user.
+func redactEnvReport(report string) string {
+	lines := strings.Split(report, "\n")
+	for i, line := range lines {
+		if name, _, ok := strings.Cut(line, "="); ok && secretEnvPattern.MatchString(name) {
+			lines[i] = name + "=" + redactedPlaceholder
+		}
+	}
+	report = strings.Join(lines, "\n")
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		report = strings.ReplaceAll(report, home, "~")
+	}
+	if u, err := user.Current(); err == nil && len(u.Username) > 2 {
+		report = strings.ReplaceAll(report, u.Username, "<user>")
+	}
+	return report
+}
+
+func osRelease() string {
+	switch runtime.GOOS {
+	case "linux":
+		f, err := os.Open("/etc/os-release")
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+				return strings.Trim(v, `"`)
+			}
+		}
+	case "darwin":
+		return "macOS " + commandVersion("sw_vers", "-productVersion")
+	case "windows":
+		return commandVersion("cmd", "/c", "ver")
+	}
+	return ""
+}
+
+// commandVersion returns the first line a version command prints.
+func commandVersion(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "not available"
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return first
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "export",
+		usage: "export <id> [--format markdown|json|text] [--roles r,r] [--from date] [--to date] [--messages a..b] [-o file]",
+		help:  "Write a conversation, or the slice of it you pick, as Markdown, JSON or text",
+		run:   runExport,
+	})
+}
+
+// exportFilter picks the messages to export. Messages keep the numbers
+// and IDs show gives them.
+type exportFilter struct {
+	roles    map[string]bool
+	from, to time.Time
+	first    int
+	last     int // 0 for no upper bound
+}
+
+type exportedMessage struct {
+	Message   int    `json:"message"`
+	ID        string `json:"id,omitempty"`
+	Role      string `json:"role"`
+	Speaker   string `json:"speaker,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Content   string `json:"content"`
+}
+
+func runExport(cfg *Config, args []string) int {
+	fs := newFlagSet("export")
+	format := fs.String("format", "markdown", "markdown, json or text")
+	roles := fs.String("roles", "user,assistant", "comma-separated roles to include: system, user, assistant, tool; or all")
+	from := fs.String("from", "", "only messages from this date or time on (2024-01-01 or RFC 3339)")
+	to := fs.String("to", "", "only messages up to this date or time; a date includes the whole day")
+	messages := fs.String("messages", "", "only messages in this range, by number or ID as in show: 10..40, 10.., ..40 or msg_a..msg_b")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: export <id> [--format markdown|json|text] [--roles r,r] [--from date] [--to date] [--messages a..b] [-o file]")
+		return exitError
+	}
+	conv, err := loadConversation(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	filter, err := newExportFilter(conv, *roles, *from, *to, *messages)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	picked := []exportedMessage{}
+	for i, msg := range conv.Messages {
+		if filter.keep(i+1, msg) {
+			picked = append(picked, exportedMessage{Message: i + 1, ID: msg.ID, Role: msg.Role, Speaker: msg.Speaker, Timestamp: msg.Timestamp, Content: msg.Content})
+		}
+	}
+	if len(picked) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: no messages match the filters")
+	}
+
+	var data []byte
+	switch *format {
+	case "markdown", "md":
+		data = []byte(exportMarkdown(conv, picked))
+	case "json":
+		data, err = json.MarshalIndent(picked, "", "  ")
+		data = append(data, '\n')
+	case "text":
+		var sb strings.Builder
+		for _, m := range picked {
+			fmt.Fprintf(&sb, "#%d [%s] %s:\n%s\n\n", m.Message, m.Timestamp, m.label(), m.Content)
+		}
+		data = []byte(sb.String())
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q; use markdown, json or text\n", *format)
+		return exitError
+	}
+	if err == nil && *out != "" {
+		err = os.WriteFile(*out, data, 0644)
+	} else if err == nil {
+		_, err = os.Stdout.Write(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *out != "" {
+		info("Exported %d of %d messages to %s\n", len(picked), len(conv.Messages), *out)
+	}
+	return exitOK
+}
+
+func newExportFilter(conv *Conversation, roles, from, to, messages string) (exportFilter, error) {
+	f := exportFilter{first: 1}
+	if roles != "all" {
+		f.roles = map[string]bool{}
+		for _, r := range strings.Split(roles, ",") {
+			r = strings.TrimSpace(r)
+			switch r {
+			case "system", "user", "assistant", "tool":
+				f.roles[r] = true
+			case "":
+			default:
+				return f, fmt.Errorf("--roles: unknown role %q", r)
+			}
+		}
+	}
+	var err error
+	if from != "" {
+		if f.from, _, err = parseExportTime(from); err != nil {
+			return f, fmt.Errorf("--from: %w", err)
+		}
+	}
+	if to != "" {
+		var dateOnly bool
+		if f.to, dateOnly, err = parseExportTime(to); err != nil {
+			return f, fmt.Errorf("--to: %w", err)
+		}
+		if dateOnly {
+			f.to = f.to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+	}
+	if messages != "" {
+		a, b, ok := strings.Cut(messages, "..")
+		if !ok {
+			a, b = messages, messages
+		}
+		if a != "" {
+			if f.first, err = rangeBound(conv, a); err != nil {
+				return f, fmt.Errorf("--messages: %w", err)
+			}
+		}
+		if b != "" {
+			if f.last, err = rangeBound(conv, b); err != nil {
+				return f, fmt.Errorf("--messages: %w", err)
+			}
+			if f.last < f.first {
+				return f, fmt.Errorf("--messages: bad range %q", messages)
+			}
+		}
+	}
+	return f, nil
+}
+
+// rangeBound reads one end of a --messages range: a message number, which
+// may lie past the end, or a message ID.
+func rangeBound(conv *Conversation, s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return 0, fmt.Errorf("no message %d; messages are numbered from 1", n)
+		}
+		return n, nil
+	}
+	i, err := conv.messageIndex(s)
+	return i + 1, err
+}
+
+// parseExportTime reads a date in local time, or a full RFC 3339 time.
+func parseExportTime(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, false, fmt.Errorf("%q is not a date (2024-01-01) or RFC 3339 time", s)
+	}
+	return t, false, nil
+}
+
+func (f exportFilter) keep(n int, msg Message) bool {
+	if n < f.first || f.last > 0 && n > f.last {
+		return false
+	}
+	if f.roles != nil && !f.roles[msg.Role] {
+		return false
+	}
+	if f.from.IsZero() && f.to.IsZero() {
+		return true
+	}
+	ts, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		return false
+	}
+	return (f.from.IsZero() || !ts.Before(f.from)) && (f.to.IsZero() || !ts.After(f.to))
+}
+
+func (m exportedMessage) label() string {
+	if m.Speaker != "" {
+		return m.Speaker
+	}
+	return strings.ToUpper(m.Role[:1]) + m.Role[1:]
+}
+
+func exportMarkdown(conv *Conversation, picked []exportedMessage) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", conv.ID)
+	for _, m := range picked {
+		fmt.Fprintf(&sb, "## %d. %s\n\n*%s*\n\n%s\n\n", m.Message, m.label(), m.Timestamp, strings.TrimSpace(m.Content))
+	}
+	return sb.String()
+}
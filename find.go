@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "find",
+		usage: "/find <text> | /find #n | /find #msg_id",
+		help:  "Search this conversation and list the matches; /find #n or #msg_id shows a message in full",
+		run:   cmdFind,
+	})
+}
+
+// findMatch is a message containing the searched text, with the
+// surrounding text to show.
+type findMatch struct {
+	index   int
+	excerpt string
+}
+
+func cmdFind(s *session, args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return fmt.Errorf("usage: /find <text> | /find #n | /find #msg_id")
+	}
+	if strings.HasPrefix(args, "#") && !strings.ContainsAny(args, " \t") {
+		i, err := s.conv.messageIndex(args)
+		if err != nil {
+			return err
+		}
+		msg := s.conv.Messages[i]
+		fmt.Printf("%s\n%s\n\n", paint(theme.Heading, fmt.Sprintf("#%d %s %s:", i+1, msg.ID, msg.Role)), forDisplay(msg.Content))
+		return nil
+	}
+	matches := findInConversation(s.conv, args)
+	if len(matches) == 0 {
+		info("No matches for %q\n", args)
+		return nil
+	}
+	for _, m := range matches {
+		msg := s.conv.Messages[m.index]
+		fmt.Printf("  %s %s\n", paint(theme.Meta, fmt.Sprintf("#%d %s %s:", m.index+1, msg.ID, msg.Role)), m.excerpt)
+	}
+	info("%d matching messages; /find #n shows one in full\n", len(matches))
+	return nil
+}
+
+// findInConversation searches the user and assistant messages for text,
+// ignoring case, and highlights the first match in each.
+func findInConversation(c *Conversation, text string) []findMatch {
+	var matches []findMatch
+	needle := strings.ToLower(text)
+	for i, msg := range c.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" || msg.Redacted {
+			continue
+		}
+		// Lower-casing can change byte lengths, so search rune by rune.
+		content := []rune(strings.ReplaceAll(msg.Content, "\n", " "))
+		lower := []rune(strings.ToLower(string(content)))
+		at := strings.Index(string(lower), needle)
+		if at < 0 || len(lower) != len(content) {
+			if at >= 0 {
+				matches = append(matches, findMatch{index: i, excerpt: truncate(msg.Content, 80)})
+			}
+			continue
+		}
+		start := len([]rune(string(lower)[:at]))
+		end := start + len([]rune(needle))
+		before, after := max(start-30, 0), min(end+40, len(content))
+		excerpt := string(content[before:start]) + paint(theme.Accent, string(content[start:end])) + string(content[end:after])
+		if before > 0 {
+			excerpt = "…" + excerpt
+		}
+		if after < len(content) {
+			excerpt += "…"
+		}
+		matches = append(matches, findMatch{index: i, excerpt: excerpt})
+	}
+	return matches
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const flashcardsPrompt = `You write flashcards for spaced-repetition study from the material below.
+Each card tests one fact or idea; questions are self-contained and answers short.
+Rate each card's difficulty as "easy", "medium" or "hard".
+Answer with only a JSON array: [{"question": "...", "answer": "...", "difficulty": "medium"}]`
+
+type flashcard struct {
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+	Difficulty string `json:"difficulty"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "flashcards",
+		usage: "flashcards <file|conversation-id> [--format anki|csv|json] [--count n] [--deck name] [-o file]",
+		help:  "Turn study material or a conversation into question/answer cards",
+		run:   runFlashcards,
+	})
+}
+
+func runFlashcards(cfg *Config, args []string) int {
+	fs := newFlagSet("flashcards")
+	format := fs.String("format", "anki", "output format: anki (tab-separated for Anki's importer), csv or json")
+	count := fs.Int("count", 20, "roughly how many cards to make")
+	deck := fs.String("deck", "", "Anki deck to import into")
+	output := fs.String("o", "", "write the cards to this file instead of stdout")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: flashcards <file|conversation-id> [--format anki|csv|json] [--count n] [--deck name] [-o file]")
+		return exitError
+	}
+	switch *format {
+	case "anki", "csv", "json":
+	case "apkg":
+		fmt.Fprintln(os.Stderr, "Error: .apkg is not supported; use --format anki and File > Import in Anki")
+		return exitError
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return exitError
+	}
+
+	material, err := studyMaterial(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	info("Writing about %d cards...\n", *count)
+	prompt := fmt.Sprintf("%s\nMake about %d cards.", flashcardsPrompt, *count)
+	r, err := ask(context.Background(), client, cfg.baseModel(), prompt, untrusted(rest[0], material))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	var cards []flashcard
+	if err := json.Unmarshal([]byte(stripCodeFence(r.content)), &cards); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: the model's answer is not the expected JSON: %v\n", err)
+		return exitAPIError
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeFlashcards(out, cards, *format, *deck); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *output != "" {
+		info("%d cards written to: %s\n", len(cards), *output)
+	}
+	return exitOK
+}
+
+// studyMaterial reads a file, or failing that a saved conversation, as
+// text to make cards from.
+func studyMaterial(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err == nil {
+		return string(data), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	conv, convErr := loadConversation(ref)
+	if convErr != nil {
+		return "", fmt.Errorf("%s is neither a file nor a saved conversation", ref)
+	}
+	var b strings.Builder
+	for _, m := range conv.Messages {
+		if (m.Role == "user" || m.Role == "assistant") && m.Content != "" && !m.Redacted {
+			fmt.Fprintf(&b, "%s: %s\n\n", m.Role, m.Content)
+		}
+	}
+	return b.String(), nil
+}
+
+func writeFlashcards(w io.Writer, cards []flashcard, format, deck string) error {
+	tag := func(c flashcard) string {
+		d := strings.ToLower(c.Difficulty)
+		if d == "" {
+			d = "medium"
+		}
+		return "difficulty::" + d
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cards)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"question", "answer", "difficulty"})
+		for _, c := range cards {
+			cw.Write([]string{c.Question, c.Answer, strings.TrimPrefix(tag(c), "difficulty::")})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	// Anki reads these header lines to configure the import.
+	fmt.Fprintln(w, "#separator:tab")
+	fmt.Fprintln(w, "#html:true")
+	fmt.Fprintln(w, "#tags column:3")
+	if deck != "" {
+		fmt.Fprintf(w, "#deck:%s\n", deck)
+	}
+	field := strings.NewReplacer("\t", " ", "\r\n", "<br>", "\n", "<br>")
+	for _, c := range cards {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", field.Replace(c.Question), field.Replace(c.Answer), tag(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
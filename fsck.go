@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// staleTempAge is how old a temporary file from a save must be before fsck
+// takes it for a leftover rather than a save in progress.
+const staleTempAge = time.Hour
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "fsck",
+		usage: "fsck [--repair]",
+		help:  "Check stored conversations, images and state files, and repair what can be repaired",
+		run:   runFsck,
+	})
+}
+
+// fsck collects the problems found in the store.
+type fsck struct {
+	repair     bool
+	problems   int
+	fixed      int
+	unreadable int
+	// refs are the stored files conversations refer to.
+	refs map[string]bool
+}
+
+// report prints a problem with file. Fixable problems are fixed with
+// --repair; the caller does the fixing.
+func (f *fsck) report(file string, fixable bool, format string, args ...any) {
+	f.problems++
+	note := ""
+	switch {
+	case fixable && f.repair:
+		f.fixed++
+		note = " (fixed)"
+	case fixable:
+		note = " (--repair fixes this)"
+	}
+	fmt.Printf("%s: %s%s\n", file, fmt.Sprintf(format, args...), note)
+}
+
+func runFsck(cfg *Config, args []string) int {
+	fs := newFlagSet("fsck")
+	repair := fs.Bool("repair", false, "fix the problems that can be fixed")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	f := &fsck{repair: *repair, refs: map[string]bool{}}
+
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	conversations := 0
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case e.IsDir():
+		case isConversationFile(name):
+			conversations++
+			f.checkConversation(name)
+		case strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp"):
+			f.checkTemp(name)
+		}
+	}
+	blobs := f.checkBlobs()
+	jsonFiles := f.checkJSON(dataDir, "shares.json", "question-index.json", "tutor.json")
+	if dir, err := configDir(); err == nil {
+		jsonFiles += f.checkJSON(dir, "snippets.json", "macros.json", "digest-state.json")
+	}
+
+	summary := fmt.Sprintf("Checked %s, %s and %s: ", plural(int64(conversations), "conversation"),
+		plural(int64(blobs), "attached file"), plural(int64(jsonFiles), "state file"))
+	switch {
+	case f.problems == 0:
+		summary += "no problems found"
+	case f.repair:
+		summary += fmt.Sprintf("%s, %d fixed", plural(int64(f.problems), "problem"), f.fixed)
+	default:
+		summary += plural(int64(f.problems), "problem")
+	}
+	fmt.Println(summary)
+	if f.problems > f.fixed {
+		return exitError
+	}
+	return exitOK
+}
+
+// checkConversation checks that a conversation file can be read, that its
+// ID matches the file name, that no two messages share an ID, that its
+// timestamps only move forward, and that the files it refers to exist.
+func (f *fsck) checkConversation(name string) {
+	conv, err := loadConversation(name)
+	if err != nil {
+		f.unreadable++
+		var syntax *xml.SyntaxError
+		if errors.As(err, &syntax) {
+			f.report(name, false, "corrupt: %v", syntax)
+		} else {
+			f.report(name, false, "can't be read: %v", errors.Unwrap(err))
+		}
+		return
+	}
+	fixed := f.fixed
+	changed := false
+	if id := strings.TrimSuffix(name, ".xml"); conv.ID != id {
+		f.report(name, true, "ID is %q, not %q", conv.ID, id)
+		conv.ID, changed = id, true
+	}
+	created, err := time.Parse(time.RFC3339, conv.CreatedAt)
+	if err != nil {
+		f.report(name, true, "invalid created_at %q", conv.CreatedAt)
+		if len(conv.Messages) > 0 {
+			conv.CreatedAt = conv.Messages[0].Timestamp
+		}
+		if created, err = time.Parse(time.RFC3339, conv.CreatedAt); err != nil {
+			if st, err := os.Stat(conv.getFilePath()); err == nil {
+				created = st.ModTime()
+			}
+			conv.CreatedAt = created.Format(time.RFC3339)
+		}
+		changed = true
+	}
+
+	prev, prevStamp := created, conv.CreatedAt
+	ids := map[string]int{}
+	for i := range conv.Messages {
+		msg := &conv.Messages[i]
+		if first, ok := ids[msg.ID]; ok {
+			f.report(name, true, "message %d: ID %s is message %d's too", i+1, msg.ID, first+1)
+			msg.ID, changed = newMessageID(), true
+		} else if msg.ID == "" {
+			f.report(name, true, "message %d has no ID", i+1)
+			msg.ID, changed = newMessageID(), true
+		}
+		ids[msg.ID] = i
+		t, err := time.Parse(time.RFC3339, msg.Timestamp)
+		switch {
+		case err != nil:
+			f.report(name, true, "message %d: invalid timestamp %q", i+1, msg.Timestamp)
+			msg.Timestamp, changed = prevStamp, true
+		case t.Before(prev):
+			f.report(name, true, "message %d: timestamp %s is earlier than the previous message's", i+1, msg.Timestamp)
+			msg.Timestamp, changed = prevStamp, true
+		default:
+			prev, prevStamp = t, msg.Timestamp
+		}
+
+		kept := msg.Attachments[:0]
+		for _, a := range msg.Attachments {
+			if a.Ref == "" {
+				kept = append(kept, a)
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(chatsDir, filepath.FromSlash(a.Ref))); err != nil {
+				f.report(name, true, "message %d: attachment %s is missing (%s)", i+1, a.Name, a.Ref)
+				changed = true
+				continue
+			}
+			f.refs[a.Ref] = true
+			kept = append(kept, a)
+		}
+		msg.Attachments = kept
+	}
+	if s := conv.Summary; s != nil && s.Through > len(conv.Messages) {
+		f.report(name, true, "summary covers %d messages, but there are %d", s.Through, len(conv.Messages))
+		conv.Summary, changed = nil, true
+	}
+
+	if changed && f.repair {
+		if err := conv.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", name, err)
+			f.fixed = fixed
+		}
+	}
+}
+
+// checkTemp reports a temporary file left over from an interrupted save.
+func (f *fsck) checkTemp(name string) {
+	path := filepath.Join(chatsDir, name)
+	st, err := os.Stat(path)
+	if err != nil || time.Since(st.ModTime()) < staleTempAge {
+		return
+	}
+	f.report(name, true, "left over from an interrupted save")
+	if f.repair {
+		os.Remove(path)
+	}
+}
+
+// checkBlobs reports stored files whose content no longer matches their
+// hash, and those no conversation refers to. Unreferenced files are only
+// reported when every conversation could be read.
+func (f *fsck) checkBlobs() int {
+	n := 0
+	var orphans []string
+	err := walkBlobs(func(ref string, d fs.DirEntry) error {
+		n++
+		if _, err := readBlob(ref); err != nil {
+			f.report(ref, false, "%v", err)
+		}
+		if !f.refs[ref] {
+			orphans = append(orphans, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		f.report("chats", false, "%v", err)
+	}
+	if f.unreadable > 0 {
+		if len(orphans) > 0 {
+			fmt.Printf("Not looking for unreferenced files: %s couldn't be read\n", plural(int64(f.unreadable), "conversation"))
+		}
+		return n
+	}
+	for _, ref := range orphans {
+		f.report(ref, false, "not referenced by any conversation")
+	}
+	return n
+}
+
+// checkJSON reports the named state files in dir that aren't valid JSON,
+// and returns how many there are.
+func (f *fsck) checkJSON(dir string, names ...string) int {
+	n := 0
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		n++
+		if err != nil {
+			f.report(path, false, "%v", err)
+			continue
+		}
+		if !json.Valid(data) {
+			var v any
+			f.report(path, false, "corrupt: %v", json.Unmarshal(data, &v))
+		}
+	}
+	return n
+}
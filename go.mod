@@ -2,13 +2,17 @@ module golang-cli-chat
 
 go 1.24.0
 
-require github.com/openai/openai-go v0.1.0-alpha.39
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/openai/openai-go v0.1.0-alpha.39
+	golang.org/x/sys v0.40.0
+	golang.org/x/term v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/tidwall/gjson v1.14.4 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	golang.org/x/sys v0.40.0 // indirect
-	golang.org/x/term v0.39.0 // indirect
 )
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// configEnv names the config file to use, like --config.
+const configEnv = envPrefix + "CONFIG"
+
+var (
+	// configFile replaces config.yaml in the user config directory.
+	configFile string
+	// logFormat is text or json, from --log-format or log_format.
+	logFormat string
+	// headless is set when running without anyone at the terminal, as in
+	// a container: nothing is opened, and no colors are used.
+	headless bool
+)
+
+// shutdownTimeout is how long servers and bots wait for the answers in
+// progress when asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// stopContext is done when the process is asked to stop, by Ctrl+C or
+// by SIGTERM as container runtimes and service managers send. A second
+// signal stops the process at once.
+func stopContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// flushLogs writes out what the JSON log has buffered; exit calls it.
+var flushLogs = func() {}
+
+func exit(code int) {
+	flushLogs()
+	os.Exit(code)
+}
+
+type logRecord struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+var sgrPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// startJSONLogs turns each line written to stderr into a JSON record,
+// with the level taken from its "Error:" or "Warning:" prefix.
+func startJSONLogs() {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	out := os.Stderr
+	os.Stderr = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(out)
+		lines := bufio.NewScanner(r)
+		lines.Buffer(make([]byte, 64<<10), 1<<20)
+		for lines.Scan() {
+			line := strings.TrimSpace(sgrPattern.ReplaceAllString(lines.Text(), ""))
+			if line == "" {
+				continue
+			}
+			rec := logRecord{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: "info", Msg: line}
+			if msg, ok := strings.CutPrefix(line, "Error: "); ok {
+				rec.Level, rec.Msg = "error", msg
+			} else if msg, ok := strings.CutPrefix(line, "Warning: "); ok {
+				rec.Level, rec.Msg = "warn", msg
+			}
+			enc.Encode(rec)
+		}
+	}()
+	flushLogs = func() {
+		os.Stderr = out
+		w.Close()
+		<-done
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// queued counts the messages that rooms and bots have accepted but not
+// answered yet, including those being answered.
+var queued atomic.Int64
+
+// providerCheckTTL is how long a provider check is reused, so frequent
+// probes don't turn into a stream of API calls.
+const providerCheckTTL = 30 * time.Second
+
+func init() {
+	registerRoute("GET /healthz", func(cfg *Config) http.Handler {
+		return http.HandlerFunc(serveHealthz)
+	})
+	registerRoute("GET /readyz", func(cfg *Config) http.Handler {
+		return newReadiness(cfg)
+	})
+}
+
+// serveHealthz is the liveness probe: the process is up and serving.
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Depth and Max are set on the queue check.
+	Depth *int64 `json:"depth,omitempty"`
+	Max   int    `json:"max,omitempty"`
+}
+
+type readiness struct {
+	cfg *Config
+
+	mu      sync.Mutex
+	client  *openai.Client
+	checked time.Time
+	last    healthCheck
+}
+
+func newReadiness(cfg *Config) *readiness {
+	return &readiness{cfg: cfg}
+}
+
+// ServeHTTP is the readiness probe. It answers 503 unless the API can be
+// reached, the chats directory can be written and the queue is below
+// serve.max_queue.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	depth := queued.Load()
+	checks := map[string]healthCheck{
+		"provider": rd.provider(r.Context()),
+		"storage":  checkStorage(),
+		"queue":    {OK: rd.cfg.Serve.MaxQueue == 0 || depth < int64(rd.cfg.Serve.MaxQueue), Depth: &depth, Max: rd.cfg.Serve.MaxQueue},
+	}
+	status := "ok"
+	for _, c := range checks {
+		if !c.OK {
+			status = "unavailable"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
+
+// provider checks that the API answers with this key, reusing a recent
+// result.
+func (rd *readiness) provider(ctx context.Context) healthCheck {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if time.Since(rd.checked) < providerCheckTTL {
+		return rd.last
+	}
+	if rd.client == nil {
+		client, err := newClient(rd.cfg)
+		if err != nil {
+			return healthCheck{Error: err.Error()}
+		}
+		rd.client = client
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	rd.last = healthCheck{OK: true}
+	if _, err := rd.client.Models.Get(ctx, rd.cfg.baseModel()); err != nil {
+		rd.last = healthCheck{Error: err.Error()}
+	}
+	rd.checked = time.Now()
+	return rd.last
+}
+
+// checkStorage writes and removes a file in the chats directory.
+func checkStorage() healthCheck {
+	if err := os.MkdirAll(chatsDir, 0755); err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+	f, err := os.CreateTemp(chatsDir, ".readyz-*")
+	if err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+	return healthCheck{OK: true}
+}
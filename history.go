@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHistorySize is how many lines of input are kept when
+// history_size is not set.
+const defaultHistorySize = 1000
+
+// inputHistory is what was typed at the prompt, oldest first, for the up
+// and down arrows. Each line is stored as a JSON string on a line of its
+// own, so messages spanning several lines survive.
+type inputHistory struct {
+	// path is the history file; "" keeps the history in memory only.
+	path    string
+	size    int
+	entries []string
+}
+
+// loadHistory reads the history file in the data directory. Incognito
+// sessions and encrypted profiles, which keep nothing on disk in the
+// clear, get a history that lasts for the session only.
+func loadHistory(size int, persist bool) *inputHistory {
+	if size == 0 {
+		size = defaultHistorySize
+	}
+	h := &inputHistory{size: max(size, 0)}
+	if !persist || size < 0 || encryptionKey.isSet() {
+		return h
+	}
+	h.path = filepath.Join(dataDir, "history")
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read the input history: %v\n", err)
+		return h
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line string
+		if json.Unmarshal(scanner.Bytes(), &line) == nil {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > h.size {
+		// Trim the file now and then rather than on every line.
+		h.entries = h.entries[len(h.entries)-h.size:]
+		h.rewrite()
+	}
+	return h
+}
+
+// add records a line sent from the prompt. Lines starting with a space
+// are left out, as in shells, and so is a repeat of the previous line.
+func (h *inputHistory) add(line string) {
+	if h == nil || h.size == 0 || strings.TrimSpace(line) == "" || strings.HasPrefix(line, " ") {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.size {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	data, _ := json.Marshal(line)
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save the input history: %v\n", err)
+		h.path = ""
+	}
+}
+
+// rewrite replaces the history file with the entries in memory.
+func (h *inputHistory) rewrite() {
+	var sb strings.Builder
+	for _, line := range h.entries {
+		data, _ := json.Marshal(line)
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	if err := os.WriteFile(h.path, []byte(sb.String()), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save the input history: %v\n", err)
+	}
+}
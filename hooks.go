@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HooksConfig lists external commands run at points in a conversation.
+type HooksConfig struct {
+	// Send hooks receive each message before it is sent, and may rewrite
+	// it (by printing the new text) or block it (by failing).
+	Send []Hook `yaml:"send"`
+	// Answer hooks receive every final answer on stdin.
+	Answer []Hook `yaml:"answer"`
+}
+
+// errBlocked is returned when a send hook refuses a message.
+var errBlocked = errors.New("blocked")
+
+// Hook is a command line run through the shell.
+type Hook struct {
+	Command string `yaml:"command"`
+	// Input is "text" (default), the answer alone, or "json", the answer
+	// with its metadata.
+	Input string `yaml:"input"`
+	// Timeout bounds the command (default 30s).
+	Timeout string `yaml:"timeout"`
+	// Personas limits the hook to answers from these personas.
+	Personas []string `yaml:"personas"`
+}
+
+// hookEvent is what a hook learns about a message: as JSON on stdin with
+// input: json, and always as CHAT_* environment variables. Send hooks get
+// it without the answer.
+type hookEvent struct {
+	Conversation     string   `json:"conversation"`
+	Message          int      `json:"message"`
+	Timestamp        string   `json:"timestamp"`
+	Model            string   `json:"model"`
+	Persona          string   `json:"persona"`
+	Tags             []string `json:"tags,omitempty"`
+	Question         string   `json:"question"`
+	Answer           string   `json:"answer,omitempty"`
+	Truncated        bool     `json:"truncated,omitempty"`
+	PromptTokens     int64    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int64    `json:"completion_tokens,omitempty"`
+}
+
+func (h Hook) check() error {
+	if strings.TrimSpace(h.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	switch h.Input {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("input must be text or json, not %q", h.Input)
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("timeout must be a duration such as 10s, not %q", h.Timeout)
+		}
+	}
+	return nil
+}
+
+func (h Hook) timeout() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+func (h Hook) appliesTo(persona string) bool {
+	return len(h.Personas) == 0 || slices.Contains(h.Personas, persona)
+}
+
+// runAnswerHooks passes the answer at index i to the answer hooks, in
+// order. Their output is shown after the answer; a failing hook is
+// reported and the others still run.
+func (s *session) runAnswerHooks(i int) {
+	if len(s.cfg.Hooks.Answer) == 0 {
+		return
+	}
+	msg := s.conv.Messages[i]
+	persona := cmp.Or(msg.Speaker, s.personaName())
+	event := hookEvent{
+		Conversation: s.conv.ID,
+		Message:      i + 1,
+		Timestamp:    msg.Timestamp,
+		Model:        s.model,
+		Persona:      persona,
+		Tags:         s.conv.Tags,
+		Answer:       msg.Content,
+		Truncated:    msg.Truncated,
+	}
+	if q := s.conv.lastIndex("user"); q >= 0 && q < i {
+		event.Question = s.conv.Messages[q].Content
+	}
+	if msg.Stats != nil {
+		event.Model = msg.Stats.Model
+		event.PromptTokens, event.CompletionTokens = msg.Stats.PromptTokens, msg.Stats.CompletionTokens
+	}
+	for _, h := range s.cfg.Hooks.Answer {
+		if !h.appliesTo(persona) {
+			continue
+		}
+		out, err := h.run(event, event.Answer)
+		if len(out) > 0 {
+			fmt.Print(paint(theme.Meta, string(out)))
+			if !bytes.HasSuffix(out, []byte("\n")) {
+				fmt.Println()
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: hook %q failed: %v\n", h.Command, err)
+		}
+	}
+}
+
+// beforeSend passes text through the send hooks in order, each getting
+// the previous one's output, and returns what is left to send. A hook
+// that fails or times out blocks the message; its stderr says why.
+func (c HooksConfig) beforeSend(persona string, event hookEvent) (string, error) {
+	text := event.Question
+	for _, h := range c.Send {
+		if !h.appliesTo(persona) {
+			continue
+		}
+		event.Question = text
+		out, err := h.run(event, text)
+		if err != nil {
+			return "", fmt.Errorf("%w by hook %q: %v", errBlocked, h.Command, err)
+		}
+		if out := strings.TrimRight(string(out), "\n"); out != "" {
+			text = out
+		}
+	}
+	return text, nil
+}
+
+// filterOutgoing runs the send hooks on a message typed in the session.
+// ok is false if a hook blocked it.
+func (s *session) filterOutgoing(text string) (string, bool) {
+	if len(s.cfg.Hooks.Send) == 0 {
+		return text, true
+	}
+	filtered, err := s.cfg.Hooks.beforeSend(s.personaName(), hookEvent{
+		Conversation: s.conv.ID,
+		Message:      len(s.conv.Messages) + 1,
+		Model:        s.model,
+		Persona:      s.personaName(),
+		Tags:         s.conv.Tags,
+		Question:     text,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: message not sent: %v\n", err)
+		s.exitCode = exitModerationBlocked
+		return "", false
+	}
+	if filtered != text {
+		info("%s\n", paint(theme.Meta, decor("  ⚙ rewritten by a send hook", "Message rewritten by a send hook")))
+	}
+	return filtered, true
+}
+
+// run feeds input (or the event as JSON) to the hook and returns what it
+// printed. A failure carries the hook's stderr.
+func (h Hook) run(event hookEvent, text string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	input := []byte(text)
+	if h.Input == "json" {
+		var err error
+		if input, err = json.Marshal(event); err != nil {
+			return nil, err
+		}
+	}
+	cmd := shellCommandContext(ctx, h.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	// Children of the shell may hold its output open after it is killed.
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"CHAT_CONVERSATION="+event.Conversation,
+		"CHAT_MESSAGE="+strconv.Itoa(event.Message),
+		"CHAT_TIMESTAMP="+event.Timestamp,
+		"CHAT_MODEL="+event.Model,
+		"CHAT_PERSONA="+event.Persona,
+		"CHAT_TAGS="+strings.Join(event.Tags, ","),
+		"CHAT_PROMPT_TOKENS="+strconv.FormatInt(event.PromptTokens, 10),
+		"CHAT_COMPLETION_TOKENS="+strconv.FormatInt(event.CompletionTokens, 10),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return out, fmt.Errorf("timed out after %s", h.timeout())
+	}
+	if msg := strings.TrimSpace(stderr.String()); err != nil && msg != "" {
+		err = errors.New(msg)
+	}
+	return out, err
+}
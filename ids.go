@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idFormat is how new conversations are named: ulid (the default), uuid
+// or unix. Conversations keep the names they were saved under, so files
+// named in any format are read alike.
+var idFormat = "ulid"
+
+// crockford is the alphabet of ULIDs: no I, L, O or U, so IDs can't be
+// misread or spell words.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newConversationID names a conversation started at now. ULIDs and UUIDs
+// (version 7) begin with the time, so they sort in the order conversations
+// were started, and end in random bits, so conversations started at the
+// same moment, even by different processes, don't collide. unix is the
+// seconds since 1970, as earlier versions named conversations; a second
+// conversation within the same second gets a suffix.
+func newConversationID(now time.Time) string {
+	switch idFormat {
+	case "uuid":
+		return "chat_" + newUUIDv7(now)
+	case "unix":
+		id := fmt.Sprintf("chat_%d", now.Unix())
+		for n := 2; ; n++ {
+			if _, err := os.Stat(filepath.Join(chatsDir, id+".xml")); err != nil {
+				return id
+			}
+			id = fmt.Sprintf("chat_%d_%d", now.Unix(), n)
+		}
+	}
+	return "chat_" + newULID(now)
+}
+
+// newULID returns a ULID: 48 bits of milliseconds and 80 random bits, in
+// 26 characters of Crockford's base32.
+func newULID(now time.Time) string {
+	var b [26]byte
+	ms := uint64(now.UnixMilli())
+	for i := 9; i >= 0; i-- {
+		b[i] = crockford[ms&31]
+		ms >>= 5
+	}
+	var random [10]byte
+	rand.Read(random[:])
+	for half := 0; half < 2; half++ {
+		// 40 bits make 8 characters.
+		var n uint64
+		for _, c := range random[half*5 : half*5+5] {
+			n = n<<8 | uint64(c)
+		}
+		for i := 7; i >= 0; i-- {
+			b[10+half*8+i] = crockford[n&31]
+			n >>= 5
+		}
+	}
+	return string(b[:])
+}
+
+// newUUIDv7 returns a version 7 UUID, which starts with the time in
+// milliseconds.
+func newUUIDv7(now time.Time) string {
+	var u [16]byte
+	rand.Read(u[:])
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixMilli()))
+	copy(u[:6], ms[2:])
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	h := hex.EncodeToString(u[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// newMessageID names a message: msg_ and 8 random characters of Crockford's
+// base32, which is plenty within one conversation. Messages keep their ID
+// when earlier ones are summarized, redacted or merged from another device,
+// so commands can refer to them by it.
+func newMessageID() string {
+	var random [5]byte
+	rand.Read(random[:])
+	return "msg_" + crockford40(random)
+}
+
+// crockford40 encodes 40 bits as 8 characters.
+func crockford40(b [5]byte) string {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	out := make([]byte, 8)
+	for i := 7; i >= 0; i-- {
+		out[i] = crockford[n&31]
+		n >>= 5
+	}
+	return string(out)
+}
+
+// assignMessageIDs gives IDs to messages saved before messages had them;
+// it is the migration to version 1 of the conversation format.
+// The IDs are derived from who sent a message and when, not its text, so
+// a conversation that isn't saved again, or is synced to another device
+// and redacted there, shows the same ones.
+func (c *Conversation) assignMessageIDs() {
+	taken := map[string]bool{}
+	for _, m := range c.Messages {
+		taken[m.ID] = true
+	}
+	for i := range c.Messages {
+		m := &c.Messages[i]
+		if m.ID != "" {
+			continue
+		}
+		seed := m.Role + "\x00" + m.Timestamp + "\x00" + m.ToolCallID + "\x00" + m.Speaker + "\x00"
+		for n := 0; m.ID == "" || taken[m.ID]; n++ {
+			sum := sha256.Sum256([]byte(seed + strconv.Itoa(n)))
+			m.ID = "msg_" + crockford40([5]byte(sum[:5]))
+		}
+		taken[m.ID] = true
+	}
+}
+
+// messageIndex finds a message by its number as show prints it (3 or #3)
+// or by its ID, and returns its index.
+func (c *Conversation) messageIndex(ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if n, err := strconv.Atoi(strings.TrimPrefix(ref, "#")); err == nil {
+		if n < 1 || n > len(c.Messages) {
+			return 0, fmt.Errorf("no message #%d; the conversation has %d", n, len(c.Messages))
+		}
+		return n - 1, nil
+	}
+	id := strings.TrimPrefix(ref, "#")
+	for i, m := range c.Messages {
+		if strings.EqualFold(m.ID, id) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no message %q in %s", ref, c.ID)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/openai/openai-go"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "image",
+		usage: "/image <prompt>",
+		help:  "Generate an image and add it to the conversation",
+		run:   cmdImage,
+	})
+}
+
+// generateImage asks DALL·E 3 for one image and returns it as PNG.
+func generateImage(ctx context.Context, client *openai.Client, prompt string) ([]byte, error) {
+	resp, err := client.Images.Generate(ctx, openai.ImageGenerateParams{
+		Prompt:         openai.F(prompt),
+		Model:          openai.F(openai.ImageModelDallE3),
+		ResponseFormat: openai.F(openai.ImageGenerateParamsResponseFormatB64JSON),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("no image was returned")
+	}
+	return base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
+}
+
+// cmdImage records the image as an assistant message so /open and show
+// find it. It is not sent back to the model with later requests.
+func cmdImage(s *session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /image <prompt>")
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	info("%s\n", paint(theme.Meta, "Generating image..."))
+	data, err := generateImage(ctx, s.client, args)
+	if err != nil {
+		return err
+	}
+
+	image := Attachment{Name: "image.png", Type: "image/png"}
+	var path string
+	if s.incognito {
+		// Incognito conversations leave nothing in the chats directory,
+		// and nothing behind once they end.
+		if path, err = s.tempFile("image-*.png", data); err != nil {
+			return err
+		}
+		image.data = data
+	} else {
+		ref, err := storeBlob(data, image.Type)
+		if err != nil {
+			return err
+		}
+		image.Ref = ref
+		if path, err = s.viewable(image); err != nil {
+			return err
+		}
+	}
+	s.conv.addMessage("assistant", "[generated image: "+args+"]")
+	s.conv.Messages[len(s.conv.Messages)-1].Attachments = []Attachment{image}
+	s.conv.Messages[len(s.conv.Messages)-1].Model = openai.ImageModelDallE3
+	s.save()
+	fmt.Printf("Image saved to %s\n", path)
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "images",
+		usage: "images gc [--older-than 90d] [--archive file.tar.zst] [--dry-run] [--yes]",
+		help:  "Delete or archive stored images and other attached files no conversation refers to, or older ones",
+		run:   runImages,
+	})
+}
+
+// storedImage is a stored attachment (see storeBlob) and the
+// conversations that refer to it.
+type storedImage struct {
+	ref     string
+	size    int64
+	modTime time.Time
+	users   []string
+}
+
+func runImages(cfg *Config, args []string) int {
+	fs := newFlagSet("images")
+	olderThan := fs.String("older-than", cfg.Retention.Images, "also collect files stored longer ago than this (e.g. 90d), dropping them from the conversations that show them")
+	archive := fs.String("archive", "", "write the files to this archive (.tar.zst or .tar.gz) before deleting them")
+	dryRun := fs.Bool("dry-run", false, "list the files without deleting them")
+	yes := fs.Bool("yes", false, "don't ask before deleting")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) != 1 || positional[0] != "gc" {
+		fmt.Fprintln(os.Stderr, "Usage: images gc [--older-than 90d] [--archive file.tar.zst] [--dry-run] [--yes]")
+		return exitError
+	}
+	maxAge, err := parseRetention(*olderThan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --older-than: %v (use e.g. 30d or 720h)\n", err)
+		return exitError
+	}
+	if *archive != "" {
+		comp, err := newCompressor(*archive, io.Discard)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		comp.Close()
+	}
+
+	images, convs, err := storedImages()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	var collect []storedImage
+	var size int64
+	for _, img := range images {
+		old := maxAge > 0 && time.Since(img.modTime) > maxAge
+		if len(img.users) > 0 && !old {
+			continue
+		}
+		note := "not referenced"
+		if len(img.users) > 0 {
+			note = fmt.Sprintf("stored %s, shown in %s", img.modTime.Format(time.DateOnly), strings.Join(img.users, ", "))
+		}
+		fmt.Printf("%s  %s  %s\n", img.ref, formatBytes(int(img.size)), note)
+		collect = append(collect, img)
+		size += img.size
+	}
+	what := fmt.Sprintf("%s (%s)", plural(int64(len(collect)), "file"), formatBytes(int(size)))
+	if len(collect) == 0 {
+		fmt.Println("No files to collect")
+		return exitOK
+	}
+	if *dryRun {
+		fmt.Printf("Would delete %s\n", what)
+		return exitOK
+	}
+	if !*yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprintln(os.Stderr, "Error: not deleting without confirmation; use --yes, or --dry-run to only list them")
+			return exitError
+		}
+		fmt.Printf("Delete %s? [y/N] ", what)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			fmt.Println("Nothing deleted")
+			return exitOK
+		}
+	}
+
+	if *archive != "" {
+		if err := archiveImages(*archive, collect); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: archive failed, nothing was deleted: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("Archived %s to %s\n", what, *archive)
+	}
+	if err := dropImages(convs, collect); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	for _, img := range collect {
+		if err := os.Remove(filepath.Join(chatsDir, filepath.FromSlash(img.ref))); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Printf("Deleted %s\n", what)
+	return exitOK
+}
+
+// storedImages lists the stored attachments with the conversations that
+// refer to them, and returns those conversations by ID. It fails if a
+// conversation can't be read, since its files would look unreferenced.
+func storedImages() ([]storedImage, map[string]*Conversation, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	convs := map[string]*Conversation{}
+	users := map[string][]string{}
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w; run fsck, as this conversation's files can't be told apart from unreferenced ones", err)
+		}
+		convs[conv.ID] = conv
+		for _, msg := range conv.Messages {
+			for _, a := range msg.Attachments {
+				if a.Ref != "" && !slices.Contains(users[a.Ref], conv.ID) {
+					users[a.Ref] = append(users[a.Ref], conv.ID)
+				}
+			}
+		}
+	}
+
+	var images []storedImage
+	err = walkBlobs(func(ref string, d fs.DirEntry) error {
+		st, err := d.Info()
+		if err != nil {
+			return err
+		}
+		images = append(images, storedImage{ref: ref, size: st.Size(), modTime: st.ModTime(), users: users[ref]})
+		return nil
+	})
+	return images, convs, err
+}
+
+// archiveImages writes stored files to an archive laid out like a backup, so
+// `backup restore` puts them back.
+func archiveImages(path string, images []storedImage) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	comp, err := newCompressor(path, out)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(comp)
+	manifest := backupManifest{CreatedAt: time.Now().Format(time.RFC3339), Files: map[string]string{}}
+	for _, img := range images {
+		data, err := os.ReadFile(filepath.Join(chatsDir, filepath.FromSlash(img.ref)))
+		if err != nil {
+			return err
+		}
+		entry := "chats/" + img.ref
+		manifest.Files[entry] = sha256Hex(data)
+		if err := writeTarFile(tw, entry, data); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, manifestName, data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := comp.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// dropImages removes the attachments referring to the stored files from
+// the conversations that show them.
+func dropImages(convs map[string]*Conversation, images []storedImage) error {
+	gone := map[string]bool{}
+	touched := map[string]bool{}
+	for _, img := range images {
+		gone[img.ref] = true
+		for _, id := range img.users {
+			touched[id] = true
+		}
+	}
+	for id := range touched {
+		conv := convs[id]
+		for i := range conv.Messages {
+			conv.Messages[i].Attachments = slices.DeleteFunc(conv.Messages[i].Attachments, func(a Attachment) bool {
+				return gone[a.Ref]
+			})
+		}
+		if err := conv.save(); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return nil
+}
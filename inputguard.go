@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// defaultInputGuard is the message size, in bytes, above which sending
+// needs confirmation when input_guard is not set.
+const defaultInputGuard = 32 * 1024
+
+// confirmSize asks before sending a message larger than the input guard,
+// which is usually a file pasted by mistake. Piped input is never held up.
+func (s *session) confirmSize(text string) bool {
+	limit := s.cfg.InputGuard
+	if limit == 0 {
+		limit = defaultInputGuard
+	}
+	if limit < 0 || len(text) <= limit || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return true
+	}
+	// About four bytes to a token in English text.
+	question := fmt.Sprintf("Send %s / ~%s tokens? [y/N] ", formatBytes(len(text)), formatTokens(int64(len(text)/4)))
+	answer, err := s.input.ReadLine(question)
+	if err != nil || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		info("Not sent\n")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IssuesConfig configures issue triage against the GitHub API.
+type IssuesConfig struct {
+	// Token falls back to the GITHUB_TOKEN environment variable. Public
+	// repositories work without one, at a low rate limit.
+	Token Credential `yaml:"token"`
+	// Template is a file with triage instructions replacing the built-in
+	// ones, e.g. to describe the project's labelling rules.
+	Template string `yaml:"template"`
+	Model    string `yaml:"model"`
+}
+
+const defaultTriageTemplate = `You triage GitHub issues for the maintainers. For each issue:
+- summarize it in one sentence;
+- propose labels, chosen only from the repository's existing labels;
+- if it duplicates another issue in the list, give that issue's number;
+- propose one action: "close-duplicate", "needs-info", "label", "good-first-issue" or "leave".
+Keep labels an issue already has unless they are clearly wrong.`
+
+const triageFormat = `Answer with only a JSON array, one object per issue, in this form:
+[{"number": 12, "summary": "...", "labels": ["bug"], "duplicate_of": 0, "action": "label", "reason": "..."}]
+Use 0 for duplicate_of when there is no duplicate.`
+
+const githubAPI = "https://api.github.com"
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "issues",
+		usage: "issues triage --repo owner/name [--limit n] [--json]",
+		help:  "Propose labels, summaries and duplicates for open GitHub issues",
+		run:   runIssues,
+	})
+}
+
+type githubIssue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+type triageProposal struct {
+	Number      int      `json:"number"`
+	Summary     string   `json:"summary"`
+	Labels      []string `json:"labels"`
+	DuplicateOf int      `json:"duplicate_of"`
+	Action      string   `json:"action"`
+	Reason      string   `json:"reason"`
+}
+
+var repoPattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+func runIssues(cfg *Config, args []string) int {
+	fs := newFlagSet("issues")
+	repo := fs.String("repo", "", "repository as owner/name")
+	limit := fs.Int("limit", 30, "number of most recently updated open issues to triage (max 100)")
+	asJSON := fs.Bool("json", false, "print the proposals as JSON")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 || rest[0] != "triage" || !repoPattern.MatchString(*repo) {
+		fmt.Fprintln(os.Stderr, "Usage: issues triage --repo owner/name [--limit n] [--json]")
+		return exitError
+	}
+	*limit = min(max(*limit, 1), 100)
+
+	template := defaultTriageTemplate
+	if cfg.Issues.Template != "" {
+		data, err := os.ReadFile(expandHome(cfg.Issues.Template))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: issues.template: %v\n", err)
+			return exitError
+		}
+		template = string(data)
+	}
+
+	token, err := cfg.Issues.Token.resolve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: issues.token: %v\n", err)
+		return exitError
+	}
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	ctx := context.Background()
+	var issues []githubIssue
+	q := url.Values{"state": {"open"}, "sort": {"updated"}, "per_page": {fmt.Sprint(*limit)}}
+	if err := githubGet(ctx, token, "/repos/"+*repo+"/issues?"+q.Encode(), &issues); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	// The issues endpoint includes pull requests.
+	var open []githubIssue
+	for _, is := range issues {
+		if is.PullRequest == nil {
+			open = append(open, is)
+		}
+	}
+	if len(open) == 0 {
+		fmt.Println("No open issues")
+		return exitOK
+	}
+	var labels []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := githubGet(ctx, token, "/repos/"+*repo+"/labels?per_page=100", &labels); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Repository labels:\n")
+	for _, l := range labels {
+		fmt.Fprintf(&prompt, "- %s: %s\n", l.Name, l.Description)
+	}
+	prompt.WriteString("\nOpen issues:\n")
+	for _, is := range open {
+		var current []string
+		for _, l := range is.Labels {
+			current = append(current, l.Name)
+		}
+		fmt.Fprintf(&prompt, "\n#%d\nLabels: %s\n%s\n", is.Number, strings.Join(current, ", "),
+			untrusted(fmt.Sprintf("issue #%d", is.Number), is.Title+"\n\n"+truncate(is.Body, 1000)))
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	model := cfg.Issues.Model
+	if model == "" {
+		model = cfg.baseModel()
+	}
+	info("Triaging %d issues in %s...\n", len(open), *repo)
+	r, err := ask(ctx, client, model, template+"\n\n"+triageFormat, prompt.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	var proposals []triageProposal
+	if err := json.Unmarshal([]byte(stripCodeFence(r.content)), &proposals); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: the model's answer is not the expected JSON: %v\n", err)
+		fmt.Fprintln(os.Stderr, r.content)
+		return exitAPIError
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(proposals, "", "  ")
+		fmt.Println(string(out))
+		return exitOK
+	}
+	titles := map[int]string{}
+	for _, is := range open {
+		titles[is.Number] = is.Title
+	}
+	for _, p := range proposals {
+		fmt.Printf("%s %s\n", paint(theme.Heading, fmt.Sprintf("#%d", p.Number)), titles[p.Number])
+		fmt.Printf("  %s\n", p.Summary)
+		action := p.Action
+		if p.DuplicateOf != 0 {
+			action += fmt.Sprintf(" (duplicate of #%d)", p.DuplicateOf)
+		}
+		fmt.Printf("  action: %s\n", paint(theme.Accent, action))
+		if len(p.Labels) > 0 {
+			fmt.Printf("  labels: %s\n", strings.Join(p.Labels, ", "))
+		}
+		if p.Reason != "" {
+			fmt.Printf("  why:    %s\n", p.Reason)
+		}
+		fmt.Println()
+	}
+	info("These are proposals only; nothing was changed on GitHub.\n")
+	return exitOK
+}
+
+// stripCodeFence removes a ``` fence models like to wrap JSON in.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
+
+func githubGet(ctx context.Context, token, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("GitHub API: %s: %s", resp.Status, body.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Editor actions that keys can be bound to.
+const (
+	actSend         = "send"
+	actNewline      = "newline"
+	actCancel       = "cancel"
+	actRetry        = "retry"
+	actCopyLast     = "copy-last"
+	actEOF          = "eof"
+	actHistoryPrev  = "history-prev"
+	actHistoryNext  = "history-next"
+	actLeft         = "left"
+	actRight        = "right"
+	actHome         = "home"
+	actEnd          = "end"
+	actWordLeft     = "word-left"
+	actWordRight    = "word-right"
+	actBackspace    = "backspace"
+	actDelete       = "delete"
+	actKillEnd      = "kill-end"
+	actKillStart    = "kill-start"
+	actKillWord     = "kill-word"
+	actClearScreen  = "clear-screen"
+	actNormalMode   = "normal-mode"
+	actInsertMode   = "insert-mode"
+	actAppend       = "append"
+	actAppendEnd    = "append-end"
+	actInsertStart  = "insert-start"
+	actSubstituteLn = "substitute-line"
+	actSwitch       = "switch-conversation"
+	actNew          = "new-conversation"
+)
+
+// keymap maps key names (see readKey) to actions. Vi uses a second map
+// for normal mode; emacs leaves it nil. Panes are the full-screen mode's
+// own keys, which apply on an empty line before the others.
+type keymap struct {
+	insert map[string]string
+	normal map[string]string
+	panes  map[string]string
+}
+
+var paneBindings = map[string]string{
+	"ctrl+o": actSwitch,
+	"ctrl+n": actNew,
+}
+
+var emacsBindings = map[string]string{
+	"enter":     actSend,
+	"alt+enter": actNewline,
+	"ctrl+j":    actNewline,
+	"ctrl+c":    actCancel,
+	"ctrl+r":    actRetry,
+	"ctrl+y":    actCopyLast,
+	"ctrl+d":    actEOF,
+	"up":        actHistoryPrev,
+	"ctrl+p":    actHistoryPrev,
+	"down":      actHistoryNext,
+	"ctrl+n":    actHistoryNext,
+	"left":      actLeft,
+	"ctrl+b":    actLeft,
+	"right":     actRight,
+	"ctrl+f":    actRight,
+	"home":      actHome,
+	"ctrl+a":    actHome,
+	"end":       actEnd,
+	"ctrl+e":    actEnd,
+	"alt+b":     actWordLeft,
+	"alt+f":     actWordRight,
+	"backspace": actBackspace,
+	"delete":    actDelete,
+	"ctrl+k":    actKillEnd,
+	"ctrl+u":    actKillStart,
+	"ctrl+w":    actKillWord,
+	"ctrl+l":    actClearScreen,
+}
+
+var viInsertBindings = map[string]string{
+	"enter":     actSend,
+	"alt+enter": actNewline,
+	"ctrl+j":    actNewline,
+	"ctrl+c":    actCancel,
+	"ctrl+d":    actEOF,
+	"esc":       actNormalMode,
+	"up":        actHistoryPrev,
+	"down":      actHistoryNext,
+	"left":      actLeft,
+	"right":     actRight,
+	"home":      actHome,
+	"end":       actEnd,
+	"backspace": actBackspace,
+	"delete":    actDelete,
+	"ctrl+w":    actKillWord,
+	"ctrl+u":    actKillStart,
+	"ctrl+l":    actClearScreen,
+}
+
+var viNormalBindings = map[string]string{
+	"enter":  actSend,
+	"ctrl+c": actCancel,
+	"ctrl+d": actEOF,
+	"ctrl+r": actRetry,
+	"y":      actCopyLast,
+	"k":      actHistoryPrev,
+	"up":     actHistoryPrev,
+	"j":      actHistoryNext,
+	"down":   actHistoryNext,
+	"h":      actLeft,
+	"left":   actLeft,
+	"l":      actRight,
+	"right":  actRight,
+	"0":      actHome,
+	"$":      actEnd,
+	"b":      actWordLeft,
+	"w":      actWordRight,
+	"x":      actDelete,
+	"D":      actKillEnd,
+	"S":      actSubstituteLn,
+	"i":      actInsertMode,
+	"a":      actAppend,
+	"A":      actAppendEnd,
+	"I":      actInsertStart,
+	"ctrl+l": actClearScreen,
+}
+
+func newKeymap(cfg KeybindingsConfig) (*keymap, error) {
+	km := &keymap{panes: copyBindings(paneBindings)}
+	switch cfg.Preset {
+	case "", "emacs":
+		km.insert = copyBindings(emacsBindings)
+	case "vi":
+		km.insert = copyBindings(viInsertBindings)
+		km.normal = copyBindings(viNormalBindings)
+	default:
+		return nil, fmt.Errorf("unknown keybinding preset %q (want emacs or vi)", cfg.Preset)
+	}
+
+	for action, keys := range cfg.Bind {
+		if !knownAction(action) {
+			return nil, fmt.Errorf("unknown keybinding action %q", action)
+		}
+		km.rebind(action, strings.Split(keys, ","))
+	}
+	return km, nil
+}
+
+func (km *keymap) rebind(action string, keys []string) {
+	maps := []map[string]string{km.insert, km.normal}
+	if action == actSwitch || action == actNew {
+		maps = []map[string]string{km.panes}
+	}
+	for _, m := range maps {
+		if m == nil {
+			continue
+		}
+		for k, a := range m {
+			if a == action {
+				delete(m, k)
+			}
+		}
+		for _, k := range keys {
+			if k = keyName(k); k != "" {
+				m[k] = action
+			}
+		}
+	}
+}
+
+// keyName writes a key from the config as readKey names it. Names and
+// modifiers are case-insensitive, but a printable key keeps its case, as
+// vi's D and d are different keys; with Ctrl, letters are lower case.
+func keyName(k string) string {
+	k = strings.TrimSpace(k)
+	mods, key := "", k
+	if i := strings.LastIndex(k, "+"); i > 0 && i < len(k)-1 {
+		mods, key = strings.ToLower(k[:i+1]), k[i+1:]
+	}
+	if utf8.RuneCountInString(key) > 1 || strings.Contains(mods, "ctrl") {
+		key = strings.ToLower(key)
+	}
+	return mods + key
+}
+
+// keyFor returns a key bound to action in m, the first in order, or "".
+func (km *keymap) keyFor(m map[string]string, action string) string {
+	var keys []string
+	for k, a := range m {
+		if a == action {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	slices.Sort(keys)
+	return keys[0]
+}
+
+// keyLabel writes a key name as help text shows it: ^O for ctrl+o.
+func keyLabel(k string) string {
+	if letter, ok := strings.CutPrefix(k, "ctrl+"); ok {
+		return "^" + strings.ToUpper(letter)
+	}
+	return k
+}
+
+// cancels reports whether k is bound to cancel, which stops the request
+// in progress in the full-screen mode.
+func (km *keymap) cancels(k string) bool {
+	return km.insert[k] == actCancel || km.normal[k] == actCancel
+}
+
+func copyBindings(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func knownAction(action string) bool {
+	for _, m := range []map[string]string{emacsBindings, viInsertBindings, viNormalBindings, paneBindings} {
+		for _, a := range m {
+			if a == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readKey decodes one key press from a terminal in raw mode and returns
+// its name: a printable character as itself, or names such as "enter",
+// "ctrl+a", "alt+b", "up" and "delete".
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case c == '\r':
+		return "enter", nil
+	case c == '\t':
+		return "tab", nil
+	case c == 0x7f || c == 0x08:
+		return "backspace", nil
+	case c == 0x1b:
+		return readEscape(r)
+	case c >= 1 && c <= 26:
+		return "ctrl+" + string(rune('a'+c-1)), nil
+	case c < 0x20:
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// readEscape decodes what follows an ESC byte. Terminals send escape
+// sequences in a single write, so an ESC with nothing buffered behind it
+// is a lone Escape key press.
+func readEscape(r *bufio.Reader) (string, error) {
+	if r.Buffered() == 0 {
+		return "esc", nil
+	}
+	next, _ := r.Peek(1)
+	if next[0] != '[' && next[0] != 'O' {
+		k, err := readKey(r)
+		if err != nil || k == "" || k == "esc" {
+			return k, err
+		}
+		return "alt+" + k, nil
+	}
+	r.ReadByte()
+
+	var seq strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq.WriteByte(b)
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	switch seq.String() {
+	case "A":
+		return "up", nil
+	case "B":
+		return "down", nil
+	case "C":
+		return "right", nil
+	case "D":
+		return "left", nil
+	case "H", "1~", "7~":
+		return "home", nil
+	case "F", "4~", "8~":
+		return "end", nil
+	case "3~":
+		return "delete", nil
+	case "5~":
+		return "pgup", nil
+	case "6~":
+		return "pgdn", nil
+	case "1;3C", "1;5C":
+		return "alt+f", nil
+	case "1;3D", "1;5D":
+		return "alt+b", nil
+	case "200~":
+		return "paste", nil
+	}
+	return "", nil
+}
+
+// readPaste reads bracketed pasted text up to the end marker. Line
+// breaks become newlines and other control characters are dropped.
+func readPaste(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		if c == 0x1b {
+			if next, _ := r.Peek(len(pasteEnd) - 1); string(next) == pasteEnd[1:] {
+				r.Discard(len(next))
+				break
+			}
+			continue
+		}
+		switch {
+		case c == '\r':
+			if next, _ := r.Peek(1); len(next) == 1 && next[0] == '\n' {
+				continue
+			}
+			sb.WriteRune('\n')
+		case c == '\n' || c == '\t' || c >= 0x20:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+var namedKeys = map[string]bool{
+	"enter": true, "tab": true, "esc": true, "backspace": true, "delete": true,
+	"up": true, "down": true, "left": true, "right": true, "home": true, "end": true,
+	"pgup": true, "pgdn": true,
+}
+
+// validKeyName reports whether k is a key name readKey can produce.
+func validKeyName(k string) bool {
+	if rest, ok := strings.CutPrefix(k, "alt+"); ok {
+		return validKeyName(rest)
+	}
+	if rest, ok := strings.CutPrefix(k, "ctrl+"); ok {
+		return len(rest) == 1 && rest[0] >= 'a' && rest[0] <= 'z'
+	}
+	return namedKeys[k] || isPrintableKey(k)
+}
+
+func isPrintableKey(k string) bool {
+	runes := []rune(k)
+	return len(runes) == 1 && unicode.IsPrint(runes[0])
+}
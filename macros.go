@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// macroStep is one replayed line. A pause step asks the user for a line
+// at replay time instead of using recorded text.
+type macroStep struct {
+	Text  string `json:"text,omitempty"`
+	Pause bool   `json:"pause,omitempty"`
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "macro",
+		usage: "/macro record | pause [prompt] | stop <name> | run <name> | list | delete <name>",
+		help:  "Record and replay sequences of commands and prompts",
+		run:   cmdMacro,
+	})
+}
+
+func loadMacros() (map[string][]macroStep, error) {
+	macros := map[string][]macroStep{}
+	err := loadConfigJSON("macros.json", &macros)
+	return macros, err
+}
+
+func cmdMacro(s *session, args string) error {
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch sub {
+	case "record":
+		if s.recording != nil {
+			return fmt.Errorf("already recording; use /macro stop <name>")
+		}
+		s.recording = []macroStep{}
+		info("Recording macro. Use /macro pause [prompt] to ask for input on replay, /macro stop <name> to finish.\n")
+	case "pause":
+		if s.recording == nil {
+			return fmt.Errorf("not recording")
+		}
+		if rest == "" {
+			rest = "Input"
+		}
+		s.recording = append(s.recording, macroStep{Text: rest, Pause: true})
+	case "stop":
+		if s.recording == nil {
+			return fmt.Errorf("not recording")
+		}
+		if !namePattern.MatchString(rest) {
+			return fmt.Errorf("usage: /macro stop <name>")
+		}
+		macros, err := loadMacros()
+		if err != nil {
+			return err
+		}
+		macros[rest] = s.recording
+		s.recording = nil
+		if err := saveConfigJSON("macros.json", macros); err != nil {
+			return err
+		}
+		info("Macro %s saved (%d steps)\n", rest, len(macros[rest]))
+	case "run":
+		macros, err := loadMacros()
+		if err != nil {
+			return err
+		}
+		steps, ok := macros[rest]
+		if !ok {
+			return fmt.Errorf("no macro named %q", rest)
+		}
+		s.pending = append(append([]macroStep{}, steps...), s.pending...)
+	case "delete":
+		macros, err := loadMacros()
+		if err != nil {
+			return err
+		}
+		if _, ok := macros[rest]; !ok {
+			return fmt.Errorf("no macro named %q", rest)
+		}
+		delete(macros, rest)
+		return saveConfigJSON("macros.json", macros)
+	case "list", "":
+		macros, err := loadMacros()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(macros))
+		for name := range macros {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-12s %d steps\n", name, len(macros[name]))
+		}
+	default:
+		return fmt.Errorf("usage: %s", commands["macro"].usage)
+	}
+	return nil
+}
+
+// recordInput appends a line typed by the user to the macro being
+// recorded. Macro commands themselves are never recorded, which also rules
+// out a macro replaying itself.
+func (s *session) recordInput(line string) {
+	if s.recording == nil || strings.HasPrefix(line, "/macro") {
+		return
+	}
+	s.recording = append(s.recording, macroStep{Text: line})
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
 	"context"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,103 +18,422 @@ import (
 )
 
 type Conversation struct {
-	XMLName   xml.Name  `xml:"conversation"`
-	ID        string    `xml:"id,attr"`
-	CreatedAt string    `xml:"created_at,attr"`
-	Messages  []Message `xml:"messages>message"`
+	XMLName xml.Name `xml:"conversation"`
+	// Version is the version of the file format; see migrations.
+	Version   int      `xml:"version,attr,omitempty"`
+	ID        string   `xml:"id,attr"`
+	CreatedAt string   `xml:"created_at,attr"`
+	Persona   string   `xml:"persona,attr,omitempty"`
+	Template  string   `xml:"template,attr,omitempty"`
+	Tags      []string `xml:"tags>tag,omitempty"`
+	// Usage totals the tokens and cost of every request made for the
+	// conversation.
+	Usage *Usage `xml:"usage,omitempty"`
+	// Summary stands in for the older messages when the conversation is
+	// sent, once it grows too long for the context window.
+	Summary  *ContextSummary `xml:"summary,omitempty"`
+	Messages []Message       `xml:"messages>message"`
 }
 
 type Message struct {
+	// ID names the message within its conversation; see newMessageID.
+	ID        string `xml:"id,attr,omitempty"`
 	Role      string `xml:"role,attr"`
 	Content   string `xml:"content"`
 	Timestamp string `xml:"timestamp,attr"`
+	Redacted  bool   `xml:"redacted,attr,omitempty"`
+	// ToolCalls are set on assistant messages that invoked tools;
+	// ToolCallID links a role="tool" result message to its call.
+	ToolCalls  []ToolCall `xml:"tool_calls>tool_call,omitempty"`
+	ToolCallID string     `xml:"tool_call_id,attr,omitempty"`
+	// Approval is "approved" or "declined" on the results of tool calls
+	// that needed confirmation.
+	Approval string `xml:"approval,attr,omitempty"`
+	// Speaker is the persona that wrote an assistant message when several
+	// take turns.
+	Speaker string `xml:"speaker,attr,omitempty"`
+	// Model is the model that wrote an assistant message, and Route the
+	// class of turn model_router sent it to that model as.
+	Model       string       `xml:"model,attr,omitempty"`
+	Route       string       `xml:"route,attr,omitempty"`
+	Attachments []Attachment `xml:"attachments>attachment,omitempty"`
+	// Trace records the internal calls that produced an assistant message.
+	Trace []TraceStep `xml:"trace>step,omitempty"`
+	// Truncated marks an answer that stopped at the length limit.
+	Truncated bool `xml:"truncated,attr,omitempty"`
+	// Stats are the timings and token counts of an assistant message.
+	Stats *ReplyStats `xml:"stats,omitempty"`
 }
 
 const (
-	chatsDir     = "chats"
 	systemPrompt = "You are a helpful assistant. Provide clear, concise, and accurate responses."
 	defaultModel = "gpt-5"
 )
 
+// Exit codes returned to the shell so wrapper scripts can branch on the
+// outcome of a session. When several turns fail, the last failure wins.
+const (
+	exitOK                = 0
+	exitError             = 1
+	exitAPIError          = 2
+	exitModerationBlocked = 3
+	exitBudgetExceeded    = 4
+	exitTimeout           = 5
+)
+
+// dataDir holds program data other than settings, and chatsDir the
+// conversations within it; see applyGlobals for where they are.
+var (
+	dataDir  = "."
+	chatsDir = "chats"
+)
+
+var quiet bool
+
+// Flags of the interactive chat. Subcommands define their own.
+var (
+	providerFlag  = flag.String("provider", "", "chat backend: openai, anthropic, ollama or azure (see providers in config.yaml)")
+	modelFlag     = flag.String("model", "", "model to chat with, overriding the config, persona and template")
+	timeoutFlag   = flag.Duration("timeout", 0, "abort a request after this long (e.g. 30s); 0 disables")
+	personaFlag   = flag.String("persona", "", "persona from the config file to chat with")
+	statusFlag    = flag.Bool("status", false, "show a status line with model, persona, tokens and cost")
+	tagsFlag      = flag.String("tag", "", "comma-separated tags for the new conversation")
+	incognitoFlag = flag.Bool("incognito", false, "write nothing to disk: no conversation file, drafts or history")
+	castFlag      = flag.String("cast", "", "comma-separated personas that take turns replying")
+	reflectFlag   = flag.Bool("reflect", false, "have the model critique and revise each answer before showing it (costs extra tokens)")
+	noStreamFlag  = flag.Bool("no-stream", false, "wait for each answer to be complete instead of printing it as it arrives")
+	verifyFlag    = flag.Bool("verify", false, "check answers based on tool results or attachments against those sources, and flag unsupported claims")
+	timeFlag      = flag.Bool("time", false, "tell the model the current date, time and time zone with every request")
+	speakFlag     = flag.Bool("speak", false, "read answers aloud (see speech in config.yaml)")
+	continueFlag  = flag.Int("auto-continue", 0, "continue answers cut off at the length limit up to this many times")
+	statsFlag     = flag.Bool("stats", false, "show the time and tokens each answer took, and the tokens per second")
+	promptFlag    = flag.String("p", "", "ask this question, print the answer and exit; text piped to stdin is sent with it")
+)
+
+func init() {
+	flag.BoolVar(&quiet, "quiet", false, "suppress banners and prompts; print only assistant replies")
+	flag.BoolVar(&plainOutput, "plain", false, "print answers as the model wrote them, without rendering markdown")
+	flag.BoolVar(&accessible, "a11y", false, "accessibility mode: plain text for screen readers, without colors, symbols or markdown")
+	flag.StringVar(&profileName, "profile", os.Getenv("CHAT_PROFILE"), "profile from the config file, with its own conversations and encryption key")
+	flag.StringVar(&configFile, "config", os.Getenv(configEnv), "config file to use instead of config.yaml in the user config directory")
+	flag.StringVar(&logFormat, "log-format", "", "text or json: write errors, warnings and status messages to stderr as JSON lines")
+}
+
+// globalFlags also go before a subcommand, e.g. --profile work digest.
+var globalFlags = map[string]*string{"profile": &profileName, "config": &configFile, "log-format": &logFormat}
+
 func main() {
-	apiKey := os.Getenv("OPENAI_KEY")
-	if apiKey == "" {
-		fmt.Println("Error: OPENAI_KEY environment variable not set")
-		fmt.Println("Please set it with: export OPENAI_KEY='your-api-key'")
-		os.Exit(1)
+	for len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "--") {
+		name, value, hasValue := strings.Cut(os.Args[1][2:], "=")
+		p, ok := globalFlags[name]
+		if !ok || !hasValue && len(os.Args) < 3 {
+			break
+		}
+		if hasValue {
+			*p = value
+			os.Args = slices.Delete(os.Args, 1, 2)
+		} else {
+			*p = os.Args[2]
+			os.Args = slices.Delete(os.Args, 1, 3)
+		}
+	}
+	// new starts a chat, like no subcommand at all, and resume continues
+	// one: the given one, or one picked from a list.
+	if len(os.Args) > 1 && os.Args[1] == "new" {
+		os.Args = slices.Delete(os.Args, 1, 2)
+	} else if len(os.Args) > 1 && os.Args[1] == "resume" {
+		*resumeFlag = resumePick
+		if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "-") {
+			*resumeFlag = os.Args[2]
+			os.Args = slices.Delete(os.Args, 2, 3)
+		}
+		os.Args = slices.Delete(os.Args, 1, 2)
+	}
+	var sub *subcommand
+	if len(os.Args) > 1 {
+		sub = subcommands[os.Args[1]]
+	}
+	if sub == nil {
+		flag.Parse()
+		if oneShot() {
+			quiet = true
+		}
+		if needsSetup() {
+			if code := runSetup(nil, nil); code != exitOK {
+				os.Exit(code)
+			}
+			fmt.Println()
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+	if err := cfg.applyGlobals(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+	switch logFormat = cmp.Or(logFormat, cfg.LogFormat, "text"); logFormat {
+	case "text":
+	case "json":
+		startJSONLogs()
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --log-format must be text or json, not %q\n", logFormat)
+		os.Exit(exitError)
+	}
+
+	if sub != nil {
+		exit(sub.run(cfg, os.Args[2:]))
+	}
+	exit(run(cfg))
+}
+
+func run(cfg *Config) int {
+	client, err := newClient(cfg)
+	if errors.Is(err, errNoAPIKey) && cmp.Or(*providerFlag, cfg.Provider, "openai") != "openai" {
+		// Chatting with another provider works without an OpenAI key;
+		// images, speech and the like fail when used.
+		client, err = openai.NewClient(option.WithHTTPClient(apiHTTPClient())), nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	provider, model, err := cfg.chatProvider(*providerFlag, client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
 	}
 
 	if err := os.MkdirAll(chatsDir, 0755); err != nil {
-		fmt.Printf("Error creating chats directory: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error creating chats directory: %v\n", err)
+		return exitError
 	}
 
-	client := openai.NewClient(
-		option.WithAPIKey(apiKey),
-	)
+	pullOnStart(cfg)
+	defer commitOnExit(cfg)
+
+	if removed, err := enforceRetention(cfg.Retention, time.Now(), false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: retention cleanup failed: %v\n", err)
+	} else if len(removed) > 0 {
+		info("Deleted %d expired conversations\n", len(removed))
+	}
 
-	conv := newConversation()
+	input, err := newLineReader(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	var ui *tui
+	if (*tuiFlag || cfg.TUI) && !oneShot() {
+		if ui, err = newTUI(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			input = ui
+			defer ui.close()
+		}
+	}
 
-	fmt.Println("=== OpenAI CLI Chat ===")
-	fmt.Println("Type your messages and press Enter. Type 'exit' or 'quit' to end the conversation.")
-	fmt.Println()
+	var tmpl ChatTemplate
+	if *templateFlag != "" {
+		if tmpl, err = findTemplate(*templateFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	personaName := cmp.Or(*personaFlag, tmpl.Persona, cfg.DefaultPersona)
+	persona, err := cfg.resolvePersona(personaName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	// Personas without a model of their own go back to this one.
+	defaultModel := cmp.Or(*modelFlag, model)
+	if persona.Model != "" {
+		model = persona.Model
+	}
+	model = cmp.Or(*modelFlag, tmpl.Model, model)
+	if cfg.HTTP.WarmUp && cmp.Or(*providerFlag, cfg.Provider, "openai") == "openai" {
+		go warmUp(client, model)
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	ctx := context.Background()
+	snippets, err := loadSnippets()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
 
-	for {
-		fmt.Print("You: ")
-		if !scanner.Scan() {
-			break
+	sess := &session{
+		conv:         newConversation(persona.SystemPrompt),
+		provider:     provider,
+		client:       client,
+		cfg:          cfg,
+		input:        input,
+		model:        model,
+		defaultModel: defaultModel,
+		timeout:      *timeoutFlag,
+		incognito:    *incognitoFlag,
+		injectTime:   *timeFlag || cfg.InjectTime,
+		reflect:      *reflectFlag,
+		verify:       *verifyFlag || cfg.Verify,
+		noStream:     *noStreamFlag || cfg.NoStream,
+		readAloud:    *speakFlag || cfg.Speech.Speak || accessible && cfg.A11y.Speak,
+		stats:        *statsFlag || cfg.Stats,
+		maxContinues: cmp.Or(*continueFlag, cfg.AutoContinue),
+		vars:         map[string]string{},
+		snippets:     snippets,
+	}
+	defer sess.removeTempFiles()
+	if personaName != "default" {
+		sess.conv.Persona = personaName
+	}
+	sess.conv.addTags(strings.Split(*tagsFlag, ",")...)
+	if *castFlag != "" {
+		if err := sess.setCast(strings.Split(*castFlag, ",")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
 		}
+	}
+	if ui != nil {
+		// The full-screen mode has its own status bar.
+		sess.ui = ui
+		ui.status = func() string { return sess.conv.ID + " │ " + sess.statusText() }
+		ui.ed.onCopyLast = func() { sess.copyLast() }
+		ui.ed.history = loadHistory(cfg.HistorySize, !sess.incognito)
+	} else {
+		sess.status = newStatusLine(*statusFlag || cfg.StatusLine)
+		defer sess.status.close()
+	}
 
-		userInput := strings.TrimSpace(scanner.Text())
-		if userInput == "" {
-			continue
+	if ed, ok := input.(*editor); ok {
+		ed.onCopyLast = func() { sess.copyLast() }
+		ed.history = loadHistory(cfg.HistorySize, !sess.incognito)
+		if sess.status != nil {
+			ed.afterRender = func() { sess.status.refresh(sess) }
 		}
+	}
 
-		if userInput == "exit" || userInput == "quit" {
-			fmt.Println("Saving conversation and exiting...")
-			break
+	info("=== OpenAI CLI Chat ===\n")
+	info("Type your messages and press Enter. Type 'exit' or 'quit' to end the conversation.\n")
+	if sess.incognito {
+		info("Incognito: nothing from this conversation will be written to disk.\n")
+	}
+	info("\n")
+	if *resumeFlag != "" {
+		if *templateFlag != "" {
+			fmt.Fprintln(os.Stderr, "Error: --template starts a new conversation and can't be used with --resume")
+			return exitError
 		}
+		conv, err := sess.pickResumed(*resumeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if err := sess.resume(conv); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		sess.conv.addTags(strings.Split(*tagsFlag, ",")...)
+	}
+	if *templateFlag != "" {
+		sess.applyTemplate(*templateFlag, tmpl)
+	}
+	if *modelFlag != "" {
+		sess.pinModel(*modelFlag)
+	}
+	sess.status.refresh(sess)
 
-		conv.addMessage("user", userInput)
+	if oneShot() {
+		sess.ask(*promptFlag)
+	} else {
+		sess.chat()
+	}
 
-		if err := conv.save(); err != nil {
-			fmt.Printf("Warning: Failed to save conversation: %v\n", err)
+	if sess.incognito {
+		info("Incognito conversation discarded\n")
+		return sess.exitCode
+	}
+	if sess.saveAnswered && sess.conv.lastIndex("assistant") != len(sess.conv.Messages)-1 {
+		// A failed -p request leaves no conversation behind.
+		return sess.exitCode
+	}
+
+	if err := sess.conv.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving conversation: %v\n", err)
+		return exitError
+	}
+
+	info("Conversation saved to: %s\n", sess.conv.getFilePath())
+	return sess.exitCode
+}
+
+// chat reads messages and commands until the user leaves.
+func (s *session) chat() {
+	for {
+		line, ok := s.nextInput()
+		if !ok {
+			return
 		}
 
-		response, err := callOpenAI(ctx, client, conv)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+		userInput := strings.TrimSpace(line)
+		if userInput == "" {
 			continue
 		}
 
-		fmt.Printf("Assistant: %s\n\n", response)
-
-		conv.addMessage("assistant", response)
+		if userInput == "exit" || userInput == "quit" {
+			if !s.incognito {
+				info("Saving conversation and exiting...\n")
+			}
+			return
+		}
 
-		if err := conv.save(); err != nil {
-			fmt.Printf("Warning: Failed to save conversation: %v\n", err)
+		if isCommand(userInput) {
+			if err := dispatchCommand(s, userInput); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			continue
 		}
+
+		s.submit(userInput)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
+func newClient(cfg *Config) (*openai.Client, error) {
+	apiKey, err := resolveAPIKey(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return openai.NewClient(option.WithAPIKey(apiKey), option.WithHTTPClient(apiHTTPClient())), nil
+}
 
-	if err := conv.save(); err != nil {
-		fmt.Printf("Error saving conversation: %v\n", err)
-		os.Exit(1)
+// baseModel is the model used when no persona picks another.
+func (cfg *Config) baseModel() string {
+	if cfg.Model != "" {
+		return cfg.Model
 	}
+	return defaultModel
+}
 
-	fmt.Printf("Conversation saved to: %s\n", conv.getFilePath())
+// info prints user-facing chrome (banners, prompts, status lines) that
+// --quiet suppresses. Replies and errors never go through it.
+func info(format string, args ...any) {
+	if quiet {
+		return
+	}
+	if logFormat == "json" {
+		// Status messages are logged, with the rest of stderr.
+		fmt.Fprintf(os.Stderr, format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
 }
 
-func newConversation() *Conversation {
+func newConversation(systemPrompt string) *Conversation {
 	now := time.Now()
 	conv := &Conversation{
-		ID:        fmt.Sprintf("chat_%d", now.Unix()),
+		Version:   conversationVersion,
+		ID:        newConversationID(now),
 		CreatedAt: now.Format(time.RFC3339),
 		Messages:  []Message{},
 	}
@@ -123,6 +445,7 @@ func newConversation() *Conversation {
 
 func (c *Conversation) addMessage(role, content string) {
 	msg := Message{
+		ID:        newMessageID(),
 		Role:      role,
 		Content:   content,
 		Timestamp: time.Now().Format(time.RFC3339),
@@ -130,28 +453,147 @@ func (c *Conversation) addMessage(role, content string) {
 	c.Messages = append(c.Messages, msg)
 }
 
+func (c *Conversation) addToolCalls(content string, calls []ToolCall) {
+	c.addMessage("assistant", content)
+	c.Messages[len(c.Messages)-1].ToolCalls = calls
+}
+
+func (c *Conversation) addToolResult(callID, result string) {
+	c.addMessage("tool", result)
+	c.Messages[len(c.Messages)-1].ToolCallID = callID
+}
+
+// lastIndex returns the index of the last message with the given role, or
+// -1.
+func (c *Conversation) lastIndex(role string) int {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Role == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Conversation) lastContent(role string) string {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Role == role && c.Messages[i].Content != "" {
+			return c.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+func (c *Conversation) firstContent(role string) string {
+	for _, msg := range c.Messages {
+		if msg.Role == role {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
 func (c *Conversation) getFilePath() string {
 	return filepath.Join(chatsDir, c.ID+".xml")
 }
 
+// save writes the conversation to a temporary file and renames it into
+// place, so concurrent readers never see a partially written file.
 func (c *Conversation) save() error {
-	file, err := os.Create(c.getFilePath())
+	path := c.getFilePath()
+	file, err := os.CreateTemp(filepath.Dir(path), "."+c.ID+"-*.tmp")
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
-
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "  ")
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to create file: %w", err)
+	}
 
-	if err := encoder.Encode(c); err != nil {
-		return fmt.Errorf("failed to encode XML: %w", err)
+	data, err := encodeConversation(c)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
 	}
 
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
 	return nil
 }
 
-func callOpenAI(ctx context.Context, client *openai.Client, conv *Conversation) (string, error) {
+// loadConversation reads a saved conversation given its ID (chat_123), its
+// file name, or a path to the file.
+func loadConversation(ref string) (*Conversation, error) {
+	path := ref
+	if filepath.Base(ref) == ref {
+		path = filepath.Join(chatsDir, strings.TrimSuffix(ref, ".xml")+".xml")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation: %w", err)
+	}
+
+	conv, err := parseConversation(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return conv, nil
+}
+
+// reply is an assistant answer, or a request to call tools, and the
+// tokens it consumed.
+type reply struct {
+	content          string
+	toolCalls        []ToolCall
+	promptTokens     int64
+	completionTokens int64
+	// cachedTokens are the part of promptTokens read from the provider's
+	// prompt cache, and cacheWriteTokens and longCacheWriteTokens the
+	// part written to it for five minutes and for an hour.
+	cachedTokens         int64
+	cacheWriteTokens     int64
+	longCacheWriteTokens int64
+	finishReason         string
+}
+
+func (r *reply) tokens() tokenCount {
+	return tokenCount{prompt: r.promptTokens, completion: r.completionTokens, cached: r.cachedTokens, written: r.cacheWriteTokens, writtenLong: r.longCacheWriteTokens}
+}
+
+// filtered reports whether the provider's content filter stopped the
+// answer.
+func (r *reply) filtered() bool {
+	return r.finishReason == string(openai.ChatCompletionChoicesFinishReasonContentFilter)
+}
+
+// truncated reports whether the answer stopped at the length limit.
+func (r *reply) truncated() bool {
+	return r.finishReason == string(openai.ChatCompletionChoicesFinishReasonLength)
+}
+
+func callOpenAI(ctx context.Context, client *openai.Client, model string, conv *Conversation, tools []Tool, opts ...option.RequestOption) (*reply, error) {
+	params, err := completionParams(model, conv, tools)
+	if err != nil {
+		return nil, err
+	}
+	completion, err := client.Chat.Completions.New(ctx, params, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+	return replyFrom(completion)
+}
+
+// completionParams builds the request for a conversation.
+func completionParams(model string, conv *Conversation, tools []Tool) (openai.ChatCompletionNewParams, error) {
 	var messages []openai.ChatCompletionMessageParamUnion
 
 	for _, msg := range conv.Messages {
@@ -159,23 +601,85 @@ func callOpenAI(ctx context.Context, client *openai.Client, conv *Conversation)
 		case "system":
 			messages = append(messages, openai.SystemMessage(msg.Content))
 		case "user":
-			messages = append(messages, openai.UserMessage(msg.Content))
+			if !slices.ContainsFunc(msg.Attachments, Attachment.isImage) {
+				messages = append(messages, openai.UserMessage(msg.Content))
+				continue
+			}
+			parts := []openai.ChatCompletionContentPartUnionParam{openai.TextPart(msg.Content)}
+			for _, a := range msg.Attachments {
+				if !a.isImage() {
+					continue
+				}
+				url, err := a.dataURL()
+				if err != nil {
+					return openai.ChatCompletionNewParams{}, err
+				}
+				parts = append(parts, openai.ImagePart(url))
+			}
+			messages = append(messages, openai.UserMessageParts(parts...))
 		case "assistant":
-			messages = append(messages, openai.AssistantMessage(msg.Content))
+			if len(msg.ToolCalls) == 0 {
+				messages = append(messages, openai.AssistantMessage(msg.Content))
+				continue
+			}
+			var calls []openai.ChatCompletionMessageToolCallParam
+			for _, call := range msg.ToolCalls {
+				calls = append(calls, openai.ChatCompletionMessageToolCallParam{
+					ID:   openai.F(call.ID),
+					Type: openai.F(openai.ChatCompletionMessageToolCallTypeFunction),
+					Function: openai.F(openai.ChatCompletionMessageToolCallFunctionParam{
+						Name:      openai.F(call.Name),
+						Arguments: openai.F(call.Arguments),
+					}),
+				})
+			}
+			messages = append(messages, openai.ChatCompletionAssistantMessageParam{
+				Role:      openai.F(openai.ChatCompletionAssistantMessageParamRoleAssistant),
+				ToolCalls: openai.F(calls),
+			})
+		case "tool":
+			messages = append(messages, openai.ToolMessage(msg.ToolCallID, msg.Content))
 		}
 	}
 
-	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.F(defaultModel),
+	params := openai.ChatCompletionNewParams{
+		Model:    openai.F(model),
 		Messages: openai.F(messages),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create completion: %w", err)
 	}
+	if len(tools) > 0 {
+		params.Tools = openai.F(toolParams(tools))
+	}
+	return params, nil
+}
 
+func replyFrom(completion *openai.ChatCompletion) (*reply, error) {
 	if len(completion.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	msg := completion.Choices[0].Message
+	r := &reply{
+		content:          msg.Content,
+		promptTokens:     completion.Usage.PromptTokens,
+		completionTokens: completion.Usage.CompletionTokens,
+		cachedTokens:     completion.Usage.PromptTokensDetails.CachedTokens,
+		finishReason:     string(completion.Choices[0].FinishReason),
+	}
+	for _, call := range msg.ToolCalls {
+		r.toolCalls = append(r.toolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
 	}
+	return r, nil
+}
+
+// ask sends a single prompt outside any saved conversation, for
+// subcommands that use the model as a one-off function.
+func ask(ctx context.Context, client *openai.Client, model, system, prompt string) (*reply, error) {
+	return callOpenAI(ctx, client, model, askConversation(system, prompt), nil)
+}
 
-	return completion.Choices[0].Message.Content, nil
+func askConversation(system, prompt string) *Conversation {
+	conv := &Conversation{}
+	conv.addMessage("system", withUntrustedNotice(system, prompt))
+	conv.addMessage("user", prompt)
+	return conv
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+)
+
+// plainOutput is set by --plain or plain in the config: answers are
+// printed as the model wrote them, markdown and all.
+var plainOutput bool
+
+// renderingMarkdown reports whether answers are rendered for the
+// terminal. Without colors the markdown is left alone, since the output
+// is usually going to a file or another program.
+func renderingMarkdown() bool {
+	return useColor && !plainOutput && !accessible
+}
+
+// renderMarkdown renders a markdown answer for the terminal: headings,
+// emphasis, code and links in the theme's colors, bullets as bullets.
+func renderMarkdown(text string) string {
+	var r mdRenderer
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = r.line(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mdRenderer renders markdown a line at a time, so answers can be
+// rendered as they stream in. It remembers whether it is inside a code
+// block.
+type mdRenderer struct {
+	inCode bool
+}
+
+func (r *mdRenderer) line(line string) string {
+	if m := mdFence.FindStringSubmatch(line); m != nil {
+		r.inCode = !r.inCode
+		if r.inCode && m[2] != "" {
+			return paint(theme.Meta, "  "+m[2])
+		}
+		return ""
+	}
+	if r.inCode {
+		return "  " + paint(theme.Code, line)
+	}
+	switch {
+	case mdTableRule.MatchString(line) && strings.Contains(line, "|"):
+		return paint(theme.Meta, line)
+	case mdRule.MatchString(line):
+		return paint(theme.Meta, strings.Repeat("─", 40))
+	case mdHeading.MatchString(line):
+		heading := mdHeading.ReplaceAllString(line, "$1")
+		heading = mdStrong.ReplaceAllString(heading, "$2")
+		heading = mdCode.ReplaceAllString(heading, "$1")
+		return paint(theme.Heading, heading)
+	case mdQuote.MatchString(line):
+		return paint(theme.Meta, "│ ") + inlineMarkdown(mdQuote.ReplaceAllString(line, ""))
+	}
+	if m := mdBullet.FindStringSubmatch(line); m != nil {
+		bullet := "• "
+		switch strings.TrimSpace(m[2]) {
+		case "[ ]":
+			bullet = "☐ "
+		case "[x]", "[X]":
+			bullet = "☑ "
+		}
+		return m[1] + paint(theme.Accent, bullet) + inlineMarkdown(line[len(m[0]):])
+	}
+	return inlineMarkdown(line)
+}
+
+// inlineMarkdown renders the spans within a line. Code spans are set
+// aside first, so what is inside them stays as written.
+func inlineMarkdown(line string) string {
+	var code []string
+	line = mdCode.ReplaceAllStringFunc(line, func(s string) string {
+		code = append(code, paint(theme.Code, mdCode.FindStringSubmatch(s)[1]))
+		return "\x00" + string(rune('0'+len(code)-1)) + "\x00"
+	})
+	line = mdImage.ReplaceAllStringFunc(line, func(s string) string {
+		return paint(theme.Meta, "[image: "+mdImage.FindStringSubmatch(s)[1]+"]")
+	})
+	line = mdLink.ReplaceAllStringFunc(line, func(s string) string {
+		m := mdLink.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return paint(theme.Link, m[2])
+		}
+		return paint(theme.Link, m[1]) + " " + paint(theme.Meta, "("+m[2]+")")
+	})
+	line = mdStrong.ReplaceAllStringFunc(line, func(s string) string {
+		m := mdStrong.FindStringSubmatch(s)
+		if m[1] != m[3] {
+			return s
+		}
+		if m[1] == "~~" {
+			return paint("9", m[2])
+		}
+		return paint("1", m[2])
+	})
+	line = mdStar.ReplaceAllString(line, paint("3", "$1"))
+	line = mdUnderline.ReplaceAllString(line, "$1"+paint("3", "$2")+"$3")
+	for i, c := range code {
+		line = strings.Replace(line, "\x00"+string(rune('0'+i))+"\x00", c, 1)
+	}
+	return line
+}
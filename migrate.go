@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// migrations upgrade stored conversations: migrations[i] takes one from
+// version i of the format to version i+1. Version 0 is every file saved
+// before conversations had a version. A change to the format that older
+// files need to catch up with adds a migration at the end.
+var migrations = []func(c *Conversation) error{
+	// 1: messages have IDs.
+	func(c *Conversation) error {
+		c.assignMessageIDs()
+		return nil
+	},
+}
+
+// conversationVersion is the version of the format this program writes.
+var conversationVersion = len(migrations)
+
+// migrate brings a conversation read from disk up to the current version.
+// The file itself is upgraded the next time the conversation is saved.
+// Files from a newer version are refused rather than read, since saving
+// them would drop what this version doesn't know about.
+func (c *Conversation) migrate() error {
+	if c.Version > conversationVersion {
+		return fmt.Errorf("saved in format version %d by a newer chat-cli; this one reads up to version %d, so update chat-cli", c.Version, conversationVersion)
+	}
+	for v := c.Version; v < conversationVersion; v++ {
+		if err := migrations[v](c); err != nil {
+			return fmt.Errorf("upgrading from format version %d: %w", v, err)
+		}
+	}
+	c.Version = conversationVersion
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MinutesConfig configures the minutes subcommand.
+type MinutesConfig struct {
+	// Template is a file with instructions replacing the built-in ones.
+	Template string `yaml:"template"`
+	Model    string `yaml:"model"`
+}
+
+// defaultMinutesTemplate is used unless minutes.template is set.
+var defaultMinutesTemplate = asset("templates/minutes.md")
+
+const minutesNotesPrompt = `This is one part of a longer meeting transcript. Write terse notes on it: ` +
+	`topics discussed, decisions, action items with owners, and open questions, attributed to speakers. ` +
+	`Include timestamps for decisions and action items.`
+
+// minutesChunkSize is how much transcript text goes into one request.
+// Longer transcripts are noted part by part and the notes combined.
+const minutesChunkSize = 24000
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "minutes",
+		usage: "minutes <transcript.vtt|.srt|.txt> [-o file]",
+		help:  "Write summary, decisions and action items from a meeting transcript",
+		run:   runMinutes,
+	})
+}
+
+// transcriptTurn is what one speaker said without interruption.
+type transcriptTurn struct {
+	start   string // timestamp, if the format has one
+	speaker string
+	text    string
+}
+
+func runMinutes(cfg *Config, args []string) int {
+	fs := newFlagSet("minutes")
+	output := fs.String("o", "", "write the minutes to this file instead of stdout")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: minutes <transcript.vtt|.srt|.txt> [-o file]")
+		return exitError
+	}
+	data, err := os.ReadFile(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	turns := parseTranscript(string(data), filepath.Ext(rest[0]))
+	if len(turns) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: the transcript is empty")
+		return exitError
+	}
+
+	template := defaultMinutesTemplate
+	if cfg.Minutes.Template != "" {
+		t, err := os.ReadFile(expandHome(cfg.Minutes.Template))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: minutes.template: %v\n", err)
+			return exitError
+		}
+		template = string(t)
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	model := cfg.Minutes.Model
+	if model == "" {
+		model = cfg.baseModel()
+	}
+
+	ctx := context.Background()
+	chunks := chunkTranscript(turns, minutesChunkSize)
+	input := chunks[0]
+	if len(chunks) > 1 {
+		var notes strings.Builder
+		for i, chunk := range chunks {
+			info("Reading part %d of %d...\n", i+1, len(chunks))
+			r, err := ask(ctx, client, model, minutesNotesPrompt, chunk)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitAPIError
+			}
+			fmt.Fprintf(&notes, "Notes on part %d of %d:\n%s\n\n", i+1, len(chunks), r.content)
+		}
+		input = notes.String()
+	}
+	info("Writing minutes...\n")
+	r, err := ask(ctx, client, model, template, input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+
+	minutes := strings.TrimSpace(r.content) + "\n"
+	if *output == "" {
+		fmt.Print(minutes)
+		return exitOK
+	}
+	if err := os.WriteFile(*output, []byte(minutes), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	info("Minutes written to: %s\n", *output)
+	return exitOK
+}
+
+var (
+	cueTiming     = regexp.MustCompile(`^(\d{1,2}:)?\d{2}:\d{2}[.,]\d{3}\s+-->\s+`)
+	vttVoice      = regexp.MustCompile(`^<v(?:\.[^ >]*)?\s+([^>]+)>(.*?)(?:</v>)?$`)
+	cueTags       = regexp.MustCompile(`</?[a-z][^>]*>`)
+	speakerPrefix = regexp.MustCompile(`^(?:\[?(\d{1,2}:\d{2}(?::\d{2})?)\]?\s+)?([\p{L}][\p{L}\p{N} .'-]{0,40}):\s+(.*)$`)
+)
+
+// parseTranscript reads WebVTT, SRT, or plain text with "Name: text"
+// lines, and merges consecutive lines by the same speaker into turns.
+func parseTranscript(data, ext string) []transcriptTurn {
+	data = strings.ReplaceAll(strings.TrimPrefix(data, "\ufeff"), "\r\n", "\n")
+	timed := strings.HasPrefix(data, "WEBVTT") || strings.EqualFold(ext, ".srt") || strings.EqualFold(ext, ".vtt")
+
+	var turns []transcriptTurn
+	add := func(start, speaker, text string) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		if n := len(turns); n > 0 && turns[n-1].speaker == speaker {
+			turns[n-1].text += " " + text
+			return
+		}
+		turns = append(turns, transcriptTurn{start, speaker, text})
+	}
+
+	var start string
+	lastSpeaker := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if timed {
+			switch {
+			case line == "" || strings.HasPrefix(line, "WEBVTT") || strings.HasPrefix(line, "NOTE"):
+				continue
+			case cueTiming.MatchString(line):
+				start, _, _ = strings.Cut(line, " ")
+				start = strings.Replace(start, ",", ".", 1)
+				continue
+			case isCueNumber(line):
+				continue
+			}
+			if m := vttVoice.FindStringSubmatch(line); m != nil {
+				lastSpeaker = strings.TrimSpace(m[1])
+				line = m[2]
+			} else if m := speakerPrefix.FindStringSubmatch(line); m != nil {
+				lastSpeaker, line = m[2], m[3]
+			}
+			add(start, lastSpeaker, cueTags.ReplaceAllString(line, ""))
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+		if m := speakerPrefix.FindStringSubmatch(line); m != nil {
+			lastSpeaker = m[2]
+			add(m[1], m[2], m[3])
+			continue
+		}
+		add("", lastSpeaker, line)
+	}
+	return turns
+}
+
+func isCueNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// chunkTranscript renders turns as text and splits it, between turns, into
+// pieces of at most size bytes (a single longer turn gets its own piece).
+func chunkTranscript(turns []transcriptTurn, size int) []string {
+	var chunks []string
+	var b strings.Builder
+	for _, t := range turns {
+		line := t.text
+		if t.speaker != "" {
+			line = t.speaker + ": " + line
+		}
+		if t.start != "" {
+			line = "[" + t.start + "] " + line
+		}
+		if b.Len() > 0 && b.Len()+len(line) > size {
+			chunks = append(chunks, untrusted("transcript", b.String()))
+			b.Reset()
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if b.Len() > 0 {
+		chunks = append(chunks, untrusted("transcript", b.String()))
+	}
+	return chunks
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ModelRouterConfig sends each turn of a chat to a cheap or a premium
+// model, as a small model classifies it. It applies while the model is
+// not chosen by --model, /model, a persona or a template.
+type ModelRouterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Classifier is the model that classifies turns (default: Cheap).
+	Classifier string `yaml:"classifier"`
+	// Cheap answers short factual turns, Premium those that need
+	// reasoning, and Code those about code (default: Premium).
+	Cheap   string `yaml:"cheap"`
+	Premium string `yaml:"premium"`
+	Code    string `yaml:"code"`
+}
+
+// routeClasses are the kinds of turn the router tells apart.
+var routeClasses = []string{"simple", "reasoning", "code"}
+
+const routerPrompt = `You route chat messages to a model. Classify the user's latest message, given the answer before it if any:
+simple: a short factual question, small talk, a quick lookup, rewording or translating a few sentences
+reasoning: analysis, planning, maths, comparing options, long or careful writing, anything that needs several steps of thought
+code: writing, reviewing, debugging or explaining code, shell commands or configuration
+Reply with one word: simple, reasoning or code.`
+
+func init() {
+	registerCommand(&command{
+		name:  "route",
+		usage: "/route [auto|off|simple|reasoning|code] [message]",
+		help:  "Show or set how turns are routed to the cheap or premium model; with a message, route just that one",
+		run:   cmdRoute,
+	})
+}
+
+func cmdRoute(s *session, args string) error {
+	mr := s.cfg.ModelRouter
+	if !mr.Enabled {
+		return fmt.Errorf("model routing is not set up; see model_router in the configuration")
+	}
+	mode, message, _ := strings.Cut(strings.TrimSpace(args), " ")
+	switch mode {
+	case "":
+		switch s.route {
+		case "":
+			fmt.Printf("Routing every turn, classified by %s\n", mr.classifier())
+		case "off":
+			fmt.Printf("Routing is off; using %s\n", s.model)
+		default:
+			fmt.Printf("Every turn goes to %s as %s\n", mr.model(s.route), s.route)
+		}
+		for _, class := range routeClasses {
+			fmt.Printf("  %-10s %s\n", class, mr.model(class))
+		}
+		return nil
+	case "auto":
+		s.route = ""
+		info("Routing every turn\n")
+		return nil
+	case "off":
+		if message != "" {
+			return fmt.Errorf("usage: /route [auto|off|simple|reasoning|code] [message]")
+		}
+		s.route = "off"
+		info("Routing is off; using %s\n", s.model)
+		return nil
+	}
+	if mr.model(mode) == "" {
+		return fmt.Errorf("unknown route %q; use auto, off, simple, reasoning or code", mode)
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		s.routeOnce = mode
+		s.submit(message)
+		s.routeOnce = ""
+		return nil
+	}
+	s.route = mode
+	info("Every turn goes to %s as %s\n", mr.model(mode), mode)
+	return nil
+}
+
+func (mr ModelRouterConfig) classifier() string {
+	if mr.Classifier != "" {
+		return mr.Classifier
+	}
+	return mr.Cheap
+}
+
+// model is the model for a class of turn.
+func (mr ModelRouterConfig) model(class string) string {
+	switch class {
+	case "simple":
+		return mr.Cheap
+	case "reasoning":
+		return mr.Premium
+	case "code":
+		if mr.Code != "" {
+			return mr.Code
+		}
+		return mr.Premium
+	}
+	return ""
+}
+
+// pinModel switches to a model the user chose, which turns routing off
+// until /route auto.
+func (s *session) pinModel(model string) {
+	s.model = model
+	if s.cfg.ModelRouter.Enabled {
+		s.route = "off"
+	}
+}
+
+// routeTurn picks the model for the turn about to be answered, and the
+// class it was routed as; both are "" to use the session's model.
+// Classifying costs a request to the classifier, which is counted in the
+// usage and recorded in trace; if it fails, the turn goes to the premium
+// model.
+func (s *session) routeTurn(ctx context.Context) (class, model string, step *TraceStep) {
+	mr := s.cfg.ModelRouter
+	if !mr.Enabled || (s.route == "off" && s.routeOnce == "") {
+		return "", "", nil
+	}
+	switch {
+	case s.routeOnce != "":
+		class = s.routeOnce
+	case s.route != "":
+		class = s.route
+	default:
+		class, step = s.classifyTurn(ctx)
+	}
+	model = mr.model(class)
+	info("%s\n", paint(theme.Meta, decor("  ⇢ ", "Routed to ")+model+" ("+class+")"))
+	return class, model, step
+}
+
+// classifyTurn asks the classifier about the latest user message and the
+// answer it follows.
+func (s *session) classifyTurn(ctx context.Context) (string, *TraceStep) {
+	var prompt strings.Builder
+	if i := s.conv.lastIndex("user"); i >= 0 {
+		for j := i - 1; j >= 0; j-- {
+			if m := s.conv.Messages[j]; m.Role == "assistant" && m.Content != "" {
+				fmt.Fprintf(&prompt, "Previous answer (start):\n%s\n\n", truncate(m.Content, 1000))
+				break
+			}
+		}
+		fmt.Fprintf(&prompt, "Latest message:\n%s", truncate(s.conv.Messages[i].Content, 4000))
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	model := s.cfg.ModelRouter.classifier()
+	r, err := s.provider.Complete(ctx, model, askConversation(routerPrompt, prompt.String()), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: model routing failed, using the premium model: %v\n", err)
+		return "reasoning", nil
+	}
+	s.countUsage(model, r)
+	answer := strings.ToLower(r.content)
+	class := "reasoning"
+	for _, c := range routeClasses {
+		if strings.Contains(answer, c) {
+			class = c
+			break
+		}
+	}
+	return class, &TraceStep{Label: "route", Tokens: r.completionTokens, Content: class + " (" + model + ": " + strings.TrimSpace(r.content) + ")"}
+}
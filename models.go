@@ -0,0 +1,96 @@
+package main
+
+import "strings"
+
+// modelInfo describes a model family: its context window in tokens and
+// USD prices per million input/output tokens. cachedPrice is the price
+// of input tokens read from the prompt cache, and cacheWritePrice that of
+// input written to it for five minutes; writing for an hour costs twice
+// the input price. OpenAI doesn't charge for writes, which it doesn't
+// report either.
+type modelInfo struct {
+	contextWindow   int
+	inputPrice      float64
+	outputPrice     float64
+	cachedPrice     float64
+	cacheWritePrice float64
+}
+
+// knownModels is matched by longest prefix, so dated snapshots such as
+// gpt-4o-2024-08-06 resolve to their family.
+var knownModels = map[string]modelInfo{
+	"gpt-5":         {400000, 1.25, 10, 0.125, 1.25},
+	"gpt-5-mini":    {400000, 0.25, 2, 0.025, 0.25},
+	"gpt-5-nano":    {400000, 0.05, 0.4, 0.005, 0.05},
+	"gpt-4.1":       {1047576, 2, 8, 0.5, 2},
+	"gpt-4.1-mini":  {1047576, 0.4, 1.6, 0.1, 0.4},
+	"gpt-4.1-nano":  {1047576, 0.1, 0.4, 0.025, 0.1},
+	"gpt-4o":        {128000, 2.5, 10, 1.25, 2.5},
+	"gpt-4o-mini":   {128000, 0.15, 0.6, 0.075, 0.15},
+	"gpt-4-turbo":   {128000, 10, 30, 10, 10},
+	"gpt-4":         {8192, 30, 60, 30, 30},
+	"gpt-3.5-turbo": {16385, 0.5, 1.5, 0.5, 0.5},
+	"o1":            {200000, 15, 60, 7.5, 15},
+	"o3":            {200000, 2, 8, 0.5, 2},
+	"o3-mini":       {200000, 1.1, 4.4, 0.55, 1.1},
+	"o4-mini":       {200000, 1.1, 4.4, 0.275, 1.1},
+
+	"claude-opus-4":     {200000, 15, 75, 1.5, 18.75},
+	"claude-opus-4-5":   {200000, 5, 25, 0.5, 6.25},
+	"claude-sonnet-4":   {200000, 3, 15, 0.3, 3.75},
+	"claude-haiku-4-5":  {200000, 1, 5, 0.1, 1.25},
+	"claude-3-7-sonnet": {200000, 3, 15, 0.3, 3.75},
+	"claude-3-5-sonnet": {200000, 3, 15, 0.3, 3.75},
+	"claude-3-5-haiku":  {200000, 0.8, 4, 0.08, 1},
+	"claude-3-opus":     {200000, 15, 75, 1.5, 18.75},
+	"claude-3-haiku":    {200000, 0.25, 1.25, 0.03, 0.3},
+}
+
+func lookupModel(name string) (modelInfo, bool) {
+	best := ""
+	for prefix := range knownModels {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelInfo{}, false
+	}
+	return knownModels[best], true
+}
+
+// tokenCount is what a request, or an answer's requests, used.
+type tokenCount struct {
+	prompt, completion int64
+	// cached are the prompt tokens read from the prompt cache, and
+	// written and writtenLong those written to it for five minutes and
+	// for an hour.
+	cached, written, writtenLong int64
+}
+
+// cost prices a request.
+func (m modelInfo) cost(t tokenCount) float64 {
+	usd := float64(t.prompt)*m.inputPrice + float64(t.completion)*m.outputPrice +
+		float64(t.written)*(m.cacheWritePrice-m.inputPrice) + float64(t.writtenLong)*m.inputPrice
+	return usd/1e6 - m.saving(t.cached)
+}
+
+// saving is what reading cachedTokens from the prompt cache saved over
+// sending them afresh.
+func (m modelInfo) saving(cachedTokens int64) float64 {
+	return float64(cachedTokens) * (m.inputPrice - m.cachedPrice) / 1e6
+}
+
+// isChatModel tells chat models from the embedding, speech, image and
+// other models the API lists alongside them.
+func isChatModel(id string) bool {
+	if !strings.HasPrefix(id, "gpt-") && !strings.HasPrefix(id, "chatgpt-") && !(len(id) > 1 && id[0] == 'o' && id[1] >= '1' && id[1] <= '9') {
+		return false
+	}
+	for _, other := range []string{"embedding", "tts", "transcribe", "image", "realtime", "audio", "search", "instruct"} {
+		if strings.Contains(id, other) {
+			return false
+		}
+	}
+	return true
+}
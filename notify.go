@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// NotifyConfig reports the outcome of unattended runs (digest, email
+// daemon, bots) to webhooks.
+type NotifyConfig struct {
+	Webhooks []NotifyWebhook `yaml:"webhooks"`
+}
+
+type NotifyWebhook struct {
+	URL string `yaml:"url"`
+	// Format is "json" (default), the notification as is, or "slack", a
+	// text message for Slack incoming webhooks and compatible services.
+	Format string `yaml:"format"`
+	// Jobs limits the webhook to some of digest, email and bot.
+	Jobs []string `yaml:"jobs"`
+	// FailuresOnly skips runs that succeeded.
+	FailuresOnly bool `yaml:"failures_only"`
+}
+
+var notifyJobs = []string{"digest", "email", "bot"}
+
+// notification is the JSON body sent to webhooks.
+type notification struct {
+	Job          string `json:"job"`
+	Status       string `json:"status"` // ok or failed
+	Time         string `json:"time"`
+	Summary      string `json:"summary,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Conversation string `json:"conversation,omitempty"`
+}
+
+func (w NotifyWebhook) check() error {
+	if u, err := url.Parse(w.URL); err != nil || u.Host == "" {
+		return fmt.Errorf("url must be a URL, not %q", w.URL)
+	}
+	switch w.Format {
+	case "", "json", "slack":
+	default:
+		return fmt.Errorf("format must be json or slack, not %q", w.Format)
+	}
+	for _, job := range w.Jobs {
+		if !slices.Contains(notifyJobs, job) {
+			return fmt.Errorf("unknown job %q (use digest, email or bot)", job)
+		}
+	}
+	return nil
+}
+
+// succeeded and failed notify the webhooks about a run of job. Sending
+// is best effort: failures are reported as warnings.
+func (c NotifyConfig) succeeded(job, conversation, summary string) {
+	c.send(notification{Job: job, Status: "ok", Conversation: conversation, Summary: summary})
+}
+
+func (c NotifyConfig) failed(job, conversation string, err error) {
+	c.send(notification{Job: job, Status: "failed", Conversation: conversation, Error: err.Error()})
+}
+
+func (c NotifyConfig) send(n notification) {
+	n.Time = time.Now().Format(time.RFC3339)
+	for _, w := range c.Webhooks {
+		if len(w.Jobs) > 0 && !slices.Contains(w.Jobs, n.Job) || w.FailuresOnly && n.Status == "ok" {
+			continue
+		}
+		if err := w.post(n); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: notifying %s failed: %v\n", w.URL, err)
+		}
+	}
+}
+
+func (w NotifyWebhook) post(n notification) error {
+	var body any = n
+	if w.Format == "slack" {
+		body = map[string]string{"text": n.slackText()}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", appName)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+func (n notification) slackText() string {
+	text := fmt.Sprintf(":white_check_mark: %s: %s", n.Job, n.Summary)
+	if n.Status != "ok" {
+		text = fmt.Sprintf(":x: %s failed: %s", n.Job, n.Error)
+	}
+	if n.Conversation != "" {
+		text += " (" + n.Conversation + ")"
+	}
+	return text
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type OCRConfig struct {
+	// Engine is "vision" (default), which sends the image to the model,
+	// or "tesseract", which reads it locally.
+	Engine string `yaml:"engine"`
+	Model  string `yaml:"model"`
+	// Languages are tesseract language codes such as eng or deu.
+	Languages []string `yaml:"languages"`
+}
+
+const ocrPrompt = `Transcribe all text in the image exactly as written, keeping line breaks, indentation and the reading order. Render tables as rows with columns separated by " | ". Do not describe the image, translate, summarize or correct anything. If there is no text, answer with nothing.`
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "ocr",
+		usage: "ocr <image> [-o file]",
+		help:  "Extract the text from a screenshot or photographed document",
+		run:   runOCR,
+	})
+	registerCommand(&command{
+		name:  "ocr",
+		usage: "/ocr <image>",
+		help:  "Extract the text from an image and send it with your next message",
+		run:   cmdOCR,
+	})
+}
+
+func runOCR(cfg *Config, args []string) int {
+	fs := newFlagSet("ocr")
+	output := fs.String("o", "", "write the text to this file instead of stdout")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ocr <image> [-o file]")
+		return exitError
+	}
+	text, err := extractText(context.Background(), cfg, rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	if *output == "" {
+		fmt.Println(text)
+		return exitOK
+	}
+	if err := os.WriteFile(*output, []byte(text+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	info("Text written to %s\n", *output)
+	return exitOK
+}
+
+func cmdOCR(s *session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /ocr <image>")
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	path := expandHome(args)
+	text, err := extractText(ctx, s.cfg, path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	s.context = append(s.context, untrusted("text in "+name, text))
+	info("Attached the text of %s (%d words); it is sent with your next message\n", name, len(strings.Fields(text)))
+	return nil
+}
+
+// extractText reads the text in an image with the configured engine.
+func extractText(ctx context.Context, cfg *Config, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	kind := detectType(path, data)
+	if !imageTypes[kind] {
+		return "", fmt.Errorf("%s is not an image (%s)", filepath.Base(path), kind)
+	}
+
+	var text string
+	if cfg.OCR.Engine == "tesseract" {
+		text, err = tesseract(ctx, path, cfg.OCR.Languages)
+	} else {
+		text, err = visionOCR(ctx, cfg, Attachment{Name: filepath.Base(path), Type: kind, data: data})
+	}
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("no text found in %s", filepath.Base(path))
+	}
+	return text, nil
+}
+
+func visionOCR(ctx context.Context, cfg *Config, image Attachment) (string, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return "", err
+	}
+	model := cfg.OCR.Model
+	if model == "" {
+		model = cfg.baseModel()
+	}
+	conv := &Conversation{}
+	conv.addMessage("system", ocrPrompt)
+	conv.addMessage("user", "Transcribe the text in this image.")
+	conv.Messages[len(conv.Messages)-1].Attachments = []Attachment{image}
+	r, err := callOpenAI(ctx, client, model, conv, nil)
+	if err != nil {
+		return "", err
+	}
+	return stripCodeFence(r.content), nil
+}
+
+func tesseract(ctx context.Context, path string, languages []string) (string, error) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return "", fmt.Errorf("ocr.engine is tesseract, but tesseract is not installed")
+	}
+	args := []string{path, "-"}
+	if len(languages) > 0 {
+		args = append(args, "-l", strings.Join(languages, "+"))
+	}
+	out, err := exec.CommandContext(ctx, "tesseract", args...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("tesseract: %s", strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// oneShot reports whether -p was given: one question is answered on
+// stdout, without banners or prompts, and the program exits.
+func oneShot() bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "p"
+	})
+	return given
+}
+
+// ask sends question, with whatever is piped to stdin, and prints the
+// answer; without a question, the piped text is the question. Failures
+// are recorded in the exit code, including a message that wasn't sent,
+// and leave the conversation unsaved.
+func (s *session) ask(question string) {
+	question = strings.TrimSpace(question)
+	s.typed = true
+	s.saveAnswered = true
+	if stdinPiped() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			s.exitCode = exitError
+			return
+		}
+		switch text := strings.TrimSpace(string(data)); {
+		case text == "":
+		case question == "":
+			// Piped text is no one's typing: its @paths aren't attached.
+			question = text
+			s.typed = false
+		default:
+			s.context = append(s.context, untrusted("standard input", text))
+		}
+	}
+	if question == "" {
+		fmt.Fprintln(os.Stderr, "Error: nothing to ask; give -p a question or pipe one in")
+		s.exitCode = exitError
+		return
+	}
+	before := len(s.conv.Messages)
+	s.submit(question)
+	if s.exitCode == exitOK && len(s.conv.Messages) == before {
+		s.exitCode = exitError
+	}
+}
+
+// stdinPiped reports whether stdin is a pipe or a file to read the input
+// from. Others, such as a terminal or the stdin cron and CI jobs get,
+// which may never be closed, are left alone.
+func stdinPiped() bool {
+	st, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return st.Mode()&os.ModeNamedPipe != 0 || st.Mode().IsRegular()
+}
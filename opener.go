@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Opener shows a file or URL in another application.
+type Opener interface {
+	Open(target string) error
+}
+
+// OpenConfig overrides the desktop's default application per kind of
+// file. Each is a command line; {} is replaced by the quoted file or URL,
+// which is otherwise appended.
+type OpenConfig struct {
+	Image   string `yaml:"image"`
+	Audio   string `yaml:"audio"`
+	PDF     string `yaml:"pdf"`
+	Browser string `yaml:"browser"`
+	// Default applies to everything else.
+	Default string `yaml:"default"`
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "open",
+		usage: "/open [file|url]",
+		help:  "Open a file or URL, or the newest image in the conversation, in its viewer",
+		run:   cmdOpen,
+	})
+}
+
+func cmdOpen(s *session, args string) error {
+	if headless {
+		return fmt.Errorf("nothing is opened in headless mode")
+	}
+	target := expandHome(args)
+	if target == "" {
+		for i := len(s.conv.Messages) - 1; i >= 0 && target == ""; i-- {
+			if a := s.conv.Messages[i].Attachments; len(a) > 0 && a[len(a)-1].Ref != "" {
+				var err error
+				if target, err = s.viewable(a[len(a)-1]); err != nil {
+					return err
+				}
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("the conversation has no images")
+		}
+	}
+	return openerFor(s.cfg.Open, target).Open(target)
+}
+
+// openerFor returns the configured opener for target, or the platform's.
+func openerFor(cfg OpenConfig, target string) Opener {
+	var line string
+	switch kind := openKind(target); {
+	case kind == "url" || kind == "text/html":
+		line = cfg.Browser
+	case kind == "application/pdf":
+		line = cfg.PDF
+	case strings.HasPrefix(kind, "image/"):
+		line = cfg.Image
+	case strings.HasPrefix(kind, "audio/"):
+		line = cfg.Audio
+	}
+	if line == "" {
+		line = cfg.Default
+	}
+	if line != "" {
+		return commandOpener(line)
+	}
+	return systemOpener{}
+}
+
+func openKind(target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return "url"
+	}
+	kind, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(target))), ";")
+	return kind
+}
+
+// commandOpener runs a user-supplied command line through the shell.
+type commandOpener string
+
+func (c commandOpener) Open(target string) error {
+	line := string(c)
+	if strings.Contains(line, "{}") {
+		line = strings.ReplaceAll(line, "{}", shellQuote(target))
+	} else {
+		line += " " + shellQuote(target)
+	}
+	return shellCommand(line).Start()
+}
+
+// systemOpener hands the target to the desktop's default application.
+type systemOpener struct{}
+
+func (systemOpener) Open(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		// Unlike "cmd /c start", which reparses the line and breaks on
+		// some paths, this takes the target as it is, and it works the
+		// same from cmd and PowerShell.
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
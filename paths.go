@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const appName = "chat-cli"
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "paths",
+		usage: "paths",
+		help:  "Show where configuration, conversations and caches are kept",
+		run:   runPaths,
+	})
+}
+
+func runPaths(cfg *Config, args []string) int {
+	config, err := configPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	cache, err := cacheDir()
+	if err != nil {
+		cache = "(none: " + err.Error() + ")"
+	}
+	data, _ := filepath.Abs(dataDir)
+	chats, _ := filepath.Abs(chatsDir)
+	rows := [][2]string{
+		{"config", config},
+		{"data", data},
+		{"chats", chats},
+		{"cache", cache},
+		{"logs", "none; errors and warnings go to stderr"},
+	}
+	if profileName != "" {
+		rows = append([][2]string{{"profile", profileName}}, rows...)
+	}
+	for _, r := range rows {
+		fmt.Printf("%-8s %s\n", r[0]+":", r[1])
+	}
+	return exitOK
+}
+
+// configDir is where global, cross-conversation state such as snippets lives.
+func configDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, appName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// defaultDataDir is the platform's place for user data:
+// $XDG_DATA_HOME or ~/.local/share on Unix, ~/Library/Application Support
+// on macOS and %LocalAppData% on Windows.
+func defaultDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, appName), nil
+		}
+		return "", errors.New("%LocalAppData% is not set")
+	case "darwin", "ios":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, appName), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// cacheDir holds data that can be fetched or computed again, such as
+// exchange rates and speech audio.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName), nil
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// loadConfigJSON decodes a JSON file from the config directory into v. A
+// missing file leaves v unchanged.
+func loadConfigJSON(name string, v any) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+func saveConfigJSON(name string, v any) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
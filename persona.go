@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Persona is a named system prompt, optionally pinned to a model.
+type Persona struct {
+	SystemPrompt string `yaml:"system_prompt"`
+	Model        string `yaml:"model"`
+	// PostProcess rewrites every answer, in order, before it is shown.
+	PostProcess []PostStep `yaml:"post_process"`
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "persona",
+		usage: "/persona [name]",
+		help:  "List personas or switch the current one",
+		run:   cmdPersona,
+	})
+}
+
+// resolvePersona returns the persona with the given name, or the built-in
+// default when name is empty.
+func (c *Config) resolvePersona(name string) (Persona, error) {
+	if name == "" || name == "default" {
+		if p, ok := c.Personas["default"]; ok {
+			return p, nil
+		}
+		return Persona{SystemPrompt: systemPrompt}, nil
+	}
+	p, ok := c.persona(name)
+	if !ok {
+		return Persona{}, fmt.Errorf("unknown persona %q", name)
+	}
+	if p.SystemPrompt == "" {
+		p.SystemPrompt = systemPrompt
+	}
+	return p, nil
+}
+
+func cmdPersona(s *session, args string) error {
+	if args == "" {
+		names := []string{"default"}
+		for name := range s.cfg.Personas {
+			if name != "default" {
+				names = append(names, name)
+			}
+		}
+		for name := range builtinPersonas {
+			if _, ok := s.cfg.Personas[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names[1:])
+		for _, name := range names {
+			marker := " "
+			if name == s.personaName() {
+				marker = "*"
+			}
+			fmt.Printf(" %s %s\n", marker, name)
+		}
+		return nil
+	}
+
+	p, err := s.cfg.resolvePersona(args)
+	if err != nil {
+		return err
+	}
+	s.setPersona(args, p)
+	info("Switched to persona %s\n", args)
+	return nil
+}
+
+func (s *session) personaName() string {
+	if s.conv.Persona == "" {
+		return "default"
+	}
+	return s.conv.Persona
+}
+
+// setPersona replaces the conversation's system prompt and the model: the
+// persona's, or the default one if it doesn't pin one, so a model pinned by
+// the previous persona isn't kept.
+func (s *session) setPersona(name string, p Persona) {
+	if name == "default" {
+		name = ""
+	}
+	s.conv.Persona = name
+	if len(s.conv.Messages) > 0 && s.conv.Messages[0].Role == "system" {
+		s.conv.Messages[0].Content = p.SystemPrompt
+	}
+	if p.Model != "" {
+		s.pinModel(p.Model)
+	} else {
+		s.model = s.defaultModel
+	}
+	s.save()
+	s.status.refresh(s)
+}
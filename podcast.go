@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type PodcastConfig struct {
+	Model string `yaml:"model"`
+}
+
+const podcastNotesPrompt = `You are taking notes on part of a podcast transcript. Each line starts with its [hh:mm:ss] timestamp. Note:
+- each topic discussed, with the timestamp where it starts
+- up to five striking quotes, copied word for word, with their timestamps and the speaker if known
+- the main points and claims made
+Be concise; these notes are combined with notes on the other parts.`
+
+const podcastPrompt = `You write a listener's guide to a podcast episode from its transcript or notes on it. Timestamps are [hh:mm:ss]. Produce markdown with exactly these sections:
+
+## Summary
+Three to five paragraphs on what the episode covers and its main arguments.
+
+## Chapters
+One line per chapter, "- hh:mm:ss Title", five to fifteen chapters in order, starting at 00:00:00.
+
+## Key quotes
+Five to ten quotes copied word for word, each as "> quote" followed by "— speaker, hh:mm:ss" (leave out the speaker if unknown).
+
+Only use timestamps and quotes that appear in the input.`
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "podcast",
+		usage: "podcast <audio|url> [-o file] [--transcript file]",
+		help:  "Summarize a podcast episode with chapters and key quotes",
+		run:   runPodcast,
+	})
+}
+
+func runPodcast(cfg *Config, args []string) int {
+	fs := newFlagSet("podcast")
+	output := fs.String("o", "", "write the summary to this file instead of stdout")
+	transcriptFile := fs.String("transcript", "", "also save the transcript (.txt, .srt or .vtt)")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: podcast <audio|url> [-o file] [--transcript file]")
+		return exitError
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	model := cfg.Podcast.Model
+	if model == "" {
+		model = cfg.baseModel()
+	}
+
+	ctx := context.Background()
+	source := rest[0]
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		dir, err := os.MkdirTemp("", "chat-cli-podcast")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer os.RemoveAll(dir)
+		if source, err = downloadEpisode(ctx, source, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitAPIError
+		}
+	}
+
+	info("Transcribing...\n")
+	segments, err := transcribeAudio(ctx, client, source, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	if len(segments) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no speech found in the recording")
+		return exitError
+	}
+	if *transcriptFile != "" {
+		format := strings.TrimPrefix(filepath.Ext(*transcriptFile), ".")
+		if err := os.WriteFile(*transcriptFile, []byte(formatTranscript(segments, format)), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		info("Transcript written to %s\n", *transcriptFile)
+	}
+
+	chunks := chunkSegments(segments, minutesChunkSize)
+	input := chunks[0]
+	if len(chunks) > 1 {
+		var notes strings.Builder
+		for i, chunk := range chunks {
+			info("Reading part %d of %d...\n", i+1, len(chunks))
+			r, err := ask(ctx, client, model, podcastNotesPrompt, chunk)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitAPIError
+			}
+			fmt.Fprintf(&notes, "Notes on part %d of %d:\n%s\n\n", i+1, len(chunks), r.content)
+		}
+		input = notes.String()
+	}
+	info("Writing summary...\n")
+	r, err := ask(ctx, client, model, podcastPrompt, input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+
+	summary := strings.TrimSpace(r.content) + "\n"
+	if *output == "" {
+		fmt.Print(summary)
+		return exitOK
+	}
+	if err := os.WriteFile(*output, []byte(summary), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	info("Summary written to: %s\n", *output)
+	return exitOK
+}
+
+// chunkSegments renders segments as "[hh:mm:ss] text" lines, split into
+// untrusted blocks of at most size characters.
+func chunkSegments(segments []transcriptSegment, size int) []string {
+	var chunks []string
+	var b strings.Builder
+	for _, s := range segments {
+		line := fmt.Sprintf("[%s] %s\n", clockTime(s.Start), s.Text)
+		if b.Len() > 0 && b.Len()+len(line) > size {
+			chunks = append(chunks, untrusted("transcript", b.String()))
+			b.Reset()
+		}
+		b.WriteString(line)
+	}
+	return append(chunks, untrusted("transcript", b.String()))
+}
+
+func clockTime(seconds float64) string {
+	s := int64(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// downloadEpisode saves a podcast episode into dir. A feed URL resolves
+// to its newest episode.
+func downloadEpisode(ctx context.Context, url, dir string) (string, error) {
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	kind, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.Contains(kind, "xml") || strings.Contains(kind, "rss") {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		if err != nil {
+			return "", err
+		}
+		items, err := parseFeed(data)
+		if err != nil {
+			return "", err
+		}
+		var newest *feedItem
+		for i, it := range items {
+			if it.Enclosure != "" && (newest == nil || it.Published.After(newest.Published)) {
+				newest = &items[i]
+			}
+		}
+		if newest == nil {
+			return "", fmt.Errorf("the feed has no episodes with audio")
+		}
+		info("Newest episode: %s\n", newest.Title)
+		return downloadEpisode(ctx, newest.Enclosure, dir)
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." || filepath.Ext(name) == "" {
+		name = "episode.mp3"
+	}
+	file := filepath.Join(dir, name)
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info("Downloading %s...\n", name)
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	return file, f.Close()
+}
+
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", appName)
+	client := &http.Client{Timeout: 30 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// PostStep is one step a persona's answers go through before they are
+// shown and saved. Set one of Instruction, Builtin or Template.
+type PostStep struct {
+	// Instruction has a model rewrite the answer, e.g. "Translate to
+	// Nynorsk." Model defaults to the session's model.
+	Instruction string `yaml:"instruction"`
+	Model       string `yaml:"model"`
+	// Builtin is a local transform: strip_emoji or plain (no markdown).
+	Builtin string `yaml:"builtin"`
+	// Template is a text/template over .Answer and .Persona.
+	Template string `yaml:"template"`
+}
+
+const postProcessPrompt = "Rewrite the text you are given as instructed. Keep its meaning and reply with only the rewritten text.\n\nInstruction: "
+
+var builtinPostSteps = map[string]func(string) string{
+	"strip_emoji": stripEmoji,
+	"plain":       plainSentences,
+}
+
+// emoji matches a run of emoji and the space after it, so removing them
+// leaves no gap.
+var emoji = regexp.MustCompile(`[\x{1F000}-\x{1FAFF}\x{2600}-\x{27BF}\x{2B00}-\x{2BFF}\x{FE0F}\x{200D}]+ ?`)
+
+func stripEmoji(s string) string {
+	return emoji.ReplaceAllString(s, "")
+}
+
+func (st PostStep) check() error {
+	set := 0
+	for _, v := range []string{st.Instruction, st.Builtin, st.Template} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set one of instruction, builtin or template")
+	}
+	if _, ok := builtinPostSteps[st.Builtin]; st.Builtin != "" && !ok {
+		return fmt.Errorf("unknown builtin %q; use strip_emoji or plain", st.Builtin)
+	}
+	if st.Template != "" {
+		if _, err := template.New("post").Parse(st.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postProcess runs an answer through a persona's steps. The answer as
+// the model wrote it is returned as a trace step when it changed.
+func (s *session) postProcess(ctx context.Context, persona string, steps []PostStep, answer string) (string, []TraceStep, error) {
+	if len(steps) == 0 {
+		return answer, nil, nil
+	}
+	original := answer
+	for _, st := range steps {
+		switch {
+		case st.Builtin != "":
+			answer = builtinPostSteps[st.Builtin](answer)
+		case st.Template != "":
+			tmpl, err := template.New("post").Parse(st.Template)
+			if err != nil {
+				return original, nil, err
+			}
+			var sb strings.Builder
+			if err := tmpl.Execute(&sb, map[string]string{"Answer": answer, "Persona": persona}); err != nil {
+				return original, nil, err
+			}
+			answer = sb.String()
+		default:
+			conv := &Conversation{}
+			conv.addMessage("system", postProcessPrompt+st.Instruction)
+			conv.addMessage("user", answer)
+			r, err := s.provider.Complete(ctx, cmp.Or(st.Model, s.model), conv, nil)
+			if err != nil {
+				return original, nil, err
+			}
+			s.recordUsage(r)
+			answer = r.content
+		}
+	}
+	if answer == original {
+		return answer, nil, nil
+	}
+	return answer, []TraceStep{{Label: "before post-processing", Content: original}}, nil
+}
+
+// postSteps are the post-processing steps of the current persona.
+func (s *session) postSteps() []PostStep {
+	p, err := s.cfg.resolvePersona(s.personaName())
+	if err != nil {
+		return nil
+	}
+	return p.PostProcess
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Provider is a chat completion backend. The chat loop talks to one
+// provider; images, speech, transcription and embeddings always use
+// OpenAI.
+type Provider interface {
+	// Complete requests the next reply to conv.
+	Complete(ctx context.Context, model string, conv *Conversation, tools []Tool) (*reply, error)
+	// Stream is Complete with onToken receiving the text as it arrives.
+	Stream(ctx context.Context, model string, conv *Conversation, tools []Tool, onToken func(string)) (*reply, error)
+	// Models lists the chat models the provider offers.
+	Models(ctx context.Context) ([]string, error)
+}
+
+// ProvidersConfig holds the settings of the providers other than OpenAI,
+// which uses the top-level api_key and model.
+type ProvidersConfig struct {
+	Anthropic AnthropicConfig `yaml:"anthropic"`
+	Ollama    OllamaConfig    `yaml:"ollama"`
+	Azure     AzureConfig     `yaml:"azure"`
+}
+
+type AnthropicConfig struct {
+	// APIKey defaults to $ANTHROPIC_API_KEY.
+	APIKey  Credential `yaml:"api_key"`
+	BaseURL string     `yaml:"base_url"`
+	Model   string     `yaml:"model"`
+	// MaxTokens bounds each answer (default 8192); the API requires one.
+	MaxTokens int `yaml:"max_tokens"`
+	// PromptCache is how long the start of a conversation stays cached
+	// between requests: "5m" (the default), "1h", which costs more to
+	// write, or "off".
+	PromptCache string `yaml:"prompt_cache"`
+}
+
+type OllamaConfig struct {
+	// URL is the Ollama server (default http://localhost:11434).
+	URL   string `yaml:"url"`
+	Model string `yaml:"model"`
+}
+
+type AzureConfig struct {
+	// Endpoint is the resource, e.g. https://my-resource.openai.azure.com.
+	Endpoint string `yaml:"endpoint"`
+	// APIKey defaults to $AZURE_OPENAI_API_KEY.
+	APIKey     Credential `yaml:"api_key"`
+	APIVersion string     `yaml:"api_version"`
+	// Model is the deployment to use; models are addressed by deployment
+	// name on Azure.
+	Model string `yaml:"model"`
+}
+
+// providerSpec describes how to build a provider and which model it uses
+// when none is configured.
+type providerSpec struct {
+	defaultModel func(cfg *Config) string
+	build        func(cfg *Config, client *openai.Client) (Provider, error)
+}
+
+var providers = map[string]*providerSpec{}
+
+func registerProvider(name string, p *providerSpec) {
+	providers[name] = p
+}
+
+func init() {
+	registerProvider("openai", &providerSpec{
+		defaultModel: (*Config).baseModel,
+		build: func(cfg *Config, client *openai.Client) (Provider, error) {
+			return &openaiProvider{client: client, chatOnly: true}, nil
+		},
+	})
+	registerProvider("ollama", &providerSpec{
+		defaultModel: func(cfg *Config) string { return cmp.Or(cfg.Providers.Ollama.Model, "llama3.2") },
+		build: func(cfg *Config, _ *openai.Client) (Provider, error) {
+			base := strings.TrimRight(cmp.Or(cfg.Providers.Ollama.URL, "http://localhost:11434"), "/")
+			// Ollama serves the OpenAI API; it ignores the key.
+			client := openai.NewClient(option.WithBaseURL(base+"/v1/"), option.WithAPIKey("ollama"), option.WithHTTPClient(apiHTTPClient()))
+			return &openaiProvider{client: client}, nil
+		},
+	})
+	registerProvider("azure", &providerSpec{
+		defaultModel: func(cfg *Config) string { return cfg.Providers.Azure.Model },
+		build:        newAzureProvider,
+	})
+	registerProvider("anthropic", &providerSpec{
+		defaultModel: func(cfg *Config) string { return cmp.Or(cfg.Providers.Anthropic.Model, "claude-sonnet-4-5") },
+		build:        newAnthropicProvider,
+	})
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chatProvider returns the provider to chat with, by name or from the
+// config, and the model to use when no persona or flag picks one.
+func (cfg *Config) chatProvider(name string, client *openai.Client) (Provider, string, error) {
+	name = cmp.Or(name, cfg.Provider, "openai")
+	spec, ok := providers[name]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown provider %q (use %s)", name, strings.Join(providerNames(), ", "))
+	}
+	p, err := spec.build(cfg, client)
+	if err != nil {
+		return nil, "", fmt.Errorf("provider %s: %w", name, err)
+	}
+	return p, spec.defaultModel(cfg), nil
+}
+
+// openaiProvider talks to the OpenAI API or a compatible one.
+type openaiProvider struct {
+	client *openai.Client
+	// opts returns options added to each request for a model, such as
+	// Azure's deployment URL.
+	opts func(model string) []option.RequestOption
+	// chatOnly hides the embedding, speech and image models OpenAI lists.
+	chatOnly bool
+}
+
+func (p *openaiProvider) requestOptions(model string) []option.RequestOption {
+	if p.opts == nil {
+		return nil
+	}
+	return p.opts(model)
+}
+
+func (p *openaiProvider) Complete(ctx context.Context, model string, conv *Conversation, tools []Tool) (*reply, error) {
+	return callOpenAI(ctx, p.client, model, conv, tools, p.requestOptions(model)...)
+}
+
+func (p *openaiProvider) Stream(ctx context.Context, model string, conv *Conversation, tools []Tool, onToken func(string)) (*reply, error) {
+	return streamOpenAI(ctx, p.client, model, conv, tools, onToken, p.requestOptions(model)...)
+}
+
+func (p *openaiProvider) Models(ctx context.Context) ([]string, error) {
+	if p.opts != nil {
+		return nil, fmt.Errorf("this provider can't list its models")
+	}
+	var ids []string
+	iter := p.client.Models.ListAutoPaging(ctx)
+	for iter.Next() {
+		if id := iter.Current().ID; !p.chatOnly || isChatModel(id) {
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+const defaultAzureAPIVersion = "2024-10-21"
+
+// newAzureProvider addresses each model as an Azure deployment of the
+// same name.
+func newAzureProvider(cfg *Config, _ *openai.Client) (Provider, error) {
+	c := cfg.Providers.Azure
+	if c.Endpoint == "" {
+		return nil, fmt.Errorf("providers.azure.endpoint is not set")
+	}
+	key, err := c.APIKey.resolve()
+	if err != nil {
+		return nil, err
+	}
+	key = cmp.Or(key, os.Getenv("AZURE_OPENAI_API_KEY"))
+	if key == "" {
+		return nil, fmt.Errorf("no API key: set providers.azure.api_key or AZURE_OPENAI_API_KEY")
+	}
+	endpoint := strings.TrimRight(c.Endpoint, "/")
+	version := cmp.Or(c.APIVersion, defaultAzureAPIVersion)
+	client := openai.NewClient(
+		// Not the OpenAI key from the environment.
+		option.WithHeaderDel("authorization"),
+		option.WithHeader("api-key", key),
+		option.WithHTTPClient(apiHTTPClient()),
+	)
+	return &openaiProvider{
+		client: client,
+		opts: func(model string) []option.RequestOption {
+			return []option.RequestOption{
+				option.WithBaseURL(endpoint + "/openai/deployments/" + model + "/"),
+				option.WithQuery("api-version", version),
+			}
+		},
+	}, nil
+}
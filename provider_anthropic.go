@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192
+)
+
+// anthropicProvider talks to the Anthropic Messages API.
+type anthropicProvider struct {
+	key       string
+	baseURL   string
+	maxTokens int
+	// cache is the lifetime of cached prompts, "" for none.
+	cache string
+	http  *http.Client
+}
+
+func newAnthropicProvider(cfg *Config, _ *openai.Client) (Provider, error) {
+	c := cfg.Providers.Anthropic
+	key, err := c.APIKey.resolve()
+	if err != nil {
+		return nil, err
+	}
+	key = cmp.Or(key, os.Getenv("ANTHROPIC_API_KEY"))
+	if key == "" {
+		return nil, fmt.Errorf("no API key: set providers.anthropic.api_key or ANTHROPIC_API_KEY")
+	}
+	cache := cmp.Or(c.PromptCache, "5m")
+	if cache == "off" {
+		cache = ""
+	}
+	return &anthropicProvider{
+		key:       key,
+		baseURL:   strings.TrimRight(cmp.Or(c.BaseURL, "https://api.anthropic.com"), "/"),
+		maxTokens: cmp.Or(c.MaxTokens, anthropicMaxTokens),
+		cache:     cache,
+		http:      apiHTTPClient(),
+	}, nil
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    []anthropicBlock   `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is one content block; Type says which fields are set.
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	// CacheControl marks the end of a prefix of the request to cache.
+	CacheControl *anthropicCache `json:"cache_control,omitempty"`
+}
+
+type anthropicCache struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	InputSchema  map[string]any  `json:"input_schema"`
+	CacheControl *anthropicCache `json:"cache_control,omitempty"`
+}
+
+// anthropicUsage counts the input read from and written to the prompt
+// cache apart from InputTokens. CacheCreation splits the writes by how
+// long they are kept.
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheCreation            *struct {
+		Ephemeral5m int64 `json:"ephemeral_5m_input_tokens"`
+		Ephemeral1h int64 `json:"ephemeral_1h_input_tokens"`
+	} `json:"cache_creation"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicRequestFor translates a conversation. The system messages it
+// starts with become the system prompt, tool results user turns, and
+// consecutive turns of one role are merged. System messages further on,
+// such as the current time, go to the user turn they follow: in the
+// system prompt they would change the start of the request.
+//
+// With cache set, the request is marked to be cached up to the end of
+// the system prompt and up to the end of the conversation before any
+// closing notes, so the next request can read both from the cache.
+func anthropicRequestFor(model string, maxTokens int, cache string, conv *Conversation, tools []Tool) (*anthropicRequest, error) {
+	req := &anthropicRequest{Model: model, MaxTokens: maxTokens}
+	var system []string
+	messages := conv.Messages
+	// The closing system notes, which differ from one request to the next.
+	var notes []Message
+	if last := lastNonSystem(messages); last >= 0 {
+		messages, notes = messages[:last+1], messages[last+1:]
+	}
+	add := func(role string, blocks ...anthropicBlock) {
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+			return
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if len(req.Messages) > 0 {
+				add("user", anthropicBlock{Type: "text", Text: msg.Content})
+				continue
+			}
+			system = append(system, msg.Content)
+		case "user":
+			blocks := []anthropicBlock{{Type: "text", Text: msg.Content}}
+			for _, a := range msg.Attachments {
+				if !a.isImage() {
+					continue
+				}
+				data, err := a.load()
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicSource{
+					Type: "base64", MediaType: a.Type, Data: base64.StdEncoding.EncodeToString(data),
+				}})
+			}
+			add("user", blocks...)
+		case "assistant":
+			var blocks []anthropicBlock
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(cmp.Or(call.Arguments, "{}"))
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+			if len(blocks) > 0 {
+				add("assistant", blocks...)
+			}
+		case "tool":
+			add("user", anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		}
+	}
+	if len(system) > 0 {
+		req.System = []anthropicBlock{{Type: "text", Text: strings.Join(system, "\n\n")}}
+	}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, anthropicTool{Name: t.Name(), Description: t.Description(), InputSchema: t.Schema()})
+	}
+	if cache != "" {
+		mark := &anthropicCache{Type: "ephemeral"}
+		if cache != "5m" {
+			mark.TTL = cache
+		}
+		// Tools come before the system prompt, so its mark covers them.
+		if len(req.System) > 0 {
+			req.System[0].CacheControl = mark
+		} else if len(req.Tools) > 0 {
+			req.Tools[len(req.Tools)-1].CacheControl = mark
+		}
+		if n := len(req.Messages); n > 0 {
+			blocks := req.Messages[n-1].Content
+			blocks[len(blocks)-1].CacheControl = mark
+		}
+	}
+	for _, note := range notes {
+		add("user", anthropicBlock{Type: "text", Text: note.Content})
+	}
+	return req, nil
+}
+
+func lastNonSystem(messages []Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "system" {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *anthropicProvider) post(ctx context.Context, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.key)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, anthropicStatusError(resp)
+	}
+	return resp, nil
+}
+
+func anthropicStatusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e anthropicError
+	if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+		return fmt.Errorf("failed to create completion: %s: %s", resp.Status, e.Error.Message)
+	}
+	return fmt.Errorf("failed to create completion: %s", resp.Status)
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, model string, conv *Conversation, tools []Tool) (*reply, error) {
+	req, err := anthropicRequestFor(model, p.maxTokens, p.cache, conv, tools)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to read completion: %w", err)
+	}
+	return anthropicReply(out, p.cache), nil
+}
+
+// anthropicReply translates an answer; cache is the lifetime requested
+// for cache entries, which prices the writes when the usage doesn't say.
+func anthropicReply(out anthropicResponse, cache string) *reply {
+	u := out.Usage
+	r := &reply{
+		promptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		completionTokens: u.OutputTokens,
+		cachedTokens:     u.CacheReadInputTokens,
+		cacheWriteTokens: u.CacheCreationInputTokens,
+		finishReason:     out.StopReason,
+	}
+	switch {
+	case u.CacheCreation != nil:
+		r.cacheWriteTokens, r.longCacheWriteTokens = u.CacheCreation.Ephemeral5m, u.CacheCreation.Ephemeral1h
+	case cache == "1h":
+		r.cacheWriteTokens, r.longCacheWriteTokens = 0, u.CacheCreationInputTokens
+	}
+	switch out.StopReason {
+	case "max_tokens":
+		r.finishReason = string(openai.ChatCompletionChoicesFinishReasonLength)
+	case "refusal":
+		r.finishReason = string(openai.ChatCompletionChoicesFinishReasonContentFilter)
+	}
+	var text []string
+	for _, b := range out.Content {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "tool_use":
+			r.toolCalls = append(r.toolCalls, ToolCall{ID: b.ID, Name: b.Name, Arguments: cmp.Or(string(b.Input), "{}")})
+		}
+	}
+	r.content = strings.Join(text, "")
+	return r
+}
+
+// anthropicEvent is one server-sent event of a streamed answer.
+type anthropicEvent struct {
+	Type         string          `json:"type"`
+	Index        int             `json:"index"`
+	Message      json.RawMessage `json:"message"`
+	ContentBlock anthropicBlock  `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) Stream(ctx context.Context, model string, conv *Conversation, tools []Tool, onToken func(string)) (*reply, error) {
+	req, err := anthropicRequestFor(model, p.maxTokens, p.cache, conv, tools)
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+	resp, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The blocks are assembled as they arrive; tool input comes as
+	// fragments of JSON.
+	var out anthropicResponse
+	var inputs []strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, fmt.Errorf("failed to read completion: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			var start struct {
+				Usage anthropicUsage `json:"usage"`
+			}
+			json.Unmarshal(ev.Message, &start)
+			out.Usage = start.Usage
+		case "content_block_start":
+			for len(out.Content) <= ev.Index {
+				out.Content = append(out.Content, anthropicBlock{})
+				inputs = append(inputs, strings.Builder{})
+			}
+			out.Content[ev.Index] = ev.ContentBlock
+		case "content_block_delta":
+			if ev.Index >= len(out.Content) {
+				continue
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				out.Content[ev.Index].Text += ev.Delta.Text
+				onToken(ev.Delta.Text)
+			case "input_json_delta":
+				inputs[ev.Index].WriteString(ev.Delta.PartialJSON)
+			}
+		case "message_delta":
+			out.StopReason = ev.Delta.StopReason
+			out.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "error":
+			return nil, fmt.Errorf("failed to create completion: %s", ev.Error.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+	for i := range out.Content {
+		if in := inputs[i].String(); in != "" {
+			out.Content[i].Input = json.RawMessage(in)
+		}
+	}
+	return anthropicReply(out, p.cache), nil
+}
+
+func (p *anthropicProvider) Models(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", p.key)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// purgedMessage is one entry of a purge export.
+type purgedMessage struct {
+	Conversation string `json:"conversation"`
+	Message      int    `json:"message"`
+	ID           string `json:"id,omitempty"`
+	Role         string `json:"role"`
+	Timestamp    string `json:"timestamp"`
+	Content      string `json:"content"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "purge",
+		usage: "purge --matching <regex> [--export file.json] [--dry-run]",
+		help:  "Redact every stored message matching a pattern",
+		run:   runPurge,
+	})
+}
+
+func runPurge(cfg *Config, args []string) int {
+	fs := newFlagSet("purge")
+	matching := fs.String("matching", "", "regular expression; prefix with (?i) to ignore case")
+	export := fs.String("export", "", "write the matching messages to this JSON file before redacting")
+	dryRun := fs.Bool("dry-run", false, "report matches without changing anything")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	if *matching == "" {
+		fmt.Fprintln(os.Stderr, "Usage: purge --matching <regex> [--export file.json] [--dry-run]")
+		return exitError
+	}
+	re, err := regexp.Compile(*matching)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid pattern: %v\n", err)
+		return exitError
+	}
+
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var matches []purgedMessage
+	var touched []*Conversation
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", e.Name(), err)
+			continue
+		}
+		var numbers []string
+		for i, msg := range conv.Messages {
+			if msg.Redacted || !msg.matches(re) {
+				continue
+			}
+			matches = append(matches, purgedMessage{
+				Conversation: conv.ID,
+				Message:      i + 1,
+				ID:           msg.ID,
+				Role:         msg.Role,
+				Timestamp:    msg.Timestamp,
+				Content:      msg.Content,
+			})
+			numbers = append(numbers, fmt.Sprint(i+1))
+			conv.Messages[i].redact()
+		}
+		if len(numbers) > 0 {
+			fmt.Printf("%s: messages %s\n", conv.ID, strings.Join(numbers, ", "))
+			touched = append(touched, conv)
+		}
+	}
+
+	if *export != "" && len(matches) > 0 {
+		data, err := json.MarshalIndent(matches, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*export, data, 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: export failed, nothing was redacted: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("Exported %d messages to %s\n", len(matches), *export)
+	}
+
+	if *dryRun {
+		fmt.Printf("Would redact %d messages in %d conversations\n", len(matches), len(touched))
+		return exitOK
+	}
+	for _, conv := range touched {
+		if err := conv.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Printf("Redacted %d messages in %d conversations\n", len(matches), len(touched))
+	if err := pruneQuestionIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to prune the question index: %v\n", err)
+	}
+	return exitOK
+}
+
+// matches reports whether the message or its trace contains a match.
+func (m Message) matches(re *regexp.Regexp) bool {
+	if re.MatchString(m.Content) {
+		return true
+	}
+	for _, step := range m.Trace {
+		if re.MatchString(step.Content) {
+			return true
+		}
+	}
+	return false
+}
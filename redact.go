@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const redactedPlaceholder = "[redacted]"
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "redact",
+		usage: "redact <id> --message <n|msg_id[,...]>",
+		help:  "Replace stored messages with a placeholder",
+		run:   runRedact,
+	})
+}
+
+func runRedact(cfg *Config, args []string) int {
+	fs := newFlagSet("redact")
+	list := fs.String("message", "", "comma-separated message numbers or IDs as printed by show")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) != 1 || *list == "" {
+		fmt.Fprintln(os.Stderr, "Usage: redact <id> --message <n|msg_id[,...]>")
+		return exitError
+	}
+
+	conv, err := loadConversation(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var picked []int
+	for _, field := range strings.Split(*list, ",") {
+		i, err := conv.messageIndex(field)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		picked = append(picked, i)
+	}
+	for _, i := range picked {
+		conv.Messages[i].redact()
+	}
+
+	if err := conv.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Redacted %d message(s) in %s\n", len(picked), conv.ID)
+	if err := pruneQuestionIndex(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to prune the question index: %v\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(chatsDir, ".git")); err == nil {
+		fmt.Println("Note: earlier versions remain in the git history of the chats directory.")
+	}
+	return exitOK
+}
+
+func (m *Message) redact() {
+	m.Content = redactedPlaceholder
+	m.Redacted = true
+	m.Trace = nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fileReference matches @path in a message, at the start or after a
+// space so that e-mail addresses are left alone.
+var fileReference = regexp.MustCompile(`(?:^|\s)@([^\s@]+)`)
+
+// Limits on what @references may attach to one message. Each file is
+// also held to the attachment size limits.
+const (
+	maxReferencedFiles = 20
+	maxReferencedText  = 1 << 20
+)
+
+// attachReferences attaches the files named by @path references in text,
+// including glob patterns such as @src/*.go. Words after an @ that name
+// no file are sent as written. A file that can't be attached stops the
+// message, unless a glob matched it among others, in which case it is
+// skipped with a warning.
+func (s *session) attachReferences(text string) error {
+	context, files := s.context, s.files
+	fail := func(err error) error {
+		s.context, s.files = context, files
+		return fmt.Errorf("%w; nothing was sent", err)
+	}
+	seen := map[string]bool{}
+	count := 0
+	for _, m := range fileReference.FindAllStringSubmatch(text, -1) {
+		ref := m[1]
+		paths, _ := filepath.Glob(expandHome(ref))
+		if len(paths) == 0 {
+			// Punctuation after a reference, as in "see @main.go."
+			ref = strings.TrimRight(ref, ".,;:!?)]}'\"")
+			paths, _ = filepath.Glob(expandHome(ref))
+		}
+		if len(paths) == 0 {
+			if strings.ContainsAny(ref, "/*?[") || filepath.Ext(ref) != "" {
+				fmt.Fprintf(os.Stderr, "Warning: @%s matches no file; sent as written\n", ref)
+			}
+			continue
+		}
+		glob := len(paths) > 1 || strings.ContainsAny(ref, "*?[")
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if fi, err := os.Stat(path); err != nil {
+				return fail(err)
+			} else if fi.IsDir() {
+				if !glob {
+					return fail(fmt.Errorf("%s is a directory; reference the files in it, e.g. @%s", path, filepath.Join(path, "*")))
+				}
+				continue
+			}
+			count++
+			if count > maxReferencedFiles {
+				return fail(fmt.Errorf("the message references more than %d files", maxReferencedFiles))
+			}
+			if err := s.attachAs(path, path); err != nil {
+				if glob {
+					fmt.Fprintf(os.Stderr, "Warning: %v; skipped\n", err)
+					continue
+				}
+				return fail(err)
+			}
+		}
+	}
+	size := 0
+	for _, block := range s.context[len(context):] {
+		size += len(block)
+	}
+	if size > maxReferencedText {
+		return fail(fmt.Errorf("the referenced files come to %s of text, more than %s", formatBytes(size), formatBytes(maxReferencedText)))
+	}
+	return nil
+}
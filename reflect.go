@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+const critiquePrompt = "Critique your answer above as a demanding reviewer would. Check it for factual errors, " +
+	"mistakes in reasoning or code, missing parts of the question, and unclear writing. List concrete problems " +
+	"only. If there is nothing worth changing, reply with exactly: NO CHANGES"
+
+const revisePrompt = "Rewrite your answer, fixing the problems you found. Reply with only the revised answer, " +
+	"as if it were your first; do not mention the critique."
+
+// reflectOn has the model critique a draft reply and revise it. It
+// returns the reply to show and the steps that led to it.
+func (s *session) reflectOn(ctx context.Context, conv *Conversation, draft string) (string, []TraceStep, error) {
+	trace := []TraceStep{{Label: "draft", Content: draft}}
+	review := *conv
+	review.Messages = append(append([]Message{}, conv.Messages...),
+		Message{Role: "assistant", Content: draft},
+		Message{Role: "user", Content: critiquePrompt})
+
+	r, err := s.provider.Complete(ctx, s.model, &review, nil)
+	if err != nil {
+		return draft, trace, err
+	}
+	s.recordUsage(r)
+	trace = append(trace, TraceStep{Label: "critique", Tokens: r.completionTokens, Content: r.content})
+	if strings.TrimSpace(strings.Trim(r.content, ".")) == "NO CHANGES" {
+		return draft, trace, nil
+	}
+
+	review.Messages = append(review.Messages,
+		Message{Role: "assistant", Content: r.content},
+		Message{Role: "user", Content: revisePrompt})
+	r, err = s.provider.Complete(ctx, s.model, &review, nil)
+	if err != nil {
+		return draft, trace, err
+	}
+	s.recordUsage(r)
+	trace = append(trace, TraceStep{Label: "revision", Tokens: r.completionTokens, Content: r.content})
+	return r.content, trace, nil
+}
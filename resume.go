@@ -0,0 +1,201 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resumeFlag names the conversation to continue: an ID, "last" for the
+// most recent one, or resumePick to choose from a list.
+var resumeFlag = flag.String("resume", "", "continue a saved conversation by ID, or \"last\"; the resume subcommand picks from a list")
+
+const (
+	resumePick = "?"
+	// pickerSize is how many recent conversations the picker lists.
+	pickerSize = 20
+	// replayMessages is how many earlier messages are shown on resuming.
+	replayMessages = 6
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "switch",
+		usage: "/switch [id|last]",
+		help:  "Save this conversation and continue another, picked from a list without an ID",
+		run:   cmdSwitch,
+	})
+}
+
+// savedConversation is a conversation file, for listing.
+type savedConversation struct {
+	id       string
+	modified time.Time
+	conv     *Conversation
+}
+
+// recentConversations returns up to n saved conversations, most
+// recently changed first. Files that can't be read are skipped.
+func recentConversations(n int) ([]savedConversation, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if err != nil {
+		return nil, err
+	}
+	var saved []savedConversation
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		saved = append(saved, savedConversation{id: strings.TrimSuffix(e.Name(), ".xml"), modified: fi.ModTime()})
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].modified.After(saved[j].modified) })
+	var out []savedConversation
+	for _, sc := range saved {
+		if len(out) == n {
+			break
+		}
+		conv, err := loadConversation(sc.id)
+		if err != nil {
+			continue
+		}
+		sc.conv = conv
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// pickConversation lists the recent conversations and asks which one to
+// continue. It returns "" if none was chosen.
+func pickConversation(input lineReader) (string, error) {
+	recent, err := recentConversations(pickerSize)
+	if err != nil {
+		return "", err
+	}
+	if len(recent) == 0 {
+		return "", fmt.Errorf("there are no saved conversations in %s", chatsDir)
+	}
+	for i, sc := range recent {
+		first := ""
+		if j := firstIndex(sc.conv, "user"); j >= 0 {
+			first = truncate(sc.conv.Messages[j].Content, 50)
+		}
+		fmt.Printf("%3d. %s  %s  %s\n", i+1, sc.modified.Format("2006-01-02 15:04"),
+			paint(theme.Meta, fmt.Sprintf("%-20s %3d msgs", sc.id, len(sc.conv.Messages))), first)
+	}
+	answer, err := input.ReadLine("Resume which? [1] ")
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return recent[0].id, nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(recent) {
+		return "", fmt.Errorf("pick a number from 1 to %d", len(recent))
+	}
+	return recent[n-1].id, nil
+}
+
+func firstIndex(c *Conversation, role string) int {
+	for i, msg := range c.Messages {
+		if msg.Role == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveResume turns the --resume value into a conversation ID.
+func resolveResume(ref string, input lineReader) (string, error) {
+	switch ref {
+	case resumePick:
+		return pickConversation(input)
+	case "last":
+		recent, err := recentConversations(1)
+		if err != nil {
+			return "", err
+		}
+		if len(recent) == 0 {
+			return "", fmt.Errorf("there are no saved conversations in %s", chatsDir)
+		}
+		return recent[0].id, nil
+	}
+	return strings.TrimSuffix(filepath.Base(ref), ".xml"), nil
+}
+
+// pickResumed loads the conversation --resume names.
+func (s *session) pickResumed(ref string) (*Conversation, error) {
+	id, err := resolveResume(ref, s.input)
+	if err != nil {
+		return nil, err
+	}
+	return loadConversation(id)
+}
+
+// resume continues a saved conversation in this session with its
+// persona and the model that wrote its last answer, and shows its last
+// messages for context.
+func (s *session) resume(conv *Conversation) error {
+	p, err := s.cfg.resolvePersona(conv.Persona)
+	if err != nil {
+		return err
+	}
+	s.conv = conv
+	if p.Model != "" {
+		s.pinModel(p.Model)
+	}
+	if i := conv.lastIndex("assistant"); i >= 0 && conv.Messages[i].Model != "" {
+		s.model = conv.Messages[i].Model
+	}
+	var shown []Message
+	for _, msg := range conv.Messages {
+		if (msg.Role == "user" || msg.Role == "assistant") && msg.Content != "" {
+			shown = append(shown, msg)
+		}
+	}
+	if len(shown) > replayMessages {
+		info("%s\n\n", paint(theme.Meta, fmt.Sprintf("(%d earlier messages)", len(shown)-replayMessages)))
+		shown = shown[len(shown)-replayMessages:]
+	}
+	for _, msg := range shown {
+		if msg.Role == "user" {
+			info("%s%s\n", s.userPrompt(), msg.Content)
+		} else if msg.Speaker != "" {
+			fmt.Printf("%s %s\n\n", paint(theme.castColor(0), msg.Speaker+":"), forDisplay(msg.Content))
+		} else {
+			fmt.Printf("%s %s\n\n", paint(theme.Assistant, "Assistant:"), forDisplay(msg.Content))
+		}
+	}
+	return nil
+}
+
+func cmdSwitch(s *session, args string) error {
+	conv, err := s.pickResumed(cmp.Or(args, resumePick))
+	if err != nil {
+		return err
+	}
+	if conv.ID == s.conv.ID {
+		return fmt.Errorf("already in %s", conv.ID)
+	}
+	s.save()
+	s.usage = sessionUsage{}
+	s.context, s.files, s.staged = nil, nil, nil
+	info("\n")
+	if err := s.resume(conv); err != nil {
+		return err
+	}
+	s.status.refresh(s)
+	info("Switched to %s\n", conv.ID)
+	return nil
+}
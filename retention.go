@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionConfig maps tags and personas to how long their conversations
+// are kept after the last message: a duration such as "24h" or "30d", or
+// "forever". When several rules match, the longest one wins.
+type RetentionConfig struct {
+	Default  string            `yaml:"default"`
+	Tags     map[string]string `yaml:"tags"`
+	Personas map[string]string `yaml:"personas"`
+	// Images is how long `images gc` keeps stored images that
+	// conversations still show.
+	Images string `yaml:"images"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "cleanup",
+		usage: "cleanup [--dry-run]",
+		help:  "Delete conversations past their retention period",
+		run:   runCleanup,
+	})
+}
+
+func runCleanup(cfg *Config, args []string) int {
+	fs := newFlagSet("cleanup")
+	dryRun := fs.Bool("dry-run", false, "list expired conversations without deleting them")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+	removed, err := enforceRetention(cfg.Retention, time.Now(), *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	for _, id := range removed {
+		fmt.Println(id)
+	}
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+	}
+	fmt.Printf("%s %d conversations\n", verb, len(removed))
+	return exitOK
+}
+
+// retentionInterval is how often the long-running modes apply the
+// retention rules.
+const retentionInterval = time.Hour
+
+var (
+	expiredMu       sync.Mutex
+	expiredHandlers []func(ids []string)
+)
+
+// onExpired registers a function that is told which conversations
+// keepRetaining deleted, so that bots and rooms drop the copies they keep
+// in memory instead of saving them again.
+func onExpired(handler func(ids []string)) {
+	expiredMu.Lock()
+	defer expiredMu.Unlock()
+	expiredHandlers = append(expiredHandlers, handler)
+}
+
+// keepRetaining applies the retention rules now and every hour from then
+// on, for serve, the bots and the email daemon, which could otherwise run
+// for longer than conversations are kept.
+func (cfg *Config) keepRetaining() {
+	if cfg.Retention.Default == "" && len(cfg.Retention.Tags) == 0 && len(cfg.Retention.Personas) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+		for {
+			if removed, err := enforceRetention(cfg.Retention, time.Now(), false); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: retention cleanup failed: %v\n", err)
+			} else if len(removed) > 0 {
+				info("Deleted %d expired conversations\n", len(removed))
+				expiredMu.Lock()
+				for _, handler := range expiredHandlers {
+					handler(removed)
+				}
+				expiredMu.Unlock()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// enforceRetention deletes expired conversations and returns their IDs,
+// along with the attached files no other conversation refers to. Files
+// that cannot be parsed are left alone.
+func enforceRetention(cfg RetentionConfig, now time.Time, dryRun bool) ([]string, error) {
+	if cfg.Default == "" && len(cfg.Tags) == 0 && len(cfg.Personas) == 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(chatsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	attached := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			continue
+		}
+		keep, err := cfg.retentionFor(conv)
+		if err != nil {
+			return removed, err
+		}
+		if keep == 0 || now.Sub(conv.lastActivity()) < keep {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(conv.getFilePath()); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, conv.ID)
+		for _, msg := range conv.Messages {
+			for _, a := range msg.Attachments {
+				if a.Ref != "" {
+					attached[a.Ref] = true
+				}
+			}
+		}
+	}
+	if dryRun || len(attached) == 0 {
+		return removed, nil
+	}
+	return removed, removeUnreferenced(attached)
+}
+
+// removeUnreferenced deletes those of the stored files in refs that no
+// conversation refers to any more. Only these are considered, so files
+// stored for a conversation that has not been saved yet are left alone.
+func removeUnreferenced(refs map[string]bool) error {
+	images, _, err := storedImages()
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if !refs[img.ref] || len(img.users) > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(chatsDir, filepath.FromSlash(img.ref))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// retentionFor returns how long conv is kept; zero means forever.
+func (cfg RetentionConfig) retentionFor(conv *Conversation) (time.Duration, error) {
+	var rules []string
+	for _, tag := range conv.Tags {
+		if r, ok := cfg.Tags[tag]; ok {
+			rules = append(rules, r)
+		}
+	}
+	persona := conv.Persona
+	if persona == "" {
+		persona = "default"
+	}
+	if r, ok := cfg.Personas[persona]; ok {
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		rules = append(rules, cfg.Default)
+	}
+
+	var longest time.Duration
+	for _, r := range rules {
+		d, err := parseRetention(r)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, nil
+		}
+		longest = max(longest, d)
+	}
+	return longest, nil
+}
+
+// parseRetention accepts Go durations plus a "d" suffix for days. Empty,
+// "0" and "forever" mean keep forever.
+func parseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "0", "forever":
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid retention %q", s)
+		}
+		return time.Duration(n * 24 * float64(time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid retention %q", s)
+	}
+	return d, nil
+}
+
+func (c *Conversation) lastActivity() time.Time {
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if t, err := time.Parse(time.RFC3339, c.Messages[i].Timestamp); err == nil {
+			return t
+		}
+	}
+	t, _ := time.Parse(time.RFC3339, c.CreatedAt)
+	return t
+}
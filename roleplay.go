@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roleplayPrompt is appended to each cast member's system prompt.
+const roleplayPrompt = "You are %s in a group conversation with the user and %s. " +
+	"Messages from the others are shown as \"[name]: text\". Reply only as yourself, " +
+	"without a name prefix, and keep it to a conversational length. You may address the others directly."
+
+// maxAutoRounds bounds /auto so a conversation can't run away with the
+// API budget.
+const maxAutoRounds = 10
+
+func init() {
+	registerCommand(&command{
+		name:  "cast",
+		usage: "/cast [persona...|off]",
+		help:  "Show the cast, or have several personas take turns replying",
+		run:   cmdCast,
+	})
+	registerCommand(&command{
+		name:  "next",
+		usage: "/next <persona>",
+		help:  "Let one cast member speak now",
+		run: func(s *session, args string) error {
+			if !slices.Contains(s.cast, args) {
+				return fmt.Errorf("%q is not in the cast", args)
+			}
+			s.speak(args)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		name:  "auto",
+		usage: "/auto [rounds]",
+		help:  "Let the cast talk among themselves (default 1 round)",
+		run:   cmdAuto,
+	})
+	registerCommand(&command{
+		name:  "mute",
+		usage: "/mute <persona>",
+		help:  "Skip a cast member until unmuted",
+		run: func(s *session, args string) error {
+			return s.setMuted(args, true)
+		},
+	})
+	registerCommand(&command{
+		name:  "unmute",
+		usage: "/unmute <persona>",
+		help:  "Let a muted cast member speak again",
+		run: func(s *session, args string) error {
+			return s.setMuted(args, false)
+		},
+	})
+}
+
+func cmdCast(s *session, args string) error {
+	switch args {
+	case "":
+		if len(s.cast) == 0 {
+			info("No cast; the current persona replies alone\n")
+			return nil
+		}
+		for _, name := range s.cast {
+			state := ""
+			if s.muted[name] {
+				state = " (muted)"
+			}
+			fmt.Printf("  %s%s\n", s.castLabel(name), state)
+		}
+		return nil
+	case "off":
+		s.cast, s.muted = nil, nil
+		info("Cast cleared\n")
+		return nil
+	}
+	return s.setCast(strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' }))
+}
+
+func (s *session) setCast(names []string) error {
+	if len(names) < 2 {
+		return fmt.Errorf("a cast needs at least two personas")
+	}
+	for _, name := range names {
+		if _, err := s.cfg.resolvePersona(name); err != nil {
+			return err
+		}
+	}
+	s.cast, s.muted = names, map[string]bool{}
+	info("Cast: %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+func (s *session) setMuted(name string, muted bool) error {
+	if !slices.Contains(s.cast, name) {
+		return fmt.Errorf("%q is not in the cast", name)
+	}
+	s.muted[name] = muted
+	return nil
+}
+
+func cmdAuto(s *session, args string) error {
+	if len(s.cast) == 0 {
+		return fmt.Errorf("no cast; set one with /cast")
+	}
+	rounds := 1
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			return fmt.Errorf("usage: /auto [rounds]")
+		}
+		rounds = min(n, maxAutoRounds)
+	}
+	for i := 0; i < rounds; i++ {
+		if !s.castTurn() {
+			break
+		}
+	}
+	return nil
+}
+
+// castTurn has each unmuted cast member reply once, in order. It reports
+// false if a request failed or was cancelled.
+func (s *session) castTurn() bool {
+	for _, name := range s.cast {
+		if s.muted[name] {
+			continue
+		}
+		if !s.speak(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// speak requests a reply from one cast member and records it under their
+// name. Tools are not offered in roleplay.
+func (s *session) speak(name string) bool {
+	p, err := s.cfg.resolvePersona(name)
+	if err != nil {
+		s.requestFailed(err)
+		return false
+	}
+	model := s.model
+	if p.Model != "" {
+		model = p.Model
+	}
+	view := s.castView(name, p)
+	if s.injectTime {
+		view = withTimeContext(view, time.Now())
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	timer := startStats(model)
+	response, err := s.provider.Complete(ctx, model, view, nil)
+	if err != nil {
+		s.requestFailed(err)
+		return false
+	}
+	s.recordUsage(response)
+	timer.add(response)
+	var trace []TraceStep
+	if len(p.PostProcess) > 0 {
+		processed, steps, err := s.postProcess(ctx, name, p.PostProcess, response.content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: post-processing failed, showing the answer as written: %v\n", err)
+		}
+		response.content = processed
+		trace = steps
+	}
+	stats := timer.done()
+
+	if quiet {
+		fmt.Printf("[%s] %s\n", name, forDisplay(response.content))
+	} else {
+		fmt.Printf("%s %s\n\n", s.castLabel(name), forDisplay(response.content))
+	}
+	s.conv.addMessage("assistant", response.content)
+	s.conv.Messages[len(s.conv.Messages)-1].Speaker = name
+	s.conv.Messages[len(s.conv.Messages)-1].Model = model
+	s.conv.Messages[len(s.conv.Messages)-1].Trace = trace
+	s.conv.Messages[len(s.conv.Messages)-1].Stats = stats
+	s.showStats(stats)
+	s.save()
+	s.status.refresh(s)
+	s.runAnswerHooks(len(s.conv.Messages) - 1)
+	return true
+}
+
+func (s *session) castLabel(name string) string {
+	i := slices.Index(s.cast, name)
+	return paint(theme.castColor(max(i, 0)), name+":")
+}
+
+// castView is the conversation as one cast member sees it: its own
+// replies as the assistant's, everyone else's as attributed user turns.
+func (s *session) castView(name string, p Persona) *Conversation {
+	var others []string
+	for _, other := range s.cast {
+		if other != name {
+			others = append(others, other)
+		}
+	}
+	view := &Conversation{ID: s.conv.ID}
+	view.addMessage("system", p.SystemPrompt+"\n\n"+fmt.Sprintf(roleplayPrompt, name, strings.Join(others, ", ")))
+	for _, m := range s.conv.Messages {
+		switch {
+		case m.Role == "user":
+			view.Messages = append(view.Messages, m)
+		case m.Role != "assistant" || m.Content == "":
+			// System prompt, and tool traffic from before the cast.
+		case m.Speaker == name:
+			view.Messages = append(view.Messages, Message{Role: "assistant", Content: m.Content})
+		default:
+			speaker := m.Speaker
+			if speaker == "" {
+				speaker = "assistant"
+			}
+			view.Messages = append(view.Messages, Message{Role: "user", Content: "[" + speaker + "]: " + m.Content})
+		}
+	}
+	return view
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Group chat rooms let several people on the network talk with the
+// assistant in one conversation. The protocol is plain HTTP:
+//
+//	GET  /rooms/{room}/events?user=name   newline-delimited JSON events
+//	POST /rooms/{room}/messages           {"user": ..., "content": ...}
+//	POST /rooms/{room}/typing             {"user": ...}
+//
+// Events are "message" (role user or assistant), "presence" (who is
+// connected), "typing" and "error". A new listener first receives the
+// conversation so far.
+type roomEvent struct {
+	Type    string   `json:"type"`
+	User    string   `json:"user,omitempty"`
+	Role    string   `json:"role,omitempty"`
+	Content string   `json:"content,omitempty"`
+	Users   []string `json:"users,omitempty"`
+	Time    string   `json:"time,omitempty"`
+}
+
+const roomPrompt = `Several people talk with you in this room. Their messages start with "name: ". Address people by name when it helps, and keep answers short enough for a chat.`
+
+var roomName = regexp.MustCompile(`^[\w-]{1,40}$`)
+
+type room struct {
+	mu        sync.Mutex
+	conv      *Conversation
+	listeners map[chan roomEvent]string
+	// replying serializes requests to the model.
+	replying sync.Mutex
+}
+
+type roomServer struct {
+	cfg    *Config
+	client *openai.Client
+	router *router
+	mu     sync.Mutex
+	rooms  map[string]*room
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "room",
+		usage: "room <url> [--name name]",
+		help:  "Join a group chat room on a serve instance, e.g. http://host:8765/rooms/kitchen",
+		run:   runRoom,
+	})
+	registerRoute("/rooms/{room}/{action}", func(cfg *Config) http.Handler {
+		rs := &roomServer{cfg: cfg, rooms: map[string]*room{}}
+		onExpired(rs.expire)
+		return rs
+	})
+}
+
+func (rs *roomServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if password := rs.cfg.Serve.Password; password.isSet() {
+		want, err := password.resolve()
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err != nil || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			http.Error(w, "wrong or missing password", http.StatusUnauthorized)
+			return
+		}
+	}
+	name := r.PathValue("room")
+	if !roomName.MatchString(name) {
+		http.Error(w, "room names are letters, digits, - and _", http.StatusBadRequest)
+		return
+	}
+	rm, err := rs.room(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch action := r.PathValue("action"); {
+	case action == "events" && r.Method == http.MethodGet:
+		rm.stream(w, r, r.URL.Query().Get("user"))
+	case action == "messages" && r.Method == http.MethodPost:
+		ev, ok := decodeRoomEvent(w, r)
+		if !ok || ev.Content == "" {
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		go rs.post(rm, ev.User, ev.Content)
+	case action == "typing" && r.Method == http.MethodPost:
+		if ev, ok := decodeRoomEvent(w, r); ok {
+			rm.broadcast(roomEvent{Type: "typing", User: ev.User})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func decodeRoomEvent(w http.ResponseWriter, r *http.Request) (roomEvent, bool) {
+	var ev roomEvent
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&ev); err != nil || ev.User == "" {
+		http.Error(w, `expected {"user": ..., "content": ...}`, http.StatusBadRequest)
+		return ev, false
+	}
+	return ev, true
+}
+
+// room returns the named room, loading its conversation from disk the
+// first time it is used. A room is only created if none is stored, so one
+// that can't be read isn't overwritten.
+func (rs *roomServer) room(name string) (*room, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rm, ok := rs.rooms[name]; ok {
+		return rm, nil
+	}
+	if rs.client == nil {
+		client, err := newClient(rs.cfg)
+		if err != nil {
+			return nil, err
+		}
+		rs.client = client
+	}
+	if rs.router == nil {
+		r, err := newRouter(rs.cfg, rs.cfg.DefaultPersona, roomPrompt)
+		if err != nil {
+			return nil, err
+		}
+		rs.router = r
+	}
+	conv, err := loadConversation("room_" + name)
+	if errors.Is(err, os.ErrNotExist) {
+		conv, err = rs.newConversation(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rm := &room{conv: conv, listeners: map[chan roomEvent]string{}}
+	rs.rooms[name] = rm
+	return rm, nil
+}
+
+// newConversation starts the conversation of a new room.
+func (rs *roomServer) newConversation(name string) (*Conversation, error) {
+	persona, err := rs.cfg.resolvePersona(rs.cfg.DefaultPersona)
+	if err != nil {
+		return nil, err
+	}
+	conv := newConversation(persona.SystemPrompt + "\n\n" + roomPrompt)
+	conv.ID = "room_" + name
+	conv.addTags("room")
+	return conv, nil
+}
+
+// expire starts the rooms whose conversations were deleted afresh. The
+// rooms stay, so the people in them remain connected.
+func (rs *roomServer) expire(ids []string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, id := range ids {
+		name, ok := strings.CutPrefix(id, "room_")
+		rm := rs.rooms[name]
+		if !ok || rm == nil {
+			continue
+		}
+		conv, err := rs.newConversation(name)
+		if err != nil {
+			delete(rs.rooms, name)
+			continue
+		}
+		rm.mu.Lock()
+		rm.conv = conv
+		rm.mu.Unlock()
+	}
+}
+
+func (rm *room) stream(w http.ResponseWriter, r *http.Request, user string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || user == "" {
+		http.Error(w, "streaming requires ?user=name", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+
+	events := make(chan roomEvent, 64)
+	rm.mu.Lock()
+	for _, m := range rm.conv.Messages {
+		if (m.Role == "user" || m.Role == "assistant") && m.Content != "" {
+			enc.Encode(roomEvent{Type: "message", User: m.Speaker, Role: m.Role, Content: m.Content, Time: m.Timestamp})
+		}
+	}
+	rm.listeners[events] = user
+	rm.mu.Unlock()
+	flusher.Flush()
+	rm.broadcast(rm.presence())
+
+	defer func() {
+		rm.mu.Lock()
+		delete(rm.listeners, events)
+		rm.mu.Unlock()
+		rm.broadcast(rm.presence())
+	}()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			if enc.Encode(ev) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (rm *room) presence() roomEvent {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	var users []string
+	for _, u := range rm.listeners {
+		if !slices.Contains(users, u) {
+			users = append(users, u)
+		}
+	}
+	slices.Sort(users)
+	return roomEvent{Type: "presence", Users: users}
+}
+
+// broadcast sends ev to every listener, dropping it for any that has
+// fallen too far behind rather than stalling the room.
+func (rm *room) broadcast(ev roomEvent) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for ch := range rm.listeners {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// post records a message and has the assistant answer it.
+func (rs *roomServer) post(rm *room, user, content string) {
+	queued.Add(1)
+	defer queued.Add(-1)
+	rm.mu.Lock()
+	rm.conv.addMessage("user", content)
+	msg := &rm.conv.Messages[len(rm.conv.Messages)-1]
+	msg.Speaker = user
+	ev := roomEvent{Type: "message", User: user, Role: "user", Content: content, Time: msg.Timestamp}
+	rm.save()
+	rm.mu.Unlock()
+	rm.broadcast(ev)
+
+	rm.replying.Lock()
+	defer rm.replying.Unlock()
+	rt, err := rs.router.route("room", strings.TrimPrefix(rm.conv.ID, "room_"), user, content)
+	if err != nil {
+		rm.broadcast(roomEvent{Type: "error", Content: err.Error()})
+		return
+	}
+	rm.broadcast(roomEvent{Type: "typing", User: "assistant"})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	rm.mu.Lock()
+	view := withSystem(attributedView(rm.conv, 0), rt.system)
+	rm.mu.Unlock()
+	r, err := callOpenAI(ctx, rs.client, rt.model, view, nil)
+	if err != nil {
+		rm.broadcast(roomEvent{Type: "error", Content: err.Error()})
+		return
+	}
+	rs.router.charge(rt, r)
+	rm.mu.Lock()
+	rm.conv.addMessage("assistant", r.content)
+	ev = roomEvent{Type: "message", Role: "assistant", Content: r.content, Time: rm.conv.Messages[len(rm.conv.Messages)-1].Timestamp}
+	rm.save()
+	rm.mu.Unlock()
+	rm.broadcast(ev)
+}
+
+func (rm *room) save() {
+	err := os.MkdirAll(chatsDir, 0755)
+	if err == nil {
+		err = rm.conv.save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save %s: %v\n", rm.conv.ID, err)
+	}
+}
+
+func runRoom(cfg *Config, args []string) int {
+	fs := newFlagSet("room")
+	defaultName := os.Getenv("USER")
+	if u, err := user.Current(); err == nil && defaultName == "" {
+		defaultName = u.Username
+	}
+	name := fs.String("name", defaultName, "your name in the room")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 || *name == "" {
+		fmt.Fprintln(os.Stderr, "Usage: room <url> [--name name]")
+		return exitError
+	}
+	base := strings.TrimRight(rest[0], "/")
+	var password string
+	if cfg.Serve.Password.isSet() {
+		if password, err = cfg.Serve.Password.resolve(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: serve.password: %v\n", err)
+			return exitError
+		}
+	}
+	request := func(method, path string, body any) (*http.Response, error) {
+		var r io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			r = strings.NewReader(string(data))
+		}
+		req, err := http.NewRequest(method, base+path, r)
+		if err != nil {
+			return nil, err
+		}
+		if password != "" {
+			req.Header.Set("Authorization", "Bearer "+password)
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := request(http.MethodGet, "/events?user="+url.QueryEscape(*name), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		fmt.Fprintf(os.Stderr, "Error: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return exitAPIError
+	}
+	defer resp.Body.Close()
+	info("Joined %s as %s. Type messages and press Enter; /quit leaves.\n", base, *name)
+
+	go func() {
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var ev roomEvent
+			if err := dec.Decode(&ev); err != nil {
+				fmt.Fprintln(os.Stderr, "Disconnected from the room")
+				os.Exit(exitAPIError)
+			}
+			printRoomEvent(ev, *name)
+		}
+	}()
+
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		switch line {
+		case "":
+			continue
+		case "/quit", "/exit":
+			return exitOK
+		}
+		r, err := request(http.MethodPost, "/messages", roomEvent{User: *name, Content: line})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		r.Body.Close()
+	}
+	return exitOK
+}
+
+func printRoomEvent(ev roomEvent, me string) {
+	switch ev.Type {
+	case "message":
+		switch {
+		case ev.Role == "assistant":
+			fmt.Printf("%s %s\n\n", paint(theme.Assistant, "Assistant:"), forDisplay(ev.Content))
+		case ev.User != me:
+			fmt.Printf("%s %s\n", paint(theme.Other, ev.User+":"), ev.Content)
+		}
+	case "presence":
+		info("%s\n", paint(theme.Meta, "  here: "+strings.Join(ev.Users, ", ")))
+	case "typing":
+		if ev.User != me {
+			info("%s\n", paint(theme.Meta, "  "+ev.User+" is typing..."))
+		}
+	case "error":
+		fmt.Fprintf(os.Stderr, "Error: %s\n", ev.Content)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutingRule picks the persona, model and budget for messages to the
+// bots and to serve's rooms. Every condition that is set must match, and
+// the first rule that matches is used.
+type RoutingRule struct {
+	// Network is irc, matrix, room, or a webhook's network name.
+	Network string `yaml:"network"`
+	// Chat and User are globs, e.g. "*#support". IRC chats are named
+	// "server #channel", rooms by their name, and Matrix rooms by ID.
+	Chat string `yaml:"chat"`
+	User string `yaml:"user"`
+	// Keywords match if any appears in the message, ignoring case.
+	Keywords []string `yaml:"keywords"`
+
+	Persona string `yaml:"persona"`
+	Model   string `yaml:"model"`
+	// Budget caps what the messages this rule matches may cost, in
+	// dollars per day.
+	Budget float64 `yaml:"budget"`
+}
+
+// errOverBudget is returned when a routing rule's daily budget is spent.
+var errOverBudget = errors.New("the daily budget for this chat is used up")
+
+// router evaluates the routing rules for each incoming message.
+type router struct {
+	cfg *Config
+	// persona is used when no rule names one, and suffix is added to
+	// every persona's prompt.
+	persona string
+	suffix  string
+
+	mu    sync.Mutex
+	day   string
+	spent map[int]float64
+}
+
+// route is what a message was routed to.
+type route struct {
+	rule    int // index in cfg.Routing, or -1
+	persona string
+	system  string
+	model   string
+}
+
+func newRouter(cfg *Config, persona, suffix string) (*router, error) {
+	r := &router{cfg: cfg, persona: persona, suffix: suffix, spent: map[int]float64{}}
+	// Fail at startup rather than on the first message.
+	if _, err := cfg.resolvePersona(persona); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *router) route(network, chat, user, text string) (route, error) {
+	rt := route{rule: -1}
+	persona := r.persona
+	for i, rule := range r.cfg.Routing {
+		if rule.matches(network, chat, user, text) {
+			rt.rule = i
+			if rule.Persona != "" {
+				persona = rule.Persona
+			}
+			rt.model = rule.Model
+			break
+		}
+	}
+	p, err := r.cfg.resolvePersona(persona)
+	if err != nil {
+		return rt, err
+	}
+	rt.persona = cmp.Or(persona, "default")
+	rt.system = p.SystemPrompt + "\n\n" + r.suffix
+	if rt.model == "" {
+		rt.model = p.Model
+	}
+	if rt.model == "" {
+		rt.model = r.cfg.baseModel()
+	}
+
+	if rt.rule >= 0 && r.cfg.Routing[rt.rule].Budget > 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.resetDay()
+		if r.spent[rt.rule] >= r.cfg.Routing[rt.rule].Budget {
+			return rt, errOverBudget
+		}
+	}
+	return rt, nil
+}
+
+// charge counts a reply's cost against its rule's budget.
+func (r *router) charge(rt route, resp *reply) {
+	m, ok := lookupModel(rt.model)
+	if rt.rule < 0 || !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetDay()
+	r.spent[rt.rule] += m.cost(resp.tokens())
+}
+
+func (r *router) resetDay() {
+	if today := time.Now().Format(time.DateOnly); today != r.day {
+		r.day = today
+		clear(r.spent)
+	}
+}
+
+func (rule RoutingRule) matches(network, chat, user, text string) bool {
+	if rule.Network != "" && !strings.EqualFold(rule.Network, network) {
+		return false
+	}
+	if !globMatch(rule.Chat, chat) || !globMatch(rule.User, user) {
+		return false
+	}
+	if len(rule.Keywords) == 0 {
+		return true
+	}
+	text = strings.ToLower(text)
+	for _, k := range rule.Keywords {
+		if strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether s matches pattern, ignoring case. An empty
+// pattern matches anything.
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return ok
+}
+
+// withSystem returns view with its system prompt replaced. view must be
+// a copy, as made by attributedView.
+func withSystem(view *Conversation, system string) *Conversation {
+	for i := range view.Messages {
+		if view.Messages[i].Role == "system" {
+			view.Messages[i].Content = system
+			return view
+		}
+	}
+	view.Messages = append([]Message{{Role: "system", Content: system}}, view.Messages...)
+	return view
+}
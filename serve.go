@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ServeConfig struct {
+	// Listen is the address serve listens on (default :8765, or
+	// localhost:8765 without a password, since anyone who can reach the
+	// server can use its rooms).
+	Listen string `yaml:"listen"`
+	// URL is how others reach this server, for the links it hands out,
+	// e.g. http://laptop.local:8765. By default the LAN address is used.
+	URL string `yaml:"url"`
+	// Password, if set, is required to join group chat rooms.
+	Password Credential `yaml:"password"`
+	// MaxQueue is how many unanswered messages /readyz tolerates before
+	// reporting the server unavailable (0: no limit).
+	MaxQueue int `yaml:"max_queue"`
+}
+
+const (
+	defaultListen      = ":8765"
+	defaultLocalListen = "localhost:8765"
+)
+
+// routes are the HTTP handlers serve offers, keyed by ServeMux pattern.
+var routes = map[string]func(cfg *Config) http.Handler{}
+
+func registerRoute(pattern string, handler func(cfg *Config) http.Handler) {
+	routes[pattern] = handler
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "serve",
+		usage: "serve [--listen addr]",
+		help:  "Run a web server for shared conversations on the local network",
+		run:   runServe,
+	})
+}
+
+func runServe(cfg *Config, args []string) int {
+	fs := newFlagSet("serve")
+	listen := fs.String("listen", cfg.Serve.listen(), "address to listen on")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+
+	mux := http.NewServeMux()
+	patterns := make([]string, 0, len(routes))
+	for pattern := range routes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		mux.Handle(pattern, routes[pattern](cfg))
+	}
+	if cfg.HTTP.WarmUp {
+		// The pool is shared, so the rooms' and bots' clients get the
+		// warm connection.
+		if client, err := newClient(cfg); err == nil {
+			cfg.keepWarm(client, cfg.baseModel())
+		}
+	}
+	cfg.keepRetaining()
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := stopContext()
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	if !cfg.Serve.Password.isSet() && !loopback(*listen) {
+		fmt.Fprintf(os.Stderr, "Warning: serve.password is not set, so anyone who can reach %s can create rooms and chat at your expense\n", *listen)
+	}
+	info("Serving on %s (Ctrl+C to stop)\n", cfg.Serve.baseURL(*listen))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func (c ServeConfig) listen() string {
+	switch {
+	case c.Listen != "":
+		return c.Listen
+	case c.Password.isSet():
+		return defaultListen
+	}
+	return defaultLocalListen
+}
+
+// loopback reports whether listen only accepts connections from this
+// machine.
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// baseURL is the address others on the network can use to reach a server
+// listening on listen.
+func (c ServeConfig) baseURL(listen string) string {
+	if c.URL != "" {
+		return strings.TrimRight(c.URL, "/")
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = lanAddress()
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// lanAddress finds the address of the interface that routes outward. The
+// UDP "connection" sends nothing; it only selects the interface.
+func lanAddress() string {
+	conn, err := net.Dial("udp", "192.0.2.1:9")
+	if err != nil {
+		return "localhost"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
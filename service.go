@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "service",
+		usage: "service install|uninstall|status [<command>]",
+		help:  "Run serve, bot, email daemon or digest as a user service (systemd or launchd)",
+		run:   runService,
+	})
+}
+
+// service is a long-running or periodic command installed as a user
+// service: a systemd unit on Linux, a launchd agent on macOS.
+type service struct {
+	name string
+	// args is the command line after the binary.
+	args []string
+	// every runs the command periodically instead of keeping it running.
+	every time.Duration
+	env   map[string]string
+}
+
+const defaultDigestEvery = 24 * time.Hour
+
+func runService(cfg *Config, args []string) int {
+	if len(args) == 0 || (args[0] != "install" && args[0] != "uninstall" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "Usage: service install [--every <duration>] [--env NAME,...] [--dry-run] <command> [args]")
+		fmt.Fprintln(os.Stderr, "       service uninstall <command> [args]")
+		fmt.Fprintln(os.Stderr, "       service status [<command> [args]]")
+		return exitError
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		fmt.Fprintf(os.Stderr, "Error: services are supported on Linux (systemd) and macOS (launchd), not %s\n", runtime.GOOS)
+		return exitError
+	}
+	action := args[0]
+	fs := newFlagSet("service " + action)
+	every := fs.Duration("every", 0, "run the command this often instead of keeping it running (digest: 24h)")
+	env := fs.String("env", "", "comma-separated environment variables to copy into the service, e.g. OPENAI_API_KEY")
+	dryRun := fs.Bool("dry-run", false, "print the service files instead of installing them")
+	noStart := fs.Bool("no-start", false, "install without starting the service")
+	// The command's own flags follow it, so flags stop at the command.
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitError
+	}
+	if action == "status" && fs.NArg() == 0 {
+		return serviceStatusAll()
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: service %s <command> [args], e.g. service %s bot irc\n", action, action)
+		return exitError
+	}
+	svc, err := newService(fs.Args(), *every)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	switch action {
+	case "install":
+		if err := svc.addEnv(*env); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		err = svc.install(*dryRun, !*noStart)
+	case "uninstall":
+		err = svc.uninstall()
+	case "status":
+		err = svc.status()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// newService checks that a command can run as a service and names it
+// after the command, e.g. chat-cli-bot-irc.
+func newService(args []string, every time.Duration) (*service, error) {
+	switch {
+	case args[0] == "serve", args[0] == "bot" && len(args) > 1:
+	case args[0] == "email" && len(args) > 1 && args[1] == "daemon":
+	case args[0] == "digest":
+		if every == 0 {
+			every = defaultDigestEvery
+		}
+	default:
+		return nil, fmt.Errorf("%q can't run as a service; use serve, bot <network>, email daemon or digest", strings.Join(args, " "))
+	}
+	if every < 0 || every > 0 && every < time.Minute {
+		return nil, fmt.Errorf("--every must be at least a minute")
+	}
+	parts := []string{appName}
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") {
+			break
+		}
+		parts = append(parts, a)
+	}
+	if profileName != "" {
+		parts = append(parts, profileName)
+		args = append([]string{"--profile", profileName}, args...)
+	}
+	if configFile != "" {
+		path, err := filepath.Abs(expandHome(configFile))
+		if err != nil {
+			return nil, err
+		}
+		args = append([]string{"--config", path}, args...)
+	}
+	name := strings.Trim(unsafeIDChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-"), "-")
+	return &service{name: name, args: args, every: every, env: map[string]string{}}, nil
+}
+
+// addEnv records the variables the service needs from this environment:
+// PATH, for hooks and tools, the XDG directories the config and data may
+// live in, and the ones named.
+func (svc *service) addEnv(names string) error {
+	for _, name := range []string{"PATH", "XDG_CONFIG_HOME", "XDG_DATA_HOME"} {
+		if v := os.Getenv(name); v != "" {
+			svc.env[name] = v
+		}
+	}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return fmt.Errorf("$%s is not set", name)
+		}
+		svc.env[name] = v
+	}
+	return nil
+}
+
+func (svc *service) envNames() []string {
+	names := make([]string, 0, len(svc.env))
+	for name := range svc.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (svc *service) describe() string {
+	d := appName + " " + strings.Join(svc.args, " ")
+	if svc.every > 0 {
+		d += " every " + svc.every.String()
+	}
+	return d
+}
+
+// serviceFile is one file written to install a service.
+type serviceFile struct {
+	path string
+	data []byte
+}
+
+func (svc *service) install(dryRun, start bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	var files []serviceFile
+	if runtime.GOOS == "darwin" {
+		files, err = svc.launchdFiles(exe)
+	} else {
+		files, err = svc.systemdFiles(exe)
+	}
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, f := range files {
+			fmt.Printf("# %s\n%s\n", f.path, f.data)
+		}
+		return nil
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return err
+		}
+		// The environment may hold API keys.
+		if err := os.WriteFile(f.path, f.data, 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", f.path)
+	}
+	if !start {
+		return nil
+	}
+	if runtime.GOOS == "darwin" {
+		if err := os.MkdirAll(filepath.Dir(svc.logPath()), 0755); err != nil {
+			return err
+		}
+		if _, err := commandOutput(exec.Command("launchctl", "load", "-w", files[0].path)); err != nil {
+			return err
+		}
+		fmt.Printf("Started %s; logs go to %s\n", svc.name, svc.logPath())
+		return nil
+	}
+	if _, err := commandOutput(exec.Command("systemctl", "--user", "daemon-reload")); err != nil {
+		return err
+	}
+	if _, err := commandOutput(exec.Command("systemctl", "--user", "enable", "--now", svc.systemdUnit())); err != nil {
+		return err
+	}
+	fmt.Printf("Started %s; see its logs with journalctl --user -u %s -f\n", svc.systemdUnit(), svc.name)
+	fmt.Printf("To keep it running while you are logged out: loginctl enable-linger %s\n", os.Getenv("USER"))
+	return nil
+}
+
+func (svc *service) uninstall() error {
+	if runtime.GOOS == "darwin" {
+		path, err := svc.launchdPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s is not installed", svc.name)
+		}
+		if _, err := commandOutput(exec.Command("launchctl", "unload", "-w", path)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", path)
+		return nil
+	}
+	dir, err := systemdUserDir()
+	if err != nil {
+		return err
+	}
+	service := filepath.Join(dir, svc.name+".service")
+	if _, err := os.Stat(service); err != nil {
+		return fmt.Errorf("%s is not installed", svc.name)
+	}
+	for _, unit := range []string{svc.name + ".timer", svc.name + ".service"} {
+		path := filepath.Join(dir, unit)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if _, err := commandOutput(exec.Command("systemctl", "--user", "disable", "--now", unit)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", path)
+	}
+	if _, err := commandOutput(exec.Command("systemctl", "--user", "daemon-reload")); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
+
+// status shows what the service manager says about the service.
+func (svc *service) status() error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("launchctl", "list", svc.name)
+	} else {
+		cmd = exec.Command("systemctl", "--user", "status", "--no-pager", svc.systemdUnit(), svc.name+".service")
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		// systemctl status exits non-zero for a stopped service, after
+		// showing it.
+		if _, ok := err.(*exec.ExitError); ok && runtime.GOOS != "darwin" {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// serviceStatusAll lists the installed services and whether they run.
+func serviceStatusAll() int {
+	var dir, suffix string
+	var err error
+	if runtime.GOOS == "darwin" {
+		dir, err = launchAgentsDir()
+		suffix = ".plist"
+	} else {
+		dir, err = systemdUserDir()
+		suffix = ".service"
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, appName+"-*"+suffix))
+	if len(matches) == 0 {
+		fmt.Println("No services installed.")
+		return exitOK
+	}
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), suffix)
+		var state string
+		if runtime.GOOS == "darwin" {
+			state = "loaded"
+			if _, err := exec.Command("launchctl", "list", name).Output(); err != nil {
+				state = "not loaded"
+			}
+		} else {
+			unit := name + ".service"
+			if _, err := os.Stat(filepath.Join(dir, name+".timer")); err == nil {
+				unit = name + ".timer"
+			}
+			out, _ := exec.Command("systemctl", "--user", "is-active", unit).Output()
+			state = cmp.Or(strings.TrimSpace(string(out)), "unknown")
+		}
+		fmt.Printf("%-32s %s\n", name, state)
+	}
+	return exitOK
+}
+
+// systemdUnit is the unit to enable: the timer of a periodic service.
+func (svc *service) systemdUnit() string {
+	if svc.every > 0 {
+		return svc.name + ".timer"
+	}
+	return svc.name + ".service"
+}
+
+func systemdUserDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "systemd", "user"), nil
+}
+
+func (svc *service) systemdFiles(exe string) ([]serviceFile, error) {
+	dir, err := systemdUserDir()
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s\nAfter=network-online.target\n\n[Service]\n", svc.describe())
+	if svc.every > 0 {
+		b.WriteString("Type=oneshot\n")
+	} else {
+		b.WriteString("Type=simple\n")
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdQuote(append([]string{exe}, svc.args...)...))
+	for _, name := range svc.envNames() {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(name+"="+svc.env[name]))
+	}
+	if svc.every == 0 {
+		b.WriteString("Restart=on-failure\nRestartSec=10\n\n[Install]\nWantedBy=default.target\n")
+	}
+	files := []serviceFile{{path: filepath.Join(dir, svc.name+".service"), data: []byte(b.String())}}
+	if svc.every > 0 {
+		timer := fmt.Sprintf("[Unit]\nDescription=%s\n\n[Timer]\nOnActiveSec=1min\nOnUnitActiveSec=%ds\n\n[Install]\nWantedBy=timers.target\n",
+			svc.describe(), int64(svc.every/time.Second))
+		files = append(files, serviceFile{path: filepath.Join(dir, svc.name+".timer"), data: []byte(timer)})
+	}
+	return files, nil
+}
+
+// systemdQuote quotes words for a unit file, where % starts a specifier.
+func systemdQuote(words ...string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		w = strings.ReplaceAll(w, "%", "%%")
+		if w != "" && !strings.ContainsAny(w, " \t\"'\\;$") {
+			quoted[i] = w
+			continue
+		}
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(w) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func launchAgentsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents"), nil
+}
+
+func (svc *service) launchdPath() (string, error) {
+	dir, err := launchAgentsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, svc.name+".plist"), nil
+}
+
+func (svc *service) logPath() string {
+	return filepath.Join(dataDir, "logs", svc.name+".log")
+}
+
+func (svc *service) launchdFiles(exe string) ([]serviceFile, error) {
+	path, err := svc.launchdPath()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	str := func(s string) {
+		b.WriteString("<string>")
+		xml.EscapeText(&b, []byte(s))
+		b.WriteString("</string>")
+	}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>`)
+	str(svc.name)
+	b.WriteString("\n\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range append([]string{exe}, svc.args...) {
+		b.WriteString("\t\t")
+		str(a)
+		b.WriteString("\n")
+	}
+	b.WriteString("\t</array>\n\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for _, name := range svc.envNames() {
+		b.WriteString("\t\t<key>")
+		xml.EscapeText(&b, []byte(name))
+		b.WriteString("</key>")
+		str(svc.env[name])
+		b.WriteString("\n")
+	}
+	b.WriteString("\t</dict>\n")
+	if svc.every > 0 {
+		fmt.Fprintf(&b, "\t<key>StartInterval</key>\n\t<integer>%d</integer>\n", int64(svc.every/time.Second))
+	} else {
+		// Restart after a crash, but not after a clean exit.
+		b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+		b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>10</integer>\n")
+	}
+	b.WriteString("\t<key>StandardOutPath</key>")
+	str(svc.logPath())
+	b.WriteString("\n\t<key>StandardErrorPath</key>")
+	str(svc.logPath())
+	b.WriteString("\n</dict>\n</plist>\n")
+	return []serviceFile{{path: path, data: b.Bytes()}}, nil
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// session holds the state of one interactive run that slash commands may
+// read or modify.
+type session struct {
+	conv *Conversation
+	// provider answers in the chat; client is OpenAI, for everything
+	// else (images, speech, embeddings).
+	provider Provider
+	client   *openai.Client
+	cfg      *Config
+	input    lineReader
+	model    string
+	timeout  time.Duration
+	status   *statusLine
+	ui       *tui
+	usage    sessionUsage
+
+	// defaultModel is the model of the provider, or --model, for
+	// personas that don't pin one.
+	defaultModel string
+
+	// incognito keeps the conversation in memory only; tempFiles are the
+	// files written for it meanwhile, removed when it ends.
+	incognito bool
+	tempFiles []string
+
+	// saveAnswered keeps the conversation from being saved until it ends
+	// with an answer, so that a failed -p request leaves nothing behind.
+	saveAnswered bool
+	// injectTime sends the current time along with each request.
+	injectTime bool
+	// questions caches the archive's questions for the duplicate check.
+	questions questionCache
+	// typed is whether the message being sent was typed by the user, not
+	// piped in or pasted; only then are its @path references attached.
+	typed bool
+
+	vars     map[string]string
+	snippets map[string]string
+
+	recording []macroStep
+	pending   []macroStep
+
+	// context holds blocks to send ahead of the next user message, and
+	// files the attached files to store with it.
+	context []string
+	files   []Attachment
+	// staged are the files /stage collected for the next message.
+	staged []string
+
+	// reflect adds a critique-and-revise round to every reply, and
+	// verify checks replies against the sources they drew on.
+	reflect bool
+	verify  bool
+
+	// readAloud speaks answers; lastAudio holds the files of the last
+	// one spoken, or lastSpeech its audio when incognito.
+	readAloud  bool
+	lastAudio  []string
+	lastSpeech [][]byte
+
+	// stats shows the time and tokens of each answer.
+	stats bool
+	// noStream waits for whole answers instead of printing them as they
+	// arrive.
+	noStream bool
+	// maxContinues is how many times an answer cut off at the length
+	// limit is continued automatically.
+	maxContinues int
+
+	// cast are the personas taking turns to reply, if more than one.
+	cast  []string
+	muted map[string]bool
+
+	// route is how turns are routed when model_router is on: "" to
+	// classify each, "off", or the class every turn goes as; routeOnce
+	// overrides it for one message.
+	route     string
+	routeOnce string
+
+	// spending caches the month's spending for the budgets, and
+	// budgetWarned the budgets already warned about.
+	spending     *monthSpending
+	budgetWarned map[string]bool
+
+	exitCode int
+}
+
+type sessionUsage struct {
+	// contextTokens is the size of the conversation as of the last reply:
+	// what the next request will send, before the new message.
+	contextTokens int64
+	Usage
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "retry",
+		usage: "/retry",
+		help:  "Discard the last reply and ask again",
+		run: func(s *session, args string) error {
+			return s.retry()
+		},
+	})
+	registerCommand(&command{
+		name:  "model",
+		usage: "/model [name]",
+		help:  "List the available models, or switch to another for the rest of the session",
+		run:   cmdModel,
+	})
+	registerCommand(&command{
+		name:  "clear",
+		usage: "/clear",
+		help:  "Save this conversation and start a new one with the same persona",
+		run:   cmdClear,
+	})
+	registerCommand(&command{
+		name:  "save",
+		usage: "/save [file]",
+		help:  "Save the conversation now, or write a copy to a file (.md for Markdown)",
+		run:   cmdSave,
+	})
+	registerCommand(&command{
+		name:  "history",
+		usage: "/history [n]",
+		help:  "Show the last n messages (default 10)",
+		run:   cmdHistory,
+	})
+	registerCommand(&command{
+		name:  "copy",
+		usage: "/copy",
+		help:  "Copy the last reply to the clipboard",
+		run: func(s *session, args string) error {
+			return s.copyLast()
+		},
+	})
+}
+
+// nextInput returns the next line to process, draining queued macro steps
+// before reading from stdin. ok is false once input is exhausted.
+func (s *session) nextInput() (string, bool) {
+	prompt := s.userPrompt()
+	if len(s.pending) > 0 {
+		step := s.pending[0]
+		s.pending = s.pending[1:]
+		if !step.Pause {
+			info("%s%s\n", prompt, step.Text)
+			s.typed = true
+			return step.Text, true
+		}
+		prompt = step.Text + ": "
+	}
+	line, err := s.input.ReadLine(prompt)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			s.exitCode = exitError
+		}
+		return "", false
+	}
+	s.typed = s.input.Typed()
+	s.recordInput(strings.TrimSpace(line))
+	return line, true
+}
+
+// addContext queues a labelled block to be sent with the next message.
+func (s *session) addContext(label, body string) {
+	s.context = append(s.context, fmt.Sprintf("[%s]\n%s\n[/%s]", label, body, label))
+}
+
+// submit sends a message as typed: with variables and snippets expanded,
+// once it has passed the filters and confirmations.
+func (s *session) submit(input string) {
+	text, ok := s.filterOutgoing(s.expandInput(unescapeCommand(input)))
+	if !ok || !s.confirmSize(text) || !s.confirmNotDuplicate(text) {
+		return
+	}
+	s.send(text)
+}
+
+// send appends a user message, preceded by any queued context, and asks
+// for a reply.
+func (s *session) send(text string) {
+	if err := s.attachStaged(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	if !s.typed {
+		if fileReference.MatchString(text) {
+			info("%s\n", paint(theme.Meta, "@references in piped or pasted text are not attached"))
+		}
+	} else if err := s.attachReferences(text); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	s.attachVideoTranscripts(text)
+	if len(s.context) > 0 {
+		text = strings.Join(s.context, "\n\n") + "\n\n" + text
+		s.context = nil
+	}
+	s.conv.addMessage("user", text)
+	s.conv.Messages[len(s.conv.Messages)-1].Attachments = s.files
+	s.files = nil
+	s.save()
+	s.complete()
+}
+
+// complete requests a reply to the conversation as it stands, running any
+// tools the model calls, then prints and stores the answer. Failures are
+// reported and recorded in the exit code.
+func (s *session) complete() {
+	if !s.checkBudgets() {
+		return
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+
+	if len(s.cast) > 0 {
+		s.castTurn()
+		return
+	}
+
+	// A routed turn is answered by its model throughout: tool rounds,
+	// continuations and reflection.
+	class, model, step := s.routeTurn(ctx)
+	if model != "" {
+		defer func(model string) { s.model = model }(s.model)
+		s.model = model
+	}
+
+	enabled := s.cfg.enabledTools()
+	turnStart := s.conv.lastIndex("user")
+	timer := startStats(s.model)
+	var trace []TraceStep
+	if step != nil {
+		trace = append(trace, *step)
+	}
+	for round := 0; ; round++ {
+		if round == maxToolRounds {
+			// Make the model answer with what it has.
+			enabled = nil
+		}
+		if untrustedConfig.BlockTools && enabled != nil && s.conv.hasUntrustedSince(turnStart) {
+			info("%s\n", paint(theme.Meta, decor("  ⚙ tools disabled", "Tools are disabled")+" for the rest of this turn: untrusted content"))
+			enabled = nil
+		}
+		s.fitContext(ctx, false)
+		conv := s.outgoing()
+		live := &liveAnswer{}
+		response, err := s.request(ctx, conv, enabled, timer, live)
+		if err != nil && contextOverflow(err) && s.fitContext(ctx, true) {
+			conv = s.outgoing()
+			response, err = s.request(ctx, conv, enabled, timer, live)
+		}
+		if err != nil {
+			s.requestFailed(err)
+			return
+		}
+		s.recordUsage(response)
+		timer.add(response)
+
+		if len(response.toolCalls) == 0 {
+			if err := s.autoContinue(ctx, conv, response, timer); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to continue the answer, showing what arrived: %v\n", err)
+			}
+			if s.reflect {
+				revised, steps, err := s.reflectOn(ctx, conv, response.content)
+				if errors.Is(err, context.Canceled) {
+					s.requestFailed(err)
+					return
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: reflection failed, showing the first draft: %v\n", err)
+				}
+				response.content = revised
+				trace = append(trace, steps...)
+			}
+			if steps := s.postSteps(); len(steps) > 0 {
+				processed, steps, err := s.postProcess(ctx, s.personaName(), steps, response.content)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: post-processing failed, showing the answer as written: %v\n", err)
+				}
+				response.content = processed
+				trace = append(trace, steps...)
+			}
+			stats := timer.done()
+			live.finish(response.content)
+			if s.verify {
+				claims, steps, err := s.verifyAnswer(ctx, turnStart, response.content)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					fmt.Fprintf(os.Stderr, "Warning: verification failed: %v\n", err)
+				}
+				showUnsupported(claims)
+				trace = append(trace, steps...)
+			}
+			s.conv.addMessage("assistant", response.content)
+			s.conv.Messages[len(s.conv.Messages)-1].Model = s.model
+			s.conv.Messages[len(s.conv.Messages)-1].Route = class
+			s.conv.Messages[len(s.conv.Messages)-1].Trace = trace
+			s.conv.Messages[len(s.conv.Messages)-1].Stats = stats
+			s.conv.Messages[len(s.conv.Messages)-1].Truncated = response.truncated()
+			s.showTruncated(response.truncated())
+			if response.filtered() {
+				fmt.Fprintln(os.Stderr, "Warning: the provider's content filter stopped the answer")
+				s.exitCode = exitModerationBlocked
+			}
+			s.showStats(stats)
+			s.save()
+			s.status.refresh(s)
+			s.runAnswerHooks(len(s.conv.Messages) - 1)
+			if s.readAloud {
+				s.speakText(response.content)
+			}
+			return
+		}
+
+		live.end()
+		if response.content != "" {
+			trace = append(trace, TraceStep{Label: "assistant", Content: response.content})
+		}
+		s.conv.addToolCalls(response.content, response.toolCalls)
+		approval := s.confirmToolCalls(response.toolCalls)
+		results := runApprovedToolCalls(ctx, response.toolCalls, enabled, approval, !s.incognito)
+		for i, call := range response.toolCalls {
+			result := results[i]
+			showToolCall(call, result)
+			s.conv.addToolResult(call.ID, result)
+			s.conv.Messages[len(s.conv.Messages)-1].Approval = approval[i]
+			trace = append(trace,
+				TraceStep{Label: "tool call " + call.Name, Content: compactJSON(call.Arguments)},
+				TraceStep{Label: "tool result " + call.Name, Content: result})
+		}
+		s.save()
+	}
+}
+
+// outgoing is the conversation as the next request sends it: condensed,
+// with the notes the session adds.
+func (s *session) outgoing() *Conversation {
+	conv := s.conv.condensed()
+	if s.injectTime {
+		conv = withTimeContext(conv, time.Now())
+	}
+	if s.conv.hasUntrustedSince(0) {
+		conv = withSystemNote(conv, untrustedNotice)
+	}
+	return conv
+}
+
+// requestFailed reports a failed request and records it in the exit
+// code. A cancelled request is not a failure.
+func (s *session) requestFailed(err error) {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Request cancelled")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	s.exitCode = exitCodeFor(err)
+}
+
+func (s *session) recordUsage(r *reply) {
+	s.usage.contextTokens = r.promptTokens + r.completionTokens
+	s.countUsage(s.model, r)
+}
+
+// countUsage adds a request's tokens to the session's and conversation's
+// totals without taking its size for that of the conversation.
+func (s *session) countUsage(model string, r *reply) {
+	s.usage.add(model, r)
+	if s.conv.Usage == nil {
+		s.conv.Usage = &Usage{}
+	}
+	s.conv.Usage.add(model, r)
+}
+
+func (s *session) userPrompt() string {
+	if s.incognito {
+		return paint(theme.Incognito, "You (incognito):") + " "
+	}
+	return paint(theme.User, "You:") + " "
+}
+
+// tempFile writes data to a temporary file that is removed when the
+// conversation is cleared or the session ends.
+func (s *session) tempFile(pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	s.tempFiles = append(s.tempFiles, f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return f.Name(), err
+}
+
+func (s *session) removeTempFiles() {
+	for _, path := range s.tempFiles {
+		os.Remove(path)
+	}
+	s.tempFiles = nil
+}
+
+func (s *session) save() {
+	if s.incognito {
+		return
+	}
+	if s.saveAnswered && s.conv.lastIndex("assistant") != len(s.conv.Messages)-1 {
+		return
+	}
+	if err := s.conv.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to save conversation: %v\n", err)
+	}
+}
+
+// requestContext bounds a request by --timeout and lets Ctrl+C cancel it
+// without exiting the program.
+func (s *session) requestContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, release := s.ui.cancellable(ctx)
+	if s.timeout <= 0 {
+		return ctx, func() {
+			release()
+			stop()
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	return ctx, func() {
+		cancel()
+		release()
+		stop()
+	}
+}
+
+func (s *session) retry() error {
+	last := -1
+	for i, msg := range s.conv.Messages {
+		if msg.Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("nothing to retry")
+	}
+	s.conv.Messages = s.conv.Messages[:last+1]
+	s.save()
+	s.complete()
+	return nil
+}
+
+func cmdModel(s *session, args string) error {
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	ids, err := s.provider.Models(ctx)
+	if args == "" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list the models: %v\n", err)
+			fmt.Println(s.model)
+			return nil
+		}
+		for _, id := range ids {
+			marker := " "
+			if id == s.model {
+				marker = "*"
+			}
+			fmt.Printf(" %s %s\n", marker, id)
+		}
+		return nil
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: failed to check the model: %v\n", err)
+	case !slices.Contains(ids, args):
+		return fmt.Errorf("unknown model %q; /model lists the available ones", args)
+	}
+	s.pinModel(args)
+	s.status.refresh(s)
+	info("Switched to model %s\n", args)
+	return nil
+}
+
+func cmdClear(s *session, args string) error {
+	old := s.conv
+	s.save()
+	s.removeTempFiles()
+	conv := newConversation(old.firstContent("system"))
+	if conv.ID == old.ID {
+		// unix IDs have one-second resolution, and an incognito
+		// conversation isn't on disk to be avoided.
+		conv.ID += "_2"
+	}
+	conv.Persona, conv.Tags = old.Persona, old.Tags
+	s.conv = conv
+	s.usage = sessionUsage{}
+	s.context, s.files, s.staged = nil, nil, nil
+	s.save()
+	s.status.refresh(s)
+	if s.incognito {
+		info("Started a new conversation\n")
+	} else {
+		info("Saved %s and started %s\n", old.ID, conv.ID)
+	}
+	return nil
+}
+
+func cmdSave(s *session, args string) error {
+	if args == "" {
+		if s.incognito {
+			return fmt.Errorf("incognito conversations are not saved; give a file to write a copy")
+		}
+		if err := s.conv.save(); err != nil {
+			return err
+		}
+		info("Saved to %s\n", s.conv.getFilePath())
+		return nil
+	}
+	path := expandHome(args)
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		var picked []exportedMessage
+		for i, msg := range s.conv.Messages {
+			if msg.Role != "system" && msg.Role != "tool" && msg.Content != "" {
+				picked = append(picked, exportedMessage{Message: i + 1, ID: msg.ID, Role: msg.Role, Speaker: msg.Speaker, Timestamp: msg.Timestamp, Content: msg.Content})
+			}
+		}
+		data = []byte(exportMarkdown(s.conv, picked))
+	} else {
+		var err error
+		if data, err = xml.MarshalIndent(s.conv, "", "  "); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	info("Wrote %s\n", path)
+	return nil
+}
+
+func cmdHistory(s *session, args string) error {
+	n := 10
+	if args != "" {
+		var err error
+		if n, err = strconv.Atoi(args); err != nil || n < 1 {
+			return fmt.Errorf("usage: /history [n]")
+		}
+	}
+	printMessages(s.conv.Messages, max(len(s.conv.Messages)-n, 0), false)
+	return nil
+}
+
+// copyLast puts the last reply on the clipboard using the OSC 52 terminal
+// escape, which works over SSH and needs no external tools.
+func (s *session) copyLast() error {
+	text := s.conv.lastContent("assistant")
+	if text == "" {
+		return fmt.Errorf("no reply to copy")
+	}
+	fmt.Fprintf(os.Stdout, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return nil
+}
+
+func exitCodeFor(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	if moderationBlocked(err) {
+		return exitModerationBlocked
+	}
+	return exitAPIError
+}
+
+// moderationBlocked reports whether the provider refused a request for
+// its content, as Azure's content filter and OpenAI's policy checks do.
+func moderationBlocked(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, sign := range []string{"content_filter", "content_policy_violation", "content management policy", "flagged by our moderation"} {
+		if strings.Contains(msg, sign) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// share grants read-only access to a conversation until it expires. Only
+// a hash of the token is kept, so the file doesn't hold usable links.
+type share struct {
+	TokenHash    string    `json:"token_hash"`
+	Conversation string    `json:"conversation"`
+	Expires      time.Time `json:"expires"`
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(asset("templates/share.html")))
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "share-link",
+		usage: "share-link <id> [--ttl 1h] | share-link --list | share-link --revoke <id>",
+		help:  "Create an expiring link to a read-only view of a conversation, served by serve",
+		run:   runShareLink,
+	})
+	registerRoute("GET /s/{token}", func(cfg *Config) http.Handler {
+		return http.HandlerFunc(serveShare)
+	})
+}
+
+func sharesPath() string {
+	return filepath.Join(dataDir, "shares.json")
+}
+
+// loadShares returns the shares that haven't expired.
+func loadShares() ([]share, error) {
+	var all, live []share
+	data, err := os.ReadFile(sharesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("%s: %w", sharesPath(), err)
+	}
+	for _, s := range all {
+		if time.Now().Before(s.Expires) {
+			live = append(live, s)
+		}
+	}
+	return live, nil
+}
+
+func saveShares(shares []share) error {
+	data, err := json.MarshalIndent(shares, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(sharesPath(), data, 0600)
+}
+
+func runShareLink(cfg *Config, args []string) int {
+	fs := newFlagSet("share-link")
+	ttl := fs.Duration("ttl", time.Hour, "how long the link works")
+	list := fs.Bool("list", false, "list conversations with live links")
+	revoke := fs.Bool("revoke", false, "invalidate every link to the conversation")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	shares, err := loadShares()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *list {
+		for _, s := range shares {
+			fmt.Printf("%s  expires %s\n", s.Conversation, s.Expires.Local().Format("2006-01-02 15:04"))
+		}
+		return exitOK
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: share-link <id> [--ttl 1h] | share-link --list | share-link --revoke <id>")
+		return exitError
+	}
+	conv, err := loadConversation(rest[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *revoke {
+		kept := shares[:0]
+		for _, s := range shares {
+			if s.Conversation != conv.ID {
+				kept = append(kept, s)
+			}
+		}
+		if err := saveShares(kept); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		info("Revoked %d links to %s\n", len(shares)-len(kept), conv.ID)
+		return exitOK
+	}
+	if *ttl <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --ttl must be positive")
+		return exitError
+	}
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	shares = append(shares, share{TokenHash: sha256Hex([]byte(token)), Conversation: conv.ID, Expires: time.Now().Add(*ttl)})
+	if err := saveShares(shares); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	listen := cfg.Serve.listen()
+	fmt.Printf("%s/s/%s\n", cfg.Serve.baseURL(listen), token)
+	info("Valid until %s, while serve is running\n", time.Now().Add(*ttl).Format("15:04 Jan 2"))
+	if cfg.Serve.URL == "" && loopback(listen) {
+		fmt.Fprintf(os.Stderr, "Warning: serve listens on %s, so the link only works on this machine. To share it on your network, set serve.password (serve then listens on all interfaces) or serve.listen, or serve.url if a proxy makes serve reachable\n", listen)
+	}
+	return exitOK
+}
+
+func serveShare(w http.ResponseWriter, r *http.Request) {
+	shares, err := loadShares()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	hash := sha256Hex([]byte(r.PathValue("token")))
+	for _, s := range shares {
+		if s.TokenHash != hash {
+			continue
+		}
+		conv, err := loadConversation(s.Conversation)
+		if err != nil {
+			http.Error(w, "conversation not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		shareTemplate.Execute(w, map[string]any{"Conv": conv, "Expires": s.Expires.Local().Format("15:04 Jan 2")})
+		return
+	}
+	http.Error(w, "this link is invalid or has expired", http.StatusNotFound)
+}
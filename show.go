@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "show",
+		usage: "show <id> [--follow] [--trace]",
+		help:  "Print a saved conversation, optionally tailing new messages",
+		run:   runShow,
+	})
+}
+
+func runShow(cfg *Config, args []string) int {
+	fs := newFlagSet("show")
+	follow := fs.Bool("follow", false, "keep watching the file and print messages as they are appended")
+	showTrace := fs.Bool("trace", false, "expand the traces of internal calls behind replies")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check for changes with --follow")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: show <id> [--follow] [--trace]")
+		return exitError
+	}
+
+	conv, err := loadConversation(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	path := conv.getFilePath()
+
+	fmt.Printf("=== %s (%s) ===\n\n", conv.ID, conv.CreatedAt)
+	printed := printMessages(conv.Messages, 0, *showTrace)
+	if !*follow {
+		return exitOK
+	}
+
+	lastMod := modTime(path)
+	for {
+		time.Sleep(*interval)
+		mod := modTime(path)
+		if mod.Equal(lastMod) {
+			continue
+		}
+		conv, err := loadConversation(path)
+		if err != nil {
+			// The writer may be mid-rename; try again on the next tick.
+			continue
+		}
+		lastMod = mod
+		if len(conv.Messages) < printed {
+			fmt.Println("--- conversation was rewound ---")
+			printed = len(conv.Messages)
+			continue
+		}
+		printed = printMessages(conv.Messages, printed, *showTrace)
+	}
+}
+
+// printMessages prints messages from index from on and returns how many
+// there are. Traces are summarized in one line unless expanded.
+func printMessages(messages []Message, from int, traces bool) int {
+	for i, msg := range messages[from:] {
+		role := msg.Role
+		if msg.Speaker != "" {
+			role += " (" + msg.Speaker + ")"
+		}
+		if msg.Route != "" {
+			role += " (" + msg.Model + " as " + msg.Route + ")"
+		}
+		if msg.Approval != "" {
+			role += " (" + msg.Approval + ")"
+		}
+		fmt.Printf("#%d %s [%s] %s:\n%s\n\n", from+i+1, msg.ID, msg.Timestamp, role, msg.Content)
+		for _, a := range msg.Attachments {
+			kind := "file"
+			if a.isImage() {
+				kind = "image"
+			}
+			fmt.Printf("[%s: %s]\n\n", kind, a.Name)
+		}
+		if len(msg.Trace) > 0 {
+			if traces {
+				printTrace(msg.Trace)
+			} else {
+				fmt.Printf("[trace: %d steps; show --trace to expand]\n\n", len(msg.Trace))
+			}
+		}
+	}
+	return len(messages)
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
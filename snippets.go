@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	varPattern     = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+	snippetPattern = regexp.MustCompile(`(^|\s)!([A-Za-z0-9_-]+)`)
+	namePattern    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "setvar",
+		usage: "/setvar <name> <value>",
+		help:  "Set a variable expanded as {{name}} in outgoing messages",
+		run:   cmdSetVar,
+	})
+	registerCommand(&command{
+		name:  "snippet",
+		usage: "/snippet save <name> [text] | list | delete <name>",
+		help:  "Manage reusable snippets, expanded with !name",
+		run:   cmdSnippet,
+	})
+}
+
+func loadSnippets() (map[string]string, error) {
+	snippets := map[string]string{}
+	err := loadConfigJSON("snippets.json", &snippets)
+	return snippets, err
+}
+
+func saveSnippets(snippets map[string]string) error {
+	return saveConfigJSON("snippets.json", snippets)
+}
+
+// expandInput replaces !snippet references and then {{var}} placeholders.
+// Unknown names are left untouched so literal text survives.
+func (s *session) expandInput(input string) string {
+	input = snippetPattern.ReplaceAllStringFunc(input, func(m string) string {
+		sub := snippetPattern.FindStringSubmatch(m)
+		text, ok := s.snippets[sub[2]]
+		if !ok {
+			return m
+		}
+		return sub[1] + text
+	})
+	return varPattern.ReplaceAllStringFunc(input, func(m string) string {
+		name := varPattern.FindStringSubmatch(m)[1]
+		if value, ok := s.vars[name]; ok {
+			return value
+		}
+		return m
+	})
+}
+
+func cmdSetVar(s *session, args string) error {
+	name, value, _ := strings.Cut(args, " ")
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("usage: /setvar <name> <value>")
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		delete(s.vars, name)
+		info("Variable %s cleared\n", name)
+		return nil
+	}
+	s.vars[name] = value
+	info("Variable %s set\n", name)
+	return nil
+}
+
+func cmdSnippet(s *session, args string) error {
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch sub {
+	case "save":
+		name, text, _ := strings.Cut(rest, " ")
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf("usage: /snippet save <name> [text]")
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			text = s.conv.lastContent("user")
+		}
+		if text == "" {
+			return fmt.Errorf("nothing to save: give the snippet text or send a message first")
+		}
+		s.snippets[name] = text
+		if err := saveSnippets(s.snippets); err != nil {
+			return err
+		}
+		info("Snippet !%s saved\n", name)
+	case "delete":
+		if _, ok := s.snippets[rest]; !ok {
+			return fmt.Errorf("no snippet named %q", rest)
+		}
+		delete(s.snippets, rest)
+		return saveSnippets(s.snippets)
+	case "list", "":
+		names := make([]string, 0, len(s.snippets))
+		for name := range s.snippets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  !%-12s %s\n", name, truncate(s.snippets[name], 60))
+		}
+	default:
+		return fmt.Errorf("usage: /snippet save <name> [text] | list | delete <name>")
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+type SpeechConfig struct {
+	// Speak reads every answer aloud, like --speak.
+	Speak bool `yaml:"speak"`
+	// Model is tts-1 (default) or tts-1-hd.
+	Model string `yaml:"model"`
+	// Voice is alloy (default), echo, fable, onyx, nova or shimmer.
+	Voice string `yaml:"voice"`
+	// Speed is from 0.25 to 4; 1 is normal.
+	Speed float64 `yaml:"speed"`
+	// Format is mp3 (default), opus, aac, flac or wav.
+	Format string `yaml:"format"`
+	// Player is the command that plays a file, which is appended as the
+	// last argument. By default mpv, ffplay, afplay or paplay is used.
+	Player string `yaml:"player"`
+}
+
+var speechVoices = []string{"alloy", "echo", "fable", "onyx", "nova", "shimmer"}
+
+// maxSpeechInput is the endpoint's limit on input characters; longer
+// answers are spoken in parts.
+const maxSpeechInput = 4000
+
+var codeBlock = regexp.MustCompile("(?s)```.*?```")
+
+func init() {
+	registerCommand(&command{
+		name:  "speak",
+		usage: "/speak [on|off|voice <name>|speed <n>]",
+		help:  "Read answers aloud, or change the voice or speed",
+		run:   cmdSpeak,
+	})
+	registerCommand(&command{
+		name:  "replay-audio",
+		usage: "/replay-audio",
+		help:  "Play the last spoken answer again",
+		run: func(s *session, args string) error {
+			if len(s.lastSpeech) > 0 {
+				return playSpeech(s.cfg.Speech, s.lastSpeech)
+			}
+			if len(s.lastAudio) == 0 {
+				return fmt.Errorf("nothing has been spoken yet")
+			}
+			return playAudio(s.cfg.Speech.Player, s.lastAudio)
+		},
+	})
+}
+
+func cmdSpeak(s *session, args string) error {
+	sub, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	switch sub {
+	case "", "on":
+		s.readAloud = true
+		s.speakText(s.conv.lastContent("assistant"))
+	case "off":
+		s.readAloud = false
+		info("Speech off\n")
+	case "voice":
+		if !slices.Contains(speechVoices, value) {
+			return fmt.Errorf("voice must be one of %s", strings.Join(speechVoices, ", "))
+		}
+		s.cfg.Speech.Voice = value
+		info("Voice: %s\n", value)
+	case "speed":
+		speed, err := strconv.ParseFloat(value, 64)
+		if err != nil || speed < 0.25 || speed > 4 {
+			return fmt.Errorf("speed must be a number from 0.25 to 4")
+		}
+		s.cfg.Speech.Speed = speed
+		info("Speed: %g\n", speed)
+	default:
+		return fmt.Errorf("usage: /speak [on|off|voice <name>|speed <n>]")
+	}
+	return nil
+}
+
+// speakText reads text aloud. Audio is cached by a hash of the text and
+// settings, so replaying or repeating a phrase isn't billed again; when
+// incognito, it is kept in memory for /replay-audio instead, and on disk
+// only while it plays.
+func (s *session) speakText(text string) {
+	text = strings.TrimSpace(codeBlock.ReplaceAllString(text, " (code omitted) "))
+	if text == "" {
+		return
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	if s.incognito {
+		var audio [][]byte
+		for _, part := range speechParts(text, maxSpeechInput) {
+			data, err := speechAudio(ctx, s.client, s.cfg.Speech, part)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: speech failed: %v\n", err)
+				return
+			}
+			audio = append(audio, data)
+		}
+		s.lastSpeech = audio
+		if err := playSpeech(s.cfg.Speech, audio); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		return
+	}
+	var files []string
+	for _, part := range speechParts(text, maxSpeechInput) {
+		file, err := synthesize(ctx, s.client, s.cfg.Speech, part)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: speech failed: %v\n", err)
+			return
+		}
+		files = append(files, file)
+	}
+	s.lastAudio = files
+	if err := playAudio(s.cfg.Speech.Player, files); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// speechOptions fills in the defaults of the speech settings.
+func speechOptions(cfg SpeechConfig) (model, voice, format string, speed float64) {
+	model, voice, format, speed = cfg.Model, cfg.Voice, cfg.Format, cfg.Speed
+	if model == "" {
+		model = openai.SpeechModelTTS1
+	}
+	if voice == "" {
+		voice = "alloy"
+	}
+	if format == "" {
+		format = "mp3"
+	}
+	if speed == 0 {
+		speed = 1
+	}
+	return model, voice, format, speed
+}
+
+func requestSpeech(ctx context.Context, client *openai.Client, cfg SpeechConfig, text string) (io.ReadCloser, error) {
+	model, voice, format, speed := speechOptions(cfg)
+	resp, err := client.Audio.Speech.New(ctx, openai.AudioSpeechNewParams{
+		Input:          openai.F(text),
+		Model:          openai.F(model),
+		Voice:          openai.F(openai.AudioSpeechNewParamsVoice(voice)),
+		ResponseFormat: openai.F(openai.AudioSpeechNewParamsResponseFormat(format)),
+		Speed:          openai.F(speed),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// speechAudio returns the spoken text without caching it.
+func speechAudio(ctx context.Context, client *openai.Client, cfg SpeechConfig, text string) ([]byte, error) {
+	body, err := requestSpeech(ctx, client, cfg, text)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// synthesize returns the cached file of the spoken text, requesting it
+// if it isn't cached yet.
+func synthesize(ctx context.Context, client *openai.Client, cfg SpeechConfig, text string) (string, error) {
+	model, voice, format, speed := speechOptions(cfg)
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := sha256Hex([]byte(fmt.Sprintf("%s\x00%s\x00%g\x00%s", model, voice, speed, text)))
+	path := filepath.Join(dir, "speech", key+"."+format)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	body, err := requestSpeech(ctx, client, cfg, text)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// Write under a temporary name so an interrupted download is never
+	// taken for a cached file.
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// speechParts splits text at paragraph, then sentence, then word breaks
+// into pieces of at most n bytes.
+func speechParts(text string, n int) []string {
+	var parts []string
+	for len(text) > n {
+		cut := strings.LastIndex(text[:n], "\n\n")
+		if cut <= 0 {
+			cut = strings.LastIndexAny(text[:n], ".!?")
+			if cut > 0 {
+				cut++
+			}
+		}
+		if cut <= 0 {
+			cut = strings.LastIndex(text[:n], " ")
+		}
+		if cut <= 0 {
+			cut = n
+		}
+		parts = append(parts, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	return append(parts, text)
+}
+
+// playSpeech plays audio held in memory from temporary files, each
+// removed once it has played.
+func playSpeech(cfg SpeechConfig, audio [][]byte) error {
+	_, _, format, _ := speechOptions(cfg)
+	for _, data := range audio {
+		f, err := os.CreateTemp("", "speech-*."+format)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = playAudio(cfg.Player, []string{f.Name()})
+		}
+		os.Remove(f.Name())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func playAudio(player string, files []string) error {
+	if player != "" {
+		for _, f := range files {
+			cmd := shellCommand(player + " " + shellQuote(f))
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("speech.player: %v", err)
+			}
+		}
+		return nil
+	}
+	var args []string
+	for _, p := range [][]string{{"mpv", "--really-quiet"}, {"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"}, {"afplay"}, {"paplay"}} {
+		if hasCommand(p[0]) {
+			args = p
+			break
+		}
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no audio player found; install mpv or set speech.player")
+	}
+	for _, f := range files {
+		cmd := exec.Command(args[0], append(args[1:], f)...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %v", args[0], err)
+		}
+	}
+	return nil
+}
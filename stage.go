@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "stage",
+		usage: "/stage <path...>",
+		help:  "Stage files or images for the next message; globs such as src/*.go work",
+		run:   cmdStage,
+	})
+	registerCommand(&command{
+		name:  "staged",
+		usage: "/staged",
+		help:  "List the files staged for the next message",
+		run: func(s *session, args string) error {
+			if len(s.staged) == 0 {
+				info("Nothing staged\n")
+				return nil
+			}
+			var total int64
+			for i, path := range s.staged {
+				size := "missing"
+				if fi, err := os.Stat(path); err == nil {
+					size = formatBytes(int(fi.Size()))
+					total += fi.Size()
+				}
+				fmt.Printf("  %d. %s (%s)\n", i+1, path, size)
+			}
+			info("%s, %s; they are read when you send\n", plural(int64(len(s.staged)), "file"), formatBytes(int(total)))
+			return nil
+		},
+	})
+	registerCommand(&command{
+		name:  "unstage",
+		usage: "/unstage <n|path|all>",
+		help:  "Remove files from the staging area, by number as in /staged, path or glob",
+		run:   cmdUnstage,
+	})
+}
+
+func cmdStage(s *session, args string) error {
+	if strings.TrimSpace(args) == "" {
+		return fmt.Errorf("usage: /stage <path...>")
+	}
+	for _, pattern := range strings.Fields(args) {
+		paths, err := filepath.Glob(expandHome(pattern))
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("%s: no such file", pattern)
+		}
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return fmt.Errorf("%s is a directory; stage the files in it, e.g. %s", path, filepath.Join(path, "*"))
+			}
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			if slices.Contains(s.staged, path) {
+				continue
+			}
+			s.staged = append(s.staged, path)
+			info("Staged %s (%s)\n", path, formatBytes(int(fi.Size())))
+		}
+	}
+	return nil
+}
+
+func cmdUnstage(s *session, args string) error {
+	args = strings.TrimSpace(args)
+	switch args {
+	case "":
+		return fmt.Errorf("usage: /unstage <n|path|all>")
+	case "all":
+		info("Unstaged %s\n", plural(int64(len(s.staged)), "file"))
+		s.staged = nil
+		return nil
+	}
+	before := len(s.staged)
+	for _, arg := range strings.Fields(args) {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 || n > len(s.staged) {
+				return fmt.Errorf("no staged file %d", n)
+			}
+			s.staged[n-1] = ""
+			continue
+		}
+		abs, err := filepath.Abs(expandHome(arg))
+		if err != nil {
+			return err
+		}
+		for i, path := range s.staged {
+			if ok, _ := filepath.Match(abs, path); ok || path == abs {
+				s.staged[i] = ""
+			}
+		}
+	}
+	s.staged = slices.DeleteFunc(s.staged, func(p string) bool { return p == "" })
+	if len(s.staged) == before {
+		return fmt.Errorf("%s is not staged", args)
+	}
+	info("Unstaged %s\n", plural(int64(before-len(s.staged)), "file"))
+	return nil
+}
+
+// attachStaged attaches the staged files to the message being sent. If
+// one can't be attached, nothing is sent and the files stay staged.
+func (s *session) attachStaged() error {
+	if len(s.staged) == 0 {
+		return nil
+	}
+	context, files := s.context, s.files
+	for _, path := range s.staged {
+		if err := s.attach(path); err != nil {
+			s.context, s.files = context, files
+			return fmt.Errorf("%w; nothing was sent, fix or /unstage it and send again", err)
+		}
+	}
+	s.staged = nil
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReplyStats records how an answer was produced: the time it took and
+// the tokens it used, summed over tool rounds. It is stored with the
+// answer for later analysis.
+type ReplyStats struct {
+	Model string `xml:"model,attr"`
+	// FirstTokenMS is the time until the first token arrived; only
+	// streamed answers have it.
+	FirstTokenMS     int64 `xml:"first_token_ms,attr,omitempty"`
+	TotalMS          int64 `xml:"total_ms,attr"`
+	PromptTokens     int64 `xml:"prompt_tokens,attr"`
+	CompletionTokens int64 `xml:"completion_tokens,attr"`
+	// CachedTokens are the part of PromptTokens read from the prompt
+	// cache, which costs less. CacheWriteTokens and LongCacheWriteTokens
+	// were written to it for five minutes and an hour, which costs more.
+	CachedTokens         int64 `xml:"cached_tokens,attr,omitempty"`
+	CacheWriteTokens     int64 `xml:"cache_write_tokens,attr,omitempty"`
+	LongCacheWriteTokens int64 `xml:"cache_write_1h_tokens,attr,omitempty"`
+}
+
+func (st ReplyStats) tokens() tokenCount {
+	return tokenCount{prompt: st.PromptTokens, completion: st.CompletionTokens, cached: st.CachedTokens, written: st.CacheWriteTokens, writtenLong: st.LongCacheWriteTokens}
+}
+
+// statsTimer measures one answer from the moment it is requested.
+type statsTimer struct {
+	start time.Time
+	stats ReplyStats
+}
+
+func startStats(model string) *statsTimer {
+	return &statsTimer{start: time.Now(), stats: ReplyStats{Model: model}}
+}
+
+// add counts the tokens of one request towards the answer.
+func (t *statsTimer) add(r *reply) {
+	t.stats.PromptTokens += r.promptTokens
+	t.stats.CompletionTokens += r.completionTokens
+	t.stats.CachedTokens += r.cachedTokens
+	t.stats.CacheWriteTokens += r.cacheWriteTokens
+	t.stats.LongCacheWriteTokens += r.longCacheWriteTokens
+}
+
+// firstToken notes that the first token of the answer has arrived.
+func (t *statsTimer) firstToken() {
+	if t.stats.FirstTokenMS == 0 {
+		t.stats.FirstTokenMS = max(time.Since(t.start).Milliseconds(), 1)
+	}
+}
+
+func (t *statsTimer) done() *ReplyStats {
+	t.stats.TotalMS = time.Since(t.start).Milliseconds()
+	return &t.stats
+}
+
+// tokensPerSecond is the rate completion tokens were produced at,
+// counted from the first token when that is known.
+func (st ReplyStats) tokensPerSecond() float64 {
+	ms := st.TotalMS - st.FirstTokenMS
+	if ms <= 0 {
+		return 0
+	}
+	return float64(st.CompletionTokens) / (float64(ms) / 1000)
+}
+
+func (st ReplyStats) String() string {
+	sep := decor(" · ", ", ")
+	s := ""
+	if st.FirstTokenMS > 0 {
+		s = "first token " + formatMillis(st.FirstTokenMS) + sep
+	}
+	s += "total " + formatMillis(st.TotalMS) + sep +
+		formatTokens(st.PromptTokens) + " prompt"
+	var cache []string
+	if st.CachedTokens > 0 {
+		cache = append(cache, formatTokens(st.CachedTokens)+" cached")
+	}
+	if written := st.CacheWriteTokens + st.LongCacheWriteTokens; written > 0 {
+		cache = append(cache, formatTokens(written)+" written to the cache")
+	}
+	if len(cache) > 0 {
+		s += " (" + strings.Join(cache, ", ") + ")"
+	}
+	s += " + " + formatTokens(st.CompletionTokens) + " completion tokens"
+	if tps := st.tokensPerSecond(); tps > 0 {
+		s += sep + fmt.Sprintf("%.0f tokens/s", tps)
+	}
+	return s
+}
+
+func formatMillis(ms int64) string {
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.1fs", float64(ms)/1000)
+}
+
+// showStats prints an answer's stats under it when --stats is on.
+func (s *session) showStats(st *ReplyStats) {
+	if s.stats {
+		info("%s\n\n", paint(theme.Meta, "  "+st.String()))
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// costItem is a line of the cost report: what one conversation spent
+// with one model on one day.
+type costItem struct {
+	date         string
+	conversation string
+	persona      string
+	tags         []string
+	model        string
+	answers      int
+	prompt       int64
+	completion   int64
+	cost         float64
+	// priced is false for models missing from the price table.
+	priced bool
+}
+
+// costTotal sums the items of a model or tag.
+type costTotal struct {
+	name       string
+	answers    int
+	prompt     int64
+	completion int64
+	cost       float64
+	priced     bool
+}
+
+// costReport itemizes the estimated API costs of a calendar month, for
+// expense claims.
+type costReport struct {
+	month      time.Time
+	items      []costItem
+	unreadable int
+}
+
+func runStatsExport(args []string) int {
+	fs := newFlagSet("stats export")
+	month := fs.String("month", time.Now().AddDate(0, -1, 0).Format("2006-01"), "the month to report, as YYYY-MM (default: last month)")
+	format := fs.String("format", "", "csv or pdf (default: from the -o extension, else csv)")
+	output := fs.String("o", "", "write to this file (default: CSV to standard output, PDF to costs-YYYY-MM.pdf)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(positional) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: stats export [--month 2024-05] [--format csv|pdf] [-o file]")
+		return exitError
+	}
+	start, err := time.ParseInLocation("2006-01", *month, time.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --month must look like 2024-05, not %q\n", *month)
+		return exitError
+	}
+	if *format == "" {
+		*format = "csv"
+		if strings.EqualFold(filepath.Ext(*output), ".pdf") {
+			*format = "pdf"
+		}
+	}
+	if *format != "csv" && *format != "pdf" {
+		fmt.Fprintf(os.Stderr, "Error: --format must be csv or pdf, not %q\n", *format)
+		return exitError
+	}
+	if *format == "pdf" && *output == "" {
+		*output = "costs-" + start.Format("2006-01") + ".pdf"
+	}
+
+	report, err := collectCosts(start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if report.unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s could not be read and are left out; run fsck\n", plural(int64(report.unreadable), "conversation"))
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "pdf" {
+		err = report.writePDF(w)
+	} else {
+		err = report.writeCSV(w)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *output != "" {
+		info("Written %s (%s, $%.2f)\n", *output, plural(int64(len(report.items)), "item"), report.total().cost)
+	}
+	return exitOK
+}
+
+// collectCosts itemizes the answers given in the month starting at
+// start, from the stats stored with each.
+func collectCosts(start time.Time) (*costReport, error) {
+	convs, unreadable, err := loadArchive()
+	if err != nil {
+		return nil, err
+	}
+	report := &costReport{month: start, unreadable: unreadable}
+	for _, conv := range convs {
+		report.items = append(report.items, conversationCosts(conv, start, start.AddDate(0, 1, 0))...)
+	}
+	slices.SortFunc(report.items, func(a, b costItem) int {
+		return cmp.Or(cmp.Compare(a.date, b.date), cmp.Compare(a.conversation, b.conversation), cmp.Compare(a.model, b.model))
+	})
+	return report, nil
+}
+
+// conversationCosts itemizes the answers of conv given from start until
+// end, by day and model.
+func conversationCosts(conv *Conversation, start, end time.Time) []costItem {
+	items := map[[2]string]*costItem{}
+	for _, msg := range conv.Messages {
+		if msg.Stats == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, msg.Timestamp)
+		if err != nil || t.Before(start) || !t.Before(end) {
+			continue
+		}
+		key := [2]string{t.Local().Format(time.DateOnly), msg.Stats.Model}
+		item := items[key]
+		if item == nil {
+			item = &costItem{date: key[0], conversation: conv.ID, persona: cmp.Or(conv.Persona, "default"), tags: conv.Tags, model: key[1]}
+			items[key] = item
+		}
+		item.answers++
+		item.prompt += msg.Stats.PromptTokens
+		item.completion += msg.Stats.CompletionTokens
+		if m, ok := lookupModel(msg.Stats.Model); ok {
+			item.cost += m.cost(msg.Stats.tokens())
+			item.priced = true
+		}
+	}
+	var list []costItem
+	for _, item := range items {
+		list = append(list, *item)
+	}
+	return list
+}
+
+func (t *costTotal) add(item costItem) {
+	t.answers += item.answers
+	t.prompt += item.prompt
+	t.completion += item.completion
+	t.cost += item.cost
+	t.priced = t.priced || item.priced
+}
+
+func (r *costReport) total() costTotal {
+	total := costTotal{name: "Total"}
+	for _, item := range r.items {
+		total.add(item)
+	}
+	return total
+}
+
+// totals sums the items by the names key gives each, most expensive
+// first.
+func (r *costReport) totals(key func(costItem) []string) []costTotal {
+	byName := map[string]*costTotal{}
+	for _, item := range r.items {
+		for _, name := range key(item) {
+			if byName[name] == nil {
+				byName[name] = &costTotal{name: name}
+			}
+			byName[name].add(item)
+		}
+	}
+	var totals []costTotal
+	for _, t := range byName {
+		totals = append(totals, *t)
+	}
+	slices.SortFunc(totals, func(a, b costTotal) int {
+		return cmp.Or(cmp.Compare(b.cost, a.cost), cmp.Compare(b.prompt+b.completion, a.prompt+a.completion), cmp.Compare(a.name, b.name))
+	})
+	return totals
+}
+
+func (r *costReport) byModel() []costTotal {
+	return r.totals(func(item costItem) []string { return []string{item.model} })
+}
+
+// byTag counts a conversation with several tags under each of them.
+func (r *costReport) byTag() []costTotal {
+	return r.totals(func(item costItem) []string {
+		if len(item.tags) == 0 {
+			return []string{"(untagged)"}
+		}
+		return item.tags
+	})
+}
+
+// writeCSV writes one row per item, for a spreadsheet to total by model
+// or tag. The cost of models without a price is left empty.
+func (r *costReport) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "conversation", "tags", "model", "answers", "prompt_tokens", "completion_tokens", "cost_usd"})
+	for _, item := range r.items {
+		cost := ""
+		if item.priced {
+			cost = strconv.FormatFloat(item.cost, 'f', 4, 64)
+		}
+		cw.Write([]string{item.date, item.conversation, strings.Join(item.tags, " "), item.model, strconv.Itoa(item.answers),
+			strconv.FormatInt(item.prompt, 10), strconv.FormatInt(item.completion, 10), cost})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writePDF writes the report as a printable document: totals by model
+// and by tag, then every item.
+func (r *costReport) writePDF(w io.Writer) error {
+	var lines []pdfLine
+	add := func(bold bool, format string, args ...any) {
+		lines = append(lines, pdfLine{text: fmt.Sprintf(format, args...), bold: bold})
+	}
+	cost := func(t costTotal) string {
+		if !t.priced {
+			return "no price"
+		}
+		return fmt.Sprintf("%.2f", t.cost)
+	}
+	table := func(heading, column string, totals []costTotal) {
+		add(true, "%s", heading)
+		add(true, "%-36s %8s %14s %14s %12s", column, "Answers", "Prompt tok.", "Compl. tok.", "Cost (USD)")
+		for _, t := range totals {
+			add(false, "%-36s %8d %14d %14d %12s", truncate(t.name, 36), t.answers, t.prompt, t.completion, cost(t))
+		}
+	}
+
+	add(true, "API costs, %s", r.month.Format("January 2006"))
+	add(false, "Generated %s by %s from the token counts stored with each answer.", time.Now().Format(time.DateOnly), appName)
+	add(false, "Costs are estimates in US dollars from the model price table.")
+	add(false, "")
+	total := r.total()
+	table("By model", "Model", r.byModel())
+	add(true, "%-36s %8d %14d %14d %12s", "Total", total.answers, total.prompt, total.completion, cost(total))
+	add(false, "")
+	table("By tag", "Tag", r.byTag())
+	add(false, "A conversation with several tags counts under each of them.")
+	add(false, "")
+	add(true, "Items")
+	add(true, "%-10s  %-32s %-22s %9s %10s", "Date", "Conversation", "Model", "Tokens", "Cost (USD)")
+	for _, item := range r.items {
+		t := costTotal{cost: item.cost, priced: item.priced}
+		add(false, "%-10s  %-32s %-22s %9d %10s", item.date, truncate(item.conversation, 32), truncate(item.model, 22),
+			item.prompt+item.completion, cost(t))
+	}
+	if len(r.items) == 0 {
+		add(false, "No answers were recorded this month.")
+	}
+	return writeTextPDF(w, lines)
+}
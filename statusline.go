@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// statusLine pins a one-line summary to the bottom row of the terminal by
+// shrinking the scroll region above it. A nil *statusLine is a no-op.
+type statusLine struct {
+	fd     int
+	height int
+}
+
+func newStatusLine(enabled bool) *statusLine {
+	fd := int(os.Stdout.Fd())
+	if !enabled || quiet || accessible || !consoleVT || !term.IsTerminal(fd) {
+		return nil
+	}
+	_, h, err := term.GetSize(fd)
+	if err != nil || h < 3 {
+		return nil
+	}
+	sl := &statusLine{fd: fd, height: h}
+	fmt.Printf("\x1b[1;%dr\x1b[H\x1b[2J", h-1)
+	return sl
+}
+
+func (sl *statusLine) refresh(s *session) {
+	if sl == nil {
+		return
+	}
+	if _, h, err := term.GetSize(sl.fd); err == nil && h != sl.height && h >= 3 {
+		sl.height = h
+		fmt.Printf("\x1b7\x1b[1;%dr\x1b8", h-1)
+	}
+	fmt.Printf("\x1b7\x1b[%d;1H\x1b[2K\x1b[%sm %s \x1b[0m\x1b8", sl.height, theme.Status, s.statusText())
+}
+
+// close restores the full scroll region and clears the status row.
+func (sl *statusLine) close() {
+	if sl == nil {
+		return
+	}
+	fmt.Printf("\x1b7\x1b[r\x1b[%d;1H\x1b[2K\x1b8", sl.height)
+}
+
+func (s *session) statusText() string {
+	text := fmt.Sprintf("%s │ persona: %s", s.model, s.personaName())
+	m, known := lookupModel(s.model)
+	if known {
+		text += fmt.Sprintf(" │ ctx %s/%s (%.0f%%)", formatTokens(s.usage.contextTokens),
+			formatTokens(int64(m.contextWindow)), 100*float64(s.usage.contextTokens)/float64(m.contextWindow))
+	} else {
+		text += fmt.Sprintf(" │ ctx %s", formatTokens(s.usage.contextTokens))
+	}
+	text += fmt.Sprintf(" │ $%.4f", s.usage.CostUSD)
+	if s.incognito {
+		text += " │ INCOGNITO"
+	}
+	return text
+}
+
+func formatTokens(n int64) string {
+	switch {
+	case n >= 1000000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1e6), ".0") + "M"
+	case n >= 1000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1e3), ".0") + "k"
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"golang.org/x/term"
+)
+
+// streamOpenAI is callOpenAI for a streamed answer: onToken receives the
+// text as it arrives, and the reply is the same once the stream ends.
+func streamOpenAI(ctx context.Context, client *openai.Client, model string, conv *Conversation, tools []Tool, onToken func(string), opts ...option.RequestOption) (*reply, error) {
+	params, err := completionParams(model, conv, tools)
+	if err != nil {
+		return nil, err
+	}
+	params.StreamOptions = openai.F(openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.F(true)})
+
+	stream := client.Chat.Completions.NewStreaming(ctx, params, opts...)
+	received := false
+	defer func() {
+		// A stream whose request failed has no body, and closing it
+		// panics.
+		if received || stream.Err() == nil {
+			stream.Close()
+		}
+	}()
+	var acc openai.ChatCompletionAccumulator
+	// The accumulator only sums the top-level token counts.
+	var cached int64
+	for stream.Next() {
+		received = true
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		cached += chunk.Usage.PromptTokensDetails.CachedTokens
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			onToken(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+	r, err := replyFrom(&acc.ChatCompletion)
+	if err == nil {
+		r.cachedTokens = cached
+	}
+	return r, err
+}
+
+// liveAnswer prints an answer while it streams in. When markdown is
+// rendered, each line is shown as it arrives and redrawn rendered once it
+// is complete.
+type liveAnswer struct {
+	started bool
+	shown   int
+	// line is the incomplete line shown so far, and prefix what comes
+	// before it on the screen.
+	line   string
+	prefix string
+	md     mdRenderer
+}
+
+func (a *liveAnswer) write(text string) {
+	if !a.started {
+		a.started = true
+		if !quiet {
+			a.prefix = paint(theme.Assistant, "Assistant:") + " "
+			fmt.Print(a.prefix)
+		}
+	}
+	a.shown += len(text)
+	a.emit(text)
+}
+
+func (a *liveAnswer) emit(text string) {
+	if !renderingMarkdown() {
+		fmt.Print(text)
+		return
+	}
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			fmt.Print(text)
+			a.line += text
+			return
+		}
+		a.redraw(a.line + text[:i])
+		fmt.Print("\n")
+		a.line, a.prefix = "", ""
+		text = text[i+1:]
+	}
+}
+
+// redraw replaces the incomplete line on the screen with line, rendered.
+func (a *liveAnswer) redraw(line string) {
+	if a.line != "" {
+		if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+			if up, _ := layout(a.prefix+a.line, w); up > 0 {
+				fmt.Printf("\x1b[%dA", up)
+			}
+		}
+		fmt.Print("\r\x1b[J" + a.prefix)
+	}
+	fmt.Print(a.md.line(line))
+}
+
+// finish prints what of content was not streamed, such as the whole of
+// an answer that wasn't streamed or the parts --auto-continue added.
+func (a *liveAnswer) finish(content string) {
+	if !a.started {
+		if quiet {
+			fmt.Println(forDisplay(content))
+		} else {
+			fmt.Printf("%s %s\n\n", paint(theme.Assistant, "Assistant:"), forDisplay(content))
+		}
+		return
+	}
+	if a.shown < len(content) {
+		a.emit(content[a.shown:])
+	}
+	a.end()
+}
+
+// end closes the streamed text, e.g. when the answer turned out to be
+// a request to call tools, or the request failed partway.
+func (a *liveAnswer) end() {
+	if !a.started {
+		return
+	}
+	if a.line != "" {
+		a.redraw(a.line)
+	}
+	if quiet {
+		fmt.Println()
+	} else {
+		fmt.Print("\n\n")
+	}
+	*a = liveAnswer{}
+}
+
+// streaming reports whether answers are printed as they arrive. Answers
+// that are rewritten before they are shown, by --reflect, post-processing
+// or for screen readers, are not streamed.
+func (s *session) streaming() bool {
+	return !s.noStream && !s.reflect && !accessible && len(s.postSteps()) == 0
+}
+
+// request asks for the next reply to conv, streaming it to live when the
+// session streams.
+func (s *session) request(ctx context.Context, conv *Conversation, tools []Tool, timer *statsTimer, live *liveAnswer) (*reply, error) {
+	if !s.streaming() {
+		return s.provider.Complete(ctx, s.model, conv, tools)
+	}
+	response, err := s.provider.Stream(ctx, s.model, conv, tools, func(text string) {
+		timer.firstToken()
+		live.write(text)
+	})
+	if err != nil {
+		live.end()
+	}
+	return response, err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// subcommand is a non-interactive mode selected by the first argument,
+// e.g. `chat-cli show <id>`. Without a known subcommand the chat REPL runs.
+type subcommand struct {
+	name  string
+	usage string
+	help  string
+	run   func(cfg *Config, args []string) int
+}
+
+var subcommands = map[string]*subcommand{}
+
+func registerSubcommand(c *subcommand) {
+	subcommands[c.name] = c
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "help",
+		usage: "help",
+		help:  "List subcommands",
+		run:   runHelp,
+	})
+}
+
+func runHelp(cfg *Config, args []string) int {
+	fmt.Printf("Usage: %s [flags]            start an interactive chat\n", appName)
+	fmt.Printf("       %s <command> [args]   run a command\n\nCommands:\n", appName)
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-32s %s\n", subcommands[name].usage, subcommands[name].help)
+	}
+	fmt.Printf("\nChat flags:\n")
+	flag.PrintDefaults()
+	return exitOK
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments, which the flag package alone does not allow.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ContextConfig struct {
+	// SummarizeAt is the share of the context window a request may fill
+	// before older messages are summarized (default 0.8; -1 never
+	// summarizes).
+	SummarizeAt float64 `yaml:"summarize_at"`
+	// KeepRecent is how many of the latest messages are always sent as
+	// they are (default 10).
+	KeepRecent int `yaml:"keep_recent"`
+	// Window is the context window in tokens, for models the price table
+	// doesn't know, such as local ones.
+	Window int `yaml:"window"`
+	// Model writes the summaries (default: the chat model).
+	Model string `yaml:"model"`
+}
+
+// ContextSummary condenses the messages before Through. They stay in the
+// conversation but are no longer sent; the summary is sent instead.
+type ContextSummary struct {
+	Through   int    `xml:"through,attr"`
+	Model     string `xml:"model,attr,omitempty"`
+	CreatedAt string `xml:"created_at,attr"`
+	Content   string `xml:",chardata"`
+}
+
+const summarizePrompt = "Summarize the conversation below so the summary can take its place in a chat that goes on. " +
+	"Keep the facts, decisions, names, numbers, code and open questions the rest of the conversation may rely on, " +
+	"and any instructions or preferences the user stated. Write terse notes in the language of the conversation, " +
+	"without commentary."
+
+const summaryNote = "Summary of the earlier part of this conversation, which is not shown:\n\n"
+
+// maxSummarizedResult bounds each tool result in the text that is
+// summarized; fetched pages and command output are mostly noise later.
+const maxSummarizedResult = 2000
+
+// condensed returns c as it is sent: the messages its summary covers are
+// replaced by the summary. The stored conversation is left alone.
+func (c *Conversation) condensed() *Conversation {
+	if c.Summary == nil || c.Summary.Through > len(c.Messages) {
+		return c
+	}
+	prompt := 0
+	for prompt < c.Summary.Through && c.Messages[prompt].Role == "system" {
+		prompt++
+	}
+	sent := *c
+	sent.Summary = nil
+	sent.Messages = append(slices.Clone(c.Messages[:prompt]), c.Messages[c.Summary.Through:]...)
+	return withSystemNote(&sent, summaryNote+c.Summary.Content)
+}
+
+// estimateTokens roughly counts the tokens of messages, at four
+// characters a token.
+func estimateTokens(msgs []Message) int64 {
+	n := 0
+	for _, m := range msgs {
+		n += len(m.Content) + 16
+		for _, call := range m.ToolCalls {
+			n += len(call.Arguments)
+		}
+	}
+	return int64(n / 4)
+}
+
+// contextWindow is the size in tokens of the model's context window, or
+// 0 when it isn't known.
+func (s *session) contextWindow() int {
+	if m, ok := lookupModel(s.model); ok {
+		return m.contextWindow
+	}
+	return s.cfg.Context.Window
+}
+
+// fitContext summarizes older messages when the conversation, as it would
+// be sent, fills more than summarize_at of the context window, or with
+// force whenever there is something to summarize. It reports whether it
+// did; a failure is a warning, and the conversation is sent as it is.
+func (s *session) fitContext(ctx context.Context, force bool) bool {
+	at := s.cfg.Context.SummarizeAt
+	if at == 0 {
+		at = 0.8
+	}
+	window := s.contextWindow()
+	if window == 0 && force {
+		// What was sent didn't fit, so that is the most the model takes.
+		window = int(estimateTokens(s.conv.condensed().Messages))
+	}
+	if at < 0 || window == 0 {
+		return false
+	}
+	limit := int64(at * float64(window))
+	if !force && estimateTokens(s.conv.condensed().Messages) <= limit {
+		return false
+	}
+
+	// Cut at the start of a turn, so tool calls stay with their results,
+	// keeping at least the recent messages and the question being asked.
+	msgs := s.conv.Messages
+	start := 0
+	for start < len(msgs) && msgs[start].Role == "system" {
+		start++
+	}
+	if s.conv.Summary != nil && s.conv.Summary.Through > start && s.conv.Summary.Through <= len(msgs) {
+		start = s.conv.Summary.Through
+	}
+	last := s.conv.lastIndex("user")
+	cut := max(min(len(msgs)-cmp.Or(s.cfg.Context.KeepRecent, 10), last), start)
+	for cut < last && estimateTokens(msgs[cut:]) > limit/2 {
+		cut++
+	}
+	for cut < last && msgs[cut].Role != "user" {
+		cut++
+	}
+	if cut <= start {
+		return false
+	}
+
+	var b strings.Builder
+	if s.conv.Summary != nil {
+		fmt.Fprintf(&b, "Summary of what came before:\n\n%s\n\n", s.conv.Summary.Content)
+	}
+	for _, m := range msgs[start:cut] {
+		switch {
+		case m.Role == "tool":
+			fmt.Fprintf(&b, "Tool result:\n%s\n\n", truncate(m.Content, maxSummarizedResult))
+		case m.Role == "user" || m.Role == "assistant":
+			for _, call := range m.ToolCalls {
+				fmt.Fprintf(&b, "Assistant called %s with %s\n\n", call.Name, compactJSON(call.Arguments))
+			}
+			if m.Content != "" {
+				fmt.Fprintf(&b, "%s:\n%s\n\n", strings.ToUpper(m.Role[:1])+m.Role[1:], m.Content)
+			}
+		}
+	}
+
+	model := cmp.Or(s.cfg.Context.Model, s.model)
+	r, err := s.provider.Complete(ctx, model, askConversation(summarizePrompt, b.String()), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to summarize earlier messages, sending them all: %v\n", err)
+		return false
+	}
+	s.countUsage(model, r)
+	s.conv.Summary = &ContextSummary{
+		Through:   cut,
+		Model:     model,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Content:   strings.TrimSpace(r.content),
+	}
+	s.save()
+	info("%s\n", paint(theme.Meta, fmt.Sprintf(decor("  ⚙ summarized %d earlier messages", "Summarized %d earlier messages")+
+		" to stay within the context window", cut-start)))
+	return true
+}
+
+// contextOverflow reports whether a request failed because the
+// conversation no longer fits the model's context window.
+func contextOverflow(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, sign := range []string{"context_length_exceeded", "maximum context length", "prompt is too long", "context window"} {
+		if strings.Contains(msg, sign) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// remote is a place conversations are synced to. Names are bare file names
+// such as chat_123.xml, or for stored files their blobSyncName; version is an opaque string (ETag, mtime) that
+// changes whenever the remote copy does.
+type remote interface {
+	List(ctx context.Context) (map[string]string, error)
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+type SyncConfig struct {
+	// Remote is "dir", "webdav" or "s3".
+	Remote string        `yaml:"remote"`
+	Dir    string        `yaml:"dir"`
+	WebDAV WebDAVConfig  `yaml:"webdav"`
+	S3     S3Config      `yaml:"s3"`
+	Git    GitSyncConfig `yaml:"git"`
+}
+
+// syncState records, per file, the local hash and remote version seen at
+// the last successful sync, so each side's changes can be told apart.
+type syncState map[string]syncEntry
+
+type syncEntry struct {
+	LocalHash     string `json:"local_hash"`
+	RemoteVersion string `json:"remote_version"`
+}
+
+const syncStateFile = ".sync-state.json"
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "sync",
+		usage: "sync [git] [--dry-run]",
+		help:  "Synchronize conversations with the configured remote or git",
+		run:   runSync,
+	})
+}
+
+func newRemote(cfg SyncConfig) (remote, error) {
+	switch cfg.Remote {
+	case "dir":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("sync.dir is not set")
+		}
+		return dirRemote(cfg.Dir), nil
+	case "webdav":
+		return newWebDAVRemote(cfg.WebDAV)
+	case "s3":
+		return newS3Remote(cfg.S3)
+	case "":
+		return nil, fmt.Errorf("no sync remote configured (set sync.remote in config.yaml)")
+	}
+	return nil, fmt.Errorf("unknown sync remote %q", cfg.Remote)
+}
+
+func runSync(cfg *Config, args []string) int {
+	fs := newFlagSet("sync")
+	dryRun := fs.Bool("dry-run", false, "show what would be transferred without changing anything")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+
+	if len(positional) == 1 && positional[0] == "git" {
+		if err := runGitSync(cfg.Sync.Git, *dryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	if len(positional) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: sync [git] [--dry-run]")
+		return exitError
+	}
+
+	r, err := newRemote(cfg.Sync)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if err := syncConversations(context.Background(), r, *dryRun); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	return exitOK
+}
+
+func syncConversations(ctx context.Context, r remote, dryRun bool) error {
+	state := syncState{}
+	if data, err := os.ReadFile(filepath.Join(chatsDir, syncStateFile)); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("corrupt sync state: %w", err)
+		}
+	}
+
+	local, err := localConversationHashes()
+	if err != nil {
+		return err
+	}
+	remoteFiles, err := r.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list remote: %w", err)
+	}
+	remoteBlobs := map[string]bool{}
+	for name := range remoteFiles {
+		if ref, ok := blobRef(name); ok {
+			remoteBlobs[ref] = true
+			delete(remoteFiles, name)
+		}
+	}
+
+	names := map[string]bool{}
+	for name := range local {
+		names[name] = true
+	}
+	for name := range remoteFiles {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var pushed, pulled, merged int
+	for _, name := range sorted {
+		localHash, hasLocal := local[name]
+		remoteVersion, hasRemote := remoteFiles[name]
+		prev, known := state[name]
+		localChanged := hasLocal && (!known || localHash != prev.LocalHash)
+		remoteChanged := hasRemote && (!known || remoteVersion != prev.RemoteVersion)
+
+		var action string
+		switch {
+		case hasLocal && !hasRemote:
+			action = "push"
+		case hasRemote && !hasLocal:
+			action = "pull"
+		case localChanged && remoteChanged:
+			action = "merge"
+		case localChanged:
+			action = "push"
+		case remoteChanged:
+			action = "pull"
+		default:
+			continue
+		}
+
+		fmt.Printf("%-5s %s\n", action, name)
+		if dryRun {
+			continue
+		}
+
+		var data []byte
+		switch action {
+		case "push":
+			data, err = os.ReadFile(filepath.Join(chatsDir, name))
+			if err == nil {
+				err = r.Put(ctx, name, data)
+			}
+			pushed++
+		case "pull":
+			data, err = r.Get(ctx, name)
+			if err == nil {
+				err = os.MkdirAll(chatsDir, 0755)
+			}
+			if err == nil {
+				err = os.WriteFile(filepath.Join(chatsDir, name), data, 0644)
+			}
+			pulled++
+		case "merge":
+			data, err = mergeConversationFiles(ctx, r, name)
+			merged++
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", action, name, err)
+		}
+		state[name] = syncEntry{LocalHash: sha256Hex(data)}
+	}
+
+	blobsPushed, blobsPulled, err := syncBlobs(ctx, r, remoteBlobs, dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	// Record the remote versions our own uploads produced.
+	remoteFiles, err = r.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list remote: %w", err)
+	}
+	for name, entry := range state {
+		entry.RemoteVersion = remoteFiles[name]
+		state[name] = entry
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(chatsDir, syncStateFile), data, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Pushed %d, pulled %d, merged %d\n", pushed, pulled, merged)
+	if blobsPushed+blobsPulled > 0 {
+		fmt.Printf("Pushed %s, pulled %s\n", plural(int64(blobsPushed), "attached file"), plural(int64(blobsPulled), "attached file"))
+	}
+	return nil
+}
+
+// syncBlobs copies the stored files the conversations refer to that only
+// one side has; remote lists those on the remote. Stored files never
+// change, so there is nothing to merge, and files no conversation refers
+// to, such as those `images gc` deleted, are not copied back.
+func syncBlobs(ctx context.Context, r remote, remote map[string]bool, dryRun bool) (pushed, pulled int, err error) {
+	refs, err := attachedRefs()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, ref := range refs {
+		file := filepath.Join(chatsDir, filepath.FromSlash(ref))
+		_, statErr := os.Stat(file)
+		local := statErr == nil
+		var action string
+		switch {
+		case local && !remote[ref]:
+			action = "push"
+		case !local && remote[ref]:
+			action = "pull"
+		default:
+			continue
+		}
+		fmt.Printf("%-5s %s\n", action, ref)
+		if dryRun {
+			continue
+		}
+		switch action {
+		case "push":
+			var data []byte
+			data, err = os.ReadFile(file)
+			if err == nil {
+				err = r.Put(ctx, blobSyncName(ref), data)
+			}
+			pushed++
+		case "pull":
+			err = pullBlob(ctx, r, ref)
+			pulled++
+		}
+		if err != nil {
+			return pushed, pulled, fmt.Errorf("%s %s: %w", action, ref, err)
+		}
+	}
+	return pushed, pulled, nil
+}
+
+// pullBlob downloads a stored file and keeps it if its content matches its
+// name.
+func pullBlob(ctx context.Context, r remote, ref string) error {
+	data, err := r.Get(ctx, blobSyncName(ref))
+	if err != nil {
+		return err
+	}
+	plain, salt, err := unseal(data)
+	if err != nil {
+		return err
+	}
+	if err := verifyBlob(ref, plain, salt); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if salt != nil {
+		perm = 0600
+	}
+	return writeBlob(filepath.Join(chatsDir, filepath.FromSlash(ref)), data, perm)
+}
+
+// attachedRefs lists the stored files the local conversations refer to.
+// Conversations that can't be read are skipped, as they are by the rest
+// of sync.
+func attachedRefs() ([]string, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var refs []string
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		conv, err := loadConversation(e.Name())
+		if err != nil {
+			continue
+		}
+		for _, msg := range conv.Messages {
+			for _, a := range msg.Attachments {
+				if blobRefPattern.MatchString(a.Ref) && !seen[a.Ref] {
+					seen[a.Ref] = true
+					refs = append(refs, a.Ref)
+				}
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// blobRefPattern matches the refs of stored files, so that a ref in a
+// synced conversation can't name a path outside the blob directories.
+var blobRefPattern = regexp.MustCompile(`^(blobs/[0-9a-f]{2}|images)/[0-9a-f]{64}\.\w+$`)
+
+// blobSyncName is the name of a stored file on a remote, where files are
+// kept side by side: its ref with the slashes turned into underscores, as
+// in blobs_4e_4e07…ab21.pdf.
+func blobSyncName(ref string) string {
+	return strings.ReplaceAll(ref, "/", "_")
+}
+
+// blobRef returns the ref of a stored file from its name on a remote.
+func blobRef(name string) (string, bool) {
+	for _, dir := range blobDirs {
+		if rest, ok := strings.CutPrefix(name, dir+"_"); ok {
+			ref := dir + "/" + strings.ReplaceAll(rest, "_", "/")
+			return ref, blobRefPattern.MatchString(ref)
+		}
+	}
+	return "", false
+}
+
+// isSyncFile reports whether a file on a remote is synced: a conversation
+// or a stored file.
+func isSyncFile(name string) bool {
+	_, blob := blobRef(name)
+	return blob || isConversationFile(name)
+}
+
+func mergeConversationFiles(ctx context.Context, r remote, name string) ([]byte, error) {
+	remoteData, err := r.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := parseConversation(remoteData)
+	if err != nil {
+		return nil, fmt.Errorf("remote copy is not a valid conversation: %w", err)
+	}
+	ours, err := loadConversation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeConversations(ours, theirs)
+	if err := ours.save(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(ours.getFilePath())
+	if err != nil {
+		return nil, err
+	}
+	return data, r.Put(ctx, name, data)
+}
+
+// mergeConversations folds the messages of other into c: the union of
+// both, ordered by timestamp, with messages both have (the same ID) kept
+// once. Messages only one side has removed come back, which is preferable
+// to losing data, but a redaction on either side always wins over the
+// original text.
+func mergeConversations(c, other *Conversation) {
+	redacted := map[string]bool{}
+	for _, m := range append(append([]Message{}, c.Messages...), other.Messages...) {
+		if m.Redacted {
+			redacted[m.ID] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	var all []Message
+	for _, m := range append(append([]Message{}, c.Messages...), other.Messages...) {
+		if redacted[m.ID] && !m.Redacted {
+			continue
+		}
+		if !seen[m.ID] {
+			seen[m.ID] = true
+			all = append(all, m)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Timestamp < all[j].Timestamp
+	})
+	c.Messages = all
+}
+
+func localConversationHashes() (map[string]string, error) {
+	entries, err := os.ReadDir(chatsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hashes := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() || !isConversationFile(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(chatsDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		hashes[e.Name()] = sha256Hex(data)
+	}
+	return hashes, nil
+}
+
+func isConversationFile(name string) bool {
+	return strings.HasSuffix(name, ".xml") && !strings.HasPrefix(name, ".")
+}
+
+// dirRemote syncs with another directory, e.g. a mounted share or a folder
+// managed by rclone or Syncthing.
+type dirRemote string
+
+func (d dirRemote) List(ctx context.Context) (map[string]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() || !isSyncFile(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size())
+	}
+	return files, nil
+}
+
+func (d dirRemote) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+func (d dirRemote) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(d), name), data, 0644)
+}
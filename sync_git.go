@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type GitSyncConfig struct {
+	// Remote is the git remote to pull from and push to (default origin).
+	Remote string `yaml:"remote"`
+	// PullOnStart pulls before an interactive chat starts.
+	PullOnStart bool `yaml:"pull_on_start"`
+	// CommitOnExit commits and pushes when an interactive chat ends.
+	CommitOnExit bool `yaml:"commit_on_exit"`
+}
+
+func runGitSync(cfg GitSyncConfig, dryRun bool) error {
+	if err := ensureGitRepo(); err != nil {
+		return err
+	}
+	if dryRun {
+		out, err := git("status", "--short", "--", ".")
+		if err == nil {
+			fmt.Print(out)
+		}
+		return err
+	}
+	if err := gitCommit(); err != nil {
+		return err
+	}
+	if !hasGitRemote(cfg) {
+		return nil
+	}
+	if err := gitPull(cfg); err != nil {
+		return err
+	}
+	branch, err := gitBranch()
+	if err != nil {
+		return err
+	}
+	_, err = git("push", "-q", gitRemote(cfg), "HEAD:"+branch)
+	return err
+}
+
+func ensureGitRepo() error {
+	if _, err := os.Stat(filepath.Join(chatsDir, ".git")); err == nil {
+		return nil
+	}
+	if _, err := git("init", "-q"); err != nil {
+		return err
+	}
+	fmt.Printf("Initialized git repository in %s\n", chatsDir)
+	return os.WriteFile(filepath.Join(chatsDir, ".gitignore"), []byte(".*.tmp\n"+syncStateFile+"\n"), 0644)
+}
+
+// gitCommit stages everything in the chats directory and commits it with a
+// message describing which conversations changed.
+func gitCommit() error {
+	if _, err := git("add", "-A", "--", "."); err != nil {
+		return err
+	}
+	status, err := git("diff", "--cached", "--name-status")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) == "" {
+		return nil
+	}
+
+	msg := gitCommitMessage(status)
+	if _, err := git("commit", "-q", "-m", msg); err != nil {
+		return err
+	}
+	fmt.Println(strings.SplitN(msg, "\n", 2)[0])
+	return nil
+}
+
+func gitCommitMessage(status string) string {
+	var lines []string
+	var added, updated, removed int
+	for _, line := range strings.Split(strings.TrimSpace(status), "\n") {
+		code, name, ok := strings.Cut(line, "\t")
+		if !ok || !isConversationFile(name) {
+			continue
+		}
+		id := strings.TrimSuffix(name, ".xml")
+		switch code[0] {
+		case 'A':
+			added++
+			lines = append(lines, fmt.Sprintf("Add %s%s", id, describeConversation(name, -1)))
+		case 'D':
+			removed++
+			lines = append(lines, "Remove "+id)
+		default:
+			updated++
+			before := countMessages(gitShow("HEAD:" + name))
+			lines = append(lines, fmt.Sprintf("Update %s%s", id, describeConversation(name, before)))
+		}
+	}
+
+	if len(lines) == 1 {
+		return lines[0]
+	}
+	var parts []string
+	for _, p := range []struct {
+		n    int
+		verb string
+	}{{added, "add"}, {updated, "update"}, {removed, "remove"}} {
+		if p.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", p.verb, p.n))
+		}
+	}
+	subject := "Sync conversations"
+	if len(parts) > 0 {
+		subject = "Sync conversations: " + strings.Join(parts, ", ")
+	}
+	return subject + "\n\n" + strings.Join(lines, "\n")
+}
+
+// describeConversation summarizes a conversation for a commit message: its
+// opening question and how many messages it holds or gained since before.
+func describeConversation(name string, before int) string {
+	conv, err := loadConversation(name)
+	if err != nil {
+		return ""
+	}
+	desc := ""
+	if first := conv.firstContent("user"); first != "" {
+		desc = fmt.Sprintf(" %q", truncate(first, 50))
+	}
+	if before < 0 {
+		return fmt.Sprintf("%s (%d messages)", desc, len(conv.Messages))
+	}
+	return fmt.Sprintf("%s (%+d messages)", desc, len(conv.Messages)-before)
+}
+
+// gitPull merges the remote branch. Conflicting conversation files are
+// resolved by merging their messages; anything else aborts the merge.
+func gitPull(cfg GitSyncConfig) error {
+	if !hasGitRemote(cfg) {
+		return nil
+	}
+	branch, err := gitBranch()
+	if err != nil {
+		return err
+	}
+	if out, err := git("ls-remote", "--heads", gitRemote(cfg), branch); err != nil || strings.TrimSpace(out) == "" {
+		// Nothing has been pushed yet.
+		return err
+	}
+	_, err = git("pull", "-q", "--no-rebase", "--no-edit", gitRemote(cfg), branch)
+	if err == nil {
+		return nil
+	}
+
+	conflicts, lsErr := git("diff", "--name-only", "--diff-filter=U")
+	if lsErr != nil || strings.TrimSpace(conflicts) == "" {
+		return err
+	}
+	for _, name := range strings.Fields(conflicts) {
+		if !isConversationFile(name) {
+			git("merge", "--abort")
+			return fmt.Errorf("cannot resolve conflict in %s automatically", name)
+		}
+		if err := resolveGitConflict(name); err != nil {
+			git("merge", "--abort")
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	_, err = git("commit", "-q", "--no-edit")
+	return err
+}
+
+func resolveGitConflict(name string) error {
+	ours, err := parseConversation([]byte(gitShow(":2:" + name)))
+	if err != nil {
+		return err
+	}
+	theirs, err := parseConversation([]byte(gitShow(":3:" + name)))
+	if err != nil {
+		return err
+	}
+	mergeConversations(ours, theirs)
+	if err := ours.save(); err != nil {
+		return err
+	}
+	_, err = git("add", "--", name)
+	return err
+}
+
+// pullOnStart and commitOnExit wire git sync into an interactive session.
+func pullOnStart(cfg *Config) {
+	if !cfg.Sync.Git.PullOnStart {
+		return
+	}
+	if err := gitPull(cfg.Sync.Git); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: git pull failed: %v\n", err)
+	}
+}
+
+func commitOnExit(cfg *Config) {
+	if !cfg.Sync.Git.CommitOnExit {
+		return
+	}
+	if err := runGitSync(cfg.Sync.Git, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: git sync failed: %v\n", err)
+	}
+}
+
+func hasGitRemote(cfg GitSyncConfig) bool {
+	out, err := git("remote")
+	return err == nil && strings.Contains("\n"+out, "\n"+gitRemote(cfg)+"\n")
+}
+
+func gitRemote(cfg GitSyncConfig) string {
+	if cfg.Remote == "" {
+		return "origin"
+	}
+	return cfg.Remote
+}
+
+func gitBranch() (string, error) {
+	out, err := git("symbolic-ref", "--short", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+func gitShow(rev string) string {
+	out, _ := git("show", rev)
+	return out
+}
+
+func countMessages(data string) int {
+	conv, err := parseConversation([]byte(data))
+	if err != nil {
+		return 0
+	}
+	return len(conv.Messages)
+}
+
+func git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = chatsDir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("git is not installed")
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
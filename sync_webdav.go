@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+type WebDAVConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	// Password falls back to the WEBDAV_PASSWORD environment variable.
+	Password string `yaml:"password"`
+}
+
+type webdavRemote struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func newWebDAVRemote(cfg WebDAVConfig) (*webdavRemote, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("sync.webdav.url is not set")
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync.webdav.url: %w", err)
+	}
+	password := cfg.Password
+	if password == "" {
+		password = os.Getenv("WEBDAV_PASSWORD")
+	}
+	return &webdavRemote{base: base, username: cfg.Username, password: password, client: http.DefaultClient}, nil
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"getetag"`
+				LastModified string `xml:"getlastmodified"`
+				Length       string `xml:"getcontentlength"`
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/><d:getlastmodified/><d:getcontentlength/><d:resourcetype/></d:prop></d:propfind>`
+
+func (w *webdavRemote) List(ctx context.Context) (map[string]string, error) {
+	resp, err := w.do(ctx, "PROPFIND", "", strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND: %s", resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND: %w", err)
+	}
+	files := map[string]string{}
+	for _, r := range ms.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Base(href)
+		if !isSyncFile(name) || len(r.Propstat) == 0 {
+			continue
+		}
+		p := r.Propstat[0].Prop
+		if p.ResourceType.Collection != nil {
+			continue
+		}
+		version := p.ETag
+		if version == "" {
+			version = p.LastModified + "-" + p.Length
+		}
+		files[name] = version
+	}
+	return files, nil
+}
+
+func (w *webdavRemote) Get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := w.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", name, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (w *webdavRemote) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := w.do(ctx, http.MethodPut, name, bytes.NewReader(data), map[string]string{
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		// The collection does not exist yet; create it and try once more.
+		if err := w.mkcol(ctx); err != nil {
+			return err
+		}
+		return w.Put(ctx, name, data)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+func (w *webdavRemote) mkcol(ctx context.Context) error {
+	resp, err := w.do(ctx, "MKCOL", "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("MKCOL: %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *webdavRemote) do(ctx context.Context, method, name string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	u := w.base.JoinPath(name)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return w.client.Do(req)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "tag",
+		usage: "/tag [name...]",
+		help:  "Show or add tags on the current conversation",
+		run:   cmdTag,
+	})
+	registerCommand(&command{
+		name:  "untag",
+		usage: "/untag <name...>",
+		help:  "Remove tags from the current conversation",
+		run:   cmdUntag,
+	})
+}
+
+func cmdTag(s *session, args string) error {
+	if args == "" {
+		if len(s.conv.Tags) == 0 {
+			fmt.Println("No tags")
+		} else {
+			fmt.Println(strings.Join(s.conv.Tags, ", "))
+		}
+		return nil
+	}
+	s.conv.addTags(strings.Fields(args)...)
+	s.save()
+	return nil
+}
+
+func cmdUntag(s *session, args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: /untag <name...>")
+	}
+	for _, tag := range strings.Fields(args) {
+		s.conv.Tags = slices.DeleteFunc(s.conv.Tags, func(t string) bool { return t == tag })
+	}
+	s.save()
+	return nil
+}
+
+func (c *Conversation) addTags(tags ...string) {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !c.hasTag(tag) {
+			c.Tags = append(c.Tags, tag)
+		}
+	}
+}
+
+func (c *Conversation) hasTag(tag string) bool {
+	return slices.Contains(c.Tags, tag)
+}
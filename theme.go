@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Theme gives each role in the output its SGR attributes, e.g. "1;36".
+type Theme struct {
+	User      string `yaml:"user"`
+	Assistant string `yaml:"assistant"`
+	Incognito string `yaml:"incognito"`
+	// Other is other people, in rooms.
+	Other string `yaml:"other"`
+	// Meta is secondary output: tool calls, traces, presence.
+	Meta    string `yaml:"meta"`
+	Heading string `yaml:"heading"`
+	Accent  string `yaml:"accent"`
+	Good    string `yaml:"good"`
+	Bad     string `yaml:"bad"`
+	Status  string `yaml:"status"`
+	Code    string `yaml:"code"`
+	Link    string `yaml:"link"`
+	// Cast tells personas apart when several take turns.
+	Cast []string `yaml:"cast"`
+}
+
+// theme is the theme in use.
+var theme = builtinThemes["default"]
+
+var builtinThemes = func() map[string]Theme {
+	var themes map[string]Theme
+	if err := yaml.Unmarshal([]byte(asset("themes.yaml")), &themes); err != nil {
+		panic(fmt.Sprintf("assets/themes.yaml: %v", err))
+	}
+	return themes
+}()
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "themes",
+		usage: "themes",
+		help:  "List the output themes with a sample of each",
+		run: func(cfg *Config, args []string) int {
+			themes, err := loadThemes()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+			saved := theme
+			defer func() { theme = saved }()
+			for _, name := range sortedKeys(themes) {
+				theme = themes[name]
+				fmt.Printf("%-14s %s %s %s %s\n", name, paint(theme.User, "You:"), paint(theme.Assistant, "Assistant:"),
+					paint(theme.Meta, "⚙ tool"), paint(theme.Status, " status "))
+			}
+			return exitOK
+		},
+	})
+	registerCommand(&command{
+		name:  "theme",
+		usage: "/theme [name]",
+		help:  "Show the themes, or switch to one for this session",
+		run: func(s *session, args string) error {
+			name := strings.TrimSpace(args)
+			if name == "" {
+				themes, err := loadThemes()
+				if err != nil {
+					return err
+				}
+				fmt.Println(strings.Join(sortedKeys(themes), ", "))
+				return nil
+			}
+			if err := setTheme(name); err != nil {
+				return err
+			}
+			s.status.refresh(s)
+			info("Theme: %s\n", name)
+			return nil
+		},
+	})
+}
+
+// loadThemes returns the built-in themes and those in themes.yaml in the
+// config directory, which can also replace built-in ones. Roles a theme
+// leaves out are taken from the default theme.
+func loadThemes() (map[string]Theme, error) {
+	themes := map[string]Theme{}
+	for name, t := range builtinThemes {
+		themes[name] = t
+	}
+	dir, err := configDir()
+	if err != nil {
+		return themes, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "themes.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return themes, nil
+	}
+	if err != nil {
+		return themes, err
+	}
+	var custom map[string]Theme
+	if err := yaml.Unmarshal(data, &custom); err != nil {
+		return themes, fmt.Errorf("themes.yaml: %w", err)
+	}
+	for name, t := range custom {
+		themes[name] = t
+	}
+	for name, t := range themes {
+		themes[name] = t.withDefaults(builtinThemes["default"])
+	}
+	return themes, nil
+}
+
+func setTheme(name string) error {
+	themes, err := loadThemes()
+	if err != nil {
+		return err
+	}
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("no theme named %q; there are %s", name, strings.Join(sortedKeys(themes), ", "))
+	}
+	theme = t
+	return nil
+}
+
+// withDefaults fills the roles t leaves empty from def.
+func (t Theme) withDefaults(def Theme) Theme {
+	v, d := reflect.ValueOf(&t).Elem(), reflect.ValueOf(def)
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			v.Field(i).Set(d.Field(i))
+		}
+	}
+	return t
+}
+
+// castColor is the attribute for the i-th member of a cast.
+func (t Theme) castColor(i int) string {
+	if len(t.Cast) == 0 {
+		return t.Assistant
+	}
+	return t.Cast[i%len(t.Cast)]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
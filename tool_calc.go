@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	registerTool(calcTool{})
+}
+
+// calcTool evaluates arithmetic locally so answers involving numbers do
+// not depend on the model doing the sums itself.
+type calcTool struct{}
+
+func (calcTool) Name() string { return "calculate" }
+
+func (calcTool) Description() string {
+	return "Evaluate an arithmetic expression exactly. Supports + - * / % ^, parentheses, " +
+		"sqrt, abs, floor, ceil, round, ln, log (base 10), log2, exp, sin, cos, tan " +
+		"(radians), min, max and the constants pi and e. Use it for any non-trivial arithmetic."
+}
+
+func (calcTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"expression": map[string]any{"type": "string", "description": "e.g. (3.5 * 12)^2 / sqrt(7)"},
+		},
+		"required": []string{"expression"},
+	}
+}
+
+func (calcTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	v, err := evalExpr(in.Expression)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s = %s", strings.TrimSpace(in.Expression), formatNumber(v)), nil
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', 15, 64)
+}
+
+// evalExpr parses and evaluates expr by recursive descent:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = unary { ("*" | "/" | "%") unary }
+//	unary  = "-" unary | power
+//	power  = atom [ "^" unary ]
+//	atom   = number | name | name "(" expr { "," expr } ")" | "(" expr ")"
+func evalExpr(expr string) (float64, error) {
+	p := &exprParser{src: expr}
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.src[p.pos:], p.pos+1)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (float64, error) {
+	v, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '+', '-':
+			op := p.src[p.pos]
+			p.pos++
+			r, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			if op == '+' {
+				v += r
+			} else {
+				v -= r
+			}
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *exprParser) term() (float64, error) {
+	v, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch op := p.peek(); op {
+		case '*', '/', '%':
+			p.pos++
+			r, err := p.unary()
+			if err != nil {
+				return 0, err
+			}
+			switch op {
+			case '*':
+				v *= r
+			case '/':
+				if r == 0 {
+					return 0, fmt.Errorf("division by zero")
+				}
+				v /= r
+			case '%':
+				if r == 0 {
+					return 0, fmt.Errorf("division by zero")
+				}
+				v = math.Mod(v, r)
+			}
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *exprParser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.unary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *exprParser) power() (float64, error) {
+	v, err := p.atom()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		// Right-associative, and binds tighter than a leading minus:
+		// -2^2 is -4, 2^-1 is 0.5.
+		e, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(v, e), nil
+	}
+	return v, nil
+}
+
+func (p *exprParser) atom() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return v, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.number()
+	case unicode.IsLetter(rune(c)):
+		return p.name()
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *exprParser) number() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c >= '0' && c <= '9' || c == '.' || c == '_' {
+			p.pos++
+			continue
+		}
+		// Exponent: 1e6, 2.5E-3.
+		if (c == 'e' || c == 'E') && p.pos+1 < len(p.src) {
+			next := p.src[p.pos+1]
+			if next >= '0' && next <= '9' || (next == '-' || next == '+') && p.pos+2 < len(p.src) {
+				p.pos += 2
+				continue
+			}
+		}
+		break
+	}
+	text := strings.ReplaceAll(p.src[start:p.pos], "_", "")
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return v, nil
+}
+
+var exprConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var exprFuncs = map[string]func(args []float64) (float64, error){
+	"sqrt":  unaryFunc(math.Sqrt),
+	"abs":   unaryFunc(math.Abs),
+	"floor": unaryFunc(math.Floor),
+	"ceil":  unaryFunc(math.Ceil),
+	"round": unaryFunc(math.Round),
+	"ln":    unaryFunc(math.Log),
+	"log":   unaryFunc(math.Log10),
+	"log2":  unaryFunc(math.Log2),
+	"exp":   unaryFunc(math.Exp),
+	"sin":   unaryFunc(math.Sin),
+	"cos":   unaryFunc(math.Cos),
+	"tan":   unaryFunc(math.Tan),
+	"min":   foldFunc(math.Min),
+	"max":   foldFunc(math.Max),
+}
+
+func unaryFunc(f func(float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("takes 1 argument, got %d", len(args))
+		}
+		return f(args[0]), nil
+	}
+}
+
+func foldFunc(f func(a, b float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("needs at least 1 argument")
+		}
+		v := args[0]
+		for _, a := range args[1:] {
+			v = f(v, a)
+		}
+		return v, nil
+	}
+}
+
+func (p *exprParser) name() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+		p.pos++
+	}
+	name := strings.ToLower(p.src[start:p.pos])
+
+	if p.peek() != '(' {
+		if v, ok := exprConstants[name]; ok {
+			return v, nil
+		}
+		return 0, fmt.Errorf("unknown name %q", name)
+	}
+	f, ok := exprFuncs[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown function %q", name)
+	}
+	p.pos++
+	var args []float64
+	if p.peek() != ')' {
+		for {
+			v, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return 0, fmt.Errorf("missing closing parenthesis after %s arguments", name)
+	}
+	p.pos++
+	v, err := f(args)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", name, err)
+	}
+	return v, nil
+}
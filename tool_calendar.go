@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(calendarTool{})
+}
+
+// CalendarConfig points at an iCalendar (.ics) feed, either a URL such as
+// a "secret address" export or a local file.
+type CalendarConfig struct {
+	URL      string     `yaml:"url"`
+	File     string     `yaml:"file"`
+	Username string     `yaml:"username"`
+	Password Credential `yaml:"password"`
+}
+
+// calendarTool lists events from the calendars in the config.
+type calendarTool struct{}
+
+func (calendarTool) external() bool { return true }
+
+func (calendarTool) Name() string { return "calendar" }
+
+func (calendarTool) configured() bool { return len(toolsConfig.Calendars) > 0 }
+
+func (calendarTool) Description() string {
+	names := make([]string, 0, len(toolsConfig.Calendars))
+	for name := range toolsConfig.Calendars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "List the user's calendar events in a date range. Calendars: " + strings.Join(names, ", ") + "."
+}
+
+func (calendarTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"from":     map[string]any{"type": "string", "description": "first day, YYYY-MM-DD; defaults to today"},
+			"days":     map[string]any{"type": "integer", "minimum": 1, "maximum": 62, "description": "number of days; defaults to 7"},
+			"calendar": map[string]any{"type": "string", "description": "one calendar name; omit for all"},
+		},
+	}
+}
+
+func (calendarTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		From     string `json:"from"`
+		Days     int    `json:"days"`
+		Calendar string `json:"calendar"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if in.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", in.From, time.Local)
+		if err != nil {
+			return "", fmt.Errorf("from must be YYYY-MM-DD, not %q", in.From)
+		}
+		from = t
+	}
+	if in.Days <= 0 {
+		in.Days = 7
+	}
+	to := from.AddDate(0, 0, min(in.Days, 62))
+
+	if _, ok := toolsConfig.Calendars[in.Calendar]; in.Calendar != "" && !ok {
+		return "", fmt.Errorf("no calendar named %q", in.Calendar)
+	}
+
+	var events []calendarEvent
+	for name, cal := range toolsConfig.Calendars {
+		if in.Calendar != "" && in.Calendar != name {
+			continue
+		}
+		data, err := cal.read(ctx)
+		if err != nil {
+			return "", fmt.Errorf("calendar %s: %w", name, err)
+		}
+		for _, ev := range parseICS(data) {
+			for _, occ := range ev.occurrences(from, to) {
+				occ.calendar = name
+				events = append(events, occ)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+
+	if len(events) == 0 {
+		return fmt.Sprintf("No events from %s to %s.", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02")), nil
+	}
+	var b strings.Builder
+	for _, ev := range events {
+		b.WriteString(ev.String())
+		b.WriteByte('\n')
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func (c CalendarConfig) read(ctx context.Context) ([]byte, error) {
+	if c.File != "" {
+		return os.ReadFile(expandHome(c.File))
+	}
+	u := c.URL
+	if rest, ok := strings.CutPrefix(u, "webcal://"); ok {
+		u = "https://" + rest
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		password, err := c.Password.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("password: %w", err)
+		}
+		req.SetBasicAuth(c.Username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+}
+
+type calendarEvent struct {
+	summary, location string
+	start, end        time.Time
+	allDay            bool
+	rrule             map[string]string
+	exdates           map[int64]bool
+	calendar          string
+}
+
+func (ev calendarEvent) String() string {
+	var when string
+	if ev.allDay {
+		when = ev.start.Format("Mon 2006-01-02")
+		if last := ev.end.AddDate(0, 0, -1); last.After(ev.start) {
+			when += " – " + last.Format("Mon 2006-01-02")
+		}
+		when += " (all day)"
+	} else {
+		start, end := ev.start.Local(), ev.end.Local()
+		when = start.Format("Mon 2006-01-02 15:04")
+		if !end.IsZero() {
+			if end.YearDay() == start.YearDay() && end.Year() == start.Year() {
+				when += "–" + end.Format("15:04")
+			} else {
+				when += " – " + end.Format("Mon 2006-01-02 15:04")
+			}
+		}
+	}
+	s := when + "  " + ev.summary
+	if ev.location != "" {
+		s += " @ " + ev.location
+	}
+	return s + " [" + ev.calendar + "]"
+}
+
+// parseICS extracts the events of an iCalendar file. It understands what
+// calendar exports commonly contain, not the whole of RFC 5545.
+func parseICS(data []byte) []calendarEvent {
+	// Unfold continuation lines, which start with a space or tab.
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+
+	var events []calendarEvent
+	var ev *calendarEvent
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		name, params, value := splitICSLine(sc.Text())
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			ev = &calendarEvent{exdates: map[int64]bool{}}
+		case name == "END" && value == "VEVENT":
+			if ev != nil && !ev.start.IsZero() {
+				events = append(events, *ev)
+			}
+			ev = nil
+		case ev == nil:
+		case name == "SUMMARY":
+			ev.summary = unescapeICS(value)
+		case name == "LOCATION":
+			ev.location = unescapeICS(value)
+		case name == "DTSTART":
+			ev.start, ev.allDay = parseICSTime(value, params)
+		case name == "DTEND":
+			ev.end, _ = parseICSTime(value, params)
+		case name == "DURATION":
+			if d, ok := parseICSDuration(value); ok && !ev.start.IsZero() {
+				ev.end = ev.start.Add(d)
+			}
+		case name == "RRULE":
+			ev.rrule = map[string]string{}
+			for _, part := range strings.Split(value, ";") {
+				if k, v, ok := strings.Cut(part, "="); ok {
+					ev.rrule[k] = v
+				}
+			}
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _ := parseICSTime(v, params)
+				ev.exdates[t.Unix()] = true
+			}
+		}
+	}
+	return events
+}
+
+// splitICSLine splits "NAME;PARAM=x:value" into its parts. Parameter
+// values may be quoted and contain colons.
+func splitICSLine(line string) (name string, params map[string]string, value string) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+	params = map[string]string{}
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func unescapeICS(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+func parseICSTime(value string, params map[string]string) (t time.Time, allDay bool) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, _ = time.ParseInLocation("20060102", value, time.Local)
+		return t, true
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, _ = time.Parse("20060102T150405Z", value)
+		return t, false
+	}
+	loc := time.Local
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, _ = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false
+}
+
+// parseICSDuration parses durations like PT1H30M or P1D.
+func parseICSDuration(s string) (time.Duration, bool) {
+	s = strings.TrimPrefix(s, "+")
+	s, ok := strings.CutPrefix(s, "P")
+	if !ok {
+		return 0, false
+	}
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, c := range s {
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num += string(c)
+		default:
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, false
+			}
+			num = ""
+			switch {
+			case c == 'W':
+				d += time.Duration(n) * 7 * 24 * time.Hour
+			case c == 'D':
+				d += time.Duration(n) * 24 * time.Hour
+			case c == 'H' && inTime:
+				d += time.Duration(n) * time.Hour
+			case c == 'M' && inTime:
+				d += time.Duration(n) * time.Minute
+			case c == 'S' && inTime:
+				d += time.Duration(n) * time.Second
+			default:
+				return 0, false
+			}
+		}
+	}
+	return d, true
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// occurrences returns the instances of ev that overlap [from, to).
+// Recurrence supports FREQ with INTERVAL, COUNT, UNTIL and, for weekly
+// rules, BYDAY; other BY* rules are not expanded.
+func (ev calendarEvent) occurrences(from, to time.Time) []calendarEvent {
+	length := ev.end.Sub(ev.start)
+	if ev.end.IsZero() {
+		length = 0
+		if ev.allDay {
+			length = 24 * time.Hour
+		}
+	}
+	overlaps := func(start time.Time) bool {
+		return start.Before(to) && (start.Add(length).After(from) || start.Equal(from))
+	}
+	instance := func(start time.Time) calendarEvent {
+		occ := ev
+		occ.start, occ.end = start, start.Add(length)
+		if ev.end.IsZero() && !ev.allDay {
+			occ.end = time.Time{}
+		}
+		return occ
+	}
+
+	freq := ev.rrule["FREQ"]
+	switch freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		// Not recurring, or a frequency we don't expand.
+		if overlaps(ev.start) {
+			return []calendarEvent{instance(ev.start)}
+		}
+		return nil
+	}
+
+	interval, _ := strconv.Atoi(ev.rrule["INTERVAL"])
+	interval = max(interval, 1)
+	count, _ := strconv.Atoi(ev.rrule["COUNT"])
+	var until time.Time
+	if u := ev.rrule["UNTIL"]; u != "" {
+		until, _ = parseICSTime(u, nil)
+		if len(u) == 8 {
+			until = until.AddDate(0, 0, 1)
+		}
+	}
+
+	// Candidate starts in order, one period at a time.
+	var days []time.Weekday
+	if freq == "WEEKLY" {
+		for _, d := range strings.Split(ev.rrule["BYDAY"], ",") {
+			if wd, ok := icsWeekdays[d]; ok {
+				days = append(days, wd)
+			}
+		}
+		sort.Slice(days, func(i, j int) bool {
+			return (days[i]+6)%7 < (days[j]+6)%7 // weeks start on Monday
+		})
+	}
+	period := func(n int) []time.Time {
+		s := ev.start
+		switch freq {
+		case "DAILY":
+			return []time.Time{s.AddDate(0, 0, n*interval)}
+		case "WEEKLY":
+			base := s.AddDate(0, 0, 7*n*interval)
+			if len(days) == 0 {
+				return []time.Time{base}
+			}
+			monday := base.AddDate(0, 0, -int((base.Weekday()+6)%7))
+			var starts []time.Time
+			for _, wd := range days {
+				starts = append(starts, monday.AddDate(0, 0, int((wd+6)%7)))
+			}
+			return starts
+		case "MONTHLY":
+			t := s.AddDate(0, n*interval, 0)
+			if t.Day() != s.Day() {
+				return nil // no such day this month, e.g. the 31st
+			}
+			return []time.Time{t}
+		case "YEARLY":
+			t := s.AddDate(n*interval, 0, 0)
+			if t.Day() != s.Day() {
+				return nil
+			}
+			return []time.Time{t}
+		}
+		return nil
+	}
+
+	var out []calendarEvent
+	seen := 0
+	for n := 0; n < 10000; n++ {
+		for _, start := range period(n) {
+			if start.Before(ev.start) {
+				continue
+			}
+			if (!until.IsZero() && start.After(until)) || (count > 0 && seen >= count) || !start.Before(to) {
+				return out
+			}
+			seen++
+			if !ev.exdates[start.Unix()] && overlaps(start) {
+				out = append(out, instance(start))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(convertTool{})
+}
+
+// convertTool converts between units locally and between currencies using
+// published exchange rates, cached so repeated questions stay offline.
+type convertTool struct{}
+
+func (convertTool) Name() string { return "convert" }
+
+func (convertTool) Description() string {
+	return "Convert a value between units (length, mass, volume, area, time, speed, data, energy, " +
+		"pressure, temperature) or currencies (ISO codes like USD, EUR, NOK). " +
+		"Use it instead of converting from memory."
+}
+
+func (convertTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"value": map[string]any{"type": "number"},
+			"from":  map[string]any{"type": "string", "description": "unit or currency code, e.g. mi, kg, degF, EUR"},
+			"to":    map[string]any{"type": "string", "description": "unit or currency code"},
+		},
+		"required": []string{"value", "from", "to"},
+	}
+}
+
+func (convertTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Value float64 `json:"value"`
+		From  string  `json:"from"`
+		To    string  `json:"to"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+
+	if isCurrencyCode(in.From) && isCurrencyCode(in.To) {
+		v, asOf, err := convertCurrency(ctx, in.Value, strings.ToUpper(in.From), strings.ToUpper(in.To))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s = %s %s (rates as of %s)",
+			formatNumber(in.Value), strings.ToUpper(in.From), formatNumber(math.Round(v*1e4)/1e4), strings.ToUpper(in.To), asOf), nil
+	}
+
+	v, err := convertUnit(in.Value, in.From, in.To)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s = %s %s", formatNumber(in.Value), in.From, formatNumber(v), in.To), nil
+}
+
+type unit struct {
+	dimension string
+	factor    float64 // in the dimension's base unit
+}
+
+// units maps names and abbreviations to a factor in the base unit of
+// their dimension: metre, kilogram, litre, square metre, second, metre per
+// second, byte, joule and pascal.
+var units = map[string]unit{}
+
+func defineUnits(dimension string, factors map[float64][]string) {
+	for factor, names := range factors {
+		for _, name := range names {
+			units[name] = unit{dimension, factor}
+		}
+	}
+}
+
+func init() {
+	defineUnits("length", map[float64][]string{
+		1e-9:     {"nm", "nanometer", "nanometre"},
+		1e-6:     {"um", "µm", "micrometer", "micrometre"},
+		1e-3:     {"mm", "millimeter", "millimetre"},
+		1e-2:     {"cm", "centimeter", "centimetre"},
+		1:        {"m", "meter", "metre"},
+		1e3:      {"km", "kilometer", "kilometre"},
+		0.0254:   {"in", "inch", "\""},
+		0.3048:   {"ft", "foot", "feet", "'"},
+		0.9144:   {"yd", "yard"},
+		1609.344: {"mi", "mile"},
+		1852:     {"nmi", "nautical mile"},
+	})
+	defineUnits("mass", map[float64][]string{
+		1e-6:        {"mg", "milligram"},
+		1e-3:        {"g", "gram"},
+		1:           {"kg", "kilogram"},
+		1e3:         {"t", "tonne", "metric ton"},
+		0.028349523: {"oz", "ounce"},
+		0.45359237:  {"lb", "lbs", "pound"},
+		6.35029318:  {"st", "stone"},
+	})
+	defineUnits("volume", map[float64][]string{
+		1e-3:         {"ml", "milliliter", "millilitre"},
+		1e-2:         {"cl", "centiliter", "centilitre"},
+		1e-1:         {"dl", "deciliter", "decilitre"},
+		1:            {"l", "liter", "litre"},
+		1e3:          {"m3", "cubic meter", "cubic metre"},
+		0.0295735296: {"fl oz", "floz", "fluid ounce"},
+		0.2365882365: {"cup"},
+		0.473176473:  {"pt", "pint"},
+		0.946352946:  {"qt", "quart"},
+		3.785411784:  {"gal", "gallon"},
+		0.00492892:   {"tsp", "teaspoon"},
+		0.0147867648: {"tbsp", "tablespoon"},
+	})
+	defineUnits("area", map[float64][]string{
+		1e-4:        {"cm2"},
+		1:           {"m2", "square meter", "square metre"},
+		1e4:         {"ha", "hectare"},
+		1e6:         {"km2"},
+		0.09290304:  {"ft2", "sqft"},
+		4046.856422: {"acre"},
+		2589988.11:  {"mi2"},
+	})
+	defineUnits("time", map[float64][]string{
+		1e-3:     {"ms", "millisecond"},
+		1:        {"s", "sec", "second"},
+		60:       {"min", "minute"},
+		3600:     {"h", "hr", "hour"},
+		86400:    {"d", "day"},
+		604800:   {"wk", "week"},
+		31557600: {"yr", "year"},
+	})
+	defineUnits("speed", map[float64][]string{
+		1:           {"m/s", "mps"},
+		1 / 3.6:     {"km/h", "kph", "kmh"},
+		0.44704:     {"mph"},
+		0.514444444: {"kn", "knot"},
+		0.3048:      {"ft/s"},
+	})
+	defineUnits("data", map[float64][]string{
+		0.125:   {"bit"},
+		1:       {"b", "byte"},
+		1e3:     {"kb", "kilobyte"},
+		1e6:     {"mb", "megabyte"},
+		1e9:     {"gb", "gigabyte"},
+		1e12:    {"tb", "terabyte"},
+		1 << 10: {"kib", "kibibyte"},
+		1 << 20: {"mib", "mebibyte"},
+		1 << 30: {"gib", "gibibyte"},
+		1 << 40: {"tib", "tebibyte"},
+	})
+	defineUnits("energy", map[float64][]string{
+		1:        {"j", "joule"},
+		1e3:      {"kj", "kilojoule"},
+		4.184:    {"cal", "calorie"},
+		4184:     {"kcal", "kilocalorie"},
+		3600:     {"wh", "watt hour"},
+		3.6e6:    {"kwh", "kilowatt hour"},
+		1055.056: {"btu"},
+	})
+	defineUnits("pressure", map[float64][]string{
+		1:           {"pa", "pascal"},
+		1e3:         {"kpa"},
+		1e5:         {"bar"},
+		101325:      {"atm"},
+		6894.757293: {"psi"},
+		133.322368:  {"mmhg"},
+	})
+}
+
+// temperatures convert to kelvin with an offset, so they don't fit the
+// factor table.
+var temperatures = map[string]struct{ scale, offset float64 }{
+	"c": {1, 273.15}, "degc": {1, 273.15}, "°c": {1, 273.15}, "celsius": {1, 273.15},
+	"f": {5.0 / 9, 459.67 * 5 / 9}, "degf": {5.0 / 9, 459.67 * 5 / 9}, "°f": {5.0 / 9, 459.67 * 5 / 9}, "fahrenheit": {5.0 / 9, 459.67 * 5 / 9},
+	"k": {1, 0}, "kelvin": {1, 0},
+}
+
+func lookupUnit(name string) (unit, bool) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if u, ok := units[key]; ok {
+		return u, true
+	}
+	// Plurals: "miles", "inches".
+	for _, suffix := range []string{"es", "s"} {
+		if u, ok := units[strings.TrimSuffix(key, suffix)]; ok && strings.HasSuffix(key, suffix) {
+			return u, true
+		}
+	}
+	return unit{}, false
+}
+
+func convertUnit(v float64, from, to string) (float64, error) {
+	tf, fromTemp := temperatures[strings.ToLower(from)]
+	tt, toTemp := temperatures[strings.ToLower(to)]
+	if fromTemp || toTemp {
+		if !fromTemp || !toTemp {
+			return 0, fmt.Errorf("cannot convert between %s and %s", from, to)
+		}
+		kelvin := v*tf.scale + tf.offset
+		return (kelvin - tt.offset) / tt.scale, nil
+	}
+
+	uf, ok := lookupUnit(from)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	ut, ok := lookupUnit(to)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if uf.dimension != ut.dimension {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, uf.dimension, to, ut.dimension)
+	}
+	return v * uf.factor / ut.factor, nil
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' && c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	// Three-letter unit names win over currency codes.
+	_, isUnit := lookupUnit(s)
+	return !isUnit
+}
+
+const (
+	ratesURL    = "https://open.er-api.com/v6/latest/USD"
+	ratesMaxAge = 12 * time.Hour
+)
+
+// exchangeRates are units of each currency per US dollar.
+type exchangeRates struct {
+	Fetched time.Time          `json:"fetched"`
+	Rates   map[string]float64 `json:"rates"`
+}
+
+func ratesCachePath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rates.json"), nil
+}
+
+// loadRates returns cached rates when they are fresh enough, otherwise
+// fetches new ones. Stale rates are used when the fetch fails, since an
+// old rate is more useful to the model than none.
+func loadRates(ctx context.Context) (*exchangeRates, error) {
+	path, pathErr := ratesCachePath()
+	var cached *exchangeRates
+	if pathErr == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			var r exchangeRates
+			if json.Unmarshal(data, &r) == nil && len(r.Rates) > 0 {
+				cached = &r
+			}
+		}
+	}
+	if cached != nil && time.Since(cached.Fetched) < ratesMaxAge {
+		return cached, nil
+	}
+
+	fresh, err := fetchRates(ctx)
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("fetching exchange rates: %w", err)
+	}
+	if pathErr == nil {
+		if data, err := json.Marshal(fresh); err == nil {
+			if os.MkdirAll(filepath.Dir(path), 0755) == nil {
+				os.WriteFile(path, data, 0644)
+			}
+		}
+	}
+	return fresh, nil
+}
+
+func fetchRates(ctx context.Context) (*exchangeRates, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ratesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", ratesURL, resp.Status)
+	}
+	var body struct {
+		Result string             `json:"result"`
+		Rates  map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Result != "success" || len(body.Rates) == 0 {
+		return nil, fmt.Errorf("%s: unexpected response", ratesURL)
+	}
+	return &exchangeRates{Fetched: time.Now().UTC(), Rates: body.Rates}, nil
+}
+
+func convertCurrency(ctx context.Context, v float64, from, to string) (float64, string, error) {
+	rates, err := loadRates(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	rf, ok := rates.Rates[from]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown currency %q", from)
+	}
+	rt, ok := rates.Rates[to]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown currency %q", to)
+	}
+	return v / rf * rt, rates.Fetched.Format("2006-01-02 15:04 UTC"), nil
+}
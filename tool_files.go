@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	registerTool(readFileTool{})
+}
+
+// readFileTool lets the model list and read files in the directories
+// allowlisted in tools.files, and nowhere else.
+type readFileTool struct{}
+
+// Files may hold text written by anyone.
+func (readFileTool) external() bool { return true }
+
+func (readFileTool) configured() bool { return len(toolsConfig.Files) > 0 }
+
+func (readFileTool) Name() string { return "read_file" }
+
+func (readFileTool) Description() string {
+	return "List a directory or read a text file on the user's computer. Only these directories and what is below them can be read: " +
+		strings.Join(toolsConfig.Files, ", ") + ". Long files are read in parts from a byte offset."
+}
+
+func (readFileTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path":   map[string]any{"type": "string", "description": "a file or directory; ~ is the home directory"},
+			"offset": map[string]any{"type": "integer", "description": "byte offset to start reading a file at"},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (readFileTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	path, err := allowedFile(in.Path)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%s:\n", path)
+		for _, e := range entries {
+			if e.IsDir() {
+				fmt.Fprintf(&sb, "%s/\n", e.Name())
+			} else if info, err := e.Info(); err == nil {
+				fmt.Fprintf(&sb, "%s (%s)\n", e.Name(), formatBytes(int(info.Size())))
+			}
+		}
+		return sb.String(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) || strings.ContainsRune(string(data), 0) {
+		return "", fmt.Errorf("%s is not a text file", path)
+	}
+	if in.Offset < 0 || in.Offset > 0 && in.Offset >= len(data) {
+		return "", fmt.Errorf("offset must be between 0 and %d", max(len(data)-1, 0))
+	}
+	s := string(data)
+	start := len(s) - len(validUTF8Suffix(s, len(s)-in.Offset))
+	// Leave room for the header, so the part itself is never shortened.
+	part := validUTF8Prefix(s[start:], min(maxToolResult()-64-len(path), len(s)-start))
+	if start == 0 && len(part) == len(s) {
+		return s, nil
+	}
+	return fmt.Sprintf("%s, bytes %d-%d of %d:\n%s", path, start, start+len(part), len(s), part), nil
+}
+
+// allowedFile resolves path, following symlinks, and returns it if it is
+// in one of the directories of tools.files. Paths outside them are
+// refused without saying whether they exist.
+func allowedFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no path given")
+	}
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return "", err
+	}
+	var roots []string
+	for _, dir := range toolsConfig.Files {
+		if root, err := filepath.Abs(expandHome(dir)); err == nil {
+			roots = append(roots, root)
+			if resolved, err := filepath.EvalSymlinks(root); err == nil {
+				roots = append(roots, resolved)
+			}
+		}
+	}
+	outside := fmt.Errorf("%s is outside the directories that can be read (%s)", path, strings.Join(toolsConfig.Files, ", "))
+	if !underAny(roots, abs) {
+		return "", outside
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	// A symlink may point out of the directories.
+	if !underAny(roots, resolved) {
+		return "", outside
+	}
+	return resolved, nil
+}
+
+// underAny reports whether path is one of dirs or below one.
+func underAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(homeAssistantTool{})
+}
+
+// HomeAssistantConfig connects to the Home Assistant REST API. Only the
+// listed entities are visible to the model, and only those under Control
+// can be changed.
+type HomeAssistantConfig struct {
+	URL     string     `yaml:"url"`
+	Token   Credential `yaml:"token"`
+	Read    []string   `yaml:"read"`
+	Control []string   `yaml:"control"`
+}
+
+func (c HomeAssistantConfig) canRead(entity string) bool {
+	return slices.Contains(c.Read, entity) || c.canControl(entity)
+}
+
+func (c HomeAssistantConfig) canControl(entity string) bool {
+	return slices.Contains(c.Control, entity)
+}
+
+type homeAssistantTool struct{}
+
+func (homeAssistantTool) external() bool { return true }
+
+func (homeAssistantTool) stateful() bool { return true }
+
+func (homeAssistantTool) Name() string { return "home_assistant" }
+
+func (homeAssistantTool) configured() bool { return toolsConfig.HomeAssistant.URL != "" }
+
+func (homeAssistantTool) Description() string {
+	ha := toolsConfig.HomeAssistant
+	readOnly := slices.DeleteFunc(slices.Clone(ha.Read), ha.canControl)
+	sort.Strings(readOnly)
+	control := slices.Clone(ha.Control)
+	sort.Strings(control)
+	desc := "Read the state of the user's Home Assistant entities or switch them on and off."
+	if len(readOnly) > 0 {
+		desc += " Readable: " + strings.Join(readOnly, ", ") + "."
+	}
+	if len(control) > 0 {
+		desc += " Readable and controllable: " + strings.Join(control, ", ") + "."
+	}
+	return desc
+}
+
+func (homeAssistantTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action":    map[string]any{"type": "string", "enum": []string{"state", "turn_on", "turn_off", "toggle"}},
+			"entity_id": map[string]any{"type": "string"},
+		},
+		"required": []string{"action", "entity_id"},
+	}
+}
+
+func (homeAssistantTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Action   string `json:"action"`
+		EntityID string `json:"entity_id"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	ha := toolsConfig.HomeAssistant
+	switch in.Action {
+	case "state":
+		if !ha.canRead(in.EntityID) {
+			return "", fmt.Errorf("%s is not in the allowlist", in.EntityID)
+		}
+	case "turn_on", "turn_off", "toggle":
+		if !ha.canControl(in.EntityID) {
+			return "", fmt.Errorf("%s may not be controlled", in.EntityID)
+		}
+	default:
+		return "", fmt.Errorf("unknown action %q", in.Action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if in.Action != "state" {
+		domain, _, _ := strings.Cut(in.EntityID, ".")
+		body, _ := json.Marshal(map[string]string{"entity_id": in.EntityID})
+		if err := ha.call(ctx, http.MethodPost, "/api/services/"+domain+"/"+in.Action, body, nil); err != nil {
+			return "", err
+		}
+	}
+
+	var state struct {
+		State      string         `json:"state"`
+		Attributes map[string]any `json:"attributes"`
+	}
+	if err := ha.call(ctx, http.MethodGet, "/api/states/"+in.EntityID, nil, &state); err != nil {
+		return "", err
+	}
+	name := in.EntityID
+	if fn, ok := state.Attributes["friendly_name"].(string); ok {
+		name = fmt.Sprintf("%s (%s)", fn, in.EntityID)
+	}
+	result := name + ": " + state.State
+	if unit, ok := state.Attributes["unit_of_measurement"].(string); ok {
+		result += " " + unit
+	}
+	return result, nil
+}
+
+func (c HomeAssistantConfig) call(ctx context.Context, method, path string, body []byte, out any) error {
+	token, err := c.Token.resolve()
+	if err != nil {
+		return fmt.Errorf("home_assistant token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("home assistant: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
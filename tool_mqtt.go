@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(mqttTool{})
+}
+
+// MQTTConfig points at an MQTT broker. Topics are allowlisted with MQTT
+// filters: + matches one level, # the rest.
+type MQTTConfig struct {
+	// Broker is tcp://host:1883 or ssl://host:8883.
+	Broker   string     `yaml:"broker"`
+	Username string     `yaml:"username"`
+	Password Credential `yaml:"password"`
+	Read     []string   `yaml:"read"`
+	Publish  []string   `yaml:"publish"`
+}
+
+type mqttTool struct{}
+
+func (mqttTool) external() bool { return true }
+
+func (mqttTool) stateful() bool { return true }
+
+func (mqttTool) Name() string { return "mqtt" }
+
+func (mqttTool) configured() bool { return toolsConfig.MQTT.Broker != "" }
+
+func (mqttTool) Description() string {
+	m := toolsConfig.MQTT
+	desc := "Read retained messages from, or publish to, the user's MQTT broker (home automation sensors and switches)."
+	if len(m.Read) > 0 {
+		desc += " Readable topics: " + strings.Join(m.Read, ", ") + "."
+	}
+	if len(m.Publish) > 0 {
+		desc += " Publishable topics: " + strings.Join(m.Publish, ", ") + "."
+	}
+	return desc
+}
+
+func (mqttTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action":  map[string]any{"type": "string", "enum": []string{"read", "publish"}},
+			"topic":   map[string]any{"type": "string"},
+			"payload": map[string]any{"type": "string", "description": "for publish"},
+		},
+		"required": []string{"action", "topic"},
+	}
+}
+
+func (mqttTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Action  string `json:"action"`
+		Topic   string `json:"topic"`
+		Payload string `json:"payload"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	m := toolsConfig.MQTT
+	switch in.Action {
+	case "read":
+		if !topicAllowed(m.Read, in.Topic) && !topicAllowed(m.Publish, in.Topic) {
+			return "", fmt.Errorf("topic %s is not in the allowlist", in.Topic)
+		}
+	case "publish":
+		if strings.ContainsAny(in.Topic, "+#") || !topicAllowed(m.Publish, in.Topic) {
+			return "", fmt.Errorf("publishing to %s is not allowed", in.Topic)
+		}
+	default:
+		return "", fmt.Errorf("unknown action %q", in.Action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := dialMQTT(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	defer conn.close()
+
+	if in.Action == "publish" {
+		if err := conn.publish(in.Topic, in.Payload); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("published %q to %s", in.Payload, in.Topic), nil
+	}
+
+	msgs, err := conn.readRetained(in.Topic, 2*time.Second)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "no retained message on " + in.Topic, nil
+	}
+	var b strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "%s: %s\n", msg[0], msg[1])
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// topicAllowed reports whether topic is covered by one of the filters.
+// A requested topic that is itself a filter must appear verbatim.
+func topicAllowed(filters []string, topic string) bool {
+	if slices.Contains(filters, topic) {
+		return true
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return false
+	}
+	for _, f := range filters {
+		if mqttMatch(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func mqttMatch(filter, topic string) bool {
+	fl, tl := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) || (f != "+" && f != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// mqttConn is just enough of an MQTT 3.1.1 client for one-off reads and
+// QoS 0 publishes.
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMQTT(ctx context.Context, cfg MQTTConfig) (*mqttConn, error) {
+	u, err := url.Parse(cfg.Broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid mqtt broker %q", cfg.Broker)
+	}
+	var conn net.Conn
+	var d net.Dialer
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = d.DialContext(ctx, "tcp", withDefaultPort(u.Host, "1883"))
+	case "ssl", "tls", "mqtts":
+		td := tls.Dialer{NetDialer: &d}
+		conn, err = td.DialContext(ctx, "tcp", withDefaultPort(u.Host, "8883"))
+	default:
+		return nil, fmt.Errorf("unsupported mqtt scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+
+	var payload []byte
+	flags := byte(0x02) // clean session
+	payload = appendMQTTString(payload, fmt.Sprintf("%s-%d", appName, time.Now().UnixNano()%1e9))
+	if cfg.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, cfg.Username)
+		if cfg.Password.isSet() {
+			password, err := cfg.Password.resolve()
+			if err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("mqtt password: %w", err)
+			}
+			flags |= 0x40
+			payload = appendMQTTString(payload, password)
+		}
+	}
+	header := appendMQTTString(nil, "MQTT")
+	header = append(header, 4, flags, 0, 30) // protocol level 4, keepalive 30s
+	if err := c.write(0x10, append(header, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, body, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt connect: %w", err)
+	}
+	if typ != 0x20 || len(body) < 2 || body[1] != 0 {
+		conn.Close()
+		if len(body) >= 2 && (body[1] == 4 || body[1] == 5) {
+			return nil, errors.New("mqtt broker refused the credentials")
+		}
+		return nil, errors.New("mqtt broker refused the connection")
+	}
+	return c, nil
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func (c *mqttConn) write(header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		pkt = append(pkt, digit)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := c.conn.Write(append(pkt, body...))
+	return err
+}
+
+// read returns the type bits of the next packet's header and its body.
+func (c *mqttConn) read() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		digit, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(digit&0x7f) * mult
+		if digit&0x80 == 0 {
+			break
+		}
+		if mult *= 128; i == 3 {
+			return 0, nil, errors.New("mqtt: malformed packet length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func (c *mqttConn) publish(topic, payload string) error {
+	return c.write(0x30, append(appendMQTTString(nil, topic), payload...))
+}
+
+// readRetained subscribes to filter and collects the retained messages the
+// broker sends straight away, waiting at most wait for them.
+func (c *mqttConn) readRetained(filter string, wait time.Duration) ([][2]string, error) {
+	body := []byte{0, 1} // packet id
+	body = append(appendMQTTString(body, filter), 0)
+	if err := c.write(0x82, body); err != nil {
+		return nil, err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(wait))
+
+	var msgs [][2]string
+	for len(msgs) < 50 {
+		typ, body, err := c.read()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		if typ&0xf0 != 0x30 || len(body) < 2 {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			continue
+		}
+		topic, rest := string(body[2:2+n]), body[2+n:]
+		if qos := (typ >> 1) & 3; qos > 0 && len(rest) >= 2 {
+			rest = rest[2:]
+		}
+		msgs = append(msgs, [2]string{topic, string(rest)})
+		// A single topic has at most one retained message, and live
+		// traffic means the retained ones have been delivered.
+		if !strings.ContainsAny(filter, "+#") || typ&0x01 == 0 {
+			break
+		}
+	}
+	return msgs, nil
+}
+
+func (c *mqttConn) close() {
+	c.write(0xe0, nil)
+	c.conn.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+func init() {
+	registerTool(readToolOutputTool{})
+}
+
+// defaultMaxToolResult is how many bytes of a tool's output are sent to
+// the model when tools.max_result is not set.
+const defaultMaxToolResult = 12000
+
+var unsafeOutputID = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+func toolOutputDir() string {
+	return filepath.Join(dataDir, "tool-output")
+}
+
+func maxToolResult() int {
+	if toolsConfig.MaxResult > 0 {
+		return toolsConfig.MaxResult
+	}
+	return defaultMaxToolResult
+}
+
+// fitToolResult shortens an oversized tool output to its start and end,
+// so one long log or page doesn't crowd the rest of the conversation out
+// of the context window. With keep, the full output is saved in the data
+// directory, where read_tool_output can page through it.
+func fitToolResult(call ToolCall, result string, keep bool) string {
+	limit := maxToolResult()
+	if len(result) <= limit {
+		return result
+	}
+	head, tail := validUTF8Prefix(result, limit*2/3), validUTF8Suffix(result, limit/3)
+	note := fmt.Sprintf("[... %d of %d bytes left out ...]", len(result)-len(head)-len(tail), len(result))
+	// Encrypted profiles keep nothing on disk in the clear.
+	if keep && !encryptionKey.isSet() {
+		id := unsafeOutputID.ReplaceAllString(call.ID, "_")
+		path := filepath.Join(toolOutputDir(), id+".txt")
+		err := os.MkdirAll(toolOutputDir(), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(result), 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save the output of %s: %v\n", call.Name, err)
+		} else {
+			note = fmt.Sprintf("[... %d of %d bytes left out. The full output is saved at %s; "+
+				"call read_tool_output with id %q and an offset to read the rest ...]",
+				len(result)-len(head)-len(tail), len(result), path, id)
+		}
+	}
+	return head + "\n" + note + "\n" + tail
+}
+
+// validUTF8Prefix returns at most n bytes from the start of s without
+// splitting a character.
+func validUTF8Prefix(s string, n int) string {
+	for n > 0 && n < len(s) && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func validUTF8Suffix(s string, n int) string {
+	i := len(s) - n
+	for i > 0 && i < len(s) && !isRuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+func isRuneStart(b byte) bool { return b&0xC0 != 0x80 }
+
+// readToolOutputTool reads back tool outputs that were too long to send
+// in full.
+type readToolOutputTool struct{}
+
+// The saved output may come from an external tool.
+func (readToolOutputTool) external() bool { return true }
+
+func (readToolOutputTool) Name() string { return "read_tool_output" }
+
+func (readToolOutputTool) Description() string {
+	return "Read part of a tool output that was too long to show in full. Use the id from the note in the shortened output."
+}
+
+func (readToolOutputTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":     map[string]any{"type": "string"},
+			"offset": map[string]any{"type": "integer", "description": "byte offset to start at"},
+			"length": map[string]any{"type": "integer", "description": "bytes to read (default and maximum: the result limit)"},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (readToolOutputTool) Execute(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		ID     string `json:"id"`
+		Offset int    `json:"offset"`
+		Length int    `json:"length"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	if in.ID == "" || unsafeOutputID.MatchString(in.ID) {
+		return "", fmt.Errorf("bad id %q", in.ID)
+	}
+	data, err := os.ReadFile(filepath.Join(toolOutputDir(), in.ID+".txt"))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no saved output with id %q", in.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if in.Offset < 0 || in.Offset >= len(data) {
+		return "", fmt.Errorf("offset must be between 0 and %d", len(data)-1)
+	}
+	// Leave room for the header, so the part itself is never shortened.
+	length := maxToolResult() - 64
+	if in.Length > 0 && in.Length < length {
+		length = in.Length
+	}
+	s := string(data)
+	// Start at a character boundary.
+	start := len(s) - len(validUTF8Suffix(s, len(s)-in.Offset))
+	part := validUTF8Prefix(s[start:], length)
+	return fmt.Sprintf("bytes %d-%d of %d:\n%s", start, start+len(part), len(s), part), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+func init() {
+	registerTool(shellTool{})
+}
+
+// ShellConfig turns on the run_shell tool. Every command is shown and
+// needs confirmation before it runs.
+type ShellConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Shell runs the commands (default $SHELL, or /bin/sh; cmd on
+	// Windows).
+	Shell string `yaml:"shell"`
+}
+
+// confirmedTool is implemented by tools whose calls the user approves
+// one by one. confirm describes the call for the question.
+type confirmedTool interface {
+	confirm(args json.RawMessage) (string, error)
+}
+
+// shellTool runs shell commands the model proposes, once the user has
+// seen and approved each one.
+type shellTool struct{}
+
+func (shellTool) external() bool { return true }
+
+func (shellTool) stateful() bool { return true }
+
+func (shellTool) configured() bool { return toolsConfig.Shell.Enabled }
+
+func (shellTool) Name() string { return "run_shell" }
+
+func (shellTool) Description() string {
+	return fmt.Sprintf("Run a command in the user's shell (%s) on their computer, in the directory chat-cli was started in. "+
+		"The user sees the command and decides whether it runs, so say in reason why it is needed. "+
+		"Returns the exit status, standard output and standard error.", filepath.Base(shellPath()))
+}
+
+func (shellTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"command": map[string]any{"type": "string"},
+			"reason":  map[string]any{"type": "string", "description": "what running it will tell or do, shown to the user"},
+		},
+		"required": []string{"command"},
+	}
+}
+
+type shellArgs struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+}
+
+func (shellTool) confirm(args json.RawMessage) (string, error) {
+	var in shellArgs
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Command) == "" {
+		return "", errors.New("no command given")
+	}
+	q := "The assistant wants to run:\n" + paint(theme.Code, indent(in.Command, "    "))
+	if in.Reason != "" {
+		q += "\n" + paint(theme.Meta, "  "+in.Reason)
+	}
+	return q, nil
+}
+
+func (shellTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in shellArgs
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Command) == "" {
+		return "", errors.New("no command given")
+	}
+	sh := shellPath()
+	flag := "-c"
+	if runtime.GOOS == "windows" && strings.EqualFold(filepath.Base(sh), "cmd.exe") {
+		flag = "/C"
+	}
+	cmd := exec.CommandContext(ctx, sh, flag, in.Command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	status := "exit status 0"
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status = exitErr.Error()
+	case err != nil:
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString(status + "\n")
+	if stdout.Len() > 0 {
+		sb.WriteString("stdout:\n" + stdout.String() + "\n")
+	}
+	if stderr.Len() > 0 {
+		sb.WriteString("stderr:\n" + stderr.String() + "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+func shellPath() string {
+	if toolsConfig.Shell.Shell != "" {
+		return toolsConfig.Shell.Shell
+	}
+	if runtime.GOOS == "windows" {
+		if c := os.Getenv("COMSPEC"); c != "" {
+			return c
+		}
+		return "cmd.exe"
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	return "/bin/sh"
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// confirmToolCalls asks about each call to a tool that needs approval,
+// and returns "approved" or "declined" for those calls by index. Without
+// a terminal to ask on, they are declined. Calls too malformed to ask
+// about are left to fail when run.
+func (s *session) confirmToolCalls(calls []ToolCall) map[int]string {
+	decisions := map[int]string{}
+	for i, call := range calls {
+		ct, ok := tools[call.Name].(confirmedTool)
+		if !ok {
+			continue
+		}
+		question, err := ct.confirm(json.RawMessage(call.Arguments))
+		if err != nil {
+			continue
+		}
+		// The question is shown even with --quiet: nothing runs unseen.
+		fmt.Println(question)
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Println(paint(theme.Meta, "  Not run: there is no terminal to confirm it on"))
+			decisions[i] = "declined"
+			continue
+		}
+		answer, err := s.input.ReadLine("Run it? [y/N] ")
+		if err == nil && strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			decisions[i] = "approved"
+		} else {
+			decisions[i] = "declined"
+		}
+	}
+	return decisions
+}
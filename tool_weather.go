@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerTool(weatherTool{})
+}
+
+type WeatherConfig struct {
+	// Location is used when the model asks without naming a place.
+	Location string `yaml:"location"`
+	// Units is "metric" (default) or "imperial".
+	Units string `yaml:"units"`
+}
+
+// weatherTool reports current conditions and a short forecast from
+// open-meteo.com, which needs no API key.
+type weatherTool struct{}
+
+func (weatherTool) external() bool { return true }
+
+func (weatherTool) Name() string { return "weather" }
+
+func (weatherTool) Description() string {
+	desc := "Get current weather and a daily forecast (up to 7 days) for a place."
+	if loc := toolsConfig.Weather.Location; loc != "" {
+		desc += " The user's home location is " + loc + "; it is used when no location is given."
+	}
+	return desc
+}
+
+func (weatherTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"location": map[string]any{"type": "string", "description": "city or place name"},
+			"days":     map[string]any{"type": "integer", "minimum": 1, "maximum": 7},
+		},
+	}
+}
+
+const (
+	geocodeURL  = "https://geocoding-api.open-meteo.com/v1/search"
+	forecastURL = "https://api.open-meteo.com/v1/forecast"
+)
+
+func (weatherTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Location string `json:"location"`
+		Days     int    `json:"days"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	if in.Location == "" {
+		in.Location = toolsConfig.Weather.Location
+	}
+	if in.Location == "" {
+		return "", fmt.Errorf("no location given and tools.weather.location is not set")
+	}
+	in.Days = min(max(in.Days, 1), 7)
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var places struct {
+		Results []struct {
+			Name      string  `json:"name"`
+			Country   string  `json:"country"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"results"`
+	}
+	q := url.Values{"name": {in.Location}, "count": {"1"}}
+	if err := getJSON(ctx, geocodeURL+"?"+q.Encode(), &places); err != nil {
+		return "", err
+	}
+	if len(places.Results) == 0 {
+		return "", fmt.Errorf("no place called %q", in.Location)
+	}
+	place := places.Results[0]
+
+	imperial := toolsConfig.Weather.Units == "imperial"
+	q = url.Values{
+		"latitude":      {fmt.Sprint(place.Latitude)},
+		"longitude":     {fmt.Sprint(place.Longitude)},
+		"current":       {"temperature_2m,relative_humidity_2m,wind_speed_10m,weather_code"},
+		"daily":         {"temperature_2m_max,temperature_2m_min,precipitation_sum,weather_code"},
+		"timezone":      {"auto"},
+		"forecast_days": {fmt.Sprint(in.Days)},
+	}
+	tempUnit, windUnit, rainUnit := "°C", "km/h", "mm"
+	if imperial {
+		q.Set("temperature_unit", "fahrenheit")
+		q.Set("wind_speed_unit", "mph")
+		q.Set("precipitation_unit", "inch")
+		tempUnit, windUnit, rainUnit = "°F", "mph", "in"
+	}
+	var fc struct {
+		Current struct {
+			Time        string  `json:"time"`
+			Temperature float64 `json:"temperature_2m"`
+			Humidity    float64 `json:"relative_humidity_2m"`
+			Wind        float64 `json:"wind_speed_10m"`
+			Code        int     `json:"weather_code"`
+		} `json:"current"`
+		Daily struct {
+			Time   []string  `json:"time"`
+			Max    []float64 `json:"temperature_2m_max"`
+			Min    []float64 `json:"temperature_2m_min"`
+			Precip []float64 `json:"precipitation_sum"`
+			Code   []int     `json:"weather_code"`
+		} `json:"daily"`
+	}
+	if err := getJSON(ctx, forecastURL+"?"+q.Encode(), &fc); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s (local time %s): %s, %.1f%s, humidity %.0f%%, wind %.0f %s\n",
+		place.Name, place.Country, fc.Current.Time, weatherCode(fc.Current.Code),
+		fc.Current.Temperature, tempUnit, fc.Current.Humidity, fc.Current.Wind, windUnit)
+	for i, day := range fc.Daily.Time {
+		if i >= len(fc.Daily.Max) || i >= len(fc.Daily.Min) || i >= len(fc.Daily.Precip) || i >= len(fc.Daily.Code) {
+			break
+		}
+		fmt.Fprintf(&b, "%s: %s, %.0f–%.0f%s, precipitation %.1f %s\n",
+			day, weatherCode(fc.Daily.Code[i]), fc.Daily.Min[i], fc.Daily.Max[i], tempUnit, fc.Daily.Precip[i], rainUnit)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// weatherCode describes a WMO weather interpretation code.
+func weatherCode(code int) string {
+	switch {
+	case code == 0:
+		return "clear sky"
+	case code <= 2:
+		return "partly cloudy"
+	case code == 3:
+		return "overcast"
+	case code <= 48:
+		return "fog"
+	case code <= 57:
+		return "drizzle"
+	case code <= 67:
+		return "rain"
+	case code <= 77:
+		return "snow"
+	case code <= 82:
+		return "rain showers"
+	case code <= 86:
+		return "snow showers"
+	default:
+		return "thunderstorm"
+	}
+}
+
+func getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+func init() {
+	registerTool(fetchURLTool{})
+	registerTool(webSearchTool{})
+}
+
+// WebConfig sets up fetch_url and web_search.
+type WebConfig struct {
+	// Fetch offers fetch_url. It is off by default, since text pasted,
+	// piped or attached into a conversation could get the model to send
+	// the conversation out in the URLs it fetches.
+	Fetch bool `yaml:"fetch"`
+	// Search is the API web_search uses: "brave" or "searxng". Without
+	// it, web_search is not offered.
+	Search string `yaml:"search"`
+	// URL is the SearXNG instance, which must have the JSON format
+	// turned on.
+	URL    string     `yaml:"url"`
+	APIKey Credential `yaml:"api_key"`
+	// MaxBytes caps how much of a page fetch_url downloads (default
+	// 2 MB).
+	MaxBytes int `yaml:"max_bytes"`
+	// AllowPrivate lets fetch_url reach addresses on the local network
+	// and this machine, which are refused by default so that text in a
+	// page can't steer the model into probing them.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+const defaultMaxFetch = 2 << 20
+
+// fetchURLTool downloads a web page and gives the model its text.
+type fetchURLTool struct{}
+
+func (fetchURLTool) external() bool { return true }
+
+func (fetchURLTool) configured() bool { return toolsConfig.Web.Fetch }
+
+func (fetchURLTool) Name() string { return "fetch_url" }
+
+func (fetchURLTool) Description() string {
+	return "Fetch a web page (http or https) and return its title and text, without markup. Plain text and JSON are returned as they are."
+}
+
+func (fetchURLTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{"type": "string"},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func (fetchURLTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		URL string `json:"url"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is not an http or https URL", in.URL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", appName)
+	req.Header.Set("Accept", "text/html, text/plain, application/json;q=0.9, */*;q=0.5")
+	resp, err := webClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u.Host, resp.Status)
+	}
+
+	limit := toolsConfig.Web.MaxBytes
+	if limit <= 0 {
+		limit = defaultMaxFetch
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return "", err
+	}
+	cut := len(data) > limit
+	if cut {
+		data = []byte(validUTF8Prefix(string(data), limit))
+	}
+	kind, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	text := string(data)
+	switch {
+	case kind == "text/html" || kind == "application/xhtml+xml":
+		title, body := htmlToText(text)
+		text = body
+		if title != "" {
+			text = "Title: " + title + "\n\n" + text
+		}
+	case strings.HasPrefix(kind, "text/") || strings.HasSuffix(kind, "json") || strings.HasSuffix(kind, "xml"):
+	default:
+		return "", fmt.Errorf("%s is %s, not a page with text", u, kind)
+	}
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "�")
+	}
+	header := "URL: " + resp.Request.URL.String() + "\n"
+	if cut {
+		header += fmt.Sprintf("(only the first %s of the page were downloaded)\n", formatBytes(limit))
+	}
+	return header + text, nil
+}
+
+var (
+	// htmlSkipped are elements whose content is not text to read.
+	htmlSkipped = regexp.MustCompile(`(?is)<(script|style|noscript|template|svg|head|nav|footer|iframe)\b.*?</(script|style|noscript|template|svg|head|nav|footer|iframe)\s*>|<!--.*?-->`)
+	htmlTitle   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlBreak   = regexp.MustCompile(`(?i)<(br|hr)\b[^>]*>|</?(p|div|section|article|main|header|aside|blockquote|pre|ul|ol|table|tr|form|h[1-6])\b[^>]*>`)
+	htmlItem    = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	htmlCell    = regexp.MustCompile(`(?i)</t[dh]\s*>`)
+	blankRuns   = regexp.MustCompile(`\n{3,}`)
+	spaceRuns   = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// htmlToText returns the title of an HTML page and its text, with block
+// elements on lines of their own and scripts, styles and navigation left
+// out. It is a heuristic for reading, not a parser.
+func htmlToText(page string) (title, text string) {
+	if m := htmlTitle.FindStringSubmatch(page); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(m[1], "")))
+	}
+	text = htmlSkipped.ReplaceAllString(page, " ")
+	text = htmlItem.ReplaceAllString(text, "\n- ")
+	text = htmlCell.ReplaceAllString(text, " | ")
+	text = htmlBreak.ReplaceAllString(text, "\n")
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, " "))
+	text = strings.ReplaceAll(text, " ", " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRuns.ReplaceAllString(line, " "))
+	}
+	text = blankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(text)
+}
+
+// webClient is the client fetch_url uses, built once so its idle
+// connections are reused. Unless allow_private is set, it refuses to
+// connect to loopback, private, shared (CGNAT) and link-local addresses,
+// checked on the address actually dialed so redirects and DNS can't get
+// around it.
+var webClient = sync.OnceValue(func() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: func(network, address string, _ syscall.RawConn) error {
+		if toolsConfig.Web.AllowPrivate {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || localAddress(ip) {
+			return fmt.Errorf("%s is a local address (set tools.web.allow_private to allow it)", host)
+		}
+		return nil
+	}}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{Transport: transport, Timeout: 60 * time.Second}
+})
+
+// sharedAddresses is the range carriers use for carrier-grade NAT, and
+// Tailscale for its devices (RFC 6598).
+var sharedAddresses = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// localAddress reports whether ip is one fetch_url must not reach.
+func localAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || sharedAddresses.Contains(ip)
+}
+
+// webSearchTool looks things up with the configured search API.
+type webSearchTool struct{}
+
+func (webSearchTool) external() bool { return true }
+
+func (webSearchTool) configured() bool { return toolsConfig.Web.Search != "" }
+
+func (webSearchTool) Name() string { return "web_search" }
+
+func (webSearchTool) Description() string {
+	return "Search the web and return the top results with their titles, URLs and snippets. Use fetch_url to read a result in full. " +
+		"Use it for current events and anything that may have changed since your training."
+}
+
+func (webSearchTool) Schema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{"type": "string"},
+			"count": map[string]any{"type": "integer", "description": "results to return (default 8, at most 20)"},
+		},
+		"required": []string{"query"},
+	}
+}
+
+// searchResult is a hit from either search API.
+type searchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"description"`
+	Content string `json:"content"`
+}
+
+func (webSearchTool) Execute(ctx context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+		Count int    `json:"count"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Query) == "" {
+		return "", errors.New("no query given")
+	}
+	count := in.Count
+	if count <= 0 {
+		count = 8
+	}
+	count = min(count, 20)
+
+	wc := toolsConfig.Web
+	var req *http.Request
+	var err error
+	switch wc.Search {
+	case "brave":
+		u := "https://api.search.brave.com/res/v1/web/search?" + url.Values{"q": {in.Query}, "count": {fmt.Sprint(count)}}.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err == nil {
+			key, kerr := wc.APIKey.resolve()
+			if kerr != nil {
+				return "", fmt.Errorf("tools.web.api_key: %w", kerr)
+			}
+			req.Header.Set("X-Subscription-Token", key)
+		}
+	case "searxng":
+		u := strings.TrimSuffix(wc.URL, "/") + "/search?" + url.Values{"q": {in.Query}, "format": {"json"}}.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	default:
+		return "", fmt.Errorf("unknown search API %q", wc.Search)
+	}
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", appName)
+	resp, err := apiHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+	var body struct {
+		Web struct {
+			Results []searchResult `json:"results"`
+		} `json:"web"`
+		Results []searchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%s: %v", req.URL.Host, err)
+	}
+	results := append(body.Web.Results, body.Results...)
+	if len(results) == 0 {
+		return "No results.", nil
+	}
+	var sb strings.Builder
+	for i, r := range results[:min(count, len(results))] {
+		snippet := r.Snippet
+		if snippet == "" {
+			snippet = r.Content
+		}
+		snippet = html.UnescapeString(htmlTag.ReplaceAllString(snippet, ""))
+		fmt.Fprintf(&sb, "%d. %s\n   %s\n   %s\n", i+1, strings.TrimSpace(r.Title), r.URL, strings.TrimSpace(snippet))
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
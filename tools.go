@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// Tool is a function the model may call. Schema describes the arguments
+// as a JSON Schema object; Execute receives them as raw JSON and returns
+// the text handed back to the model.
+type Tool interface {
+	Name() string
+	Description() string
+	Schema() map[string]any
+	Execute(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// maxToolRounds bounds how many times in a row the model may call tools
+// before it has to answer.
+const maxToolRounds = 8
+
+var tools = map[string]Tool{}
+
+func registerTool(t Tool) {
+	tools[t.Name()] = t
+}
+
+// ToolCall is a tool invocation requested by the model, stored on the
+// assistant message that made it.
+type ToolCall struct {
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr"`
+	Arguments string `xml:",chardata"`
+}
+
+// configuredTool is implemented by tools that only work once something is
+// set up in the config, such as a calendar to read. They are not offered
+// to the model until then.
+type configuredTool interface {
+	configured() bool
+}
+
+// externalTool is implemented by tools whose results come from outside
+// sources (a calendar invite, an MQTT payload) and may contain text written
+// to manipulate the model. Their results are marked untrusted.
+type externalTool interface {
+	external() bool
+}
+
+// statefulTool is implemented by tools that change things outside the
+// program, like switching a light. Calls to them are not independent, so
+// they run one at a time in the order the model asked for them.
+type statefulTool interface {
+	stateful() bool
+}
+
+// toolsConfig is the tools section of the config, for tools to read their
+// settings from; applyGlobals sets it.
+var toolsConfig ToolsConfig
+
+// enabledTools returns the registered tools minus those disabled in the
+// config, sorted by name so requests are stable.
+func (cfg *Config) enabledTools() []Tool {
+	var list []Tool
+	for name, t := range tools {
+		if ct, ok := t.(configuredTool); ok && !ct.configured() {
+			continue
+		}
+		if !cfg.Tools.isDisabled(name) {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+type ToolsConfig struct {
+	// Disabled lists tool names the model is not offered; "all" disables
+	// tool calling entirely.
+	Disabled []string `yaml:"disabled"`
+	// Parallel is how many tool calls from one answer run at once
+	// (default 4); 1 runs them one after another.
+	Parallel int `yaml:"parallel"`
+	// MaxResult is how many bytes of a tool's output the model gets
+	// (default 12000); longer output is shortened and kept on disk.
+	MaxResult int `yaml:"max_result"`
+	// Files are the directories read_file may list and read.
+	Files []string `yaml:"files"`
+	// Shell turns on run_shell, which runs commands you approve.
+	Shell ShellConfig `yaml:"shell"`
+	// Web sets up fetch_url and web_search.
+	Web WebConfig `yaml:"web"`
+
+	Weather       WeatherConfig             `yaml:"weather"`
+	Calendars     map[string]CalendarConfig `yaml:"calendars"`
+	HomeAssistant HomeAssistantConfig       `yaml:"home_assistant"`
+	MQTT          MQTTConfig                `yaml:"mqtt"`
+}
+
+func (tc ToolsConfig) isDisabled(name string) bool {
+	for _, d := range tc.Disabled {
+		if d == name || d == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+func toolParams(list []Tool) []openai.ChatCompletionToolParam {
+	params := make([]openai.ChatCompletionToolParam, 0, len(list))
+	for _, t := range list {
+		params = append(params, openai.ChatCompletionToolParam{
+			Type: openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(shared.FunctionDefinitionParam{
+				Name:        openai.F(t.Name()),
+				Description: openai.F(t.Description()),
+				Parameters:  openai.F(shared.FunctionParameters(t.Schema())),
+			}),
+		})
+	}
+	return params
+}
+
+// runToolCall executes one call and returns what the model is told. Errors
+// are reported to the model as text so it can correct itself. Only the
+// enabled tools run: a model may ask for one it wasn't offered, such as
+// a disabled tool or, after untrusted content, any tool.
+func runToolCall(ctx context.Context, call ToolCall, enabled []Tool, keep bool) string {
+	t, ok := tools[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+	if !slices.ContainsFunc(enabled, func(e Tool) bool { return e.Name() == call.Name }) {
+		return "error: tool not available"
+	}
+	result, err := t.Execute(ctx, json.RawMessage(call.Arguments))
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	result = fitToolResult(call, result, keep)
+	if et, ok := t.(externalTool); ok && et.external() {
+		return untrusted("tool "+call.Name, result)
+	}
+	return result
+}
+
+// runToolCalls runs the calls of one answer, independent ones in
+// parallel, and returns their results in the order of calls. keep saves
+// oversized outputs to disk; see fitToolResult.
+func runToolCalls(ctx context.Context, calls []ToolCall, enabled []Tool, keep bool) []string {
+	results := make([]string, len(calls))
+	parallel := toolsConfig.Parallel
+	if parallel <= 0 {
+		parallel = 4
+	}
+	var independent, stateful []int
+	for i, call := range calls {
+		if st, ok := tools[call.Name].(statefulTool); ok && st.stateful() {
+			stateful = append(stateful, i)
+		} else {
+			independent = append(independent, i)
+		}
+	}
+	if parallel == 1 || len(calls) == 1 {
+		for i, call := range calls {
+			results[i] = runToolCall(ctx, call, enabled, keep)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	// The stateful calls form one chain that takes a worker's place.
+	if len(stateful) > 0 {
+		parallel--
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range stateful {
+				results[i] = runToolCall(ctx, calls[i], enabled, keep)
+			}
+		}()
+	}
+	sem := make(chan struct{}, max(parallel, 1))
+	for _, i := range independent {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = runToolCall(ctx, calls[i], enabled, keep)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runApprovedToolCalls runs the calls the user didn't decline (see
+// confirmToolCalls) and tells the model about those they did.
+func runApprovedToolCalls(ctx context.Context, calls []ToolCall, enabled []Tool, approval map[int]string, keep bool) []string {
+	results := make([]string, len(calls))
+	var run []ToolCall
+	var at []int
+	for i, call := range calls {
+		if approval[i] == "declined" {
+			results[i] = "The user declined to run this."
+			continue
+		}
+		run = append(run, call)
+		at = append(at, i)
+	}
+	for j, result := range runToolCalls(ctx, run, enabled, keep) {
+		results[at[j]] = result
+	}
+	return results
+}
+
+// showToolCall prints a tool call and its result so the user can see
+// which parts of an answer were computed rather than generated.
+func showToolCall(call ToolCall, result string) {
+	if quiet {
+		return
+	}
+	if accessible {
+		fmt.Printf("Used tool %s with %s. Result: %s\n", call.Name, compactJSON(call.Arguments), truncate(result, 200))
+		return
+	}
+	fmt.Fprintln(os.Stdout, paint(theme.Meta, fmt.Sprintf("  ⚙ %s %s → %s", call.Name, compactJSON(call.Arguments), truncate(result, 200))))
+}
+
+func compactJSON(s string) string {
+	var v any
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return strings.TrimSpace(s)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// decodeArgs unmarshals tool arguments into v with a readable error.
+func decodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
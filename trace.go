@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TraceStep is one internal exchange behind a reply: a tool call, its
+// result, or a draft and critique with --reflect. Steps are stored on the
+// final message for debugging and never sent to the model.
+type TraceStep struct {
+	Label   string `xml:"label,attr" json:"label"`
+	Tokens  int64  `xml:"tokens,attr,omitempty" json:"tokens,omitempty"`
+	Content string `xml:",chardata" json:"content"`
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "trace",
+		usage: "/trace [n] | /trace export <file.json>",
+		help:  "Show the hidden steps behind the last reply (or message n), or export all traces",
+		run:   cmdTrace,
+	})
+}
+
+func cmdTrace(s *session, args string) error {
+	if rest, ok := strings.CutPrefix(args, "export"); ok {
+		return exportTraces(s.conv, strings.TrimSpace(rest))
+	}
+
+	n := -1
+	if args != "" {
+		i, err := strconv.Atoi(args)
+		if err != nil || i < 1 || i > len(s.conv.Messages) {
+			return fmt.Errorf("usage: /trace [n], where n is a message number as shown by 'show'")
+		}
+		n = i - 1
+	} else {
+		for i := len(s.conv.Messages) - 1; i >= 0; i-- {
+			if s.conv.Messages[i].Role == "assistant" && s.conv.Messages[i].Content != "" {
+				n = i
+				break
+			}
+		}
+	}
+	if n < 0 || len(s.conv.Messages[n].Trace) == 0 {
+		return fmt.Errorf("no trace for that message")
+	}
+	printTrace(s.conv.Messages[n].Trace)
+	return nil
+}
+
+func printTrace(steps []TraceStep) {
+	for _, step := range steps {
+		label := step.Label
+		if step.Tokens > 0 {
+			label += fmt.Sprintf(", %s tokens", formatTokens(step.Tokens))
+		}
+		fmt.Printf("%s\n%s\n\n", paint(theme.Meta, decor("── "+label+" ──", label+":")), step.Content)
+	}
+}
+
+// exportTraces writes every trace in the conversation to a JSON file,
+// keyed by message number.
+func exportTraces(conv *Conversation, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: /trace export <file.json>")
+	}
+	type entry struct {
+		Message int         `json:"message"`
+		Content string      `json:"content"`
+		Trace   []TraceStep `json:"trace"`
+	}
+	var out []entry
+	for i, m := range conv.Messages {
+		if len(m.Trace) > 0 {
+			out = append(out, entry{i + 1, m.Content, m.Trace})
+		}
+	}
+	if len(out) == 0 {
+		return fmt.Errorf("the conversation has no traces")
+	}
+	data, err := json.MarshalIndent(map[string]any{"conversation": conv.ID, "messages": out}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(expandHome(path), data, 0644); err != nil {
+		return err
+	}
+	info("Exported %d traces to %s\n", len(out), path)
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// maxAudioUpload is the transcription endpoint's upload limit. Longer
+// recordings are cut into chunkSeconds pieces with ffmpeg.
+const (
+	maxAudioUpload = 25 << 20
+	chunkSeconds   = 600
+)
+
+// transcriptSegment is a stretch of speech, in seconds from the start of
+// the recording.
+type transcriptSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "transcribe",
+		usage: "transcribe <audio> [--translate] [--format text|srt|vtt] [-o file]",
+		help:  "Transcribe an audio or video file, optionally translated to English",
+		run:   runTranscribe,
+	})
+	registerCommand(&command{
+		name:  "transcribe",
+		usage: "/transcribe <audio> [--translate]",
+		help:  "Transcribe a recording of any length and send the transcript with your next message",
+		run:   cmdTranscribe,
+	})
+}
+
+func runTranscribe(cfg *Config, args []string) int {
+	fs := newFlagSet("transcribe")
+	translate := fs.Bool("translate", false, "translate the speech to English")
+	format := fs.String("format", "", "output format: text, srt or vtt (default: from -o, else text)")
+	output := fs.String("o", "", "write the transcript to this file instead of stdout")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: transcribe <audio> [--translate] [--format text|srt|vtt] [-o file]")
+		return exitError
+	}
+	if *format == "" {
+		*format = "text"
+		if ext := strings.TrimPrefix(filepath.Ext(*output), "."); ext == "srt" || ext == "vtt" {
+			*format = ext
+		}
+	}
+	if *format != "text" && *format != "srt" && *format != "vtt" {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, srt or vtt)\n", *format)
+		return exitError
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	segments, err := transcribeAudio(context.Background(), client, rest[0], *translate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	out := formatTranscript(segments, *format)
+	if *output == "" {
+		fmt.Print(out)
+		return exitOK
+	}
+	if err := os.WriteFile(*output, []byte(out), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	info("Transcript written to %s\n", *output)
+	return exitOK
+}
+
+func cmdTranscribe(s *session, args string) error {
+	translate := false
+	var path string
+	for _, f := range strings.Fields(args) {
+		if f == "--translate" {
+			translate = true
+		} else {
+			path = f
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: /transcribe <audio> [--translate]")
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	segments, err := transcribeAudio(ctx, s.client, expandHome(path), translate)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	text := formatTranscript(segments, "text")
+	s.context = append(s.context, untrusted("transcript of "+name, text))
+	info("Attached transcript of %s (%d words); it is sent with your next message\n", name, len(strings.Fields(text)))
+	return nil
+}
+
+// transcribeAudio transcribes (or translates to English) a recording.
+// Files over the upload limit are split into chunks with ffmpeg and the
+// segment times shifted back onto the whole recording's timeline.
+func transcribeAudio(ctx context.Context, client *openai.Client, path string, translate bool) ([]transcriptSegment, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	type chunk struct {
+		path  string
+		start float64
+	}
+	chunks := []chunk{{path, 0}}
+	if fi.Size() > maxAudioUpload {
+		dir, err := os.MkdirTemp("", "chat-cli-audio")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		parts, starts, err := splitAudio(ctx, path, dir)
+		if err != nil {
+			return nil, err
+		}
+		chunks = chunks[:0]
+		for i := range parts {
+			chunks = append(chunks, chunk{parts[i], starts[i]})
+		}
+	}
+
+	var all []transcriptSegment
+	for i, c := range chunks {
+		if len(chunks) > 1 {
+			info("Transcribing part %d of %d...\n", i+1, len(chunks))
+		}
+		segments, err := transcribeChunk(ctx, client, c.path, translate)
+		if err != nil {
+			return nil, fmt.Errorf("transcribing %s: %w", filepath.Base(path), err)
+		}
+		for _, s := range segments {
+			s.Start += c.start
+			s.End += c.start
+			all = append(all, s)
+		}
+	}
+	return all, nil
+}
+
+func transcribeChunk(ctx context.Context, client *openai.Client, path string, translate bool) ([]transcriptSegment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw string
+	if translate {
+		t, err := client.Audio.Translations.New(ctx, openai.AudioTranslationNewParams{
+			File:           openai.F[io.Reader](f),
+			Model:          openai.F(openai.AudioModelWhisper1),
+			ResponseFormat: openai.F(openai.AudioResponseFormatVerboseJSON),
+		})
+		if err != nil {
+			return nil, err
+		}
+		raw = t.JSON.RawJSON()
+	} else {
+		t, err := client.Audio.Transcriptions.New(ctx, openai.AudioTranscriptionNewParams{
+			File:           openai.F[io.Reader](f),
+			Model:          openai.F(openai.AudioModelWhisper1),
+			ResponseFormat: openai.F(openai.AudioResponseFormatVerboseJSON),
+		})
+		if err != nil {
+			return nil, err
+		}
+		raw = t.JSON.RawJSON()
+	}
+
+	var resp struct {
+		Text     string              `json:"text"`
+		Duration float64             `json:"duration"`
+		Segments []transcriptSegment `json:"segments"`
+	}
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return nil, fmt.Errorf("unexpected response: %w", err)
+	}
+	if len(resp.Segments) == 0 && strings.TrimSpace(resp.Text) != "" {
+		resp.Segments = []transcriptSegment{{End: resp.Duration, Text: resp.Text}}
+	}
+	for i := range resp.Segments {
+		resp.Segments[i].Text = strings.TrimSpace(resp.Segments[i].Text)
+	}
+	return resp.Segments, nil
+}
+
+// splitAudio re-encodes a recording as small mono MP3 chunks in dir and
+// returns their paths and start times. Re-encoding rather than copying
+// the stream keeps each chunk well under the upload limit and works for
+// video files too.
+func splitAudio(ctx context.Context, path, dir string) ([]string, []float64, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, nil, fmt.Errorf("%s is over %d MB; splitting it needs ffmpeg", filepath.Base(path), maxAudioUpload>>20)
+	}
+	list := filepath.Join(dir, "chunks.csv")
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-loglevel", "error", "-i", path,
+		"-vn", "-ac", "1", "-ar", "16000", "-b:a", "48k",
+		"-f", "segment", "-segment_time", strconv.Itoa(chunkSeconds), "-reset_timestamps", "1",
+		"-segment_list", list, "-segment_list_type", "csv",
+		filepath.Join(dir, "part%03d.mp3"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	f, err := os.Open(list)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ffmpeg segment list: %w", err)
+	}
+	var parts []string
+	var starts []float64
+	for _, r := range records {
+		if len(r) < 2 {
+			continue
+		}
+		start, err := strconv.ParseFloat(r[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ffmpeg segment list: %w", err)
+		}
+		parts = append(parts, filepath.Join(dir, r[0]))
+		starts = append(starts, start)
+	}
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("ffmpeg produced no audio from %s", filepath.Base(path))
+	}
+	return parts, starts, nil
+}
+
+// formatTranscript renders segments as plain text, SubRip or WebVTT.
+func formatTranscript(segments []transcriptSegment, format string) string {
+	var b strings.Builder
+	if format == "vtt" {
+		b.WriteString("WEBVTT\n\n")
+	}
+	for i, s := range segments {
+		switch format {
+		case "srt":
+			fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, subtitleTime(s.Start, ","), subtitleTime(s.End, ","), s.Text)
+		case "vtt":
+			fmt.Fprintf(&b, "%s --> %s\n%s\n\n", subtitleTime(s.Start, "."), subtitleTime(s.End, "."), s.Text)
+		default:
+			b.WriteString(s.Text)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// subtitleTime formats seconds as hh:mm:ss followed by sep and
+// milliseconds: a comma for SRT, a dot for VTT.
+func subtitleTime(seconds float64, sep string) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+var tuiFlag = flag.Bool("tui", false, "full-screen mode with a scrollable history, an input box and a status bar")
+
+const (
+	// tuiScrollback is how many lines of output the history keeps.
+	tuiScrollback = 10000
+	// tuiSync is written to the captured output to learn when everything
+	// printed before it has reached the history. It is an APC sequence,
+	// which terminals ignore.
+	tuiSync = "\x1b_chat-cli-sync\x1b\\"
+)
+
+// tui is the full-screen mode. It takes over the terminal's alternate
+// screen and captures stdout and stderr, so everything the session prints
+// lands in a history pane that can be scrolled. Input is read with the
+// line editor's keymap in a box under a status bar.
+type tui struct {
+	out            *os.File // the terminal
+	stdout, stderr *os.File // what os.Stdout and os.Stderr were
+	pipe           *os.File // where os.Stdout and os.Stderr write now
+	fd             int
+	state          *term.State
+	ed             *editor
+	keys           chan tuiKey
+	synced         chan struct{}
+	drained        chan struct{}
+	done           chan struct{}
+
+	// status returns the status bar's text. It is called on each prompt,
+	// from the goroutine that reads input.
+	status func() string
+
+	mu      sync.Mutex
+	lines   []string // finished lines of output
+	partial string   // the line being printed
+	held    []byte   // an escape sequence or character split by a read
+	scroll  int      // rows scrolled up from the bottom
+	width   int
+	height  int
+	prompt  string
+	reading bool
+	bar     string
+	// mark is where the output since the last submitted line starts; it
+	// is printed again on leaving, so the goodbye stays on screen.
+	mark    int
+	cancels []context.CancelFunc
+	// err ends input once the keyboard can't be read.
+	err error
+}
+
+type tuiKey struct {
+	key   string
+	paste string
+	err   error
+}
+
+// newTUI switches the terminal to full-screen mode. Close restores it.
+func newTUI(cfg *Config) (*tui, error) {
+	fd := int(os.Stdin.Fd())
+	if quiet || accessible || headless || !consoleVT || !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, errors.New("the full-screen mode needs a terminal")
+	}
+	km, err := newKeymap(cfg.Keybindings)
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	t := &tui{
+		out:    os.Stdout,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		pipe:   w,
+		fd:     fd,
+		state:  state,
+		// Keys arrive through t.keys, and pastes are bracketed, so the
+		// editor's own reader is never read.
+		ed:      &editor{in: bufio.NewReader(strings.NewReader("")), out: io.Discard, fd: fd, keys: km},
+		keys:    make(chan tuiKey, 256),
+		synced:  make(chan struct{}, 1),
+		drained: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	t.width, t.height = t.size()
+	fmt.Fprint(t.out, "\x1b[?1049h"+pasteOn)
+	os.Stdout, os.Stderr = w, w
+	go t.capture(r)
+	go t.readKeys(bufio.NewReader(os.Stdin))
+	go t.watchSize()
+	return t, nil
+}
+
+// close leaves full-screen mode and prints the output that followed the
+// last submitted line on the normal screen.
+func (t *tui) close() {
+	t.sync()
+	os.Stdout, os.Stderr = t.stdout, t.stderr
+	t.pipe.Close()
+	<-t.drained
+	close(t.done)
+	fmt.Fprint(t.out, pasteOff+"\x1b[?25h\x1b[?1049l")
+	term.Restore(t.fd, t.state)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tail := t.lines[min(t.mark, len(t.lines)):]
+	if t.partial != "" {
+		tail = append(tail, t.partial)
+	}
+	for _, line := range tail {
+		fmt.Fprintln(t.out, line+"\x1b[0m")
+	}
+}
+
+func (t *tui) size() (int, int) {
+	w, h, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// sync waits until everything printed so far is in the history.
+func (t *tui) sync() {
+	fmt.Fprint(t.pipe, tuiSync)
+	<-t.synced
+}
+
+func (t *tui) ReadLine(prompt string) (string, error) {
+	if t.err != nil {
+		return "", t.err
+	}
+	t.sync()
+	t.mu.Lock()
+	if t.status != nil {
+		t.bar = t.status()
+	}
+	t.prompt, t.reading = prompt, true
+	t.ed.buf, t.ed.pos, t.ed.normal, t.ed.pasted = nil, 0, false, false
+	t.ed.resetRecall()
+	t.draw()
+	t.mu.Unlock()
+
+	for ev := range t.keys {
+		t.mu.Lock()
+		line, done, err := t.handle(ev)
+		if done || err != nil {
+			t.reading = false
+			if err == nil {
+				t.lines = append(t.lines, strings.Split(prompt+line, "\n")...)
+				t.mark, t.scroll = len(t.lines), 0
+			}
+		}
+		t.draw()
+		t.mu.Unlock()
+		if done || err != nil {
+			return line, err
+		}
+	}
+	return "", io.EOF
+}
+
+func (t *tui) Typed() bool { return t.ed.Typed() }
+
+// handle applies a key to the input box. Ctrl+O and Ctrl+N on an empty
+// line switch to another conversation or start a new one.
+func (t *tui) handle(ev tuiKey) (string, bool, error) {
+	switch {
+	case ev.err != nil:
+		t.err = ev.err
+		return "", false, ev.err
+	case ev.key == "paste":
+		if !t.ed.normal {
+			t.ed.insert([]rune(ev.paste)...)
+			t.ed.pasted = true
+		}
+		return "", false, nil
+	case len(t.ed.buf) == 0 && t.ed.keys.panes[ev.key] == actSwitch:
+		return "/switch", true, nil
+	case len(t.ed.buf) == 0 && t.ed.keys.panes[ev.key] == actNew:
+		return "/clear", true, nil
+	}
+	line, done, err := t.ed.handle(ev.key, t.prompt)
+	if errors.Is(err, errCancelled) {
+		t.ed.buf, t.ed.pos = nil, 0
+		t.ed.resetRecall()
+		return "", false, nil
+	}
+	return line, done, err
+}
+
+// readKeys reads the keyboard for as long as the program runs. Scrolling
+// works at any time, and the cancel keys cancel the request in progress;
+// other keys wait for the next prompt.
+func (t *tui) readKeys(in *bufio.Reader) {
+	for {
+		k, err := readKey(in)
+		if err != nil {
+			t.keys <- tuiKey{err: err}
+			return
+		}
+		ev := tuiKey{key: k}
+		switch k {
+		case "":
+			continue
+		case "paste":
+			if ev.paste, err = readPaste(in); err != nil {
+				t.keys <- tuiKey{err: err}
+				return
+			}
+		case "pgup", "pgdn":
+			t.mu.Lock()
+			page := max(1, t.height/2)
+			if k == "pgdn" {
+				page = -page
+			}
+			t.scroll = max(0, t.scroll+page)
+			t.draw()
+			t.mu.Unlock()
+			continue
+		}
+		if t.ed.keys.cancels(k) {
+			t.mu.Lock()
+			cancels := t.cancels
+			t.mu.Unlock()
+			if len(cancels) > 0 {
+				for _, cancel := range cancels {
+					cancel()
+				}
+				continue
+			}
+		}
+		t.keys <- ev
+	}
+}
+
+// cancellable lets the cancel keys cancel ctx: the terminal is raw, so
+// Ctrl+C doesn't interrupt the program. A nil *tui leaves ctx as it is.
+func (t *tui) cancellable(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	t.cancels = append(t.cancels, cancel)
+	t.mu.Unlock()
+	return ctx, func() {
+		t.mu.Lock()
+		t.cancels = t.cancels[:max(0, len(t.cancels)-1)]
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+func (t *tui) watchSize() {
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-tick.C:
+		}
+		w, h := t.size()
+		t.mu.Lock()
+		if w != t.width || h != t.height {
+			t.width, t.height = w, h
+			t.draw()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// capture moves what the session prints into the history.
+func (t *tui) capture(r *os.File) {
+	defer close(t.drained)
+	defer r.Close()
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			t.feed(buf[:n])
+			t.draw()
+			t.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// feed adds output to the history. Colors are kept, a carriage return
+// starts the line over, and other cursor movement is dropped. Terminal
+// commands such as copying to the clipboard go straight to the terminal.
+func (t *tui) feed(data []byte) {
+	data = append(t.held, data...)
+	t.held = nil
+	cut := len(data)
+	if i := bytes.LastIndexByte(data, 0x1b); i >= 0 && escapeLen(string(data[i:])) < 0 {
+		cut = i
+	} else if cut > 0 && data[cut-1] == '\r' {
+		cut--
+	} else {
+		for k := 1; k <= 3 && k <= cut; k++ {
+			if utf8.RuneStart(data[cut-k]) {
+				if !utf8.FullRune(data[cut-k : cut]) {
+					cut -= k
+				}
+				break
+			}
+		}
+	}
+	t.held = append([]byte(nil), data[cut:]...)
+
+	s := string(data[:cut])
+	var line strings.Builder
+	line.WriteString(t.partial)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == 0x1b:
+			n := max(escapeLen(s[i:]), 1)
+			seq := s[i : i+n]
+			switch {
+			case seq == tuiSync:
+				select {
+				case t.synced <- struct{}{}:
+				default:
+				}
+			case strings.HasPrefix(seq, "\x1b]"):
+				t.out.WriteString(seq)
+			case strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m"):
+				line.WriteString(seq)
+			}
+			i += n
+			continue
+		case c == '\n':
+			t.lines = append(t.lines, line.String())
+			line.Reset()
+		case c == '\r':
+			if i+1 >= len(s) || s[i+1] != '\n' {
+				line.Reset()
+			}
+		case c == '\t':
+			line.WriteString("    ")
+		case c >= 0x20 && c != 0x7f:
+			_, n := utf8.DecodeRuneInString(s[i:])
+			line.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		i++
+	}
+	t.partial = line.String()
+	if extra := len(t.lines) - tuiScrollback; extra > 0 {
+		t.lines = append(t.lines[:0], t.lines[extra:]...)
+		t.mark = max(0, t.mark-extra)
+	}
+}
+
+// escapeLen returns the length of the escape sequence s starts with, or
+// -1 if it is cut short.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return -1
+	}
+	switch s[1] {
+	case '[':
+		for j := 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j + 1
+			}
+		}
+	case ']', '_':
+		for j := 2; j < len(s); j++ {
+			if s[j] == 0x07 {
+				return j + 1
+			}
+			if s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 2
+			}
+		}
+	default:
+		return 2
+	}
+	return -1
+}
+
+// draw repaints the screen: the history pane, the status bar and the
+// input box, which grows up to a third of the screen. t.mu must be held.
+func (t *tui) draw() {
+	w, h := t.width, t.height
+	if h < 3 {
+		return
+	}
+	var input []string
+	curRow, curCol := 0, 0
+	if t.reading {
+		text := t.prompt + string(t.ed.buf)
+		input = wrapRows(text, w)
+		curRow, curCol = layout(t.prompt+string(t.ed.buf[:t.ed.pos]), w)
+		if curCol == w {
+			curRow, curCol = curRow+1, 0
+		}
+		for len(input) <= curRow {
+			input = append(input, "")
+		}
+	} else {
+		working := "Working…"
+		if k := t.ed.keys.keyFor(t.ed.keys.insert, actCancel); k != "" {
+			working += " " + keyLabel(k) + " cancels"
+		}
+		input = []string{paint(theme.Meta, working)}
+	}
+	maxInput := max(1, h/3)
+	first := max(0, curRow+1-maxInput)
+	input = input[first:min(len(input), first+maxInput)]
+	curRow -= first
+	pane := h - 1 - len(input)
+
+	// Only the lines that can be on screen are wrapped.
+	var rows []string
+	need := pane + t.scroll
+	if t.partial != "" {
+		rows = wrapRows(t.partial, w)
+	}
+	for i := len(t.lines) - 1; i >= 0 && len(rows) < need; i-- {
+		rows = append(wrapRows(t.lines[i], w), rows...)
+	}
+	if len(rows) < need {
+		t.scroll = max(0, len(rows)-pane)
+	}
+	end := len(rows) - t.scroll
+	rows = rows[max(0, end-pane):end]
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[?25l")
+	for i := range pane {
+		fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[2K", i+1)
+		if i < len(rows) {
+			sb.WriteString(rows[i] + "\x1b[0m")
+		}
+	}
+	bar := t.bar
+	if t.scroll > 0 {
+		bar += fmt.Sprintf(" │ ↑ %d", t.scroll)
+	}
+	fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[2K\x1b[%sm%s\x1b[0m", pane+1, theme.Status, statusBar(bar, t.hints(), w))
+	for i, row := range input {
+		fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[2K%s\x1b[0m", pane+2+i, row)
+	}
+	if t.reading {
+		fmt.Fprintf(&sb, "\x1b[%d;%dH\x1b[?25h", pane+2+curRow, curCol+1)
+	}
+	t.out.WriteString(sb.String())
+}
+
+// hints names the keys of the full-screen mode for the status bar.
+func (t *tui) hints() string {
+	hints := "PgUp/PgDn scroll"
+	if k := t.ed.keys.keyFor(t.ed.keys.panes, actSwitch); k != "" {
+		hints += " · " + keyLabel(k) + " switch"
+	}
+	if k := t.ed.keys.keyFor(t.ed.keys.panes, actNew); k != "" {
+		hints += " · " + keyLabel(k) + " new"
+	}
+	return hints
+}
+
+// statusBar fits text and, if there is room, hints on the right into a
+// row of the given width.
+func statusBar(text, hints string, width int) string {
+	text = " " + text + " "
+	n, m := utf8.RuneCountInString(text), utf8.RuneCountInString(hints)+1
+	if n+m <= width {
+		return text + strings.Repeat(" ", width-n-m) + hints + " "
+	}
+	if n > width {
+		return string([]rune(text)[:width])
+	}
+	return text + strings.Repeat(" ", width-n)
+}
+
+// wrapRows splits s into screen rows of the given width, the way layout
+// counts them. Colors carry over to the rows a line wraps onto.
+func wrapRows(s string, width int) []string {
+	var rows []string
+	for _, line := range strings.Split(s, "\n") {
+		var row strings.Builder
+		sgr, col := "", 0
+		for i := 0; i < len(line); {
+			if line[i] == 0x1b {
+				n := max(escapeLen(line[i:]), 1)
+				seq := line[i : i+n]
+				row.WriteString(seq)
+				if seq == "\x1b[0m" || seq == "\x1b[m" {
+					sgr = ""
+				} else if strings.HasSuffix(seq, "m") {
+					sgr += seq
+				}
+				i += n
+				continue
+			}
+			if col == width {
+				rows = append(rows, row.String())
+				row.Reset()
+				row.WriteString(sgr)
+				col = 0
+			}
+			_, n := utf8.DecodeRuneInString(line[i:])
+			row.WriteString(line[i : i+n])
+			col++
+			i += n
+		}
+		rows = append(rows, row.String())
+	}
+	return rows
+}
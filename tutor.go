@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// tutorIntervals are the review intervals of the Leitner boxes: a topic
+// answered correctly moves up a box and waits longer; a wrong answer sends
+// it back to the first.
+var tutorIntervals = []time.Duration{
+	24 * time.Hour,
+	2 * 24 * time.Hour,
+	4 * 24 * time.Hour,
+	8 * 24 * time.Hour,
+	16 * 24 * time.Hour,
+	32 * 24 * time.Hour,
+}
+
+// tutorMistakesKept is how many wrong answers per topic are remembered to
+// aim later questions at.
+const tutorMistakesKept = 10
+
+const tutorAskPrompt = `You are a patient tutor. Ask the student one question about the topic below that can be answered in a sentence or two. ` +
+	`Vary the questions. If the student's past mistakes are listed, prefer questions that check whether they now understand those points. ` +
+	`Write only the question.`
+
+const tutorGradePrompt = `You are a patient tutor grading a student's answer. Be fair about wording; what matters is understanding. ` +
+	`Answer with only JSON: {"correct": true, "feedback": "one or two sentences: what was right or wrong, and the correct answer if needed"}`
+
+type tutorTopic struct {
+	Box      int            `json:"box"`
+	Due      time.Time      `json:"due"`
+	Correct  int            `json:"correct"`
+	Wrong    int            `json:"wrong"`
+	Mistakes []tutorMistake `json:"mistakes,omitempty"`
+}
+
+type tutorMistake struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "tutor",
+		usage: "tutor [topic] [--questions n] [--list] [--forget topic]",
+		help:  "Quiz yourself, repeating topics you got wrong sooner",
+		run:   runTutor,
+	})
+}
+
+func tutorPath() string {
+	return filepath.Join(dataDir, "tutor.json")
+}
+
+func loadTutor() (map[string]*tutorTopic, error) {
+	topics := map[string]*tutorTopic{}
+	data, err := os.ReadFile(tutorPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return topics, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &topics); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", tutorPath(), err)
+	}
+	return topics, nil
+}
+
+func saveTutor(topics map[string]*tutorTopic) error {
+	data, err := json.MarshalIndent(topics, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(tutorPath(), data, 0644)
+}
+
+func runTutor(cfg *Config, args []string) int {
+	fs := newFlagSet("tutor")
+	perTopic := fs.Int("questions", 3, "questions per topic")
+	list := fs.Bool("list", false, "list topics and when they are due")
+	forget := fs.String("forget", "", "stop tracking a topic")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	topics, err := loadTutor()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	now := time.Now()
+
+	switch {
+	case *list:
+		printTutorTopics(topics, now)
+		return exitOK
+	case *forget != "":
+		if _, ok := topics[*forget]; !ok {
+			fmt.Fprintf(os.Stderr, "Error: no topic %q\n", *forget)
+			return exitError
+		}
+		delete(topics, *forget)
+		if err := saveTutor(topics); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	// A named topic is studied now; otherwise whatever is due.
+	var queue []string
+	if len(rest) > 0 {
+		name := strings.Join(rest, " ")
+		if topics[name] == nil {
+			topics[name] = &tutorTopic{Due: now}
+		}
+		queue = []string{name}
+	} else {
+		for name, t := range topics {
+			if !t.Due.After(now) {
+				queue = append(queue, name)
+			}
+		}
+		sort.Slice(queue, func(i, j int) bool { return topics[queue[i]].Due.Before(topics[queue[j]].Due) })
+	}
+	if len(queue) == 0 {
+		fmt.Println("Nothing is due. Start a topic with: tutor <topic>")
+		printTutorTopics(topics, now)
+		return exitOK
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	tutor := &tutorSession{client: client, model: cfg.baseModel(), in: bufio.NewReader(os.Stdin)}
+	info("Answer each question; an empty line skips it, 'quit' stops.\n\n")
+
+	code := exitOK
+	for _, name := range queue {
+		t := topics[name]
+		fmt.Printf("%s\n", paint(theme.Heading, "Topic: "+name))
+		right, asked, quit, err := tutor.quiz(name, t, *perTopic)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			code = exitAPIError
+		}
+		if asked > 0 {
+			t.schedule(right == asked, time.Now())
+			fmt.Printf("%d of %d right; next review %s\n\n", right, asked, t.Due.Format("Mon 2006-01-02"))
+		}
+		if quit || err != nil {
+			break
+		}
+	}
+	if err := saveTutor(topics); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return code
+}
+
+// schedule moves a topic between boxes after a round of questions.
+func (t *tutorTopic) schedule(allRight bool, now time.Time) {
+	if allRight {
+		t.Box = min(t.Box+1, len(tutorIntervals)-1)
+	} else {
+		t.Box = 0
+	}
+	t.Due = now.Add(tutorIntervals[t.Box])
+}
+
+func printTutorTopics(topics map[string]*tutorTopic, now time.Time) {
+	names := make([]string, 0, len(topics))
+	for name := range topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := topics[name]
+		due := t.Due.Format("2006-01-02")
+		if !t.Due.After(now) {
+			due = "now"
+		}
+		fmt.Printf("%-30s due %-10s  box %d  %d right, %d wrong\n", name, due, t.Box+1, t.Correct, t.Wrong)
+	}
+}
+
+type tutorSession struct {
+	client *openai.Client
+	model  string
+	in     *bufio.Reader
+}
+
+// quiz asks up to n questions on a topic and records the results.
+func (ts *tutorSession) quiz(name string, t *tutorTopic, n int) (right, asked int, quit bool, err error) {
+	ctx := context.Background()
+	var previous []string
+	for i := 0; i < n; i++ {
+		var prompt strings.Builder
+		fmt.Fprintf(&prompt, "Topic: %s\n", name)
+		for _, m := range t.Mistakes {
+			fmt.Fprintf(&prompt, "Past mistake: asked %q, answered %q\n", m.Question, m.Answer)
+		}
+		for _, q := range previous {
+			fmt.Fprintf(&prompt, "Already asked this session: %s\n", q)
+		}
+		r, err := ask(ctx, ts.client, ts.model, tutorAskPrompt, prompt.String())
+		if err != nil {
+			return right, asked, false, err
+		}
+		question := strings.TrimSpace(r.content)
+		previous = append(previous, question)
+		fmt.Printf("\n%s %s\n", paint(theme.Assistant, "Q:"), question)
+
+		fmt.Print(paint(theme.User, "A: "))
+		answer, readErr := ts.in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if (readErr != nil && answer == "") || answer == "quit" {
+			return right, asked, true, nil
+		}
+		if answer == "" {
+			continue
+		}
+
+		r, err = ask(ctx, ts.client, ts.model, tutorGradePrompt,
+			fmt.Sprintf("Topic: %s\nQuestion: %s\nStudent's answer: %s", name, question, answer))
+		if err != nil {
+			return right, asked, false, err
+		}
+		var grade struct {
+			Correct  bool   `json:"correct"`
+			Feedback string `json:"feedback"`
+		}
+		if err := json.Unmarshal([]byte(stripCodeFence(r.content)), &grade); err != nil {
+			return right, asked, false, fmt.Errorf("the model's grade is not the expected JSON: %v", err)
+		}
+		asked++
+		if grade.Correct {
+			right++
+			t.Correct++
+			fmt.Printf("%s %s\n", paint(theme.Good, "Right."), grade.Feedback)
+		} else {
+			t.Wrong++
+			t.Mistakes = append(t.Mistakes, tutorMistake{question, answer})
+			if len(t.Mistakes) > tutorMistakesKept {
+				t.Mistakes = t.Mistakes[len(t.Mistakes)-tutorMistakesKept:]
+			}
+			fmt.Printf("%s %s\n", paint(theme.Bad, "Not quite."), grade.Feedback)
+		}
+	}
+	return right, asked, false, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesURL is where update looks for new versions.
+const releasesURL = "https://api.github.com/repos/oivindkulsrud/golang-cli-chat/releases/latest"
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "update",
+		usage: "update [--check] [--force]",
+		help:  "Replace this binary with the latest release, after verifying its checksum",
+		run:   runUpdate,
+	})
+}
+
+func runUpdate(cfg *Config, args []string) int {
+	fs := newFlagSet("update")
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	force := fs.Bool("force", false, "install the latest release even if it is not newer")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var rel release
+	if err := getJSON(ctx, releasesURL, &rel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: checking for releases: %v\n", err)
+		return exitAPIError
+	}
+	latest := strings.TrimPrefix(rel.TagName, "v")
+	if !*force && !newerVersion(latest, version) {
+		fmt.Printf("%s %s is up to date (latest release: %s)\n", appName, version, latest)
+		return exitOK
+	}
+	if *check {
+		fmt.Printf("%s %s is available (you have %s)\n", appName, latest, version)
+		return exitOK
+	}
+	if version == "dev" && !*force {
+		fmt.Fprintln(os.Stderr, "Error: this is a development build; use --force to replace it with a release")
+		return exitError
+	}
+
+	name := fmt.Sprintf("%s_%s_%s", appName, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	var binURL, sumsURL string
+	for _, a := range rel.Assets {
+		switch a.Name {
+		case name:
+			binURL = a.URL
+		case "checksums.txt":
+			sumsURL = a.URL
+		}
+	}
+	if binURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: release %s has no build for %s/%s\n", latest, runtime.GOOS, runtime.GOARCH)
+		return exitError
+	}
+	if sumsURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: release %s has no checksums.txt to verify against\n", latest)
+		return exitError
+	}
+
+	info("Downloading %s %s...\n", appName, latest)
+	sums, err := download(ctx, sumsURL, 1<<20)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	want := checksumFor(sums, name)
+	if want == "" {
+		fmt.Fprintf(os.Stderr, "Error: checksums.txt does not list %s\n", name)
+		return exitError
+	}
+	bin, err := download(ctx, binURL, 256<<20)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitAPIError
+	}
+	if got := sha256Hex(bin); got != want {
+		fmt.Fprintf(os.Stderr, "Error: checksum mismatch for %s (expected %s, got %s); nothing was changed\n", name, want, got)
+		return exitError
+	}
+
+	if err := replaceExecutable(bin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Updated %s from %s to %s\n", appName, version, latest)
+	return exitOK
+}
+
+// replaceExecutable swaps the running binary for bin. The new file is
+// written next to it and renamed over it, so an interrupted update leaves
+// the old binary in place. Windows cannot replace a running executable,
+// but it can rename it, so the old one is moved aside first.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, bin, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("cannot write next to %s (installed by a package manager? update it there): %w", exe, err)
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", appName)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// checksumFor finds name in a sha256sum-style listing.
+func checksumFor(sums []byte, name string) string {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+// newerVersion compares dotted version numbers; anything is newer than a
+// development build.
+func newerVersion(latest, current string) bool {
+	if current == "dev" {
+		return true
+	}
+	a, b := strings.Split(latest, "."), strings.Split(strings.TrimPrefix(current, "v"), ".")
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x, _ = strconv.Atoi(a[i])
+		}
+		if i < len(b) {
+			y, _ = strconv.Atoi(b[i])
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Usage totals the tokens of the requests made for a conversation and
+// their estimated cost. Every request counts: tool rounds, continuations,
+// and the extra calls of --reflect and --verify as well as the answers.
+type Usage struct {
+	Requests         int64 `xml:"requests,attr"`
+	PromptTokens     int64 `xml:"prompt_tokens,attr"`
+	CompletionTokens int64 `xml:"completion_tokens,attr"`
+	// CachedTokens are the part of PromptTokens read from the prompt
+	// cache, and SavedUSD what that saved. CacheWriteTokens were written
+	// to the cache, which costs more than sending them.
+	CachedTokens     int64   `xml:"cached_tokens,attr,omitempty"`
+	SavedUSD         float64 `xml:"saved_usd,attr,omitempty"`
+	CacheWriteTokens int64   `xml:"cache_write_tokens,attr,omitempty"`
+	// CostUSD is estimated from the price table; requests to models it
+	// doesn't know are counted in Unpriced instead.
+	CostUSD  float64 `xml:"cost_usd,attr"`
+	Unpriced int64   `xml:"unpriced,attr,omitempty"`
+}
+
+func init() {
+	registerCommand(&command{
+		name:  "usage",
+		usage: "/usage",
+		help:  "Show the tokens and estimated cost of this session and conversation",
+		run:   cmdUsage,
+	})
+}
+
+// add counts one request made with model.
+func (u *Usage) add(model string, r *reply) {
+	u.Requests++
+	u.PromptTokens += r.promptTokens
+	u.CompletionTokens += r.completionTokens
+	u.CachedTokens += r.cachedTokens
+	u.CacheWriteTokens += r.cacheWriteTokens + r.longCacheWriteTokens
+	if m, ok := lookupModel(model); ok {
+		u.CostUSD += m.cost(r.tokens())
+		u.SavedUSD += m.saving(r.cachedTokens)
+	} else {
+		u.Unpriced++
+	}
+}
+
+func (u Usage) String() string {
+	s := fmt.Sprintf("%s, %s prompt + %s completion tokens, $%.4f",
+		plural(u.Requests, "request"), formatTokens(u.PromptTokens), formatTokens(u.CompletionTokens), u.CostUSD)
+	if u.CachedTokens > 0 {
+		s += fmt.Sprintf("; %s prompt tokens cached, saving $%.4f", formatTokens(u.CachedTokens), u.SavedUSD)
+	}
+	if u.CacheWriteTokens > 0 {
+		s += fmt.Sprintf("; %s written to the cache", formatTokens(u.CacheWriteTokens))
+	}
+	if u.Unpriced > 0 {
+		s += fmt.Sprintf(" (not counting %s to models without prices)", plural(u.Unpriced, "request"))
+	}
+	return s
+}
+
+// plural counts n of noun, e.g. "1 request" or "3 requests".
+func plural(n int64, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func cmdUsage(s *session, args string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session:       %s\n", s.usage.Usage)
+	if s.conv.Usage != nil {
+		fmt.Fprintf(&b, "Conversation:  %s\n", *s.conv.Usage)
+	}
+	if m, ok := lookupModel(s.model); ok {
+		fmt.Fprintf(&b, "Context:       %s of %s tokens (%.0f%%)\n", formatTokens(s.usage.contextTokens),
+			formatTokens(int64(m.contextWindow)), 100*float64(s.usage.contextTokens)/float64(m.contextWindow))
+	} else {
+		fmt.Fprintf(&b, "Context:       %s tokens\n", formatTokens(s.usage.contextTokens))
+	}
+	fmt.Print(b.String())
+	return nil
+}
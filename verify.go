@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const verifyPrompt = "You check an answer against the sources it was based on. List every factual statement in the " +
+	"answer that the sources do not support or that contradicts them, one per line as: - <statement> — <why>. " +
+	"General knowledge, opinions and advice need no source. If every claim is supported, reply with exactly: ALL SUPPORTED"
+
+// turnSources collects what the model was given to answer the last
+// question from: tool results and attached or fetched content.
+func (c *Conversation) turnSources(turnStart int) []string {
+	var sources []string
+	if turnStart < 0 {
+		return nil
+	}
+	for _, msg := range c.Messages[turnStart:] {
+		switch {
+		case msg.Role == "tool":
+			sources = append(sources, msg.Content)
+		case msg.Role == "user" && containsUntrusted(msg.Content):
+			sources = append(sources, msg.Content)
+		}
+	}
+	return sources
+}
+
+// verifyAnswer has a second call check an answer's claims against the
+// turn's sources, and returns the claims it found unsupported. Answers
+// without sources are not checked.
+func (s *session) verifyAnswer(ctx context.Context, turnStart int, answer string) ([]string, []TraceStep, error) {
+	sources := s.conv.turnSources(turnStart)
+	if len(sources) == 0 {
+		return nil, nil, nil
+	}
+	var prompt strings.Builder
+	for i, src := range sources {
+		fmt.Fprintf(&prompt, "Source %d:\n%s\n\n", i+1, src)
+	}
+	fmt.Fprintf(&prompt, "Answer to check:\n%s", answer)
+
+	r, err := s.provider.Complete(ctx, s.model, askConversation(verifyPrompt, prompt.String()), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.recordUsage(r)
+	trace := []TraceStep{{Label: "verification", Tokens: r.completionTokens, Content: r.content}}
+	if strings.TrimSpace(strings.Trim(r.content, ".")) == "ALL SUPPORTED" {
+		return nil, trace, nil
+	}
+	var unsupported []string
+	for _, line := range strings.Split(r.content, "\n") {
+		if claim, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && claim != "" {
+			unsupported = append(unsupported, claim)
+		}
+	}
+	return unsupported, trace, nil
+}
+
+// showUnsupported flags the claims verification could not back up.
+func showUnsupported(claims []string) {
+	for _, claim := range claims {
+		fmt.Println(paint(theme.Bad, decor("  ⚠ unsupported: ", "Unsupported claim: ")+claim))
+	}
+	if len(claims) > 0 {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time by releases:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Otherwise commit and date come from the VCS information Go embeds.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "version",
+		usage: "version",
+		help:  "Show the version, commit, build date and Go version",
+		run: func(cfg *Config, args []string) int {
+			fmt.Println(versionString())
+			return exitOK
+		},
+	})
+}
+
+func buildInfo() (rev, date string, dirty bool) {
+	rev, date = commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = s.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = s.Value
+				}
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+	}
+	return rev, date, dirty
+}
+
+func versionString() string {
+	rev, date, dirty := buildInfo()
+	var details []string
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		if dirty {
+			rev += "-dirty"
+		}
+		details = append(details, "commit "+rev)
+	}
+	if date != "" {
+		details = append(details, "built "+date)
+	}
+	details = append(details, runtime.Version(), runtime.GOOS+"/"+runtime.GOARCH)
+	return fmt.Sprintf("%s %s (%s)", appName, version, strings.Join(details, ", "))
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "setup",
+		usage: "setup",
+		help:  "Run the interactive setup wizard and write config.yaml",
+		run:   runSetup,
+	})
+}
+
+// needsSetup reports whether the wizard should run before an interactive
+// chat: there is no config file yet and a person is at the keyboard.
+func needsSetup() bool {
+	if quiet || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return false
+	}
+	path, err := configPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+type wizard struct {
+	in *bufio.Reader
+}
+
+// ask prints a question and returns the answer, or def when it is empty.
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (w *wizard) choose(question string, options []string, def int) (int, error) {
+	fmt.Println(question)
+	for i, o := range options {
+		fmt.Printf("  %d) %s\n", i+1, o)
+	}
+	for {
+		answer, err := w.ask("Choice", fmt.Sprint(def+1))
+		if err != nil {
+			return 0, err
+		}
+		var n int
+		if _, err := fmt.Sscan(answer, &n); err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		fmt.Printf("Please enter a number between 1 and %d.\n", len(options))
+	}
+}
+
+func (w *wizard) secret(question string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return w.ask(question, "")
+	}
+	fmt.Printf("%s: ", question)
+	b, err := term.ReadPassword(fd)
+	fmt.Println()
+	return strings.TrimSpace(string(b)), err
+}
+
+func runSetup(_ *Config, args []string) int {
+	path, err := configPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin)}
+	cfg, err := w.run(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nSetup aborted: %v\n", err)
+		return exitError
+	}
+
+	key, err := resolveAPIKey(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return exitOK
+	}
+	fmt.Print("Verifying API key... ")
+	if err := verifyAPIKey(key); err != nil {
+		fmt.Printf("failed: %v\nThe configuration was saved; fix the key and run '%s setup' again if needed.\n", err, appName)
+		return exitOK
+	}
+	fmt.Println("ok")
+	return exitOK
+}
+
+func (w *wizard) run(path string) (*Config, error) {
+	fmt.Printf("Welcome! Let's set up %s. Press Enter to accept the default in brackets.\n\n", appName)
+	if _, err := os.Stat(path); err == nil {
+		answer, err := w.ask(path+" exists. Overwrite it? (y/N)", "n")
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(strings.ToLower(answer), "y") {
+			return nil, errors.New("kept existing configuration")
+		}
+	}
+
+	cfg := &Config{}
+	def := 1
+	if os.Getenv("OPENAI_KEY") != "" {
+		def = 0
+	}
+	method, err := w.choose("How should the OpenAI API key be provided?", []string{
+		"OPENAI_KEY environment variable",
+		"Stored in config.yaml (file is made readable only by you)",
+		"Read from a file",
+		"Output of a command, e.g. a password manager",
+	}, def)
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case 1:
+		cfg.APIKey, err = w.secret("API key")
+	case 2:
+		cfg.APIKeyFile, err = w.ask("Path to key file", "~/.openai-key")
+	case 3:
+		cfg.APIKeyCommand, err = w.ask("Command that prints the key", "pass show openai")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Model, err = w.ask("\nDefault model", defaultModel); err != nil {
+		return nil, err
+	}
+	prompt, err := w.ask("System prompt for the default persona", systemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	if prompt != systemPrompt {
+		cfg.Personas = map[string]Persona{"default": {SystemPrompt: prompt}}
+	}
+	dir := resolveDataDir("")
+	if cfg.DataDir, err = w.ask("Data directory (conversations go in its chats/ folder)", dir); err != nil {
+		return nil, err
+	}
+	if cfg.DataDir == dir {
+		// Left to the default, which follows the platform's.
+		cfg.DataDir = ""
+	}
+	colors, err := w.choose("\nColored output?", []string{"auto", "always", "never"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Color = []string{"auto", "always", "never"}[colors]
+
+	if err := writeConfig(path, cfg); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nWrote %s\n", path)
+	return cfg, nil
+}
+
+// writeConfig writes only the settings the wizard asked about, leaving
+// everything else to its default.
+func writeConfig(path string, cfg *Config) error {
+	doc := map[string]any{"model": cfg.Model, "color": cfg.Color}
+	if cfg.DataDir != "" {
+		doc["data_dir"] = cfg.DataDir
+	}
+	if cfg.APIKey != "" {
+		doc["api_key"] = cfg.APIKey
+	}
+	if cfg.APIKeyFile != "" {
+		doc["api_key_file"] = cfg.APIKeyFile
+	}
+	if cfg.APIKeyCommand != "" {
+		doc["api_key_command"] = cfg.APIKeyCommand
+	}
+	if len(cfg.Personas) > 0 {
+		doc["personas"] = cfg.Personas
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	data = append([]byte("# Written by "+appName+" setup. See the README for all settings.\n"), data...)
+	return os.WriteFile(path, data, 0600)
+}
+
+// verifyAPIKey makes the cheapest authenticated call there is.
+func verifyAPIKey(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	client := openai.NewClient(option.WithAPIKey(key))
+	_, err := client.Models.List(ctx)
+	return err
+}
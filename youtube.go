@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type YouTubeConfig struct {
+	// Disabled stops transcripts being fetched for YouTube links.
+	Disabled bool `yaml:"disabled"`
+	// Languages lists caption languages in order of preference; the
+	// default is English, then whatever the video has.
+	Languages []string `yaml:"languages"`
+}
+
+// maxVideoTranscript caps how much of a transcript is sent, so that a
+// long video doesn't crowd out the conversation.
+const maxVideoTranscript = 100000
+
+var (
+	youtubeLink = regexp.MustCompile(`(?:youtube\.com/(?:watch\?(?:\S*&)?v=|shorts/|live/|embed/)|youtu\.be/)([\w-]{11})`)
+	// cueTimestamp matches the word timings in automatic captions.
+	cueTimestamp = regexp.MustCompile(`<\d{2}:\d{2}[:.\d]*>`)
+)
+
+// attachVideoTranscripts fetches the transcript of each YouTube video
+// linked in text and queues it as context for the message.
+func (s *session) attachVideoTranscripts(text string) {
+	if s.cfg.YouTube.Disabled {
+		return
+	}
+	seen := map[string]bool{}
+	for _, m := range youtubeLink.FindAllStringSubmatch(text, -1) {
+		id := m[1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		info("Fetching the transcript of video %s...\n", id)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		title, segments, err := videoTranscript(ctx, id, s.cfg.YouTube.Languages)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: no transcript for video %s: %v\n", id, err)
+			continue
+		}
+		body := fmt.Sprintf("Title: %s\n\n", title)
+		for _, seg := range segments {
+			line := fmt.Sprintf("[%s] %s\n", clockTime(seg.Start), seg.Text)
+			if len(body)+len(line) > maxVideoTranscript {
+				body += "[transcript truncated]\n"
+				break
+			}
+			body += line
+		}
+		s.context = append(s.context, untrusted("youtube.com/watch?v="+id, body))
+		info("Attached the transcript of %q\n", title)
+	}
+}
+
+// videoTranscript gets a video's captions with yt-dlp when it is
+// installed, as it keeps up with YouTube's changes, and otherwise reads
+// the caption tracks listed on the watch page.
+func videoTranscript(ctx context.Context, id string, languages []string) (string, []transcriptSegment, error) {
+	if _, err := exec.LookPath("yt-dlp"); err == nil {
+		return ytdlpTranscript(ctx, id, languages)
+	}
+	return watchPageTranscript(ctx, id, languages)
+}
+
+func ytdlpTranscript(ctx context.Context, id string, languages []string) (string, []transcriptSegment, error) {
+	dir, err := os.MkdirTemp("", "chat-cli-youtube")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	langs := "en.*,en"
+	if len(languages) > 0 {
+		langs = strings.Join(languages, ",")
+	}
+	cmd := exec.CommandContext(ctx, "yt-dlp", "--quiet", "--no-warnings", "--skip-download", "--no-simulate",
+		"--write-subs", "--write-auto-subs", "--sub-langs", langs, "--sub-format", "vtt",
+		"--print", "title", "-o", filepath.Join(dir, "video"), "https://www.youtube.com/watch?v="+id)
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return "", nil, fmt.Errorf("yt-dlp: %s", strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", nil, err
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "video.*.vtt"))
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("the video has no captions")
+	}
+	// Prefer the languages in the order given.
+	rank := func(f string) int {
+		for i, l := range languages {
+			if strings.HasPrefix(filepath.Base(f), "video."+l) {
+				return i
+			}
+		}
+		return len(languages)
+	}
+	slices.SortStableFunc(files, func(a, b string) int { return rank(a) - rank(b) })
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(string(out)), parseVTTSegments(string(data)), nil
+}
+
+// parseVTTSegments reads WebVTT cues. YouTube's automatic captions
+// repeat each line in the following cue as they scroll, so a line equal
+// to the previous one is dropped.
+func parseVTTSegments(data string) []transcriptSegment {
+	var segments []transcriptSegment
+	var start float64
+	var last string
+	// A cue ends at a blank line after its text; YouTube puts a blank
+	// line between the timing and the text.
+	inCue, cueText := false, false
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			inCue = inCue && !cueText
+		case cueTiming.MatchString(line):
+			start = parseCueTime(strings.Fields(line)[0])
+			inCue, cueText = true, false
+		case inCue:
+			cueText = true
+			text := strings.TrimSpace(html.UnescapeString(cueTags.ReplaceAllString(cueTimestamp.ReplaceAllString(line, ""), "")))
+			if text == "" || text == last {
+				continue
+			}
+			last = text
+			segments = append(segments, transcriptSegment{Start: start, Text: text})
+		}
+	}
+	return segments
+}
+
+// parseCueTime reads hh:mm:ss.mmm or mm:ss.mmm as seconds.
+func parseCueTime(s string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(strings.Replace(s, ",", ".", 1), ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		seconds = seconds*60 + v
+	}
+	return seconds
+}
+
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+	// Kind is "asr" for automatic captions.
+	Kind string `json:"kind"`
+}
+
+func watchPageTranscript(ctx context.Context, id string, languages []string) (string, []transcriptSegment, error) {
+	resp, err := httpGet(ctx, "https://www.youtube.com/watch?v="+id)
+	if err != nil {
+		return "", nil, err
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	resp.Body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	const marker = "ytInitialPlayerResponse = "
+	i := strings.Index(string(page), marker)
+	if i < 0 {
+		return "", nil, fmt.Errorf("unexpected watch page (installing yt-dlp may help)")
+	}
+	var player struct {
+		VideoDetails struct {
+			Title string `json:"title"`
+		} `json:"videoDetails"`
+		Captions struct {
+			Renderer struct {
+				Tracks []captionTrack `json:"captionTracks"`
+			} `json:"playerCaptionsTracklistRenderer"`
+		} `json:"captions"`
+	}
+	// The object is followed by more script, which the decoder ignores.
+	if err := json.NewDecoder(strings.NewReader(string(page[i+len(marker):]))).Decode(&player); err != nil {
+		return "", nil, fmt.Errorf("unexpected watch page: %w", err)
+	}
+	track := pickCaptionTrack(player.Captions.Renderer.Tracks, languages)
+	if track == nil {
+		return "", nil, fmt.Errorf("the video has no captions")
+	}
+
+	resp, err = httpGet(ctx, track.BaseURL)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		Texts []struct {
+			Start string `xml:"start,attr"`
+			Text  string `xml:",chardata"`
+		} `xml:"text"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("captions could not be read (installing yt-dlp may help): %w", err)
+	}
+	var segments []transcriptSegment
+	for _, t := range doc.Texts {
+		start, _ := strconv.ParseFloat(t.Start, 64)
+		if text := strings.TrimSpace(html.UnescapeString(t.Text)); text != "" {
+			segments = append(segments, transcriptSegment{Start: start, Text: text})
+		}
+	}
+	return player.VideoDetails.Title, segments, nil
+}
+
+// pickCaptionTrack chooses by language preference (English by default),
+// then human-made over automatic captions.
+func pickCaptionTrack(tracks []captionTrack, languages []string) *captionTrack {
+	if len(languages) == 0 {
+		languages = []string{"en"}
+	}
+	rank := func(t captionTrack) int {
+		r := len(languages) * 2
+		for i, l := range languages {
+			if t.LanguageCode == l || strings.HasPrefix(t.LanguageCode, l+"-") {
+				r = i * 2
+				break
+			}
+		}
+		if t.Kind == "asr" {
+			r++
+		}
+		return r
+	}
+	var best *captionTrack
+	for i := range tracks {
+		if best == nil || rank(tracks[i]) < rank(*best) {
+			best = &tracks[i]
+		}
+	}
+	return best
+}